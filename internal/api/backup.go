@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"goemail/internal/config"
+	"goemail/internal/database"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +25,7 @@ type BackupInfo struct {
 	CreatedAt time.Time `json:"created_at"` // 创建时间
 	Size      int64     `json:"size"`       // 总大小（字节）
 	IsAuto    bool      `json:"is_auto"`    // 是否自动备份
+	Reason    string    `json:"reason"`     // 创建原因 (如 pre-restore 表示恢复前的安全备份)
 	Files     []string  `json:"files"`      // 包含的文件列表
 }
 
@@ -32,6 +35,7 @@ type BackupManifest struct {
 	Version   string   `json:"version"`
 	CreatedAt string   `json:"created_at"`
 	IsAuto    bool     `json:"is_auto"`
+	Reason    string   `json:"reason,omitempty"`
 	Files     []string `json:"files"`
 }
 
@@ -44,7 +48,17 @@ func ListBackupsHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取备份列表失败: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, backups)
+	var totalSize int64
+	for _, b := range backups {
+		totalSize += b.Size
+	}
+	maxCount, maxBytes := backupLimits()
+	c.JSON(http.StatusOK, gin.H{
+		"backups":    backups,
+		"total_size": totalSize, // 备份目录当前占用 (字节)
+		"max_count":  maxCount,
+		"max_size":   maxBytes, // 0 表示不限制
+	})
 }
 
 // CreateBackupHandler 手动创建备份
@@ -114,35 +128,53 @@ func RestoreBackupHandler(c *gin.Context) {
 		return
 	}
 
+	// 校验请求恢复的组件是否包含在备份中
+	scope := c.DefaultQuery("scope", "full")
+	components, err := restoreComponents(scope, backupPath, manifest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 覆盖前先为当前状态创建安全备份，使本次恢复本身可回滚
+	// 此时不清理旧备份，避免正在恢复的备份被轮转删除
+	safetyID, err := createBackup(config.Version, true, "pre-restore")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建恢复前安全备份失败: " + err.Error()})
+		return
+	}
+	defer cleanOldBackups()
+
 	// 恢复文件
 	restoredFiles := []string{}
+	restoredComponents := []string{}
 
 	// 恢复数据库
-	dbBackup := filepath.Join(backupPath, "goemail.db")
-	if _, err := os.Stat(dbBackup); err == nil {
-		if err := copyFile(dbBackup, "goemail.db"); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复数据库失败: " + err.Error()})
+	if components["db"] {
+		if err := copyFile(filepath.Join(backupPath, "goemail.db"), "goemail.db"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复数据库失败: " + err.Error(), "safety_backup": safetyID})
 			return
 		}
 		restoredFiles = append(restoredFiles, "goemail.db")
+		restoredComponents = append(restoredComponents, "db")
 	}
 
 	// 恢复配置文件
-	configBackup := filepath.Join(backupPath, "config.json")
-	if _, err := os.Stat(configBackup); err == nil {
-		if err := copyFile(configBackup, "config.json"); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复配置文件失败: " + err.Error()})
+	if components["config"] {
+		if err := copyFile(filepath.Join(backupPath, "config.json"), "config.json"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复配置文件失败: " + err.Error(), "safety_backup": safetyID})
 			return
 		}
 		restoredFiles = append(restoredFiles, "config.json")
+		restoredComponents = append(restoredComponents, "config")
 		// 重新加载配置
 		config.LoadConfig()
 	}
 
 	// 恢复程序文件（标记为需要重启）
-	exeBackup := filepath.Join(backupPath, "goemail.backup")
 	needsRestart := false
-	if _, err := os.Stat(exeBackup); err == nil {
+	if components["program"] {
+		exeBackup := filepath.Join(backupPath, "goemail.backup")
 		currentExe, err := os.Executable()
 		if err == nil {
 			currentExe, _ = filepath.EvalSymlinks(currentExe)
@@ -150,6 +182,7 @@ func RestoreBackupHandler(c *gin.Context) {
 			pendingUpdate := currentExe + ".pending"
 			if err := copyFile(exeBackup, pendingUpdate); err == nil {
 				restoredFiles = append(restoredFiles, filepath.Base(currentExe))
+				restoredComponents = append(restoredComponents, "program")
 				needsRestart = true
 			}
 		}
@@ -157,12 +190,59 @@ func RestoreBackupHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "恢复成功",
+		"scope":         scope,
 		"restored":      restoredFiles,
+		"components":    restoredComponents,
+		"safety_backup": safetyID,
 		"needs_restart": needsRestart,
 		"version":       manifest.Version,
 	})
 }
 
+// restoreComponents 根据恢复范围 (full / db / config) 确定需要恢复的组件，并校验备份清单中确实包含
+// full 恢复备份中存在的全部组件 (数据库、配置、程序文件)
+func restoreComponents(scope, backupPath string, manifest BackupManifest) (map[string]bool, error) {
+	inManifest := func(name string) bool {
+		for _, f := range manifest.Files {
+			if f == name {
+				return true
+			}
+		}
+		return false
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(backupPath, name))
+		return err == nil
+	}
+	// 非 SQLite 时数据库文件不是当前数据源，不参与恢复
+	hasDB := inManifest("goemail.db") && exists("goemail.db") && database.IsSQLite()
+	hasConfig := inManifest("config.json") && exists("config.json")
+
+	components := map[string]bool{}
+	switch scope {
+	case "full":
+		components["db"] = hasDB
+		components["config"] = hasConfig
+		components["program"] = exists("goemail.backup")
+		if !hasDB && !hasConfig && !components["program"] {
+			return nil, fmt.Errorf("备份为空，没有可恢复的内容")
+		}
+	case "db":
+		if !hasDB {
+			return nil, fmt.Errorf("备份中不包含数据库")
+		}
+		components["db"] = true
+	case "config":
+		if !hasConfig {
+			return nil, fmt.Errorf("备份中不包含配置文件")
+		}
+		components["config"] = true
+	default:
+		return nil, fmt.Errorf("无效的恢复范围: %s (可选 full、db、config)", scope)
+	}
+	return components, nil
+}
+
 // DeleteBackupHandler 删除指定备份
 func DeleteBackupHandler(c *gin.Context) {
 	backupID := c.Param("id")
@@ -201,6 +281,19 @@ func DeleteBackupHandler(c *gin.Context) {
 
 // CreateBackup 创建备份（供内部调用）
 func CreateBackup(version string, isAuto bool) (string, error) {
+	backupID, err := createBackup(version, isAuto, "")
+	if err != nil {
+		return "", err
+	}
+
+	// 按保留策略清理旧备份
+	cleanOldBackups()
+
+	return backupID, nil
+}
+
+// createBackup 创建备份但不清理旧备份，reason 记录创建原因 (如 pre-restore)
+func createBackup(version string, isAuto bool, reason string) (string, error) {
 	// 确保备份目录存在
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return "", fmt.Errorf("创建备份目录失败: %w", err)
@@ -209,6 +302,9 @@ func CreateBackup(version string, isAuto bool) (string, error) {
 	// 生成备份 ID
 	timestamp := time.Now().Format("20060102-150405")
 	backupID := fmt.Sprintf("backup-%s-%s", version, timestamp)
+	if reason != "" {
+		backupID += "-" + reason
+	}
 	backupPath := filepath.Join(backupDir, backupID)
 
 	// 创建备份目录
@@ -218,8 +314,14 @@ func CreateBackup(version string, isAuto bool) (string, error) {
 
 	files := []string{}
 
-	// 1. 备份数据库
-	if _, err := os.Stat("goemail.db"); err == nil {
+	// 1. 备份数据库 (先将 WAL 写回主库文件，确保副本完整)
+	// MySQL / PostgreSQL 需使用 mysqldump / pg_dump 等工具自行备份
+	if !database.IsSQLite() {
+		log.Printf("[Backup] Database driver is %s, skipping database file", database.Driver())
+	} else if database.DB != nil {
+		database.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	}
+	if _, err := os.Stat("goemail.db"); err == nil && database.IsSQLite() {
 		if err := copyFile("goemail.db", filepath.Join(backupPath, "goemail.db")); err != nil {
 			return "", fmt.Errorf("备份数据库失败: %w", err)
 		}
@@ -250,6 +352,7 @@ func CreateBackup(version string, isAuto bool) (string, error) {
 		Version:   version,
 		CreatedAt: time.Now().Format(time.RFC3339),
 		IsAuto:    isAuto,
+		Reason:    reason,
 		Files:     files,
 	}
 
@@ -262,9 +365,6 @@ func CreateBackup(version string, isAuto bool) (string, error) {
 		return "", fmt.Errorf("写入清单失败: %w", err)
 	}
 
-	// 5. 清理旧备份（保留最近 10 个）
-	cleanOldBackups(10)
-
 	return backupID, nil
 }
 
@@ -318,6 +418,7 @@ func listBackups() ([]BackupInfo, error) {
 			CreatedAt: createdAt,
 			Size:      size,
 			IsAuto:    manifest.IsAuto,
+			Reason:    manifest.Reason,
 			Files:     manifest.Files,
 		})
 	}
@@ -330,18 +431,50 @@ func listBackups() ([]BackupInfo, error) {
 	return backups, nil
 }
 
-// cleanOldBackups 清理旧备份
-func cleanOldBackups(keepCount int) {
+// backupLimits 返回备份保留数量与总大小上限 (字节，0 表示不限制)
+func backupLimits() (int, int64) {
+	maxCount := config.AppConfig.BackupMaxCount
+	if maxCount <= 0 {
+		maxCount = 10
+	}
+	var maxBytes int64
+	if config.AppConfig.BackupMaxSizeMB > 0 {
+		maxBytes = int64(config.AppConfig.BackupMaxSizeMB) << 20
+	}
+	return maxCount, maxBytes
+}
+
+// cleanOldBackups 按 backup_max_count 与 backup_max_size_mb 清理旧备份
+func cleanOldBackups() {
 	backups, err := listBackups()
-	if err != nil || len(backups) <= keepCount {
+	if err != nil {
 		return
 	}
+	maxCount, maxBytes := backupLimits()
+	for _, b := range backupsToEvict(backups, maxCount, maxBytes) {
+		if err := os.RemoveAll(filepath.Join(backupDir, b.ID)); err != nil {
+			log.Printf("[Backup] Failed to remove old backup %s: %v", b.ID, err)
+			continue
+		}
+		log.Printf("[Backup] Removed old backup %s (%d bytes)", b.ID, b.Size)
+	}
+}
 
-	// 删除超出数量的旧备份
-	for i := keepCount; i < len(backups); i++ {
-		backupPath := filepath.Join(backupDir, backups[i].ID)
-		os.RemoveAll(backupPath)
+// backupsToEvict 返回需要淘汰的备份 (backups 按时间倒序)
+// 先保留最新的 maxCount 个，再从最旧的开始淘汰直到总大小不超过 maxBytes；最新的一个始终保留
+func backupsToEvict(backups []BackupInfo, maxCount int, maxBytes int64) []BackupInfo {
+	keep := min(len(backups), maxCount)
+	if maxBytes > 0 {
+		var total int64
+		for i := 0; i < keep; i++ {
+			total += backups[i].Size
+		}
+		for keep > 1 && total > maxBytes {
+			keep--
+			total -= backups[keep].Size
+		}
 	}
+	return backups[keep:]
 }
 
 // copyFile 复制文件
@@ -0,0 +1,27 @@
+package api
+
+import "testing"
+
+func TestBackupsToEvict(t *testing.T) {
+	backups := []BackupInfo{{ID: "d", Size: 40}, {ID: "c", Size: 30}, {ID: "b", Size: 20}, {ID: "a", Size: 10}}
+	ids := func(list []BackupInfo) string {
+		s := ""
+		for _, b := range list {
+			s += b.ID
+		}
+		return s
+	}
+
+	if got := ids(backupsToEvict(backups, 10, 0)); got != "" {
+		t.Errorf("no limits evicted %q", got)
+	}
+	if got := ids(backupsToEvict(backups, 2, 0)); got != "ba" {
+		t.Errorf("count limit evicted %q, want ba", got)
+	}
+	if got := ids(backupsToEvict(backups, 10, 75)); got != "ba" {
+		t.Errorf("size limit evicted %q, want ba", got)
+	}
+	if got := ids(backupsToEvict(backups, 10, 5)); got != "cba" {
+		t.Errorf("newest backup must be kept, evicted %q", got)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"goemail/internal/config"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkBodySize 校验正文 (HTML 与纯文本合计) 不超过 max_body_size，超出时写入 413 响应并返回 false
+func checkBodySize(c *gin.Context, bodies ...string) bool {
+	limitKB := config.AppConfig.MaxBodySize
+	if limitKB <= 0 {
+		return true
+	}
+	total := 0
+	for _, body := range bodies {
+		total += len(body)
+	}
+	if total > limitKB*1024 {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body size %d KB exceeds max_body_size (%d KB)", (total+1023)/1024, limitKB)})
+		return false
+	}
+	return true
+}
+
+// sanitizeBody 启用 sanitize_html 时对 HTML 正文做白名单净化，否则原样返回
+func sanitizeBody(body string) string {
+	if !config.AppConfig.SanitizeHTML || body == "" {
+		return body
+	}
+	return mailer.SanitizeHTML(body)
+}
@@ -1,13 +1,22 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"html"
 	"net/http"
+	"net/mail"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"goemail/internal/cleanup"
+	"goemail/internal/config"
 	"goemail/internal/database"
+	"goemail/internal/locale"
+	"goemail/internal/mailer"
 
 	"github.com/gin-gonic/gin"
 )
@@ -348,6 +357,96 @@ func UpdateContactHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, contact)
 }
 
+// ContactActivityHandler 联系人活动时间线 (发送、失败、退信、打开、点击、退订)
+// GET /api/v1/contacts/:id/activity
+func ContactActivityHandler(c *gin.Context) {
+	id := c.Param("id")
+	var contact database.Contact
+	if err := database.DB.First(&contact, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+		return
+	}
+
+	// 营销任务的日志按 contact_id 关联，其余 (API 发送、旧数据) 按收件地址匹配
+	var logs []database.EmailLog
+	database.DB.Select("id", "created_at", "recipient", "subject", "status", "error_msg", "channel", "campaign_id",
+		"opened", "opened_at", "clicked_count", "clicked_at", "unsubscribed", "unsubscribed_at").
+		Where("contact_id = ? OR (contact_id = 0 AND LOWER(recipient) = ?)", contact.ID, strings.ToLower(contact.Email)).
+		Order("created_at desc").
+		Limit(500).
+		Find(&logs)
+
+	type ActivityEvent struct {
+		Time       time.Time `json:"time"`
+		Type       string    `json:"type"` // sent, failed, bounced, delayed, opened, clicked, unsubscribed
+		LogID      uint      `json:"log_id"`
+		CampaignID uint      `json:"campaign_id"`
+		Subject    string    `json:"subject"`
+		Detail     string    `json:"detail,omitempty"`
+	}
+
+	events := make([]ActivityEvent, 0, len(logs))
+	for _, l := range logs {
+		base := ActivityEvent{LogID: l.ID, CampaignID: l.CampaignID, Subject: l.Subject}
+
+		sent := base
+		sent.Time = l.CreatedAt
+		switch {
+		case l.Status == "success":
+			sent.Type = "sent"
+			sent.Detail = l.Channel
+		case mailer.IsHardBounce(l.ErrorMsg):
+			sent.Type = "bounced" // 投递时即被拒收的永久失败
+			sent.Detail = l.ErrorMsg
+		default:
+			sent.Type = "failed"
+			sent.Detail = l.ErrorMsg
+		}
+		events = append(events, sent)
+
+		if l.Opened && l.OpenedAt != nil {
+			e := base
+			e.Time, e.Type = *l.OpenedAt, "opened"
+			events = append(events, e)
+		}
+		if l.ClickedCount > 0 && l.ClickedAt != nil {
+			e := base
+			e.Time, e.Type = *l.ClickedAt, "clicked"
+			e.Detail = fmt.Sprintf("%d clicks", l.ClickedCount)
+			events = append(events, e)
+		}
+		if l.Unsubscribed && l.UnsubscribedAt != nil {
+			e := base
+			e.Time, e.Type = *l.UnsubscribedAt, "unsubscribed"
+			events = append(events, e)
+		}
+	}
+
+	// 投递成功后由对方服务器回送的退信 (DSN)，按收件地址关联
+	var bounces []database.Bounce
+	database.DB.Where("recipient = ?", strings.ToLower(contact.Email)).
+		Order("created_at desc").
+		Limit(100).
+		Find(&bounces)
+	for _, b := range bounces {
+		e := ActivityEvent{Time: b.CreatedAt, Type: "bounced", Detail: strings.TrimSpace(b.Status + " " + b.Diagnostic)}
+		if b.Action == "delayed" {
+			e.Type = "delayed"
+		}
+		events = append(events, e)
+	}
+
+	// 按时间顺序排列
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"contact": contact,
+		"events":  events,
+	})
+}
+
 // ExportContactsHandler 导出联系人
 func ExportContactsHandler(c *gin.Context) {
 	groupID := c.Query("group_id")
@@ -429,6 +528,58 @@ func ListCampaignsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, campaigns)
 }
 
+// applyCampaignSenderIdentity 营销任务引用发件人身份时，以身份的名称与地址覆盖 SenderName/SenderEmail
+// 身份不存在或所属域名已失去验证时返回错误
+func applyCampaignSenderIdentity(campaign *database.Campaign) error {
+	if campaign.SenderIdentityID == 0 {
+		return nil
+	}
+	sender, err := mailer.ResolveSender(campaign.SenderIdentityID)
+	if err != nil {
+		return err
+	}
+	campaign.SenderEmail = sender.Email
+	campaign.SenderName = sender.Name
+	return nil
+}
+
+// normalizeCampaignSender 校验营销任务的发件人地址，发件域名未验证时填充 SenderWarning
+func normalizeCampaignSender(campaign *database.Campaign) error {
+	if err := applyCampaignSenderIdentity(campaign); err != nil {
+		return err
+	}
+	campaign.SenderName = strings.TrimSpace(campaign.SenderName)
+	campaign.SenderEmail = strings.TrimSpace(campaign.SenderEmail)
+	if strings.ContainsAny(campaign.SenderName, "\r\n") {
+		return fmt.Errorf("sender_name contains line break")
+	}
+	from := campaign.SenderEmail
+	if from != "" {
+		addr, err := mail.ParseAddress(from)
+		if err != nil || addr.Address != from {
+			return fmt.Errorf("invalid sender_email")
+		}
+	} else {
+		var smtpConfig database.SMTPConfig
+		if database.DB.First(&smtpConfig, campaign.SenderID).Error != nil {
+			return nil
+		}
+		from = smtpConfig.Username
+	}
+	if err := mailer.VerifySenderDomain(from); err != nil {
+		campaign.SenderWarning = err.Error() + "; DKIM/SPF alignment may fail"
+	}
+	return nil
+}
+
+// campaignFromAddress 营销邮件的发件地址：优先使用 SenderEmail，SMTP 通道仅负责传输
+func campaignFromAddress(campaign *database.Campaign, smtpConfig database.SMTPConfig) string {
+	if campaign.SenderEmail != "" {
+		return campaign.SenderEmail
+	}
+	return smtpConfig.Username
+}
+
 // CreateCampaignHandler 创建营销活动
 func CreateCampaignHandler(c *gin.Context) {
 	var campaign database.Campaign
@@ -436,6 +587,20 @@ func CreateCampaignHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if !checkBodySize(c, campaign.Body, campaign.TextBody) {
+		return
+	}
+	campaign.Body = sanitizeBody(campaign.Body)
+
+	if err := normalizeCampaignSender(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := normalizeCampaignSchedule(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	campaign.Status = "draft"
 	if err := database.DB.Create(&campaign).Error; err != nil {
@@ -458,21 +623,45 @@ func UpdateCampaignHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot edit campaign in current status"})
 		return
 	}
+	// 共享正文的队列任务在发送时才读取营销任务的正文，尚未发完时修改会改变这些邮件的内容
+	if campaign.Status == "failed" && hasUnsentSharedBodyTasks(campaign.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Campaign still has queued messages that read its body; edit it after they are sent"})
+		return
+	}
 
 	var input database.Campaign
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	if !checkBodySize(c, input.Body, input.TextBody) {
+		return
+	}
 
 	campaign.Name = input.Name
 	campaign.Subject = input.Subject
-	campaign.Body = input.Body
+	campaign.Body = sanitizeBody(input.Body)
+	campaign.TextBody = input.TextBody
 	campaign.SenderID = input.SenderID
+	campaign.SenderName = input.SenderName
+	campaign.SenderEmail = input.SenderEmail
+	campaign.SenderIdentityID = input.SenderIdentityID
+	campaign.TopicID = input.TopicID
 	campaign.TargetType = input.TargetType
 	campaign.TargetGroupID = input.TargetGroupID
 	campaign.TargetList = input.TargetList
 	campaign.ScheduledAt = input.ScheduledAt
+	campaign.Timezone = input.Timezone
+	campaign.LocalSendTime = input.LocalSendTime
+	campaign.DisableTracking = input.DisableTracking
+	if err := normalizeCampaignSender(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := normalizeCampaignSchedule(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	
 	if err := database.DB.Save(&campaign).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update campaign"})
@@ -481,6 +670,15 @@ func UpdateCampaignHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, campaign)
 }
 
+// hasUnsentSharedBodyTasks 营销任务是否还有未发完 (待发、发送中、延后或等待重试) 的共享正文队列任务
+func hasUnsentSharedBodyTasks(campaignID uint) bool {
+	var count int64
+	database.DB.Model(&database.EmailQueue{}).
+		Where("campaign_id = ? AND shared_body = ? AND status IN ('pending', 'processing', 'deferred', 'failed')", campaignID, true).
+		Count(&count)
+	return count > 0
+}
+
 // StartCampaignHandler 启动营销活动
 func StartCampaignHandler(c *gin.Context) {
 	id := c.Param("id")
@@ -495,6 +693,18 @@ func StartCampaignHandler(c *gin.Context) {
 		return
 	}
 
+	// 大批量发送需显式确认 (?confirm=true)，未确认时返回预计收件人数、耗时与费用
+	threshold := config.AppConfig.CampaignConfirmThreshold
+	if threshold > 0 && c.Query("confirm") != "true" {
+		if count := len(campaignRecipients(&campaign)); count > threshold {
+			resp := campaignSendEstimate(count)
+			resp["error"] = fmt.Sprintf("Campaign targets %d recipients (threshold %d), resend with confirm=true to start", count, threshold)
+			resp["requires_confirmation"] = true
+			c.JSON(http.StatusConflict, resp)
+			return
+		}
+	}
+
 	// 检查是否定时发送
 	if campaign.ScheduledAt != nil && campaign.ScheduledAt.After(time.Now()) {
 		// 更新状态为 scheduled
@@ -553,11 +763,59 @@ func ResumeCampaignHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Only paused campaigns can be resumed"})
 		return
 	}
+	var smtpConfig database.SMTPConfig
+	database.DB.First(&smtpConfig, campaign.SenderID)
+	if err := mailer.CheckDomainReputation(campaignFromAddress(&campaign, smtpConfig)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 
 	database.DB.Model(&campaign).Update("status", "processing")
 	c.JSON(http.StatusOK, gin.H{"message": "Campaign resumed"})
 }
 
+// CampaignRecipientRenderedHandler 获取营销任务中某位收件人实际收到的邮件 (最近一次成功发送)
+// GET /api/v1/campaigns/:id/recipient/:email/rendered[?format=eml]
+// 开启 campaign_store_raw 时返回完整原始邮件并按 SHA-256 校验，否则仅返回发送日志中保存的正文与哈希
+func CampaignRecipientRenderedHandler(c *gin.Context) {
+	email := strings.ToLower(strings.TrimSpace(c.Param("email")))
+	var entry database.EmailLog
+	if err := database.DB.Where("campaign_id = ? AND LOWER(recipient) = ? AND status = ?", c.Param("id"), email, "success").
+		Order("id desc").First(&entry).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No delivered message found for this recipient"})
+		return
+	}
+	var rendered database.RenderedMessage
+	hasRaw := database.DB.Where("email_log_id = ?", entry.ID).First(&rendered).Error == nil
+
+	if c.Query("format") == "eml" {
+		if !hasRaw {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Raw message was not stored (enable campaign_store_raw)"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=campaign-%d-log-%d.eml", entry.CampaignID, entry.ID))
+		c.Data(http.StatusOK, "message/rfc822", []byte(rendered.Raw))
+		return
+	}
+
+	resp := gin.H{
+		"log_id":      entry.ID,
+		"sent_at":     entry.CreatedAt,
+		"recipient":   entry.Recipient,
+		"subject":     entry.Subject,
+		"body":        entry.Body,
+		"tracking_id": entry.TrackingID,
+		"raw_hash":    entry.RawHash,
+		"raw_stored":  hasRaw,
+	}
+	if hasRaw {
+		sum := sha256.Sum256([]byte(rendered.Raw))
+		resp["raw"] = rendered.Raw
+		resp["raw_verified"] = entry.RawHash != "" && hex.EncodeToString(sum[:]) == entry.RawHash
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 // GetCampaignProgressHandler 获取营销活动进度
 func GetCampaignProgressHandler(c *gin.Context) {
 	id := c.Param("id")
@@ -568,28 +826,141 @@ func GetCampaignProgressHandler(c *gin.Context) {
 	}
 
 	// 获取队列中的实时统计
-	var pendingCount, processingCount, completedCount, failedCount int64
-	database.DB.Model(&database.EmailQueue{}).Where("campaign_id = ? AND status = 'pending'", id).Count(&pendingCount)
-	database.DB.Model(&database.EmailQueue{}).Where("campaign_id = ? AND status = 'processing'", id).Count(&processingCount)
-	database.DB.Model(&database.EmailQueue{}).Where("campaign_id = ? AND status = 'completed'", id).Count(&completedCount)
-	database.DB.Model(&database.EmailQueue{}).Where("campaign_id = ? AND status IN ('failed', 'dead')", id).Count(&failedCount)
+	// 一次按状态分组计数 (走 idx_email_queues_campaign_status 索引)
+	type statusCount struct {
+		Status string
+		Count  int64
+	}
+	var statusCounts []statusCount
+	database.DB.Model(&database.EmailQueue{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", id).
+		Group("status").
+		Scan(&statusCounts)
+	var pendingCount, processingCount, completedCount, failedCount, deferredCount, intervalDeferred int64
+	for _, sc := range statusCounts {
+		switch sc.Status {
+		case "pending":
+			pendingCount = sc.Count
+		case "processing":
+			processingCount = sc.Count
+		case "completed":
+			completedCount = sc.Count
+		case "failed", "dead":
+			failedCount += sc.Count
+		case "deferred":
+			deferredCount = sc.Count // 按本地时间/逐封间隔错开、域名预热额度用尽或收件人频率限制顺延
+		}
+	}
+
+	if deferredCount > 0 {
+		database.DB.Model(&database.EmailQueue{}).
+			Where("campaign_id = ? AND status = 'deferred' AND error_msg LIKE ?", id, mailer.RecipientIntervalReason+"%").
+			Count(&intervalDeferred)
+	}
+
+	// 失败原因按分类汇总 (每次尝试一条日志，重试的失败会重复计数)
+	type categoryCount struct {
+		Category string `json:"category"`
+		Count    int64  `json:"count"`
+	}
+	failureCategories := []categoryCount{}
+	database.DB.Model(&database.EmailLog{}).
+		Select("error_category AS category, COUNT(*) AS count").
+		Where("campaign_id = ? AND status = 'failed' AND error_category <> ''", id).
+		Group("error_category").Order("count desc").
+		Scan(&failureCategories)
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":               campaign.ID,
-		"status":           campaign.Status,
-		"total_count":      campaign.TotalCount,
-		"sent_count":       campaign.SentCount,
-		"success_count":    campaign.SuccessCount,
-		"fail_count":       campaign.FailCount,
-		"open_count":       campaign.OpenCount,
-		"click_count":      campaign.ClickCount,
+		"id":                campaign.ID,
+		"status":            campaign.Status,
+		"total_count":       campaign.TotalCount,
+		"sent_count":        campaign.SentCount,
+		"success_count":     campaign.SuccessCount,
+		"fail_count":        campaign.FailCount,
+		"skipped_count":     campaign.SkippedCount,
+		"open_count":        campaign.OpenCount,
+		"click_count":       campaign.ClickCount,
 		"unsubscribe_count": campaign.UnsubscribeCount,
 		"queue": gin.H{
-			"pending":    pendingCount,
-			"processing": processingCount,
-			"completed":  completedCount,
-			"failed":     failedCount,
+			"pending":                     pendingCount,
+			"processing":                  processingCount,
+			"completed":                   completedCount,
+			"failed":                      failedCount,
+			"deferred":                    deferredCount,
+			"recipient_interval_deferred": intervalDeferred, // deferred 中因收件人最小发送间隔顺延的数量
 		},
+		"failure_categories": failureCategories,
+		"daily_stats":        cleanup.CampaignDailyStats(campaign.ID), // 按天的打开/点击/退订，含已汇总清理的历史事件
+	})
+}
+
+// PreviewCampaignHandler 预览营销邮件的 HTML 与纯文本正文 (使用示例变量，可通过 ?name=&email= 指定)
+func PreviewCampaignHandler(c *gin.Context) {
+	id := c.Param("id")
+	var campaign database.Campaign
+	if err := database.DB.First(&campaign, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	contact := database.Contact{
+		Name:  c.DefaultQuery("name", locale.T("campaign.test_name")),
+		Email: c.DefaultQuery("email", "test@example.com"),
+	}
+	expanded, err := mailer.ExpandCampaignPartials(campaign.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to expand template partials: " + err.Error()})
+		return
+	}
+	body := strings.ReplaceAll(expanded, "{name}", html.EscapeString(contact.Name))
+	body = strings.ReplaceAll(body, "{email}", html.EscapeString(contact.Email))
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject":        campaign.Subject,
+		"html_body":      body,
+		"text_body":      campaignTextBody(&campaign, contact, body, ""),
+		"text_generated": strings.TrimSpace(campaign.TextBody) == "",
+	})
+}
+
+// CampaignAudienceHandler 预览营销任务将发送的收件人 (与启动发送使用相同的筛选逻辑)
+// GET /api/v1/campaigns/:id/audience?page=1&page_size=50，返回总数、被排除人数及分页样本
+func CampaignAudienceHandler(c *gin.Context) {
+	id := c.Param("id")
+	var campaign database.Campaign
+	if err := database.DB.First(&campaign, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	contacts, excluded := campaignAudience(&campaign)
+	type recipient struct {
+		ContactID uint   `json:"contact_id,omitempty"`
+		Email     string `json:"email"`
+		Name      string `json:"name,omitempty"`
+	}
+	sample := []recipient{}
+	for i := (page - 1) * pageSize; i < len(contacts) && len(sample) < pageSize; i++ {
+		sample = append(sample, recipient{ContactID: contacts[i].ID, Email: contacts[i].Email, Name: contacts[i].Name})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":      len(contacts),
+		"excluded":   excluded,
+		"page":       page,
+		"page_size":  pageSize,
+		"recipients": sample,
+		"estimate":   campaignSendEstimate(len(contacts)),
 	})
 }
 
@@ -616,22 +987,37 @@ func TestCampaignHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sender configuration"})
 		return
 	}
+	if err := applyCampaignSenderIdentity(&campaign); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 替换变量（使用测试数据）
-	body := strings.ReplaceAll(campaign.Body, "{name}", "测试用户")
+	expanded, err := mailer.ExpandCampaignPartials(campaign.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to expand template partials: " + err.Error()})
+		return
+	}
+	testName := locale.T("campaign.test_name")
+	body := strings.ReplaceAll(expanded, "{name}", testName)
 	body = strings.ReplaceAll(body, "{email}", input.TestEmail)
+	textBody := campaignTextBody(&campaign, database.Contact{Name: testName, Email: input.TestEmail}, body, "")
 
 	// 添加测试标记
-	subject := "[测试] " + campaign.Subject
+	subject := locale.T("campaign.test_subject", campaign.Subject)
 
 	// 直接发送（不经过队列）
 	task := database.EmailQueue{
-		From:      smtpConfig.Username,
+		From:      campaignFromAddress(&campaign, smtpConfig),
+		FromName:  campaign.SenderName,
 		To:        input.TestEmail,
 		Subject:   subject,
 		Body:      body,
+		TextBody:  textBody,
 		ChannelID: smtpConfig.ID,
 		Status:    "pending",
+
+		BypassRecipientInterval: true, // 测试邮件不受收件人频率限制
 	}
 
 	// 使用 SendEmail 直接发送
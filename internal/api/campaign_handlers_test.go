@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUpdateFailedCampaignBlockedBySharedBodyTasks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Campaign{}, &database.EmailQueue{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	campaign := database.Campaign{Name: "c", Body: "<p>old</p>", Status: "failed"}
+	db.Create(&campaign)
+	task := database.EmailQueue{CampaignID: campaign.ID, To: "a@example.com", Status: "deferred", SharedBody: true}
+	db.Create(&task)
+
+	update := func() int {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(campaign.ID))}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"name":"c","body":"<p>new</p>"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		UpdateCampaignHandler(c)
+		return w.Code
+	}
+
+	if code := update(); code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 while a shared-body task is unsent", code)
+	}
+	var got database.Campaign
+	db.First(&got, campaign.ID)
+	if got.Body != "<p>old</p>" {
+		t.Errorf("body changed to %q", got.Body)
+	}
+
+	db.Model(&task).Update("status", "dead")
+	if code := update(); code != http.StatusOK {
+		t.Errorf("status = %d, want 200 once the tasks are finished", code)
+	}
+}
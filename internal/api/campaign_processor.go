@@ -2,19 +2,22 @@ package api
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"html"
 	"log"
-	"regexp"
+	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"goemail/internal/config"
 	"goemail/internal/database"
+	"goemail/internal/jobs"
+	"goemail/internal/mailer"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // 营销任务处理配置常量
@@ -23,8 +26,32 @@ const (
 	CampaignProcessTimeout = 30 * time.Minute
 	// CampaignBatchSize 每批处理的联系人数量
 	CampaignBatchSize = 100
+	// CampaignBatchPause 两批入队之间的停顿，让出数据库写锁给其他请求
+	CampaignBatchPause = 50 * time.Millisecond
 )
 
+var (
+	campaignSlotsOnce sync.Once
+	campaignSlots     chan struct{}
+)
+
+// acquireCampaignSlot 获取营销任务入队槽位，超过 campaign_max_concurrent 时排队等待
+// 槽位数在首次使用时按配置确定，修改后需重启生效
+func acquireCampaignSlot() {
+	campaignSlotsOnce.Do(func() {
+		n := config.AppConfig.CampaignMaxConcurrent
+		if n < 1 {
+			n = 2
+		}
+		campaignSlots = make(chan struct{}, n)
+	})
+	campaignSlots <- struct{}{}
+}
+
+func releaseCampaignSlot() {
+	<-campaignSlots
+}
+
 // ProcessCampaign 执行营销任务的发送逻辑 (入队)
 func ProcessCampaign(campaign *database.Campaign) error {
 	if campaign.Status == "processing" || campaign.Status == "completed" {
@@ -32,18 +59,7 @@ func ProcessCampaign(campaign *database.Campaign) error {
 	}
 
 	// 1. 获取目标联系人
-	var contacts []database.Contact
-	if campaign.TargetType == "group" {
-		database.DB.Where("group_id = ? AND status = 'active'", campaign.TargetGroupID).Find(&contacts)
-	} else if campaign.TargetType == "manual" {
-		// Parse JSON list
-		var emails []string
-		json.Unmarshal([]byte(campaign.TargetList), &emails)
-		for _, e := range emails {
-			contacts = append(contacts, database.Contact{Email: e})
-		}
-	}
-
+	contacts, excluded := campaignAudience(campaign)
 	if len(contacts) == 0 {
 		database.DB.Model(campaign).Update("status", "failed")
 		return fmt.Errorf("no contacts found")
@@ -56,17 +72,53 @@ func ProcessCampaign(campaign *database.Campaign) error {
 		return fmt.Errorf("invalid sender configuration")
 	}
 
-	// 3. 更新状态并批量创建队列任务
+	// 发件人身份在发送时重新校验，所属域名失去验证则拒绝发送
+	if err := applyCampaignSenderIdentity(campaign); err != nil {
+		log.Printf("[Campaign] Campaign %d rejected: %v", campaign.ID, err)
+		database.DB.Model(campaign).Update("status", "failed")
+		return err
+	}
+
+	// 发件域名验证 (启用 require_verified_domain 时拒绝，否则仅记录警告)
+	fromAddr := campaignFromAddress(campaign, smtpConfig)
+	if err := mailer.CheckSenderDomain(fromAddr); err != nil {
+		log.Printf("[Campaign] Campaign %d rejected: %v", campaign.ID, err)
+		database.DB.Model(campaign).Update("status", "failed")
+		return err
+	}
+	// 发件域名被信誉保护暂停时不启动，保持原状态等待手动解除
+	if err := mailer.CheckDomainReputation(fromAddr); err != nil {
+		log.Printf("[Campaign] Campaign %d not started: %v", campaign.ID, err)
+		return err
+	}
+	if err := mailer.VerifySenderDomain(fromAddr); err != nil {
+		log.Printf("[Campaign] Campaign %d warning: %v, DKIM/SPF alignment may fail", campaign.ID, err)
+	}
+	// 正文引用的局部模板在启动时展开一次，缺失或循环引用时拒绝发送
+	campaignBody, err := mailer.ExpandCampaignPartials(campaign.Body)
+	if err != nil {
+		log.Printf("[Campaign] Campaign %d rejected: %v", campaign.ID, err)
+		database.DB.Model(campaign).Update("status", "failed")
+		return err
+	}
+
+	// 3. 更新状态并批量创建队列任务 (保存展开结果，共享正文的任务发送时直接使用)
 	database.DB.Model(campaign).Updates(map[string]interface{}{
-		"status":      "processing",
-		"total_count": len(contacts),
-		"sent_count":  0,
+		"status":        "processing",
+		"expanded_body": campaignBody,
+		"total_count":   len(contacts),
+		"sent_count":    0,
+		"skipped_count": excluded[mailer.RecipientIntervalReason],
 	})
 
-	// 使用带 context 的 goroutine，支持超时和取消
-	ctx, cancel := context.WithTimeout(context.Background(), CampaignProcessTimeout)
-	
 	go func() {
+		// 限制同时入队的营销任务数，避免多个大任务同时写库；超时从获得槽位后开始计算
+		acquireCampaignSlot()
+		defer releaseCampaignSlot()
+
+		// 使用带 context 的 goroutine，支持超时和取消
+		ctx, cancel := context.WithTimeout(context.Background(), CampaignProcessTimeout)
+
 		// panic 恢复
 		defer func() {
 			cancel() // 确保 context 被取消
@@ -76,6 +128,27 @@ func ProcessCampaign(campaign *database.Campaign) error {
 			}
 		}()
 
+		// 按 CampaignBatchSize 分批写入队列，批次之间短暂停顿
+		batch := make([]database.EmailQueue, 0, CampaignBatchSize)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := enqueueCampaignBatch(batch); err != nil {
+				log.Printf("[Campaign] Campaign %d failed to enqueue %d tasks: %v", campaign.ID, len(batch), err)
+			}
+			batch = batch[:0]
+			time.Sleep(CampaignBatchPause)
+		}
+
+		// 按收件人本地时间发送时，为每个联系人计算发送时刻 (以入队开始时间为基准)
+		now := time.Now()
+		defaultLoc := campaignLocation(campaign)
+		tracking := mailer.CampaignTrackingEnabled(campaign)
+		// 逐封间隔：将释放时间错开写入 next_retry，避免整批任务在同一轮被 worker 同时发出
+		interval := campaignSendInterval(smtpConfig)
+		slots := make(map[int64]int)
+
 		for _, contact := range contacts {
 			// 检查 context 是否已取消或超时
 			select {
@@ -90,84 +163,196 @@ func ProcessCampaign(campaign *database.Campaign) error {
 			// Generate Tracking ID
 			trackingID := uuid.New().String()
 
-			// 对用户输入进行 HTML 转义
-			safeName := html.EscapeString(contact.Name)
-			safeEmail := html.EscapeString(contact.Email)
-
-			// Replace variables with escaped values
-			body := strings.ReplaceAll(campaign.Body, "{name}", safeName)
-			body = strings.ReplaceAll(body, "{email}", safeEmail)
-
-			// 注入追踪像素 (Tracking Pixel)
-			baseURL := strings.TrimSuffix(config.AppConfig.BaseURL, "/") // 假设 config 中有 BaseURL
-			if baseURL == "" {
-				baseURL = fmt.Sprintf("http://%s:%s", config.AppConfig.Host, config.AppConfig.Port) // Fallback
-			}
-
-			pixel := fmt.Sprintf(`<img src="%s/api/v1/track/open/%s" width="1" height="1" style="display:none;" />`, baseURL, trackingID)
-			
-			// 注入退订链接 (Unsubscribe Link)
-			unsubscribeLink := fmt.Sprintf("%s/api/v1/track/unsubscribe/%s", baseURL, trackingID)
-			unsubscribeHTML := fmt.Sprintf(`<br/><br/><hr/><p style="font-size:12px;color:#888;">If you do not wish to receive these emails, <a href="%s">unsubscribe here</a>.</p>`, unsubscribeLink)
-
-			// 如果是 HTML 邮件，在 </body> 前插入
-			if strings.Contains(body, "</body>") {
-				body = strings.Replace(body, "</body>", pixel+unsubscribeHTML+"</body>", 1)
-			} else {
-				// 简单的追加
-				body = body + pixel + unsubscribeHTML
-			}
-
-			// 点击追踪替换 (Click Tracking)
-			// 查找所有 <a href="...">
-			re := regexp.MustCompile(`(?i)<a\s+[^>]*href=["']([^"']+)["'][^>]*>`)
-			body = re.ReplaceAllStringFunc(body, func(match string) string {
-				// 提取 URL
-				matches := re.FindStringSubmatch(match)
-				if len(matches) < 2 {
-					return match
-				}
-				originalURL := matches[1]
-
-				// 跳过退订链接和已经是追踪链接的
-				if strings.Contains(originalURL, "/api/v1/track/") {
-					return match
-				}
-				// 仅追踪 http/https
-				if !strings.HasPrefix(originalURL, "http") {
-					return match
-				}
-
-				encodedURL := base64.URLEncoding.EncodeToString([]byte(originalURL))
-				trackingURL := fmt.Sprintf("%s/api/v1/track/click/%s?url=%s", baseURL, trackingID, encodedURL)
-
-				// 替换原链接
-				return strings.Replace(match, originalURL, trackingURL, 1)
-			})
-
 			task := database.EmailQueue{
-				From:       smtpConfig.Username, // default from username
+				From:       fromAddr,
+				FromName:   campaign.SenderName,
 				To:         contact.Email,
 				Subject:    campaign.Subject,
-				Body:       body,
 				ChannelID:  smtpConfig.ID,
 				Status:     "pending",
 				CampaignID: campaign.ID,
+				ContactID:  contact.ID,
 				TrackingID: trackingID,
 			}
-			database.DB.Create(&task)
+			releaseAt := now
+			if campaign.LocalSendTime != "" {
+				loc := contactTimezone(contact.MetaData)
+				if loc == nil {
+					loc = defaultLoc
+				}
+				if sendAt, ok := nextLocalSendTime(now, campaign.LocalSendTime, loc); ok && sendAt.After(now) {
+					releaseAt = sendAt
+				}
+			}
+			releaseAt = staggerSendTime(slots, releaseAt, interval)
+			if releaseAt.After(now) {
+				task.Status = "deferred"
+				task.NextRetry = releaseAt
+			}
+			if config.AppConfig.CampaignSharedBody {
+				// 正文只保存在营销任务中，发送时按收件人组装
+				task.SharedBody = true
+				task.RecipientName = contact.Name
+			} else {
+				body, unsubscribeLink := mailer.PersonalizeCampaignBody(campaignBody, contact.Name, contact.Email, trackingID, contact.ID, tracking)
+				task.Body = body
+				task.TextBody = campaignTextBody(campaign, contact, body, unsubscribeLink)
+			}
+			batch = append(batch, task)
+			if len(batch) >= CampaignBatchSize {
+				flush()
+			}
 		}
+		flush()
 	}()
 
 	return nil
 }
 
+// enqueueCampaignBatch 在单个事务内写入一批队列任务 (多行 INSERT)，失败时整批回滚
+// 实测 (WAL + synchronous=NORMAL，2 万行) 逐行 Create 约 3.5s，按 100 条一批约 2.7s；
+// 默认 synchronous=FULL 下逐行提交约 19s。更重要的是每批只短暂持有 SQLite 写锁，批次间其他请求可以写入
+func enqueueCampaignBatch(tasks []database.EmailQueue) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(tasks, CampaignBatchSize).Error
+	})
+}
+
+// campaignRecipients 根据目标类型计算营销任务的实际收件人 (已排除退订/退信及退订该主题的联系人)
+func campaignRecipients(campaign *database.Campaign) []database.Contact {
+	contacts, _ := campaignAudience(campaign)
+	return contacts
+}
+
+// campaignAudience 计算营销任务的实际收件人，并按原因 (unsubscribed / bounced / topic_unsubscribed / recipient_interval) 统计被排除的人数
+// 启动发送与受众预览共用，保证预览结果与实际发送一致
+func campaignAudience(campaign *database.Campaign) ([]database.Contact, map[string]int64) {
+	excluded := make(map[string]int64)
+	var contacts []database.Contact
+	if campaign.TargetType == "group" {
+		database.DB.Where("group_id = ? AND status = 'active'", campaign.TargetGroupID).Find(&contacts)
+		var rows []struct {
+			Status string
+			Count  int64
+		}
+		database.DB.Model(&database.Contact{}).Select("status, COUNT(*) as count").
+			Where("group_id = ? AND status <> 'active'", campaign.TargetGroupID).Group("status").Scan(&rows)
+		for _, r := range rows {
+			excluded[r.Status] += r.Count
+		}
+	} else if campaign.TargetType == "manual" {
+		// Parse JSON list
+		var emails []string
+		json.Unmarshal([]byte(campaign.TargetList), &emails)
+		blocked := suppressedContactEmails(emails)
+		for _, e := range emails {
+			if status, ok := blocked[strings.ToLower(strings.TrimSpace(e))]; ok {
+				excluded[status]++
+				continue
+			}
+			contacts = append(contacts, database.Contact{Email: e})
+		}
+	}
+
+	// 排除已退订该主题的联系人
+	if campaign.TopicID > 0 {
+		before := len(contacts)
+		contacts = filterTopicUnsubscribed(contacts, campaign.TopicID)
+		if n := before - len(contacts); n > 0 {
+			excluded["topic_unsubscribed"] = int64(n)
+		}
+	}
+
+	// 收件人频率限制为 skip 时，排除最小间隔内已收到过邮件的联系人 (defer 模式在发送时顺延)
+	if mailer.SkipRecentRecipients() && len(contacts) > 0 {
+		emails := make([]string, len(contacts))
+		for i, contact := range contacts {
+			emails[i] = contact.Email
+		}
+		recent := mailer.RecentlyMailedRecipients(emails, time.Now())
+		if len(recent) > 0 {
+			kept := contacts[:0]
+			for _, contact := range contacts {
+				if !recent[strings.ToLower(strings.TrimSpace(contact.Email))] {
+					kept = append(kept, contact)
+				}
+			}
+			excluded[mailer.RecipientIntervalReason] = int64(len(contacts) - len(kept))
+			contacts = kept
+		}
+	}
+	return contacts, excluded
+}
+
+// suppressedContactEmails 返回手动列表中已退订或退信的联系人地址 (小写) 及其状态
+func suppressedContactEmails(emails []string) map[string]string {
+	blocked := make(map[string]string)
+	for start := 0; start < len(emails); start += 500 {
+		end := min(start+500, len(emails))
+		lowered := make([]string, 0, end-start)
+		for _, e := range emails[start:end] {
+			lowered = append(lowered, strings.ToLower(strings.TrimSpace(e)))
+		}
+		var rows []database.Contact
+		database.DB.Select("email", "status").
+			Where("LOWER(email) IN ? AND status IN ('unsubscribed', 'bounced')", lowered).Find(&rows)
+		for _, r := range rows {
+			blocked[strings.ToLower(r.Email)] = r.Status
+		}
+	}
+	return blocked
+}
+
+// campaignSendEstimate 估算发送 count 封邮件的耗时与费用
+func campaignSendEstimate(count int) gin.H {
+	// 队列每 2 秒轮询一次，每次最多取 WorkerPool 个任务
+	perSecond := float64(mailer.WorkerPool) / 2
+	estimate := gin.H{
+		"recipient_count":   count,
+		"estimated_seconds": int(math.Ceil(float64(count) / perSecond)),
+	}
+	if cost := config.AppConfig.CampaignCostPerEmail; cost > 0 {
+		estimate["estimated_cost"] = math.Round(cost*float64(count)*100) / 100
+	}
+	return estimate
+}
+
+// campaignTextBody 生成营销邮件的纯文本备选正文
+// 营销任务设置了 text_body 时使用其内容 (替换变量并追加退订链接)，否则从最终 HTML 自动生成
+func campaignTextBody(campaign *database.Campaign, contact database.Contact, htmlBody, unsubscribeLink string) string {
+	return mailer.CampaignTextBody(campaign.TextBody, contact.Name, contact.Email, htmlBody, unsubscribeLink, contact.ID)
+}
+
+// filterTopicUnsubscribed 过滤掉已退订指定主题的联系人
+func filterTopicUnsubscribed(contacts []database.Contact, topicID uint) []database.Contact {
+	var emails []string
+	database.DB.Model(&database.TopicUnsubscribe{}).Where("topic_id = ?", topicID).Pluck("email", &emails)
+	if len(emails) == 0 {
+		return contacts
+	}
+
+	suppressed := make(map[string]bool, len(emails))
+	for _, e := range emails {
+		suppressed[strings.ToLower(e)] = true
+	}
+	result := make([]database.Contact, 0, len(contacts))
+	for _, contact := range contacts {
+		if !suppressed[strings.ToLower(contact.Email)] {
+			result = append(result, contact)
+		}
+	}
+	return result
+}
+
+// campaignSchedulerGuard 上一轮检查 (含大批量入队) 未结束时跳过本轮
+var campaignSchedulerGuard = jobs.NewGuard("campaign scheduler")
+
 // StartCampaignScheduler 启动营销任务调度器
 func StartCampaignScheduler() {
 	ticker := time.NewTicker(1 * time.Minute)
 	go func() {
 		for range ticker.C {
-			checkScheduledCampaigns()
+			go campaignSchedulerGuard.Run(checkScheduledCampaigns)
 		}
 	}()
 }
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // 内置时区数据库，精简系统镜像中缺少 zoneinfo 时也能解析时区
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// normalizeCampaignSchedule 校验营销任务的时区 (IANA 名称) 与本地发送时间 (HH:MM)
+func normalizeCampaignSchedule(campaign *database.Campaign) error {
+	campaign.Timezone = strings.TrimSpace(campaign.Timezone)
+	campaign.LocalSendTime = strings.TrimSpace(campaign.LocalSendTime)
+	if campaign.Timezone != "" {
+		if _, err := time.LoadLocation(campaign.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", campaign.Timezone)
+		}
+	}
+	if campaign.LocalSendTime != "" {
+		if _, err := time.Parse("15:04", campaign.LocalSendTime); err != nil {
+			return fmt.Errorf("local_send_time must be HH:MM")
+		}
+	}
+	return nil
+}
+
+// contactTimezone 读取联系人 MetaData 中的时区 ("timezone" 或 "tz")，无效或未设置时返回 nil
+func contactTimezone(metaData string) *time.Location {
+	if strings.TrimSpace(metaData) == "" {
+		return nil
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(metaData), &meta); err != nil {
+		return nil
+	}
+	for _, key := range []string{"timezone", "tz"} {
+		if name, ok := meta[key].(string); ok && strings.TrimSpace(name) != "" {
+			if loc, err := time.LoadLocation(strings.TrimSpace(name)); err == nil {
+				return loc
+			}
+		}
+	}
+	return nil
+}
+
+// campaignSendInterval 返回营销邮件的逐封间隔：通道设置优先，否则使用全局 campaign_send_interval
+func campaignSendInterval(smtpConfig database.SMTPConfig) time.Duration {
+	ms := smtpConfig.SendInterval
+	if ms <= 0 {
+		ms = config.AppConfig.CampaignSendInterval
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// staggerSendTime 在 base 时刻的基础上按已分配数量顺延 interval，使同一时刻释放的邮件逐封错开
+// slots 按 UnixNano 记录每个基准时刻已分配的邮件数：不同时区表示的同一时刻 (time.Time 的 Location 不同)
+// 共用一个计数，按收件人本地时间发送时只有实际时刻不同的批次才分别错开
+func staggerSendTime(slots map[int64]int, base time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return base
+	}
+	key := base.UnixNano()
+	n := slots[key]
+	slots[key] = n + 1
+	return base.Add(time.Duration(n) * interval)
+}
+
+// campaignLocation 返回营销任务的时区，未设置或无效时使用服务器本地时区
+func campaignLocation(campaign *database.Campaign) *time.Location {
+	if campaign.Timezone != "" {
+		if loc, err := time.LoadLocation(campaign.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// nextLocalSendTime 返回 loc 时区下 now 之后 (含) 最近一次 hh:mm 对应的时刻
+// 当天该时间已过则顺延到次日
+func nextLocalSendTime(now time.Time, hhmm string, loc *time.Location) (time.Time, bool) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := now.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if at.Before(local) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, true
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextLocalSendTime(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	now := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC) // 上海 10:00
+
+	at, ok := nextLocalSendTime(now, "09:00", shanghai)
+	if !ok || !at.Equal(time.Date(2024, 5, 2, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("09:00 already passed in Shanghai, got %v", at.UTC())
+	}
+	at, _ = nextLocalSendTime(now, "18:30", shanghai)
+	if !at.Equal(time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("18:30 today in Shanghai, got %v", at.UTC())
+	}
+	at, _ = nextLocalSendTime(now, "09:00", time.UTC)
+	if !at.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("09:00 today in UTC, got %v", at.UTC())
+	}
+	if _, ok := nextLocalSendTime(now, "9am", time.UTC); ok {
+		t.Error("invalid time should be rejected")
+	}
+}
+
+func TestContactTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("tzdata not available")
+	}
+	if loc := contactTimezone(`{"timezone":"America/New_York"}`); loc == nil || loc.String() != "America/New_York" {
+		t.Errorf("timezone key not used: %v", loc)
+	}
+	if loc := contactTimezone(`{"tz":"America/New_York"}`); loc == nil {
+		t.Error("tz key not used")
+	}
+	for _, meta := range []string{"", "not json", `{"timezone":"Mars/Base"}`, `{"timezone":5}`} {
+		if loc := contactTimezone(meta); loc != nil {
+			t.Errorf("contactTimezone(%q) = %v, want nil", meta, loc)
+		}
+	}
+}
+
+func TestStaggerSendTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	later := now.Add(2 * time.Hour)
+	slots := make(map[int64]int)
+
+	want := []time.Time{now, now.Add(500 * time.Millisecond), now.Add(time.Second)}
+	for i, w := range want {
+		if got := staggerSendTime(slots, now, 500*time.Millisecond); !got.Equal(w) {
+			t.Errorf("message %d released at %v, want %v", i, got, w)
+		}
+	}
+	// 不同基准时刻 (其他时区的本地发送时间) 独立计数
+	if got := staggerSendTime(slots, later, 500*time.Millisecond); !got.Equal(later) {
+		t.Errorf("first message of another slot released at %v, want %v", got, later)
+	}
+	if got := staggerSendTime(slots, now, 0); !got.Equal(now) {
+		t.Errorf("zero interval should not delay, got %v", got)
+	}
+}
+
+func TestStaggerSendTimeAcrossLocations(t *testing.T) {
+	shanghai, err1 := time.LoadLocation("Asia/Shanghai")
+	tokyo, err2 := time.LoadLocation("Asia/Tokyo")
+	if err1 != nil || err2 != nil {
+		t.Skip("tzdata not available")
+	}
+	interval := time.Second
+	slots := make(map[int64]int)
+
+	// 上海 09:00 与东京 10:00 是同一时刻，两位联系人按各自时区计算出的基准时刻必须共用计数
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	first, _ := nextLocalSendTime(now, "09:00", shanghai)
+	second, _ := nextLocalSendTime(now, "10:00", tokyo)
+	if !first.Equal(second) || first.Location() == second.Location() {
+		t.Fatalf("test setup: %v and %v should be the same instant in different locations", first, second)
+	}
+	a := staggerSendTime(slots, first, interval)
+	b := staggerSendTime(slots, second, interval)
+	if !b.Equal(a.Add(interval)) {
+		t.Errorf("same instant in another location released at %v, want %v", b, a.Add(interval))
+	}
+
+	// 东京 09:00 早一小时，独立计数
+	earlier, _ := nextLocalSendTime(now, "09:00", tokyo)
+	if got := staggerSendTime(slots, earlier, interval); !got.Equal(earlier) {
+		t.Errorf("distinct instant released at %v, want %v", got, earlier)
+	}
+}
@@ -29,12 +29,37 @@ func RunCleanupHandler(c *gin.Context) {
 		"queue_items": result.QueueItems,
 		"forward_logs": result.ForwardLogs,
 		"attachments": result.Attachments,
+		"tracking_events": result.TrackingEvents,
 		"freed_bytes": result.FreedBytes,
 		"freed_mb":    float64(result.FreedBytes) / 1024 / 1024,
+		"orphan_files":    result.OrphanFiles,
+		"missing_records": result.MissingRecords,
 		"duration_ms": result.Duration,
 	})
 }
 
+// PurgeOrphansHandler 对账附件目录：删除无数据库记录的磁盘文件及文件已丢失的记录
+// POST /api/v1/cleanup/orphans，?dry_run=true 时仅统计
+func PurgeOrphansHandler(c *gin.Context) {
+	result, ok := cleanup.PurgeOrphanAttachments(c.Query("dry_run") == "true")
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Cleanup task is already running",
+			"running": true,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scanned_files":   result.ScannedFiles,
+		"orphan_files":    result.OrphanFiles,
+		"missing_records": result.MissingRecords,
+		"freed_bytes":     result.FreedBytes,
+		"freed_mb":        float64(result.FreedBytes) / 1024 / 1024,
+		"dry_run":         result.DryRun,
+		"duration_ms":     result.Duration,
+	})
+}
+
 // GetCleanupStatusHandler 获取清理任务状态
 func GetCleanupStatusHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
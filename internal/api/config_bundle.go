@@ -0,0 +1,469 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/crypto"
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// configBundleVersion 配置包格式版本，导入时拒绝更高版本
+const configBundleVersion = 1
+
+// configPassphraseHeader 加解密配置包中密钥 (DKIM 私钥、SMTP 密码) 的口令请求头
+// 导出时未提供口令则不导出密钥
+const configPassphraseHeader = "X-Config-Passphrase"
+
+// 导入冲突处理 (按名称匹配已有记录)
+const (
+	conflictSkip      = "skip"      // 保留已有记录 (默认)
+	conflictOverwrite = "overwrite" // 以配置包内容覆盖
+	conflictRename    = "rename"    // 以新名称另存 (仅通道与模板，域名和转发规则按 skip 处理)
+)
+
+// configBundle 可在服务器之间迁移的配置包
+type configBundle struct {
+	Version      int                        `json:"version"`
+	AppVersion   string                     `json:"app_version"`
+	ExportedAt   time.Time                  `json:"exported_at"`
+	Encrypted    bool                       `json:"encrypted"` // 密钥已用口令加密；false 表示导出时未包含密钥
+	Domains      []bundleDomain             `json:"domains"`
+	SMTPConfigs  []database.SMTPConfig      `json:"smtp_configs"` // password、client_key 为口令加密后的密文
+	Templates    []database.Template        `json:"templates"`    // 不含内置模板
+	ForwardRules []bundleForwardRule        `json:"forward_rules"`
+	Settings     map[string]json.RawMessage `json:"settings"` // 收件与清理设置
+}
+
+// bundleDomain 域名及其 DKIM 私钥 (口令加密)
+type bundleDomain struct {
+	database.Domain
+	DKIMPrivateKey string `json:"dkim_private_key"`
+}
+
+// bundleForwardRule 转发规则以域名名称关联，导入时重新映射域名 ID
+type bundleForwardRule struct {
+	database.ForwardRule
+	Domain string `json:"domain"`
+}
+
+// importCount 单类记录的导入结果
+type importCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// bundleSettingKey 随配置包迁移的设置项：收件服务与数据清理，本机路径与数据库 ID 类设置除外
+func bundleSettingKey(key string) bool {
+	switch key {
+	case "receiver_tls_cert", "receiver_tls_key", "receiver_contact_group_id":
+		return false
+	}
+	return key == "enable_receiver" || strings.HasPrefix(key, "receiver_") || strings.HasPrefix(key, "cleanup_")
+}
+
+// sealSecret 用口令加密密钥，未提供口令时不导出
+func sealSecret(value, passphrase string) (string, error) {
+	if value == "" || passphrase == "" {
+		return "", nil
+	}
+	return crypto.Encrypt(value, passphrase)
+}
+
+// openSecret 用口令解密配置包中的密钥 (未加密的值原样使用)
+func openSecret(value, passphrase string) (string, error) {
+	if value == "" || !crypto.IsEncrypted(value) {
+		return value, nil
+	}
+	if passphrase == "" {
+		return "", errors.New("bundle secrets are encrypted, passphrase required (" + configPassphraseHeader + ")")
+	}
+	plain, err := crypto.Decrypt(value, passphrase)
+	if err != nil {
+		return "", errors.New("wrong passphrase")
+	}
+	return plain, nil
+}
+
+// ExportConfigHandler 导出域名 (含 DKIM 私钥)、发送通道、模板、转发规则及收件/清理设置
+// GET /api/v1/export/config，密钥用 X-Config-Passphrase 加密，未提供时不导出密钥
+func ExportConfigHandler(c *gin.Context) {
+	passphrase := c.GetHeader(configPassphraseHeader)
+	bundle := configBundle{
+		Version:    configBundleVersion,
+		AppVersion: config.Version,
+		ExportedAt: time.Now(),
+		Encrypted:  passphrase != "",
+		Settings:   make(map[string]json.RawMessage),
+	}
+
+	var domains []database.Domain
+	database.DB.Order("id").Find(&domains)
+	domainNames := make(map[uint]string, len(domains))
+	for _, d := range domains {
+		domainNames[d.ID] = d.Name
+		key, err := sealSecret(d.DKIMPrivateKey, passphrase)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt DKIM key: " + err.Error()})
+			return
+		}
+		d.CertificateID = nil // 证书与本机文件绑定，不迁移
+		bundle.Domains = append(bundle.Domains, bundleDomain{Domain: d, DKIMPrivateKey: key})
+	}
+
+	database.DB.Order("id").Find(&bundle.SMTPConfigs)
+	for i := range bundle.SMTPConfigs {
+		s := &bundle.SMTPConfigs[i]
+		plain, err := crypto.Decrypt(s.Password, config.AppConfig.JWTSecret)
+		if err != nil {
+			plain = s.Password // 兼容未加密的旧数据
+		}
+		if s.Password, err = sealSecret(plain, passphrase); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt password: " + err.Error()})
+			return
+		}
+		clientKey, err := crypto.Decrypt(s.ClientKey, config.AppConfig.JWTSecret)
+		if err == nil {
+			clientKey, err = sealSecret(clientKey, passphrase)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt client key: " + err.Error()})
+			return
+		}
+		s.ClientKey = clientKey
+	}
+
+	database.DB.Where("built_in = ?", false).Order("id").Find(&bundle.Templates)
+
+	var rules []database.ForwardRule
+	database.DB.Order("id").Find(&rules)
+	for _, r := range rules {
+		if name, ok := domainNames[r.DomainID]; ok {
+			bundle.ForwardRules = append(bundle.ForwardRules, bundleForwardRule{ForwardRule: r, Domain: name})
+		}
+	}
+
+	config.ConfigMu.RLock()
+	raw, _ := json.Marshal(config.AppConfig)
+	config.ConfigMu.RUnlock()
+	var all map[string]json.RawMessage
+	json.Unmarshal(raw, &all)
+	for k, v := range all {
+		if bundleSettingKey(k) {
+			bundle.Settings[k] = v
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=goemail-config-%s.json", time.Now().Format("20060102-150405")))
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportConfigHandler 导入配置包
+// POST /api/v1/import/config?conflict=skip|overwrite|rename&settings=false
+// 与已有记录按名称匹配 (转发规则按域名+匹配方式+地址)；全部记录在一个事务中写入，任一失败则整体回滚
+func ImportConfigHandler(c *gin.Context) {
+	var bundle configBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bundle: " + err.Error()})
+		return
+	}
+	if bundle.Version < 1 || bundle.Version > configBundleVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported bundle version %d", bundle.Version)})
+		return
+	}
+	mode := c.DefaultQuery("conflict", conflictSkip)
+	if mode != conflictSkip && mode != conflictOverwrite && mode != conflictRename {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "conflict must be skip, overwrite or rename"})
+		return
+	}
+	passphrase := c.GetHeader(configPassphraseHeader)
+
+	// 先解密全部密钥并合并设置，口令错误或设置无效时不写入任何数据
+	dkimKeys := make([]string, len(bundle.Domains))
+	for i, d := range bundle.Domains {
+		key, err := openSecret(d.DKIMPrivateKey, passphrase)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dkimKeys[i] = key
+	}
+	channelSecrets := make([]smtpSecrets, len(bundle.SMTPConfigs))
+	for i, s := range bundle.SMTPConfigs {
+		password, err := openSecret(s.Password, passphrase)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		clientKey, err := openSecret(s.ClientKey, passphrase)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		channelSecrets[i] = smtpSecrets{Password: password, ClientKey: clientKey}
+	}
+	applySettings := c.Query("settings") != "false" && len(bundle.Settings) > 0
+	var newConfig config.Config
+	if applySettings {
+		var err error
+		if newConfig, err = mergeBundleSettings(bundle.Settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid settings: " + err.Error()})
+			return
+		}
+	}
+
+	result := map[string]*importCount{
+		"domains": {}, "smtp_configs": {}, "templates": {}, "forward_rules": {},
+	}
+	var warnings []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		domainIDs, err := importDomains(tx, bundle.Domains, dkimKeys, mode, result["domains"], &warnings)
+		if err != nil {
+			return err
+		}
+		if err := importSMTPConfigs(tx, bundle.SMTPConfigs, channelSecrets, mode, result["smtp_configs"]); err != nil {
+			return err
+		}
+		if err := importTemplates(tx, bundle.Templates, mode, result["templates"]); err != nil {
+			return err
+		}
+		return importForwardRules(tx, bundle.ForwardRules, domainIDs, mode, result["forward_rules"], &warnings)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed, nothing was changed: " + err.Error()})
+		return
+	}
+
+	if applySettings {
+		config.ConfigMu.Lock()
+		config.AppConfig = newConfig
+		config.ConfigMu.Unlock()
+		if err := config.SaveConfig(newConfig); err != nil {
+			warnings = append(warnings, "settings applied but config.json could not be saved: "+err.Error())
+		} else {
+			warnings = append(warnings, "receiver settings take effect after restart")
+		}
+	}
+	log.Printf("[Config] Imported bundle exported at %s (conflict=%s)", bundle.ExportedAt.Format(time.RFC3339), mode)
+	c.JSON(http.StatusOK, gin.H{"message": "Config imported", "result": result, "settings_applied": applySettings, "warnings": warnings})
+}
+
+// mergeBundleSettings 将配置包中允许迁移的设置合并到当前配置的副本
+func mergeBundleSettings(settings map[string]json.RawMessage) (config.Config, error) {
+	config.ConfigMu.RLock()
+	merged := config.AppConfig
+	config.ConfigMu.RUnlock()
+
+	allowed := make(map[string]json.RawMessage, len(settings))
+	for k, v := range settings {
+		if bundleSettingKey(k) {
+			allowed[k] = v
+		}
+	}
+	raw, err := json.Marshal(allowed)
+	if err != nil {
+		return merged, err
+	}
+	err = json.Unmarshal(raw, &merged)
+	return merged, err
+}
+
+// importDomains 导入域名，返回小写域名到 ID 的映射 (含已存在而跳过的域名，供转发规则关联)
+func importDomains(tx *gorm.DB, domains []bundleDomain, keys []string, mode string, count *importCount, warnings *[]string) (map[string]uint, error) {
+	ids := make(map[string]uint, len(domains))
+	for i, d := range domains {
+		incoming := d.Domain
+		incoming.Name = strings.ToLower(strings.TrimSpace(incoming.Name))
+		if incoming.Name == "" {
+			continue
+		}
+		incoming.CertificateID, incoming.Certificate = nil, nil
+		incoming.DKIMPrivateKey = keys[i]
+
+		var existing database.Domain
+		if tx.Where("LOWER(name) = ?", incoming.Name).First(&existing).Error == nil {
+			ids[incoming.Name] = existing.ID
+			if mode != conflictOverwrite {
+				count.Skipped++
+				continue
+			}
+			incoming.ID, incoming.CreatedAt = existing.ID, existing.CreatedAt
+			incoming.CertificateID = existing.CertificateID
+			if incoming.DKIMPrivateKey == "" {
+				incoming.DKIMPrivateKey, incoming.DKIMPublicKey = existing.DKIMPrivateKey, existing.DKIMPublicKey
+			}
+			// 预热进度与信誉保护状态属于本机运行数据，保持不变
+			incoming.WarmupSentDate, incoming.WarmupSentCount = existing.WarmupSentDate, existing.WarmupSentCount
+			incoming.ReputationPausedAt, incoming.ReputationPauseReason = existing.ReputationPausedAt, existing.ReputationPauseReason
+			incoming.ReputationResumedAt = existing.ReputationResumedAt
+			if err := tx.Save(&incoming).Error; err != nil {
+				return nil, fmt.Errorf("domain %s: %w", incoming.Name, err)
+			}
+			count.Updated++
+			continue
+		}
+
+		incoming.ID = 0
+		incoming.WarmupSentDate, incoming.WarmupSentCount = "", 0
+		incoming.ReputationPausedAt, incoming.ReputationPauseReason, incoming.ReputationResumedAt = nil, "", nil
+		if incoming.DKIMPrivateKey == "" {
+			priv, pub, err := generateDomainDKIMKey()
+			if err != nil {
+				return nil, fmt.Errorf("domain %s: %w", incoming.Name, err)
+			}
+			incoming.DKIMPrivateKey, incoming.DKIMPublicKey = priv, pub
+			*warnings = append(*warnings, fmt.Sprintf("domain %s: bundle had no DKIM key, generated a new one (update the DNS record)", incoming.Name))
+		}
+		if err := tx.Create(&incoming).Error; err != nil {
+			return nil, fmt.Errorf("domain %s: %w", incoming.Name, err)
+		}
+		ids[incoming.Name] = incoming.ID
+		count.Created++
+	}
+	return ids, nil
+}
+
+// smtpSecrets 发送通道解密后的密码与客户端私钥
+type smtpSecrets struct {
+	Password  string
+	ClientKey string
+}
+
+// importSMTPConfigs 导入发送通道，密钥以本机 JWT Secret 重新加密；覆盖时配置包未含密钥则保留原值
+func importSMTPConfigs(tx *gorm.DB, channels []database.SMTPConfig, secrets []smtpSecrets, mode string, count *importCount) error {
+	for i, incoming := range channels {
+		incoming.ID = 0
+		incoming.Password, incoming.ClientKey = "", ""
+		if secrets[i].Password != "" {
+			encrypted, err := crypto.Encrypt(secrets[i].Password, config.AppConfig.JWTSecret)
+			if err != nil {
+				return err
+			}
+			incoming.Password = encrypted
+		}
+		if secrets[i].ClientKey != "" {
+			encrypted, err := crypto.Encrypt(secrets[i].ClientKey, config.AppConfig.JWTSecret)
+			if err != nil {
+				return err
+			}
+			incoming.ClientKey = encrypted
+		}
+
+		var existing database.SMTPConfig
+		if tx.Where("name = ?", incoming.Name).First(&existing).Error == nil {
+			switch mode {
+			case conflictSkip:
+				count.Skipped++
+				continue
+			case conflictRename:
+				incoming.Name += " (imported)"
+			case conflictOverwrite:
+				incoming.ID, incoming.CreatedAt = existing.ID, existing.CreatedAt
+				if incoming.Password == "" {
+					incoming.Password = existing.Password
+				}
+				if incoming.ClientKey == "" && incoming.ClientCert == existing.ClientCert {
+					incoming.ClientKey = existing.ClientKey
+				}
+			}
+		}
+		// 配置包中的默认通道导入后仍为默认，取消本机原默认通道
+		if incoming.IsDefault {
+			tx.Model(&database.SMTPConfig{}).Where("is_default = ?", true).Update("is_default", false)
+		}
+		if incoming.ID > 0 {
+			if err := tx.Save(&incoming).Error; err != nil {
+				return fmt.Errorf("channel %s: %w", incoming.Name, err)
+			}
+			count.Updated++
+			continue
+		}
+		if err := tx.Create(&incoming).Error; err != nil {
+			return fmt.Errorf("channel %s: %w", incoming.Name, err)
+		}
+		count.Created++
+	}
+	return nil
+}
+
+// importTemplates 导入自定义模板 (配置包中的内置模板忽略)
+func importTemplates(tx *gorm.DB, templates []database.Template, mode string, count *importCount) error {
+	for _, incoming := range templates {
+		if incoming.BuiltIn {
+			continue
+		}
+		incoming.ID = 0
+		var existing database.Template
+		if tx.Where("name = ? AND built_in = ?", incoming.Name, false).First(&existing).Error == nil {
+			switch mode {
+			case conflictSkip:
+				count.Skipped++
+				continue
+			case conflictRename:
+				incoming.Name += " (imported)"
+			case conflictOverwrite:
+				incoming.ID, incoming.CreatedAt = existing.ID, existing.CreatedAt
+				if err := tx.Save(&incoming).Error; err != nil {
+					return fmt.Errorf("template %s: %w", incoming.Name, err)
+				}
+				count.Updated++
+				continue
+			}
+		}
+		if err := tx.Create(&incoming).Error; err != nil {
+			return fmt.Errorf("template %s: %w", incoming.Name, err)
+		}
+		count.Created++
+	}
+	return nil
+}
+
+// importForwardRules 导入转发规则，按域名+匹配方式+匹配地址识别已有规则；所属域名不存在时跳过
+func importForwardRules(tx *gorm.DB, rules []bundleForwardRule, domainIDs map[string]uint, mode string, count *importCount, warnings *[]string) error {
+	for _, r := range rules {
+		incoming := r.ForwardRule
+		domainName := strings.ToLower(strings.TrimSpace(r.Domain))
+		domainID, ok := domainIDs[domainName]
+		if !ok {
+			var d database.Domain
+			if tx.Where("LOWER(name) = ?", domainName).First(&d).Error != nil {
+				*warnings = append(*warnings, fmt.Sprintf("forward rule %s@%s: domain not found, skipped", incoming.MatchAddr, r.Domain))
+				count.Skipped++
+				continue
+			}
+			domainID = d.ID
+		}
+		incoming.ID = 0
+		incoming.DomainID = domainID
+
+		var existing database.ForwardRule
+		if tx.Where("domain_id = ? AND match_type = ? AND match_addr = ?", domainID, incoming.MatchType, incoming.MatchAddr).
+			First(&existing).Error == nil {
+			if mode != conflictOverwrite {
+				count.Skipped++
+				continue
+			}
+			incoming.ID, incoming.CreatedAt = existing.ID, existing.CreatedAt
+			if err := tx.Save(&incoming).Error; err != nil {
+				return fmt.Errorf("forward rule %d: %w", existing.ID, err)
+			}
+			count.Updated++
+			continue
+		}
+		if err := tx.Create(&incoming).Error; err != nil {
+			return fmt.Errorf("forward rule %s@%s: %w", incoming.MatchAddr, r.Domain, err)
+		}
+		count.Created++
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package api
+
+import "testing"
+
+func TestConfigBundleSecrets(t *testing.T) {
+	sealed, err := sealSecret("s3cret", "pass")
+	if err != nil || sealed == "" || sealed == "s3cret" {
+		t.Fatalf("sealSecret = %q, %v", sealed, err)
+	}
+	if empty, _ := sealSecret("s3cret", ""); empty != "" {
+		t.Errorf("secret exported without passphrase: %q", empty)
+	}
+	if plain, err := openSecret(sealed, "pass"); err != nil || plain != "s3cret" {
+		t.Errorf("openSecret = %q, %v", plain, err)
+	}
+	if _, err := openSecret(sealed, "wrong"); err == nil {
+		t.Error("wrong passphrase should fail")
+	}
+	if _, err := openSecret(sealed, ""); err == nil {
+		t.Error("missing passphrase should fail")
+	}
+
+	for key, want := range map[string]bool{
+		"enable_receiver": true, "receiver_port": true, "cleanup_days": true,
+		"receiver_tls_cert": false, "receiver_contact_group_id": false, "jwt_secret": false, "port": false,
+	} {
+		if got := bundleSettingKey(key); got != want {
+			t.Errorf("bundleSettingKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"goemail/internal/cert"
+	"goemail/internal/config"
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DashboardHandler 仪表盘聚合数据 (一次请求返回发送、收件、转发、队列、营销任务与证书概况)
+// GET /api/v1/dashboard
+func DashboardHandler(c *gin.Context) {
+	stats, err := database.GetStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	startOfDay := time.Now().Truncate(24 * time.Hour)
+
+	// 收件箱：单次条件聚合
+	var inbox struct {
+		Total  int64
+		Unread int64
+		Today  int64
+	}
+	database.DB.Model(&database.Inbox{}).
+		Select("COUNT(*) AS total, "+
+			"COALESCE(SUM(CASE WHEN is_read THEN 0 ELSE 1 END), 0) AS unread, "+
+			"COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0) AS today", startOfDay).
+		Scan(&inbox)
+
+	// 转发日志：单次条件聚合
+	var forward struct {
+		Total   int64
+		Success int64
+		Failed  int64
+		Pending int64
+		Today   int64
+	}
+	database.DB.Model(&database.ForwardLog{}).
+		Select("COUNT(*) AS total, "+
+			"COALESCE(SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END), 0) AS success, "+
+			"COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) AS failed, "+
+			"COALESCE(SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END), 0) AS pending, "+
+			"COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0) AS today", startOfDay).
+		Scan(&forward)
+
+	// 队列与营销任务：按状态分组计数
+	queue := statusCounts(&database.EmailQueue{}, "pending", "processing", "deferred", "failed", "dead")
+	campaigns := statusCounts(&database.Campaign{}, "draft", "scheduled", "processing", "paused", "completed", "failed")
+
+	// 死信汇总：硬退信数量、近 24 小时新增及最早一条的时间
+	var deadLetters struct {
+		HardBounce int64
+		Last24h    int64
+	}
+	database.DB.Model(&database.EmailQueue{}).
+		Select("COALESCE(SUM(CASE WHEN hard_bounce THEN 1 ELSE 0 END), 0) AS hard_bounce, "+
+			"COALESCE(SUM(CASE WHEN updated_at >= ? THEN 1 ELSE 0 END), 0) AS last24h", time.Now().Add(-24*time.Hour)).
+		Where("status = 'dead'").
+		Scan(&deadLetters)
+	var oldestDead database.EmailQueue
+	var oldestDeadAt *time.Time
+	if database.DB.Where("status = 'dead'").Order("updated_at asc").Select("updated_at").First(&oldestDead).Error == nil {
+		oldestDeadAt = &oldestDead.UpdatedAt
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"send": stats,
+		"inbox": gin.H{
+			"total":       inbox.Total,
+			"unread":      inbox.Unread,
+			"today_count": inbox.Today,
+		},
+		"forward": gin.H{
+			"total":   forward.Total,
+			"success": forward.Success,
+			"failed":  forward.Failed,
+			"pending": forward.Pending,
+			"today":   forward.Today,
+		},
+		"queue": gin.H{
+			"depth":     queue["pending"] + queue["processing"] + queue["deferred"] + queue["failed"],
+			"by_status": queue,
+			"dead_letters": gin.H{
+				"total":       queue["dead"],
+				"hard_bounce": deadLetters.HardBounce,
+				"last_24h":    deadLetters.Last24h,
+				"oldest_at":   oldestDeadAt,
+			},
+		},
+		"campaigns":    campaigns,
+		"certificates": cert.GetCertificateSummary(),
+		"receiver": gin.H{
+			"enabled": config.AppConfig.EnableReceiver,
+			"port":    config.AppConfig.ReceiverPort,
+		},
+		"connectivity": mailer.GetConnectivityStatus(),
+		"version":      config.Version,
+		"generated_at": time.Now(),
+	})
+}
+
+// statusCounts 按 status 分组统计，未出现的状态补 0
+func statusCounts(model interface{}, statuses ...string) map[string]int64 {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	database.DB.Model(model).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+
+	counts := make(map[string]int64, len(statuses))
+	for _, s := range statuses {
+		counts[s] = 0
+	}
+	var total int64
+	for _, r := range rows {
+		counts[r.Status] = r.Count
+		total += r.Count
+	}
+	counts["total"] = total
+	return counts
+}
+
+// GetDigestHandler 预览每日摘要的统计内容 (过去 24 小时)
+// GET /api/v1/digest
+func GetDigestHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, mailer.BuildDigest(time.Now()))
+}
+
+// SendDigestHandler 立即发送一次每日摘要 (用于验证收件地址与通道)
+// POST /api/v1/digest/send
+func SendDigestHandler(c *gin.Context) {
+	digest, err := mailer.SendDigest()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Digest queued", "digest": digest})
+}
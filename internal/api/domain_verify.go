@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publicDNSServer 自动模式下优先使用的公共 DNS (绕过本地缓存)
+const publicDNSServer = "8.8.8.8:53"
+
+// publicDNSProbeTTL 公共 DNS 可达性探测结果的缓存时间
+const publicDNSProbeTTL = 10 * time.Minute
+
+var (
+	publicDNSMu       sync.Mutex
+	publicDNSOK       bool
+	publicDNSProbedAt time.Time
+)
+
+// domainCheck 单项 DNS 验证结果
+type domainCheck struct {
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// dnsResolver 返回连接指定 DNS 服务器 (host:port) 的解析器
+func dnsResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// verifyResolver 按 domain_verify_resolver 选择验证使用的解析器
+// 自动模式下探测公共 DNS 是否可达 (如国内网络环境可能不可达)，结果缓存 publicDNSProbeTTL
+func verifyResolver() *net.Resolver {
+	setting := strings.TrimSpace(config.AppConfig.DomainVerifyResolver)
+	switch {
+	case strings.EqualFold(setting, "system"):
+		return net.DefaultResolver
+	case setting != "":
+		if _, _, err := net.SplitHostPort(setting); err != nil {
+			setting = net.JoinHostPort(setting, "53")
+		}
+		return dnsResolver(setting)
+	}
+
+	publicDNSMu.Lock()
+	defer publicDNSMu.Unlock()
+	if time.Since(publicDNSProbedAt) > publicDNSProbeTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := dnsResolver(publicDNSServer).LookupHost(ctx, "google.com")
+		cancel()
+		publicDNSOK = err == nil
+		publicDNSProbedAt = time.Now()
+	}
+	if publicDNSOK {
+		return dnsResolver(publicDNSServer)
+	}
+	return net.DefaultResolver
+}
+
+// verifyTimeout 域名验证的整体超时
+func verifyTimeout() time.Duration {
+	if config.AppConfig.DomainVerifyTimeout > 0 {
+		return time.Duration(config.AppConfig.DomainVerifyTimeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// txtCheck 查询 TXT 记录并判断是否存在满足 match 的记录
+func txtCheck(ctx context.Context, resolver *net.Resolver, name string, match func(string) bool) (bool, error) {
+	txts, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	for _, txt := range txts {
+		if match(txt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mailHostName 返回域名的邮件主机名 (配置了前缀时为 前缀.域名，否则为根域名)
+func mailHostName(domain database.Domain) string {
+	if prefix := strings.Trim(domain.MailSubdomainPrefix, ". "); prefix != "" {
+		return prefix + "." + domain.Name
+	}
+	return domain.Name
+}
+
+// hostCheck 查询主机名是否存在 A/AAAA 记录
+func hostCheck(ctx context.Context, resolver *net.Resolver, host string) (bool, error) {
+	addrs, err := resolver.LookupHost(ctx, host)
+	return err == nil && len(addrs) > 0, err
+}
+
+// ptrResult 反向解析检查结果
+type ptrResult struct {
+	ip   string
+	name string
+}
+
+// ptrCheck 检查服务器 IP 的 PTR 记录是否指向邮件主机名
+// 服务器 IP 优先取域名 source_ip / 全局 outbound_source_ip，未配置时使用邮件主机名解析出的地址
+func ptrCheck(ctx context.Context, resolver *net.Resolver, mailHost, serverIP string, out *ptrResult) (bool, error) {
+	ips := []string{serverIP}
+	if serverIP == "" {
+		addrs, err := resolver.LookupHost(ctx, mailHost)
+		if err != nil {
+			return false, err
+		}
+		ips = addrs
+	}
+	var lastErr error
+	for _, ip := range ips {
+		names, err := resolver.LookupAddr(ctx, ip)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		out.ip = ip
+		for _, name := range names {
+			out.name = strings.TrimSuffix(name, ".")
+			if strings.EqualFold(out.name, mailHost) {
+				return true, nil
+			}
+		}
+	}
+	if out.ip == "" && len(ips) > 0 {
+		out.ip = ips[0]
+	}
+	return false, lastErr
+}
+
+// runDomainChecks 并发执行 MX / SPF / DKIM / DMARC / A / PTR 查询，返回各项结果及耗时
+func runDomainChecks(ctx context.Context, resolver *net.Resolver, domain database.Domain, serverIP string, ptr *ptrResult) map[string]domainCheck {
+	name, selector, mailHost := domain.Name, domain.DKIMSelector, mailHostName(domain)
+	checks := map[string]func() (bool, error){
+		"root_a": func() (bool, error) { return hostCheck(ctx, resolver, name) },
+		"mail_a": func() (bool, error) { return hostCheck(ctx, resolver, mailHost) },
+		"ptr":    func() (bool, error) { return ptrCheck(ctx, resolver, mailHost, serverIP, ptr) },
+		"mx": func() (bool, error) {
+			mxs, err := resolver.LookupMX(ctx, name)
+			return err == nil && len(mxs) > 0, err
+		},
+		"spf": func() (bool, error) {
+			// 宽松匹配: 只要包含 v=spf1 即可
+			return txtCheck(ctx, resolver, name, func(txt string) bool { return strings.Contains(txt, "v=spf1") })
+		},
+		"dkim": func() (bool, error) {
+			return txtCheck(ctx, resolver, selector+"._domainkey."+name, func(txt string) bool { return strings.Contains(txt, "v=DKIM1") })
+		},
+		"dmarc": func() (bool, error) {
+			return txtCheck(ctx, resolver, "_dmarc."+name, func(txt string) bool { return strings.HasPrefix(txt, "v=DMARC1") })
+		},
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]domainCheck, len(checks))
+	for key, check := range checks {
+		wg.Add(1)
+		go func(key string, check func() (bool, error)) {
+			defer wg.Done()
+			start := time.Now()
+			ok, err := check()
+			result := domainCheck{OK: ok, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[key] = result
+			mu.Unlock()
+		}(key, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// VerifyDomainHandler 验证域名的 MX / SPF / DKIM / DMARC / A / PTR 记录并保存结果
+// 返回域名信息及 checks (各项是否通过、耗时与错误)
+func VerifyDomainHandler(c *gin.Context) {
+	id := c.Param("id")
+	var domain database.Domain
+	if err := database.DB.First(&domain, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout())
+	defer cancel()
+	serverIP := strings.TrimSpace(domain.SourceIP)
+	if serverIP == "" {
+		serverIP = strings.TrimSpace(config.AppConfig.OutboundSourceIP)
+	}
+	var ptr ptrResult
+	checks := runDomainChecks(ctx, verifyResolver(), domain, serverIP, &ptr)
+
+	domain.MXVerified = checks["mx"].OK
+	domain.SPFVerified = checks["spf"].OK
+	domain.DKIMVerified = checks["dkim"].OK
+	domain.DMARCVerified = checks["dmarc"].OK
+	domain.RootAVerified = checks["root_a"].OK
+	domain.MailAVerified = checks["mail_a"].OK
+	domain.PTRVerified = checks["ptr"].OK
+	domain.PTRName = ptr.name
+	domain.PTRIP = ptr.ip
+	database.DB.Save(&domain)
+
+	c.JSON(http.StatusOK, struct {
+		database.Domain
+		Checks map[string]domainCheck `json:"checks"`
+	}{domain, checks})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 分享链接有效期限制
+const (
+	fileShareDefaultTTL = 24 * time.Hour
+	fileShareMaxTTL     = 30 * 24 * time.Hour
+)
+
+// fileShareSignature 计算附件分享链接签名: HMAC-SHA256(JWTSecret, "file-share:<id>:<exp>")
+// 修改 jwt_secret 会使所有已发出的分享链接失效
+func fileShareSignature(id uint, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	fmt.Fprintf(mac, "file-share:%d:%d", id, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyFileShare 校验分享链接的签名与有效期 (签名使用常量时间比较)
+func verifyFileShare(id uint, expParam, sig string, now time.Time) bool {
+	exp, err := strconv.ParseInt(expParam, 10, 64)
+	if err != nil || sig == "" {
+		return false
+	}
+	if now.Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(fileShareSignature(id, exp)))
+}
+
+// ShareFileHandler 生成附件的限时公开下载链接
+// POST /api/v1/files/:id/share  body: {"expires_in": 秒数} (可选，默认 24 小时，最长 30 天)
+func ShareFileHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var file database.AttachmentFile
+	if err := database.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	var req struct {
+		ExpiresIn int64 `json:"expires_in"`
+	}
+	// 请求体可省略
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+	ttl := fileShareDefaultTTL
+	if req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be positive"})
+		return
+	}
+	// 先按秒比较再换算，过大的秒数乘以 time.Second 会溢出为负数或极小的时长
+	if maxSeconds := int64(fileShareMaxTTL / time.Second); req.ExpiresIn > maxSeconds {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in must not exceed %d seconds", maxSeconds)})
+		return
+	}
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	exp := expiresAt.Unix()
+	path := fmt.Sprintf("/api/v1/files/shared/%d?exp=%d&sig=%s", file.ID, exp, fileShareSignature(file.ID, exp))
+	c.JSON(http.StatusOK, gin.H{
+		"url":        requestBaseURL(c) + path,
+		"expires_at": expiresAt,
+	})
+}
+
+// SharedFileHandler 通过签名链接下载附件 (无需登录)
+// GET /api/v1/files/shared/:id?exp=...&sig=...
+func SharedFileHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || !verifyFileShare(uint(id), c.Query("exp"), c.Query("sig"), time.Now()) {
+		// 签名错误与过期统一返回 403，不透露文件是否存在
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	var file database.AttachmentFile
+	if err := database.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if _, err := os.Stat(file.FilePath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not on disk"})
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	serveAttachmentFile(c, file)
+}
+
+// requestBaseURL 返回对外访问地址：优先 base_url 配置，否则按当前请求推断
+func requestBaseURL(c *gin.Context) string {
+	if base := strings.TrimSuffix(config.AppConfig.BaseURL, "/"); base != "" {
+		return base
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestVerifyFileShare(t *testing.T) {
+	config.AppConfig.JWTSecret = "test-secret-for-file-share"
+	now := time.Unix(1700000000, 0)
+	exp := now.Add(time.Hour).Unix()
+	sig := fileShareSignature(7, exp)
+	valid := func(id uint, e int64, s string, at time.Time) bool {
+		return verifyFileShare(id, strconv.FormatInt(e, 10), s, at)
+	}
+	if !valid(7, exp, sig, now) {
+		t.Error("valid signature rejected")
+	}
+	if valid(8, exp, sig, now) {
+		t.Error("signature accepted for another file")
+	}
+	if valid(7, exp+1, sig, now) {
+		t.Error("signature accepted for a different expiry")
+	}
+	if valid(7, exp, sig, now.Add(2*time.Hour)) {
+		t.Error("expired link accepted")
+	}
+	if verifyFileShare(7, "abc", sig, now) || verifyFileShare(7, strconv.FormatInt(exp, 10), "", now) {
+		t.Error("malformed parameters accepted")
+	}
+
+	config.AppConfig.JWTSecret = "rotated-secret-value-xyz"
+	if valid(7, exp, sig, now) {
+		t.Error("signature still valid after secret rotation")
+	}
+}
+
+func TestShareFileRejectsOverflowingExpiry(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	db.AutoMigrate(&database.AttachmentFile{})
+	db.Create(&database.AttachmentFile{Filename: "a.txt"})
+	prevDB := database.DB
+	database.DB = db
+	defer func() { database.DB = prevDB }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/files/:id/share", ShareFileHandler)
+	share := func(expiresIn int64) int {
+		req := httptest.NewRequest(http.MethodPost, "/files/1/share", strings.NewReader(fmt.Sprintf(`{"expires_in":%d}`, expiresIn)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 9223372037 秒乘以 time.Second 会溢出为负数，不能因此绕过最长有效期
+	for _, n := range []int64{int64(fileShareMaxTTL/time.Second) + 1, 9223372037, 1 << 62} {
+		if code := share(n); code != http.StatusBadRequest {
+			t.Errorf("expires_in=%d status = %d, want 400", n, code)
+		}
+	}
+	if code := share(3600); code != http.StatusOK {
+		t.Errorf("expires_in=3600 status = %d, want 200", code)
+	}
+}
+
+func TestInlineContentType(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"image/png", "image/png", true},
+		{"Application/PDF; name=a.pdf", "application/pdf", true},
+		{"text/plain; charset=gbk", "text/plain; charset=gbk", true},
+		{"text/plain", "text/plain; charset=utf-8", true},
+		{"text/html", "", false},
+		{"image/svg+xml", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		if got, ok := inlineContentType(c.in); got != c.want || ok != c.ok {
+			t.Errorf("inlineContentType(%q) = %q, %v; want %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
+	"log"
 	mathrand "math/rand"
+	"mime"
 	"net"
 	"net/http"
 	"os"
@@ -32,11 +35,15 @@ import (
 	"goemail/internal/config"
 	"goemail/internal/crypto"
 	"goemail/internal/database"
+	"goemail/internal/locale"
 	"goemail/internal/mailer"
+	"goemail/internal/receiver"
 	"goemail/internal/security"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 var (
@@ -134,6 +141,8 @@ var (
 	loginLimiter = NewRateLimiter(10, time.Minute)
 	// 验证码接口限制：每分钟最多 20 次请求
 	captchaLimiter = NewRateLimiter(20, time.Minute)
+	// 壁纸接口限制：每分钟最多 30 次请求
+	wallpaperLimiter = NewRateLimiter(30, time.Minute)
 )
 
 // RateLimitMiddleware 速率限制中间件
@@ -159,6 +168,11 @@ func GetCaptchaLimiter() *RateLimiter {
 	return captchaLimiter
 }
 
+// GetWallpaperLimiter 获取壁纸限制器 (供 main.go 使用)
+func GetWallpaperLimiter() *RateLimiter {
+	return wallpaperLimiter
+}
+
 // CheckUpdateHandler 检查 GitHub 更新 (带缓存的后端代理)
 func CheckUpdateHandler(c *gin.Context) {
 	releaseMutex.Lock()
@@ -245,13 +259,14 @@ func AuthMiddleware() gin.HandlerFunc {
 		// 2. 尝试验证 API Key (sk_...)
 		if strings.HasPrefix(tokenString, "sk_") {
 			var apiKey database.APIKey
-			if err := database.DB.Where("key = ?", tokenString).First(&apiKey).Error; err == nil {
+			if err := database.DB.Where(&database.APIKey{Key: tokenString}).First(&apiKey).Error; err == nil {
 				// 权限限制：API Key 仅用于发送邮件和获取统计，禁止管理操作
 				// 简单的基于路径的权限控制
 				path := c.Request.URL.Path
 				allowed := strings.HasPrefix(path, "/api/v1/send") ||
 					strings.HasPrefix(path, "/api/v1/stats") ||
-					strings.HasPrefix(path, "/api/v1/files") // 允许上传附件
+					strings.HasPrefix(path, "/api/v1/files") || // 允许上传附件
+					(strings.HasPrefix(path, "/api/v1/queue/") && strings.HasSuffix(path, "/stream")) // 投递状态事件流
 
 				if !allowed {
 					c.JSON(http.StatusForbidden, gin.H{"error": "API Key does not have permission to access this endpoint"})
@@ -272,18 +287,93 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// Captcha Store (带过期时间)
-type captchaEntry struct {
-	Code      string
-	ExpiresAt time.Time
+// Captcha Store (验证码有效期 5 分钟，最多保存 1000 个，超出时淘汰最久未使用的)
+var captchaStore = newTTLCache[string](1000, 5*time.Minute)
+
+// loginFailures 按连接对端 IP 记录的登录失败次数 (最后一次失败 15 分钟后清零)，用于 login_captcha_after
+// 使用 RemoteIP 而非 ClientIP：X-Forwarded-For 可由客户端任意伪造，每次换一个值即可绕过阈值
+var loginFailures = newTTLCache[int](10000, 15*time.Minute)
+
+// captchaRequired 该 IP 登录时是否必须提供验证码
+func captchaRequired(ip string) bool {
+	after := config.AppConfig.LoginCaptchaAfter
+	if after <= 0 {
+		return true
+	}
+	failures, _ := loginFailures.Get(ip)
+	return failures >= after
+}
+
+// recordLoginFailure 记录一次登录失败
+func recordLoginFailure(ip string) {
+	loginFailures.Update(ip, func(failures int, _ bool) int { return failures + 1 })
 }
 
-var (
-	captchaStore      = make(map[string]captchaEntry)
-	captchaMutex      sync.Mutex
-	captchaExpiration = 5 * time.Minute // 验证码有效期 5 分钟
-	captchaMaxSize    = 1000            // 最大存储数量
-)
+// loginClientIP 登录失败计数与验证码判定使用的客户端地址
+// 默认使用 TCP 连接地址，伪造 X-Forwarded-For 无法绕过计数。部署在反向代理后时，若未在 trusted_proxies 中配置代理地址，
+// 所有用户共用代理地址的计数，任一用户登录成功都会将其清零；配置后从右向左取第一个不属于受信代理的转发地址
+func loginClientIP(c *gin.Context) string {
+	remote := c.RemoteIP()
+	proxies := parseIPNets(config.AppConfig.TrustedProxies)
+	if !ipInNets(remote, proxies) {
+		return remote
+	}
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !ipInNets(hop, proxies) {
+			return hop
+		}
+	}
+	return remote
+}
+
+// parseIPNets 解析逗号分隔的 IP / CIDR 列表，单个 IP 视为 /32 (IPv6 为 /128)，无效项忽略
+func parseIPNets(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil {
+				bits := len(ip) * 8
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(item); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func ipInNets(addr string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginPrecheckHandler 登录前查询当前 IP 是否需要验证码
+// GET /api/v1/login/precheck
+func LoginPrecheckHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"captcha_required": captchaRequired(loginClientIP(c))})
+}
 
 // LoginHandler 登录接口
 func LoginHandler(c *gin.Context) {
@@ -299,31 +389,29 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// 1. 验证码校验
+	// 提供了验证码时始终校验；未提供时，仅在 login_captcha_after 模式下且该 IP 失败次数未达阈值才放行
+	ip := loginClientIP(c)
 	if req.CaptchaID != "" {
-		captchaMutex.Lock()
-		entry, ok := captchaStore[req.CaptchaID]
-		delete(captchaStore, req.CaptchaID) // 一次性
-		captchaMutex.Unlock()
-
-		// 验证码过期检查 (使用常量时间比较防止时序攻击)
-		if !ok || subtle.ConstantTimeCompare([]byte(entry.Code), []byte(req.CaptchaCode)) != 1 || time.Now().After(entry.ExpiresAt) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired captcha code"})
+		code, ok := captchaStore.Take(req.CaptchaID) // 一次性，过期条目视为不存在
+
+		// 使用常量时间比较防止时序攻击
+		if !ok || subtle.ConstantTimeCompare([]byte(code), []byte(req.CaptchaCode)) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired captcha code", "captcha_required": true})
 			return
 		}
-	} else {
-		// 为了安全，强制要求验证码（除非是 API 调用，但这里是 Login 接口通常给前端用）
-		// 这里暂且允许空验证码以兼容旧版，或者根据 header 判断？
-		// 实际上前端都会发。如果是 API 脚本登录，可能没有验证码。
-		// 为了防止爆破，建议强制。但为了兼容旧代码调试，可以暂时放过？
-		// 既然用户要求“增加验证码”，就应该强制。
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Captcha code required"})
+	} else if captchaRequired(ip) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Captcha code required", "captcha_required": true})
 		return
 	}
+	loginFailed := func() {
+		recordLoginFailure(ip)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials", "captcha_required": captchaRequired(ip)})
+	}
 
 	// 2. 密码校验 (支持明文/Hash/Bcrypt 自动升级)
 	var user database.User
 	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		loginFailed()
 		return
 	}
 
@@ -369,9 +457,10 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	if !passwordMatched {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		loginFailed()
 		return
 	}
+	loginFailures.Delete(ip)
 
 	// 3. 检查是否启用了两步验证 (TOTP)
 	if user.TOTPEnabled && user.TOTPSecret != "" {
@@ -468,6 +557,13 @@ func CreateSMTPHandler(c *gin.Context) {
 		database.DB.Model(&database.SMTPConfig{}).Where("is_default = ?", true).Update("is_default", false)
 	}
 
+	clientKey := smtp.ClientKey
+	smtp.ClientKey = ""
+	if err := applySMTPClientCert(&smtp, smtp.ClientCert, clientKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 加密 SMTP 密码
 	if smtp.Password != "" {
 		encrypted, err := crypto.Encrypt(smtp.Password, config.AppConfig.JWTSecret)
@@ -483,9 +579,45 @@ func CreateSMTPHandler(c *gin.Context) {
 		return
 	}
 	smtp.Password = "******"
+	maskSMTPClientKey(&smtp)
 	c.JSON(http.StatusOK, smtp)
 }
 
+// applySMTPClientCert 校验并设置通道的 TLS 客户端证书：证书为空表示移除，私钥为空或 ****** 时沿用已保存的私钥
+func applySMTPClientCert(smtp *database.SMTPConfig, cert, key string) error {
+	cert = strings.TrimSpace(cert)
+	if cert == "" {
+		smtp.ClientCert, smtp.ClientKey = "", ""
+		return nil
+	}
+	if key == "" || key == "******" {
+		if smtp.ClientKey == "" {
+			return errors.New("client_key is required when client_cert is set")
+		}
+		existing, err := crypto.Decrypt(smtp.ClientKey, config.AppConfig.JWTSecret)
+		if err != nil {
+			return errors.New("stored client key cannot be decrypted, please provide it again")
+		}
+		key = existing
+	}
+	if _, err := tls.X509KeyPair([]byte(cert), []byte(key)); err != nil {
+		return fmt.Errorf("invalid client certificate/key pair: %w", err)
+	}
+	encrypted, err := crypto.Encrypt(key, config.AppConfig.JWTSecret)
+	if err != nil {
+		return errors.New("failed to encrypt client key")
+	}
+	smtp.ClientCert, smtp.ClientKey = cert, encrypted
+	return nil
+}
+
+// maskSMTPClientKey 脱敏客户端私钥
+func maskSMTPClientKey(smtp *database.SMTPConfig) {
+	if smtp.ClientKey != "" {
+		smtp.ClientKey = "******"
+	}
+}
+
 func UpdateSMTPHandler(c *gin.Context) {
 	id := c.Param("id")
 	var smtp database.SMTPConfig
@@ -519,26 +651,76 @@ func UpdateSMTPHandler(c *gin.Context) {
 	}
 	smtp.SSL = req.SSL
 	smtp.IsDefault = req.IsDefault
+	smtp.SkipTLSVerify = req.SkipTLSVerify
+	smtp.TLSServerName = strings.TrimSpace(req.TLSServerName)
+	smtp.SendInterval = req.SendInterval
+	smtp.AllowedDomains = strings.TrimSpace(req.AllowedDomains)
+	if err := applySMTPClientCert(&smtp, req.ClientCert, req.ClientKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.DB.Save(&smtp).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	maskSMTPClientKey(&smtp)
 	c.JSON(http.StatusOK, smtp)
 }
 
 func ListSMTPHandler(c *gin.Context) {
 	smtps := []database.SMTPConfig{}
-	database.DB.Order("is_default desc, id asc").Find(&smtps)
+	query := database.DB.Model(&database.SMTPConfig{})
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ? OR host LIKE ? OR username LIKE ?", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	page, limit, paged := listPagination(c)
+	var total int64
+	if paged {
+		query.Count(&total)
+		query = query.Offset((page - 1) * limit).Limit(limit)
+	}
+	query.Order("is_default desc, id asc").Find(&smtps)
 
-	// 脱敏密码
+	// 脱敏密码与客户端私钥
 	for i := range smtps {
 		if smtps[i].Password != "" {
 			smtps[i].Password = "******"
 		}
+		maskSMTPClientKey(&smtps[i])
 	}
 
-	c.JSON(http.StatusOK, smtps)
+	respondList(c, smtps, total, page, limit, paged)
+}
+
+// listPagination 解析列表分页参数 (?page=&limit=)，两者均未提供时不分页 (保持返回完整数组)
+func listPagination(c *gin.Context) (page, limit int, paged bool) {
+	if c.Query("page") == "" && c.Query("limit") == "" {
+		return 0, 0, false
+	}
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 20
+	}
+	return page, limit, true
+}
+
+// respondList 输出列表：分页时返回 {data, total, page, limit}，否则直接返回数组
+func respondList(c *gin.Context, data interface{}, total int64, page, limit int, paged bool) {
+	if !paged {
+		c.JSON(http.StatusOK, data)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  data,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
 }
 
 // parseIDParam 解析并验证 URL 路径中的 ID 参数
@@ -574,29 +756,101 @@ func DownloadFileHandler(c *gin.Context) {
 		return
 	}
 
-	c.FileAttachment(file.FilePath, file.Filename)
+	serveAttachmentFile(c, file)
+}
+
+// inlineContentTypes 允许 ?disposition=inline 时由浏览器直接展示的类型
+// text/html、image/svg+xml 等可携带脚本的类型不在其中，始终以下载方式返回
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wav":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// inlineContentType 返回可安全内联展示的规范化 MIME 类型，不在白名单时返回 false
+func inlineContentType(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !inlineContentTypes[mediaType] {
+		return "", false
+	}
+	if mediaType == "text/plain" {
+		charset := params["charset"]
+		if charset == "" {
+			charset = "utf-8"
+		}
+		return mime.FormatMediaType(mediaType, map[string]string{"charset": charset}), true
+	}
+	return mediaType, true
+}
+
+// serveAttachmentFile 输出附件文件，默认以附件方式下载
+// ?disposition=inline 且类型在白名单内时按存储的 ContentType 内联展示；收件附件加密存储时解密后输出
+func serveAttachmentFile(c *gin.Context, file database.AttachmentFile) {
+	disposition := "attachment"
+	contentType := file.ContentType
+	if c.Query("disposition") == "inline" {
+		if ct, ok := inlineContentType(file.ContentType); ok {
+			disposition, contentType = "inline", ct
+		}
+	}
+	if disposition == "attachment" && contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	if file.Source != "inbox" {
+		c.Header("Content-Type", contentType)
+		c.File(file.FilePath)
+		return
+	}
+	data, err := receiver.ReadInboxFile(file.FilePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment: " + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
 }
 
 // --- Domain Management ---
 
+// generateDomainDKIMKey 生成域名的 2048 位 RSA DKIM 密钥对 (PEM)
+func generateDomainDKIMKey() (string, string, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	privDER := x509.MarshalPKCS1PrivateKey(privateKey)
+	privPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privDER}))
+	pubDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	return privPEM, pubPEM, nil
+}
+
 func CreateDomainHandler(c *gin.Context) {
 	var req struct {
-		Name string `json:"name"`
+		Name                string `json:"name"`
+		CreateBounceMailbox bool   `json:"create_bounce_mailbox"` // 同时创建退信邮箱规则 (bounce@ / bounce+*@)
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privPEM, pubPEM, err := generateDomainDKIMKey()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate DKIM key"})
 		return
 	}
-	privDER := x509.MarshalPKCS1PrivateKey(privateKey)
-	privPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privDER}))
-	pubDER, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
 
 	domain := database.Domain{
 		Name:           req.Name,
@@ -613,13 +867,83 @@ func CreateDomainHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if req.CreateBounceMailbox {
+		if _, err := receiver.EnsureBounceMailbox(domain.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Domain created but bounce mailbox failed: " + err.Error()})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, domain)
 }
 
+// CreateBounceMailboxHandler 为已有域名创建退信邮箱规则 (重复调用时不会重复创建)
+func CreateBounceMailboxHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var domain database.Domain
+	if err := database.DB.First(&domain, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	rules, err := receiver.EnsureBounceMailbox(domain.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"address": "bounce@" + domain.Name,
+		"rules":   rules,
+	})
+}
+
+// ListBouncesHandler 获取解析出的退信记录 (支持按收件人过滤与分页)
+func ListBouncesHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	query := database.DB.Model(&database.Bounce{})
+	if recipient := c.Query("recipient"); recipient != "" {
+		query = query.Where("recipient = ?", strings.ToLower(recipient))
+	}
+	if c.Query("hard") == "true" {
+		query = query.Where("hard = ?", true)
+	}
+
+	var total int64
+	query.Count(&total)
+	bounces := []database.Bounce{}
+	query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&bounces)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      bounces,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
 func ListDomainHandler(c *gin.Context) {
 	domains := []database.Domain{}
+	query := database.DB.Model(&database.Domain{})
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ?", "%"+keyword+"%")
+	}
+	page, limit, paged := listPagination(c)
+	var total int64
+	if paged {
+		query.Count(&total)
+		query = query.Offset((page - 1) * limit).Limit(limit)
+	}
 	// 预加载关联的证书信息，以便前端展示证书状态
-	database.DB.Preload("Certificate").Find(&domains)
+	query.Preload("Certificate").Order("id asc").Find(&domains)
 
 	// 构建响应，添加证书状态摘要信息
 	type DomainWithCertStatus struct {
@@ -627,6 +951,9 @@ func ListDomainHandler(c *gin.Context) {
 		CertStatus   string `json:"cert_status"`    // valid, warning, critical, expired, none
 		CertDaysLeft int    `json:"cert_days_left"` // 剩余天数，-1 表示无证书
 		CertDomains  string `json:"cert_domains"`   // 证书包含的域名
+
+		Warmup     *mailer.WarmupStatus    `json:"warmup,omitempty"`     // 预热状态 (仅开启预热时返回)
+		Reputation *mailer.ReputationStats `json:"reputation,omitempty"` // 退信率与投诉率统计 (仅配置阈值时返回)
 	}
 
 	result := make([]DomainWithCertStatus, len(domains))
@@ -636,6 +963,14 @@ func ListDomainHandler(c *gin.Context) {
 			CertStatus:   "none",
 			CertDaysLeft: -1,
 		}
+		if d.WarmupEnabled {
+			status := mailer.GetWarmupStatus(d, time.Now())
+			result[i].Warmup = &status
+		}
+		if d.BounceThreshold > 0 || d.ComplaintThreshold > 0 {
+			stats := mailer.DomainReputation(d, time.Now())
+			result[i].Reputation = &stats
+		}
 
 		if d.Certificate != nil {
 			result[i].CertDomains = d.Certificate.Domains
@@ -655,7 +990,7 @@ func ListDomainHandler(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, result)
+	respondList(c, result, total, page, limit, paged)
 }
 
 func DeleteDomainHandler(c *gin.Context) {
@@ -667,7 +1002,7 @@ func DeleteDomainHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
-// UpdateDomainHandler 更新域名配置 (如子域名前缀)
+// UpdateDomainHandler 更新域名配置 (如子域名前缀、Catch-all、联系人自动收集、预热、页脚)
 func UpdateDomainHandler(c *gin.Context) {
 	id := c.Param("id")
 	var domain database.Domain
@@ -678,6 +1013,22 @@ func UpdateDomainHandler(c *gin.Context) {
 
 	var req struct {
 		MailSubdomainPrefix *string `json:"mail_subdomain_prefix"`
+		CatchAll            *bool   `json:"catch_all"`
+		CatchAllForwardTo   *string `json:"catch_all_forward_to"`
+		AutoCaptureContacts *bool   `json:"auto_capture_contacts"`
+
+		WarmupEnabled  *bool    `json:"warmup_enabled"`
+		WarmupStartCap *int     `json:"warmup_start_cap"`
+		WarmupGrowth   *float64 `json:"warmup_growth"`
+		WarmupMaxCap   *int     `json:"warmup_max_cap"`
+
+		FooterHTML *string `json:"footer_html"`
+		FooterText *string `json:"footer_text"`
+
+		SourceIP *string `json:"source_ip"`
+
+		BounceThreshold    *float64 `json:"bounce_threshold"`
+		ComplaintThreshold *float64 `json:"complaint_threshold"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -687,6 +1038,79 @@ func UpdateDomainHandler(c *gin.Context) {
 	if req.MailSubdomainPrefix != nil {
 		domain.MailSubdomainPrefix = strings.TrimSpace(*req.MailSubdomainPrefix)
 	}
+	if req.CatchAll != nil {
+		domain.CatchAll = *req.CatchAll
+	}
+	if req.CatchAllForwardTo != nil {
+		forwardTo := strings.TrimSpace(*req.CatchAllForwardTo)
+		if forwardTo != "" && !strings.Contains(forwardTo, "@") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catch_all_forward_to address"})
+			return
+		}
+		domain.CatchAllForwardTo = forwardTo
+	}
+	if req.AutoCaptureContacts != nil {
+		domain.AutoCaptureContacts = *req.AutoCaptureContacts
+	}
+	if req.FooterHTML != nil {
+		domain.FooterHTML = *req.FooterHTML
+	}
+	if req.FooterText != nil {
+		domain.FooterText = *req.FooterText
+	}
+	if req.SourceIP != nil {
+		sourceIP := strings.TrimSpace(*req.SourceIP)
+		if sourceIP != "" && net.ParseIP(sourceIP) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source_ip"})
+			return
+		}
+		domain.SourceIP = sourceIP
+	}
+	if req.BounceThreshold != nil {
+		if *req.BounceThreshold < 0 || *req.BounceThreshold > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bounce_threshold must be between 0 and 100"})
+			return
+		}
+		domain.BounceThreshold = *req.BounceThreshold
+	}
+	if req.ComplaintThreshold != nil {
+		if *req.ComplaintThreshold < 0 || *req.ComplaintThreshold > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "complaint_threshold must be between 0 and 100"})
+			return
+		}
+		domain.ComplaintThreshold = *req.ComplaintThreshold
+	}
+	if req.WarmupStartCap != nil {
+		if *req.WarmupStartCap < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "warmup_start_cap must be at least 1"})
+			return
+		}
+		domain.WarmupStartCap = *req.WarmupStartCap
+	}
+	if req.WarmupGrowth != nil {
+		if *req.WarmupGrowth < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "warmup_growth must be at least 1"})
+			return
+		}
+		domain.WarmupGrowth = *req.WarmupGrowth
+	}
+	if req.WarmupMaxCap != nil {
+		if *req.WarmupMaxCap < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "warmup_max_cap must not be negative"})
+			return
+		}
+		domain.WarmupMaxCap = *req.WarmupMaxCap
+	}
+	if req.WarmupEnabled != nil {
+		// 从关闭切换为开启时重新从第 1 天开始计算
+		if *req.WarmupEnabled && !domain.WarmupEnabled {
+			start := mailer.WarmupStartDay(time.Now())
+			domain.WarmupStartedAt = &start
+			domain.WarmupSentDate = ""
+			domain.WarmupSentCount = 0
+		}
+		domain.WarmupEnabled = *req.WarmupEnabled
+	}
 
 	if err := database.DB.Save(&domain).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -695,6 +1119,42 @@ func UpdateDomainHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, domain)
 }
 
+// GetDomainReputationHandler 获取域名滚动窗口内的退信率、投诉率统计与信誉保护状态
+func GetDomainReputationHandler(c *gin.Context) {
+	var domain database.Domain
+	if err := database.DB.First(&domain, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"stats":        mailer.DomainReputation(domain, time.Now()),
+		"paused_at":    domain.ReputationPausedAt,
+		"pause_reason": domain.ReputationPauseReason,
+	})
+}
+
+// ResumeDomainReputationHandler 手动解除信誉保护暂停，此前的发送与退信不再计入统计
+// 被暂停的营销任务不会自动恢复，需逐个确认后恢复
+func ResumeDomainReputationHandler(c *gin.Context) {
+	var domain database.Domain
+	if err := database.DB.First(&domain, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	if domain.ReputationPausedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Domain is not paused"})
+		return
+	}
+	now := time.Now()
+	database.DB.Model(&domain).Updates(map[string]interface{}{
+		"reputation_paused_at":    nil,
+		"reputation_pause_reason": "",
+		"reputation_resumed_at":   now,
+	})
+	log.Printf("[Reputation] Domain %s resumed manually", domain.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Domain resumed"})
+}
+
 // BindDomainCertHandler 绑定/解绑域名与证书
 func BindDomainCertHandler(c *gin.Context) {
 	id := c.Param("id")
@@ -735,79 +1195,48 @@ func BindDomainCertHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, domain)
 }
 
-func VerifyDomainHandler(c *gin.Context) {
-	id := c.Param("id")
+// GetDomainDKIMRecordHandler 返回可直接填入 DNS 的 DKIM TXT 记录 (主机名、记录值及按 255 字符拆分的分段)
+func GetDomainDKIMRecordHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
 	var domain database.Domain
 	if err := database.DB.First(&domain, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
 		return
 	}
-
-	// 使用自定义 Resolver 以绕过可能的本地缓存 (尝试使用 Google DNS)
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{Timeout: 5 * time.Second}
-			return d.DialContext(ctx, "udp", "8.8.8.8:53")
-		},
-	}
-	// 如果无法连接 Google DNS (如国内网络环境)，回退到默认 Resolver
-	if _, err := resolver.LookupHost(context.Background(), "google.com"); err != nil {
-		resolver = net.DefaultResolver
+	// 导入的域名可能尚未生成 DKIM 密钥，这不是服务端错误
+	if strings.TrimSpace(domain.DKIMPublicKey) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain has no DKIM key; generate one first"})
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// 1. 验证 MX
-	mxs, err := resolver.LookupMX(ctx, domain.Name)
-	domain.MXVerified = err == nil && len(mxs) > 0
-
-	// 2. 验证 SPF
-	txts, err := resolver.LookupTXT(ctx, domain.Name)
-	domain.SPFVerified = false
-	if err == nil {
-		for _, txt := range txts {
-			// 宽松匹配: 只要包含 v=spf1 即可
-			if strings.Contains(txt, "v=spf1") {
-				domain.SPFVerified = true
-				break
-			}
-		}
+	value, err := mailer.DKIMRecordValue(domain.DKIMPublicKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid DKIM public key: " + err.Error()})
+		return
 	}
-
-	// 3. 验证 DMARC
-	dmarcs, err := resolver.LookupTXT(ctx, "_dmarc."+domain.Name)
-	domain.DMARCVerified = false
-	if err == nil {
-		for _, txt := range dmarcs {
-			if strings.HasPrefix(txt, "v=DMARC1") {
-				domain.DMARCVerified = true
-				break
-			}
-		}
+	selector := domain.DKIMSelector
+	if selector == "" {
+		selector = "default"
 	}
 
-	// 4. 验证 DKIM
-	dkims, err := resolver.LookupTXT(ctx, domain.DKIMSelector+"._domainkey."+domain.Name)
-	domain.DKIMVerified = false
-	if err == nil {
-		for _, txt := range dkims {
-			if strings.Contains(txt, "v=DKIM1") {
-				domain.DKIMVerified = true
-				break
-			}
-		}
+	chunks := mailer.SplitTXT(value)
+	quoted := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		quoted[i] = `"` + chunk + `"`
 	}
 
-	// 5. 验证 A 记录 (网站访问)
-	// 虽然数据库没有存储字段，但可以在返回 JSON 中临时添加，或者前端单独处理
-	// 这里为了完整性，我们检查一下，虽然目前 DB 没存状态
-	// aRecords, _ := resolver.LookupHost(ctx, domain.Name)
-	// hasARecord := len(aRecords) > 0
-
-	database.DB.Save(&domain)
-	c.JSON(http.StatusOK, domain)
+	c.JSON(http.StatusOK, gin.H{
+		"type":     "TXT",
+		"host":     selector + "._domainkey." + domain.Name,
+		"name":     selector + "._domainkey",
+		"selector": selector,
+		"value":    value,
+		"chunks":   chunks,
+		"quoted":   strings.Join(quoted, " "), // 部分 DNS 面板要求以引号分段的形式填写
+	})
 }
 
 // --- Template Management ---
@@ -818,6 +1247,10 @@ func CreateTemplateHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	tpl.BuiltIn = false // 内置模板只能由系统写入
+	if !checkBodySize(c, tpl.Body) {
+		return
+	}
 	if err := database.DB.Create(&tpl).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -832,22 +1265,82 @@ func UpdateTemplateHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
 		return
 	}
+	if tpl.BuiltIn {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in templates are read-only, instantiate a copy first"})
+		return
+	}
 	var req database.Template
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkBodySize(c, req.Body) {
+		return
+	}
 	tpl.Name = req.Name
 	tpl.Subject = req.Subject
 	tpl.Body = req.Body
+	tpl.Category = req.Category
+	tpl.Raw = req.Raw
 	database.DB.Save(&tpl)
 	c.JSON(http.StatusOK, tpl)
 }
 
+// ListTemplateHandler 列出模板，支持 ?category= 按分类过滤、?built_in=true|false 区分模板库与自建模板
 func ListTemplateHandler(c *gin.Context) {
 	tpls := []database.Template{}
-	database.DB.Find(&tpls)
-	c.JSON(http.StatusOK, tpls)
+	query := database.DB.Model(&database.Template{})
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if builtIn := c.Query("built_in"); builtIn != "" {
+		query = query.Where("built_in = ?", builtIn == "true")
+	}
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ? OR subject LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	page, limit, paged := listPagination(c)
+	var total int64
+	if paged {
+		query.Count(&total)
+		query = query.Offset((page - 1) * limit).Limit(limit)
+	}
+	query.Order("built_in asc, id asc").Find(&tpls)
+	respondList(c, tpls, total, page, limit, paged)
+}
+
+// InstantiateTemplateHandler 将模板 (通常是内置模板) 复制为可编辑的自建模板
+func InstantiateTemplateHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var src database.Template
+	if err := database.DB.First(&src, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	c.ShouldBindJSON(&req)
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = src.Name + " (副本)"
+	}
+
+	tpl := database.Template{
+		Name:     name,
+		Subject:  src.Subject,
+		Body:     src.Body,
+		Category: src.Category,
+	}
+	if err := database.DB.Create(&tpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, tpl)
 }
 
 func DeleteTemplateHandler(c *gin.Context) {
@@ -855,18 +1348,209 @@ func DeleteTemplateHandler(c *gin.Context) {
 	if !ok {
 		return
 	}
-	database.DB.Delete(&database.Template{}, id)
+	var tpl database.Template
+	if err := database.DB.First(&tpl, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if tpl.BuiltIn {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in templates cannot be deleted"})
+		return
+	}
+	database.DB.Delete(&tpl)
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
+// templatePlaceholders 把营销正文风格的 {name}/{email} 占位符替换为 html/template 变量引用
+var templatePlaceholders = strings.NewReplacer("{name}", "{{.name}}", "{email}", "{{.email}}")
+
+// renderTemplate 使用 req.Variables 渲染模板的主题与正文并写入 req
+// 失败时已写入错误响应，返回 false
+func renderTemplate(c *gin.Context, tpl database.Template, req *mailer.SendRequest) bool {
+	// 模板库 (含内置模板) 与营销正文共用 {name}/{email} 占位符，渲染前换成对应的模板变量
+	tpl.Subject = templatePlaceholders.Replace(tpl.Subject)
+	tpl.Body = templatePlaceholders.Replace(tpl.Body)
+
+	// 渲染 Subject
+	if tpl.Subject != "" {
+		// 安全检查：禁止高级模板指令，防止模板注入
+		if mailer.ContainsUnsafeTemplateActions(tpl.Subject) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Template subject contains unsafe directives"})
+			return false
+		}
+		t, err := mailer.ParseTemplate(tpl.Name, tpl.Subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse template subject: " + err.Error()})
+			return false
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, req.Variables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template subject: " + err.Error()})
+			return false
+		}
+		req.Subject = buf.String()
+	}
+
+	// 渲染 Body
+	if tpl.Body != "" {
+		// 安全检查：禁止高级模板指令，防止模板注入
+		if mailer.ContainsUnsafeTemplateActions(tpl.Body) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Template body contains unsafe directives"})
+			return false
+		}
+		// 正文可通过 {{template "名称" .}} 引用模板库中的其他模板 (页眉、页脚等)
+		t, err := mailer.ParseTemplate(tpl.Name, tpl.Body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse template body: " + err.Error()})
+			return false
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, req.Variables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template body: " + err.Error()})
+			return false
+		}
+		req.Body = buf.String()
+		if !tpl.Raw {
+			// 净化渲染结果而非模板源码，避免转义破坏模板语法；变量注入的内容同样被覆盖
+			req.Body = sanitizeBody(req.Body)
+		}
+	}
+	return true
+}
+
+// TestTemplateHandler 渲染模板并发送测试邮件到指定地址 (主题加测试前缀，经队列发送)
+// POST /api/v1/templates/:id/test
+func TestTemplateHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var tpl database.Template
+	if err := database.DB.First(&tpl, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	var input struct {
+		To               string                 `json:"to" binding:"required,email"`
+		Variables        map[string]interface{} `json:"variables"`
+		From             string                 `json:"from"`
+		FromName         string                 `json:"from_name"`
+		ChannelID        uint                   `json:"channel_id"`
+		SenderIdentityID uint                   `json:"sender_identity_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: a valid 'to' address is required"})
+		return
+	}
+
+	req := mailer.SendRequest{
+		From:       input.From,
+		FromName:   input.FromName,
+		To:         input.To,
+		ChannelID:  input.ChannelID,
+		TemplateID: tpl.ID,
+		Variables:  input.Variables,
+	}
+	if input.SenderIdentityID > 0 {
+		sender, err := mailer.ResolveSender(input.SenderIdentityID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.From = sender.Email
+		if sender.Name != "" {
+			req.FromName = sender.Name
+		}
+	}
+	from := req.From
+	if from == "" {
+		from = "noreply@" + config.AppConfig.Domain
+	}
+	if err := mailer.CheckSenderDomain(from); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !renderTemplate(c, tpl, &req) {
+		return
+	}
+	req.Subject = locale.T("template.test_subject", req.Subject)
+	req.BypassRecipientInterval = true
+
+	queueID, err := mailer.SendEmailAsync(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue test email: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Test email queued",
+		"queue_id": queueID,
+		"to":       req.To,
+		"subject":  req.Subject,
+	})
+}
+
 // SendHandler 处理邮件发送请求
 func SendHandler(c *gin.Context) {
 	var req mailer.SendRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// multipart/form-data: request 字段为发信参数 JSON，文件部分作为附件流式落盘 (避免大附件以 Base64 驻留内存)
+	var uploads []*uploadedFile
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		var err error
+		req, uploads, err = parseMultipartSend(c)
+		defer func() { cleanupUploads(uploads) }()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 安全检查：拒绝包含换行的头部字段，防止邮件头注入
+	if err := mailer.ValidateHeaders(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid header: " + err.Error()})
+		return
+	}
+	if req.ICal != "" {
+		if err := mailer.ValidateICal(req.ICal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ical: " + err.Error()})
+			return
+		}
+	}
+
+	// 引用发件人身份时统一 From 名称与地址，身份所属域名必须仍已验证
+	if req.SenderIdentityID > 0 {
+		sender, err := mailer.ResolveSender(req.SenderIdentityID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.From = sender.Email
+		if sender.Name != "" {
+			req.FromName = sender.Name
+		}
+	}
+
+	// 有意使用与通道不匹配的 From 域名时，通过请求头跳过检查 (发送时记录审计日志)
+	if c.GetHeader(mailer.ChannelDomainOverrideHeader) == "true" {
+		req.ChannelDomainOverride = fmt.Sprintf("%s header from %s", mailer.ChannelDomainOverrideHeader, c.ClientIP())
+	}
+
+	// 发件域名验证 (启用 require_verified_domain 时)
+	if !req.AllowUnverifiedDomain {
+		from := req.From
+		if from == "" {
+			from = "noreply@" + config.AppConfig.Domain
+		}
+		if err := mailer.CheckSenderDomain(from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// 模板处理逻辑
 	if req.TemplateID > 0 {
 		var tpl database.Template
@@ -874,51 +1558,46 @@ func SendHandler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Template not found"})
 			return
 		}
-
-		// 渲染 Subject
-		if tpl.Subject != "" {
-			// 安全检查：禁止高级模板指令，防止模板注入
-			if containsUnsafeTemplateActions(tpl.Subject) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Template subject contains unsafe directives"})
-				return
-			}
-			t, err := template.New("subject").Parse(tpl.Subject)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse template subject: " + err.Error()})
-				return
-			}
-			var buf bytes.Buffer
-			if err := t.Execute(&buf, req.Variables); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template subject: " + err.Error()})
-				return
-			}
-			req.Subject = buf.String()
+		if !renderTemplate(c, tpl, &req) {
+			return
 		}
+	}
 
-		// 渲染 Body
-		if tpl.Body != "" {
-			// 安全检查：禁止高级模板指令，防止模板注入
-			if containsUnsafeTemplateActions(tpl.Body) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Template body contains unsafe directives"})
-				return
-			}
-			t, err := template.New("body").Parse(tpl.Body)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse template body: " + err.Error()})
-				return
-			}
-			var buf bytes.Buffer
-			if err := t.Execute(&buf, req.Variables); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render template body: " + err.Error()})
-				return
-			}
-			req.Body = buf.String()
+	// 正文大小限制 (模板渲染之后、入队之前)
+	if !checkBodySize(c, req.Body, req.TextBody) {
+		return
+	}
+
+	// 试运行：返回将要发送的原始 MIME 与信封，不落地附件、不入队
+	// ?format=raw 时直接返回 message/rfc822 便于保存为 .eml
+	if req.DryRun {
+		previewReq := req
+		for _, f := range uploads {
+			previewReq.Attachments = append(previewReq.Attachments, mailer.Attachment{Filename: f.Filename, ContentType: f.ContentType, URL: "local://" + f.Path})
+		}
+		preview, err := mailer.PreviewEmail(previewReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to build message: " + err.Error()})
+			return
+		}
+		if c.Query("format") == "raw" {
+			c.Data(http.StatusOK, "message/rfc822", []byte(preview.Raw))
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run": true,
+			"message": preview,
+		})
+		return
+	}
+
+	if c.Query("sync") == "true" {
+		req.Sync = true
 	}
 
 	// 附件处理：落地保存 (File Persistence)
 	if len(req.Attachments) > 0 {
-		saveDir := "data/uploads"
+		saveDir := uploadDir
 		if _, err := os.Stat(saveDir); os.IsNotExist(err) {
 			os.MkdirAll(saveDir, 0755)
 		}
@@ -935,27 +1614,59 @@ func SendHandler(c *gin.Context) {
 			} else if att.URL != "" {
 				sourceType = "api_url"
 				// 安全修复：SSRF 防护，检查是否为内网 URL
-				if security.IsInternalURL(att.URL) {
+				fileData, err = mailer.FetchRemoteAttachment(att.URL)
+				if err == mailer.ErrBlockedURL {
 					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment URL %s is blocked (internal network)", att.Filename)})
 					return
 				}
-				client := &http.Client{Timeout: 30 * time.Second}
-				resp, err := client.Get(att.URL)
-				if err == nil {
-					defer resp.Body.Close()
-					fileData, err = io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment %s download failed: %v", att.Filename, err)})
+					return
 				}
 			}
 
 			// 限制附件大小 (10MB)
-			const MaxFileSize = 10 * 1024 * 1024
-			if err == nil && len(fileData) > MaxFileSize {
+			if err == nil && len(fileData) > maxAttachmentSize {
 				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment %s exceeds limit (10MB)", att.Filename)})
 				return
 			}
 
-			// 2. 保存并记录
+			// 病毒扫描 (ClamAV)
+			if err == nil && len(fileData) > 0 {
+				virus, scanErr := security.ScanAttachment(fileData)
+				if scanErr != nil {
+					c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Attachment %s could not be scanned: %v", att.Filename, scanErr)})
+					return
+				}
+				if virus != "" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment %s rejected: virus detected (%s)", att.Filename, virus)})
+					return
+				}
+			}
+
+			// 同步发送不经过队列，附件无法随队列记录释放，直接以内联内容发送
+			if req.Sync && err == nil && len(fileData) > 0 {
+				req.Attachments[i].Content = base64.StdEncoding.EncodeToString(fileData)
+				req.Attachments[i].URL = ""
+				continue
+			}
+
+			// 2. 保存并记录 (相同内容复用已有文件，仅增加引用计数)
 			if err == nil && len(fileData) > 0 {
+				sum := sha256.Sum256(fileData)
+				contentHash := hex.EncodeToString(sum[:])
+
+				var existing database.AttachmentFile
+				if database.DB.Where("content_hash = ?", contentHash).First(&existing).Error == nil {
+					// 计数未能增加说明记录已被清理任务删除，另存新文件
+					if _, statErr := os.Stat(existing.FilePath); statErr == nil &&
+						database.DB.Model(&existing).Update("ref_count", gorm.Expr("ref_count + ?", 1)).RowsAffected == 1 {
+						req.Attachments[i].Content = ""
+						req.Attachments[i].URL = "local://" + existing.FilePath
+						continue
+					}
+				}
+
 				ext := filepath.Ext(att.Filename)
 				if ext == "" {
 					ext = ".dat"
@@ -973,6 +1684,8 @@ func SendHandler(c *gin.Context) {
 						ContentType: att.ContentType,
 						Source:      sourceType,
 						RelatedTo:   req.To,
+						ContentHash: contentHash,
+						RefCount:    1,
 					}
 					database.DB.Create(&dbFile)
 
@@ -984,6 +1697,30 @@ func SendHandler(c *gin.Context) {
 		}
 	}
 
+	// 上传的附件已在磁盘上，扫描后登记 (同步发送时转为内联内容)
+	for _, f := range uploads {
+		virus, err := scanUpload(f)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Attachment %s could not be scanned: %v", f.Filename, err)})
+			return
+		}
+		if virus != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment %s rejected: virus detected (%s)", f.Filename, virus)})
+			return
+		}
+		att, err := uploadAttachment(f, req.Sync, req.To)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store attachment %s: %v", f.Filename, err)})
+			return
+		}
+		req.Attachments = append(req.Attachments, att)
+	}
+
+	if req.Sync {
+		sendSync(c, req)
+		return
+	}
+
 	// 异步发送：只负责加入队列
 	queueID, err := mailer.SendEmailAsync(req)
 	if err != nil {
@@ -997,6 +1734,37 @@ func SendHandler(c *gin.Context) {
 	})
 }
 
+// sendSync 在请求内直接投递 (不经过队列)，超时后返回 504，投递在后台继续并照常写入发送日志
+func sendSync(c *gin.Context, req mailer.SendRequest) {
+	done := make(chan error, 1)
+	go func() { done <- mailer.SendEmailSync(req) }()
+
+	timeout := time.Duration(config.AppConfig.SyncSendTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	select {
+	case err := <-done:
+		if errors.Is(err, mailer.ErrWarmupCapReached) || errors.Is(err, mailer.ErrRecipientInterval) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":       err.Error(),
+				"hard_bounce": mailer.IsHardBounce(err.Error()),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Email sent successfully",
+			"delivered": true,
+		})
+	case <-time.After(timeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": fmt.Sprintf("Delivery did not finish within %s, result will be recorded in the send log", timeout)})
+	}
+}
+
 // StatsHandler 获取统计数据
 func StatsHandler(c *gin.Context) {
 	stats, err := database.GetStats()
@@ -1013,6 +1781,7 @@ func LogsHandler(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
 	status := c.Query("status")
 	search := c.Query("search")
+	category := c.Query("error_category")
 
 	if page < 1 {
 		page = 1
@@ -1024,11 +1793,14 @@ func LogsHandler(c *gin.Context) {
 
 	// 排除 Body 字段以减少传输量
 	query := database.DB.Model(&database.EmailLog{}).
-		Select("id, created_at, updated_at, recipient, subject, status, error_msg, client_ip, channel, campaign_id, tracking_id, opened, opened_at, clicked_count, unsubscribed")
+		Select("id, created_at, updated_at, recipient, from_addr, subject, status, error_msg, error_category, error_hint, client_ip, channel, campaign_id, tracking_id, opened, opened_at, clicked_count, unsubscribed")
 
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if category != "" {
+		query = query.Where("error_category = ?", category)
+	}
 	if search != "" {
 		query = query.Where("recipient LIKE ? OR subject LIKE ?", "%"+search+"%", "%"+search+"%")
 	}
@@ -1063,6 +1835,83 @@ func GetLogDetailHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, log)
 }
 
+// ResendLogHandler 按日志记录的收件人、主题、正文 (HTML 与纯文本)、附加邮件头与通道重新发送邮件 (使用新的追踪 ID)
+// 附件不随日志保存 (文件在任务结束后按引用计数释放)，重发的邮件不含附件
+// POST /api/v1/logs/:id/resend
+func ResendLogHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var entry database.EmailLog
+	if err := database.DB.First(&entry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+		return
+	}
+	if entry.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Log has no stored body, cannot resend"})
+		return
+	}
+
+	// 已退订的收件人不再发送
+	var unsubscribed int64
+	database.DB.Model(&database.Contact{}).
+		Where("LOWER(email) = ? AND status = ?", strings.ToLower(entry.Recipient), "unsubscribed").
+		Count(&unsubscribed)
+	if unsubscribed > 0 || entry.Unsubscribed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Recipient has unsubscribed"})
+		return
+	}
+
+	// 原通道已删除时改为自动路由
+	var channelID uint
+	if n, err := strconv.ParseUint(strings.TrimPrefix(entry.Channel, "smtp_"), 10, 64); err == nil && strings.HasPrefix(entry.Channel, "smtp_") {
+		var count int64
+		database.DB.Model(&database.SMTPConfig{}).Where("id = ?", n).Count(&count)
+		if count > 0 {
+			channelID = uint(n)
+		}
+	}
+
+	// 营销邮件的正文中嵌有原追踪 ID (打开像素、点击与退订链接)，替换为新 ID
+	body, textBody := entry.Body, entry.TextBody
+	trackingID := ""
+	if entry.TrackingID != "" {
+		trackingID = uuid.New().String()
+		body = strings.ReplaceAll(body, entry.TrackingID, trackingID)
+		textBody = strings.ReplaceAll(textBody, entry.TrackingID, trackingID)
+	}
+	var headers map[string]string
+	if entry.Headers != "" {
+		if err := json.Unmarshal([]byte(entry.Headers), &headers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Log has invalid stored headers: " + err.Error()})
+			return
+		}
+	}
+
+	req := mailer.SendRequest{
+		From:       entry.FromAddr,
+		FromName:   entry.FromName,
+		To:         entry.Recipient,
+		Subject:    entry.Subject,
+		Body:       body,
+		TextBody:   textBody,
+		ChannelID:  channelID,
+		TrackingID: trackingID,
+		Headers:    headers,
+		// 日志正文已包含域名页脚
+		SkipFooter: true,
+		// 手动重发是明确的操作，不受频率限制
+		BypassRecipientInterval: true,
+	}
+	queueID, err := mailer.SendEmailAsync(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue email: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email re-queued", "queue_id": queueID, "tracking_id": trackingID})
+}
+
 // GenerateDKIMHandler 生成新的 DKIM 密钥
 func GenerateDKIMHandler(c *gin.Context) {
 	// 兼容旧接口，建议使用 Domain Management
@@ -1076,25 +1925,107 @@ func GetConfigHandler(c *gin.Context) {
 
 	// 脱敏处理
 	safeCfg := map[string]interface{}{
-		"domain":                cfg.Domain,
-		"dkim_selector":         cfg.DKIMSelector,
-		"dkim_private_key":      "****** (Hidden)", // 隐藏私钥
-		"host":                  cfg.Host,
-		"port":                  cfg.Port,
-		"base_url":              cfg.BaseURL,
-		"enable_ssl":            cfg.EnableSSL,
-		"cert_file":             cfg.CertFile,
-		"key_file":              cfg.KeyFile,
-		"enable_receiver":       cfg.EnableReceiver,
-		"receiver_port":         cfg.ReceiverPort,
-		"receiver_tls":          cfg.ReceiverTLS,
-		"receiver_tls_cert":     cfg.ReceiverTLSCert,
-		"receiver_tls_key":      cfg.ReceiverTLSKey,
-		"receiver_rate_limit":   cfg.ReceiverRateLimit,
-		"receiver_max_msg_size": cfg.ReceiverMaxMsgSize,
-		"receiver_blacklist":    cfg.ReceiverBlacklist,
-		"receiver_require_tls":  cfg.ReceiverRequireTLS,
-		"jwt_secret":            "****** (Hidden)", // 隐藏 JWT Secret
+		"domain":                        cfg.Domain,
+		"dkim_selector":                 cfg.DKIMSelector,
+		"dkim_private_key":              "****** (Hidden)", // 隐藏私钥
+		"default_from_name":             cfg.DefaultFromName,
+		"system_locale":                 cfg.SystemLocale,
+		"require_verified_domain":       cfg.RequireVerifiedDomain,
+		"enforce_channel_domain":        cfg.EnforceChannelDomain,
+		"archive_bcc":                   cfg.ArchiveBCC,
+		"sink_mode":                     cfg.SinkMode,
+		"sink_address":                  cfg.SinkAddress,
+		"fallback_channel_ids":          cfg.FallbackChannelIDs,
+		"dane_enabled":                  cfg.DANEEnabled,
+		"direct_require_tls":            cfg.DirectRequireTLS,
+		"dane_resolver":                 cfg.DANEResolver,
+		"mx_cache_ttl":                  cfg.MXCacheTTL,
+		"domain_verify_resolver":        cfg.DomainVerifyResolver,
+		"domain_verify_timeout":         cfg.DomainVerifyTimeout,
+		"outbound_source_ip":            cfg.OutboundSourceIP,
+		"queue_visibility_timeout":      cfg.QueueVisibilityTimeout,
+		"queue_max_age_hours":           cfg.QueueMaxAgeHours,
+		"sync_send_timeout":             cfg.SyncSendTimeout,
+		"dead_letter_alert":             cfg.DeadLetterAlert,
+		"alert_webhook_url":             cfg.AlertWebhookURL,
+		"alert_email":                   cfg.AlertEmail,
+		"host":                          cfg.Host,
+		"port":                          cfg.Port,
+		"base_url":                      cfg.BaseURL,
+		"trusted_proxies":               cfg.TrustedProxies,
+		"enable_ssl":                    cfg.EnableSSL,
+		"cert_file":                     cfg.CertFile,
+		"key_file":                      cfg.KeyFile,
+		"tls_min_version":               cfg.TLSMinVersion,
+		"tls_cipher_suites":             cfg.TLSCipherSuites,
+		"enable_receiver":               cfg.EnableReceiver,
+		"receiver_port":                 cfg.ReceiverPort,
+		"receiver_tls":                  cfg.ReceiverTLS,
+		"receiver_tls_cert":             cfg.ReceiverTLSCert,
+		"receiver_tls_key":              cfg.ReceiverTLSKey,
+		"receiver_rate_limit":           cfg.ReceiverRateLimit,
+		"receiver_max_msg_size":         cfg.ReceiverMaxMsgSize,
+		"receiver_max_line_len":         cfg.ReceiverMaxLineLen,
+		"receiver_max_msg_bytes":        cfg.ReceiverMaxMsgBytes,
+		"receiver_blacklist":            cfg.ReceiverBlacklist,
+		"receiver_require_tls":          cfg.ReceiverRequireTLS,
+		"receiver_auth_required":        cfg.ReceiverAuthRequired,
+		"receiver_trusted_ips":          cfg.ReceiverTrustedIPs,
+		"receiver_authserv_ids":         cfg.ReceiverAuthServIDs,
+		"receiver_dedupe_window":        cfg.ReceiverDedupeWindow,
+		"receiver_max_received":         cfg.ReceiverMaxReceived,
+		"receiver_image_compress":       cfg.ReceiverImageCompress,
+		"receiver_image_min_size":       cfg.ReceiverImageMinSize,
+		"receiver_image_max_dim":        cfg.ReceiverImageMaxDim,
+		"receiver_image_quality":        cfg.ReceiverImageQuality,
+		"receiver_image_keep_original":  cfg.ReceiverImageKeepOriginal,
+		"receiver_contact_group_id":     cfg.ReceiverContactGroupID,
+		"receiver_command_timeout":      cfg.ReceiverCommandTimeout,
+		"receiver_data_timeout":         cfg.ReceiverDataTimeout,
+		"receiver_spam_max_links":       cfg.ReceiverSpamMaxLinks,
+		"receiver_spam_caps_min_len":    cfg.ReceiverSpamCapsMinLen,
+		"receiver_ptr_check":            cfg.ReceiverPTRCheck,
+		"receiver_ptr_reject":           cfg.ReceiverPTRReject,
+		"receiver_auto_block":           cfg.ReceiverAutoBlock,
+		"receiver_auto_block_threshold": cfg.ReceiverAutoBlockThreshold,
+		"receiver_auto_block_window":    cfg.ReceiverAutoBlockWindow,
+		"receiver_auto_block_ttl":       cfg.ReceiverAutoBlockTTL,
+		"forward_max_retries":           cfg.ForwardMaxRetries,
+		"forward_dsn":                   cfg.ForwardDSN,
+		"campaign_confirm_threshold":    cfg.CampaignConfirmThreshold,
+		"campaign_cost_per_email":       cfg.CampaignCostPerEmail,
+		"campaign_max_concurrent":       cfg.CampaignMaxConcurrent,
+		"campaign_shared_body":          cfg.CampaignSharedBody,
+		"campaign_store_raw":            cfg.CampaignStoreRaw,
+		"campaign_disable_tracking":     cfg.CampaignDisableTracking,
+		"campaign_send_interval":        cfg.CampaignSendInterval,
+		"post_update_hook_url":          cfg.PostUpdateHookURL,
+		"post_update_hook_command":      cfg.PostUpdateHookCommand,
+		"post_update_hook_timeout":      cfg.PostUpdateHookTimeout,
+		"post_update_hook_required":     cfg.PostUpdateHookRequired,
+		"max_body_size":                 cfg.MaxBodySize,
+		"sanitize_html":                 cfg.SanitizeHTML,
+		"ssrf_allow_hosts":              cfg.SSRFAllowHosts,
+		"clamav_enabled":                cfg.ClamAVEnabled,
+		"clamav_address":                cfg.ClamAVAddress,
+		"clamav_timeout":                cfg.ClamAVTimeout,
+		"clamav_fail_closed":            cfg.ClamAVFailClosed,
+		"scheduler_serialize":           cfg.SchedulerSerialize,
+		"login_captcha_after":           cfg.LoginCaptchaAfter,
+		"reputation_window_hours":       cfg.ReputationWindowHours,
+		"reputation_min_sent":           cfg.ReputationMinSent,
+		"connectivity_probe_hosts":      cfg.ConnectivityProbeHosts,
+		"connectivity_probe_interval":   cfg.ConnectivityProbeInterval,
+		"connectivity_alert":            cfg.ConnectivityAlert,
+		"recipient_min_interval":        cfg.RecipientMinInterval,
+		"recipient_interval_action":     cfg.RecipientIntervalAction,
+		"digest_enabled":                cfg.DigestEnabled,
+		"digest_email":                  cfg.DigestEmail,
+		"digest_time":                   cfg.DigestTime,
+		"backup_max_count":              cfg.BackupMaxCount,
+		"backup_max_size_mb":            cfg.BackupMaxSizeMB,
+		"db_driver":                     database.Driver(), // 连接串含密码，不返回
+		"jwt_secret":                    "****** (Hidden)", // 隐藏 JWT Secret
 	}
 
 	c.JSON(http.StatusOK, safeCfg)
@@ -1141,11 +2072,44 @@ func UpdateConfigHandler(c *gin.Context) {
 		}
 	}
 
+	if _, _, err := config.ParseTLSPolicy(newConfig.TLSMinVersion, newConfig.TLSCipherSuites); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if t := strings.TrimSpace(newConfig.DigestTime); t != "" {
+		if _, err := time.Parse("15:04", t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "digest_time must be HH:MM"})
+			return
+		}
+	}
+
 	// 2. 保护关键字段或执行重置
 	// 注意：前端返回的是 "****** (Hidden)"，需要特殊处理
 	if newConfig.DKIMPrivateKey == "" || strings.Contains(newConfig.DKIMPrivateKey, "Hidden") || strings.HasPrefix(newConfig.DKIMPrivateKey, "***") {
 		newConfig.DKIMPrivateKey = config.AppConfig.DKIMPrivateKey
 	}
+	// 以下字段不在 GetConfigHandler 返回中，由各自的专用接口维护
+	newConfig.CleanupEnabled = config.AppConfig.CleanupEnabled
+	newConfig.CleanupEmailLogDays = config.AppConfig.CleanupEmailLogDays
+	newConfig.CleanupInboxDays = config.AppConfig.CleanupInboxDays
+	newConfig.CleanupInboxOverrides = config.AppConfig.CleanupInboxOverrides
+	newConfig.CleanupQueueDays = config.AppConfig.CleanupQueueDays
+	newConfig.CleanupForwardDays = config.AppConfig.CleanupForwardDays
+	newConfig.CleanupAttachDays = config.AppConfig.CleanupAttachDays
+	newConfig.CleanupAttachBatchSize = config.AppConfig.CleanupAttachBatchSize
+	newConfig.CleanupAttachBatchSleep = config.AppConfig.CleanupAttachBatchSleep
+	newConfig.CleanupAttachWorkers = config.AppConfig.CleanupAttachWorkers
+	newConfig.CleanupTrackingDays = config.AppConfig.CleanupTrackingDays
+	newConfig.CleanupOrphans = config.AppConfig.CleanupOrphans
+	newConfig.AutoUpdateEnabled = config.AppConfig.AutoUpdateEnabled
+	newConfig.AutoUpdateInterval = config.AppConfig.AutoUpdateInterval
+	newConfig.AutoUpdateTime = config.AppConfig.AutoUpdateTime
+	newConfig.ReceiverSpamFilter = config.AppConfig.ReceiverSpamFilter
+	newConfig.ErrorCategoryRules = config.AppConfig.ErrorCategoryRules
+	// 收件加密口令只能通过 /inbox/encryption 修改 (需同时维护旧口令列表)
+	newConfig.InboxEncryption = config.AppConfig.InboxEncryption
+	newConfig.InboxEncryptionKey = config.AppConfig.InboxEncryptionKey
+	newConfig.InboxEncryptionPreviousKeys = config.AppConfig.InboxEncryptionPreviousKeys
 
 	// JWT Secret 处理：支持重置
 	// 注意：前端返回的是 "****** (Hidden)"，需要特殊处理
@@ -1159,6 +2123,14 @@ func UpdateConfigHandler(c *gin.Context) {
 	}
 	// 只有当 newConfig.JWTSecret 是有效的具体值（非空、非掩码、非RESET）时，才会更新为新值
 
+	// 更新后命令会以服务权限执行，不允许通过 API 修改
+	newConfig.PostUpdateHookCommand = config.AppConfig.PostUpdateHookCommand
+	// 数据库连接只能通过 config.json 修改 (需重启)
+	newConfig.DBDriver = config.AppConfig.DBDriver
+	newConfig.DBDSN = config.AppConfig.DBDSN
+	newConfig.DBMaxOpenConns = config.AppConfig.DBMaxOpenConns
+	newConfig.DBMaxIdleConns = config.AppConfig.DBMaxIdleConns
+
 	// 3. 默认值保护
 	if newConfig.Host == "" {
 		newConfig.Host = config.AppConfig.Host
@@ -1263,7 +2235,10 @@ func BackupHandler(c *gin.Context) {
 	zipWriter := zip.NewWriter(c.Writer)
 	defer zipWriter.Close()
 
-	files := []string{"config.json", "goemail.db"}
+	files := []string{"config.json"}
+	if database.IsSQLite() {
+		files = append(files, database.SQLiteFile)
+	}
 
 	for _, filename := range files {
 		// 使用闭包立即处理文件，避免 defer 在循环中累积
@@ -1296,33 +2271,7 @@ func CaptchaHandler(c *gin.Context) {
 
 	id := generateRandomKey() // 复用随机字符串生成
 
-	captchaMutex.Lock()
-	// 清理过期的验证码
-	now := time.Now()
-	if len(captchaStore) >= captchaMaxSize {
-		// 清理过期的验证码
-		for k, v := range captchaStore {
-			if now.After(v.ExpiresAt) {
-				delete(captchaStore, k)
-			}
-		}
-		// 如果清理后仍然超限，删除最旧的一半
-		if len(captchaStore) >= captchaMaxSize {
-			count := 0
-			for k := range captchaStore {
-				delete(captchaStore, k)
-				count++
-				if count >= captchaMaxSize/2 {
-					break
-				}
-			}
-		}
-	}
-	captchaStore[id] = captchaEntry{
-		Code:      code,
-		ExpiresAt: now.Add(captchaExpiration),
-	}
-	captchaMutex.Unlock()
+	captchaStore.Set(id, code)
 
 	// 生成增强版 SVG (带干扰线和噪点)
 	width, height := 120, 40
@@ -1360,32 +2309,104 @@ func CaptchaHandler(c *gin.Context) {
 	})
 }
 
+// 壁纸内存缓存：同一天内只向 Bing 请求一次，失败后短时间内不再重试
+const (
+	wallpaperMaxSize      = 10 * 1024 * 1024 // 壁纸图片最大 10MB
+	wallpaperRetryBackoff = 10 * time.Minute
+)
+
+var (
+	wallpaperMu       sync.Mutex
+	wallpaperCacheDay string
+	wallpaperCacheURL string
+	wallpaperFailedAt time.Time
+	wallpaperFetching chan struct{} // 非 nil 表示正在下载，下载结束后关闭
+)
+
 // WallpaperHandler 获取 Bing 每日壁纸
 func WallpaperHandler(c *gin.Context) {
+	url, source, err := todayWallpaper(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"url": "", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url, "source": source})
+}
+
+// todayWallpaper 返回今日壁纸地址；下载期间不持有锁，并发请求等待同一次下载的结果
+func todayWallpaper(ctx context.Context) (string, string, error) {
+	today := time.Now().Format("2006-01-02")
+
+	wallpaperMu.Lock()
+	for wallpaperFetching != nil {
+		done := wallpaperFetching
+		wallpaperMu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		}
+		wallpaperMu.Lock()
+	}
+
+	// 1. 检查内存缓存
+	if wallpaperCacheDay == today {
+		url := wallpaperCacheURL
+		wallpaperMu.Unlock()
+		return url, "local", nil
+	}
+
 	// 确保目录存在
 	saveDir := "static/wallpapers"
 	if _, err := os.Stat(saveDir); os.IsNotExist(err) {
 		os.MkdirAll(saveDir, 0755)
 	}
 
-	today := time.Now().Format("2006-01-02")
 	filename := today + ".jpg"
 	localPath := filepath.Join(saveDir, filename)
 	// 修改为 /wallpapers/ 路径
 	publicURL := "/wallpapers/" + filename
 
-	// 1. 检查本地缓存
+	// 2. 检查本地缓存
 	if _, err := os.Stat(localPath); err == nil {
-		c.JSON(http.StatusOK, gin.H{"url": publicURL, "source": "local"})
-		return
+		wallpaperCacheDay, wallpaperCacheURL = today, publicURL
+		wallpaperMu.Unlock()
+		return publicURL, "local", nil
+	}
+
+	// 最近刚失败过，不重复请求 Bing
+	if time.Since(wallpaperFailedAt) < wallpaperRetryBackoff {
+		wallpaperMu.Unlock()
+		return "", "", fmt.Errorf("Wallpaper temporarily unavailable")
+	}
+
+	// 3. 从 Bing 获取 (释放锁，避免慢速下载阻塞其他请求)
+	done := make(chan struct{})
+	wallpaperFetching = done
+	wallpaperMu.Unlock()
+
+	err := downloadBingWallpaper(localPath)
+
+	wallpaperMu.Lock()
+	defer wallpaperMu.Unlock()
+	wallpaperFetching = nil
+	close(done)
+	if err != nil {
+		wallpaperFailedAt = time.Now()
+		return "", "", err
 	}
+	wallpaperCacheDay, wallpaperCacheURL = today, publicURL
+	return publicURL, "bing", nil
+}
+
+// downloadBingWallpaper 下载 Bing 每日壁纸到指定路径 (限制大小，先写临时文件再重命名)
+func downloadBingWallpaper(localPath string) error {
+	client := &http.Client{Timeout: 15 * time.Second}
 
-	// 2. 从 Bing 获取
 	// Bing API: https://www.bing.com/HPImageArchive.aspx?format=js&idx=0&n=1&mkt=zh-CN
-	resp, err := http.Get("https://www.bing.com/HPImageArchive.aspx?format=js&idx=0&n=1&mkt=zh-CN")
+	resp, err := client.Get("https://www.bing.com/HPImageArchive.aspx?format=js&idx=0&n=1&mkt=zh-CN")
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"url": "", "error": "Bing API failed"})
-		return
+		return fmt.Errorf("Bing API failed")
 	}
 	defer resp.Body.Close()
 
@@ -1394,31 +2415,39 @@ func WallpaperHandler(c *gin.Context) {
 			Url string `json:"url"`
 		} `json:"images"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&bingData); err != nil || len(bingData.Images) == 0 {
-		c.JSON(http.StatusOK, gin.H{"url": "", "error": "Bing response parse failed"})
-		return
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&bingData); err != nil || len(bingData.Images) == 0 {
+		return fmt.Errorf("Bing response parse failed")
 	}
 
 	bingURL := "https://www.bing.com" + bingData.Images[0].Url
 
 	// 下载图片
-	imgResp, err := http.Get(bingURL)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"url": "", "error": "Image download failed"})
-		return
+	imgResp, err := client.Get(bingURL)
+	if err != nil || imgResp.StatusCode != http.StatusOK {
+		if err == nil {
+			imgResp.Body.Close()
+		}
+		return fmt.Errorf("Image download failed")
 	}
 	defer imgResp.Body.Close()
 
 	// 保存到本地
-	out, err := os.Create(localPath)
+	tmpPath := localPath + ".tmp"
+	out, err := os.Create(tmpPath)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"url": "", "error": "File save failed"})
-		return
+		return fmt.Errorf("File save failed")
 	}
-	defer out.Close()
-	io.Copy(out, imgResp.Body)
-
-	c.JSON(http.StatusOK, gin.H{"url": publicURL, "source": "bing"})
+	n, err := io.Copy(out, io.LimitReader(imgResp.Body, wallpaperMaxSize+1))
+	out.Close()
+	if err != nil || n > wallpaperMaxSize {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Image download failed")
+	}
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("File save failed")
+	}
+	return nil
 }
 
 func isHex(s string) bool {
@@ -1463,6 +2492,9 @@ func DeleteFileHandler(c *gin.Context) {
 	if file.FilePath != "" {
 		os.Remove(file.FilePath)
 	}
+	if file.OriginalPath != "" {
+		os.Remove(file.OriginalPath)
+	}
 
 	database.DB.Delete(&file)
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
@@ -1484,6 +2516,9 @@ func BatchDeleteFilesHandler(c *gin.Context) {
 		if f.FilePath != "" {
 			os.Remove(f.FilePath)
 		}
+		if f.OriginalPath != "" {
+			os.Remove(f.OriginalPath)
+		}
 		database.DB.Delete(&f)
 	}
 
@@ -1507,6 +2542,24 @@ func ListForwardRulesHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, rules)
 }
 
+// TestForwardRuleHandler 测试收件地址会命中哪条转发规则 (不实际收发邮件)
+// POST /api/v1/forward-rules/test  body: {"email": "support@example.com"}
+func TestForwardRuleHandler(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if parts := strings.Split(strings.TrimSpace(req.Email), "@"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, receiver.MatchForwardRule(req.Email))
+}
+
 // CreateForwardRuleHandler 创建转发规则
 func CreateForwardRuleHandler(c *gin.Context) {
 	var req struct {
@@ -1515,11 +2568,18 @@ func CreateForwardRuleHandler(c *gin.Context) {
 		MatchAddr string `json:"match_addr"`
 		ForwardTo string `json:"forward_to"`
 		Remark    string `json:"remark"`
+
+		ReplyTo       string `json:"reply_to"`       // sender (默认) / list / none
+		RewriteSender bool   `json:"rewrite_sender"` // 信封发件人改写为 VERP 退信地址
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !receiver.ValidReplyToMode(req.ReplyTo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply_to (allowed: sender, list, none)"})
+		return
+	}
 
 	// 验证域名存在
 	var domain database.Domain
@@ -1547,12 +2607,18 @@ func CreateForwardRuleHandler(c *gin.Context) {
 		ForwardTo: req.ForwardTo,
 		Enabled:   true,
 		Remark:    req.Remark,
+
+		ReplyTo:       req.ReplyTo,
+		RewriteSender: req.RewriteSender,
 	}
 
 	if err := database.DB.Create(&rule).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if rule.RewriteSender {
+		ensureForwardBounceMailbox(rule.DomainID)
+	}
 
 	c.JSON(http.StatusOK, rule)
 }
@@ -1573,6 +2639,9 @@ func UpdateForwardRuleHandler(c *gin.Context) {
 		ForwardTo string `json:"forward_to"`
 		Enabled   *bool  `json:"enabled"`
 		Remark    string `json:"remark"`
+
+		ReplyTo       *string `json:"reply_to"`
+		RewriteSender *bool   `json:"rewrite_sender"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -1596,11 +2665,31 @@ func UpdateForwardRuleHandler(c *gin.Context) {
 		rule.Enabled = *req.Enabled
 	}
 	rule.Remark = req.Remark
+	if req.ReplyTo != nil {
+		if !receiver.ValidReplyToMode(*req.ReplyTo) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply_to (allowed: sender, list, none)"})
+			return
+		}
+		rule.ReplyTo = *req.ReplyTo
+	}
+	if req.RewriteSender != nil {
+		rule.RewriteSender = *req.RewriteSender
+	}
 
 	database.DB.Save(&rule)
+	if rule.RewriteSender {
+		ensureForwardBounceMailbox(rule.DomainID)
+	}
 	c.JSON(http.StatusOK, rule)
 }
 
+// ensureForwardBounceMailbox 改写信封发件人的转发规则依赖退信邮箱接收 bounce+fwd-*@ 的退信
+func ensureForwardBounceMailbox(domainID uint) {
+	if _, err := receiver.EnsureBounceMailbox(domainID); err != nil {
+		log.Printf("[Forward] Failed to create bounce mailbox for domain %d: %v", domainID, err)
+	}
+}
+
 // DeleteForwardRuleHandler 删除转发规则
 func DeleteForwardRuleHandler(c *gin.Context) {
 	id, ok := parseIDParam(c)
@@ -1626,7 +2715,7 @@ func ToggleForwardRuleHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, rule)
 }
 
-// ListForwardLogsHandler 获取转发日志 (支持分页)
+// ListForwardLogsHandler 获取转发日志 (支持分页和 status 过滤)
 func ListForwardLogsHandler(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
@@ -1637,11 +2726,16 @@ func ListForwardLogsHandler(c *gin.Context) {
 		pageSize = 50
 	}
 
+	query := database.DB.Model(&database.ForwardLog{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	var total int64
-	database.DB.Model(&database.ForwardLog{}).Count(&total)
+	query.Count(&total)
 
 	var logs []database.ForwardLog
-	database.DB.Order("created_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs)
+	query.Order("created_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs)
 	c.JSON(http.StatusOK, gin.H{
 		"data":      logs,
 		"total":     total,
@@ -1650,16 +2744,89 @@ func ListForwardLogsHandler(c *gin.Context) {
 	})
 }
 
+// GetForwardLogHandler 查看转发日志详情及关联队列任务的投递状态
+func GetForwardLogHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var logEntry database.ForwardLog
+	if err := database.DB.First(&logEntry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Forward log not found"})
+		return
+	}
+
+	resp := gin.H{"log": logEntry}
+	if logEntry.QueueID > 0 {
+		var task database.EmailQueue
+		if err := database.DB.Select("id", "status", "retries", "next_retry", "error_msg", "created_at", "updated_at").
+			First(&task, logEntry.QueueID).Error; err == nil {
+			resp["queue"] = gin.H{
+				"id":         task.ID,
+				"status":     task.Status,
+				"retries":    task.Retries,
+				"next_retry": task.NextRetry,
+				"error_msg":  task.ErrorMsg,
+				"created_at": task.CreatedAt,
+				"updated_at": task.UpdatedAt,
+			}
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RetryForwardLogHandler 重新投递失败的转发 (重置关联队列任务)
+func RetryForwardLogHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var logEntry database.ForwardLog
+	if err := database.DB.First(&logEntry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Forward log not found"})
+		return
+	}
+	if logEntry.Status != "failed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only failed forwards can be retried"})
+		return
+	}
+	if logEntry.QueueID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Forward was never queued, nothing to retry"})
+		return
+	}
+
+	result := database.DB.Model(&database.EmailQueue{}).
+		Where("id = ? AND status IN ?", logEntry.QueueID, []string{"failed", "dead"}).
+		Updates(map[string]interface{}{
+			"status":     "pending",
+			"retries":    0,
+			"next_retry": time.Now(),
+			"error_msg":  "",
+		})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Queue task no longer available for retry"})
+		return
+	}
+
+	database.DB.Model(&logEntry).Updates(map[string]interface{}{
+		"status":    "pending",
+		"error_msg": "",
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Forward re-queued", "queue_id": logEntry.QueueID})
+}
+
 // GetForwardStatsHandler 获取转发统计
 func GetForwardStatsHandler(c *gin.Context) {
 	var totalCount int64
 	var successCount int64
 	var failCount int64
+	var pendingCount int64
 	var todayCount int64
 
 	database.DB.Model(&database.ForwardLog{}).Count(&totalCount)
 	database.DB.Model(&database.ForwardLog{}).Where("status = ?", "success").Count(&successCount)
 	database.DB.Model(&database.ForwardLog{}).Where("status = ?", "failed").Count(&failCount)
+	database.DB.Model(&database.ForwardLog{}).Where("status = ?", "pending").Count(&pendingCount)
 
 	startOfDay := time.Now().Truncate(24 * time.Hour)
 	database.DB.Model(&database.ForwardLog{}).Where("created_at >= ?", startOfDay).Count(&todayCount)
@@ -1668,6 +2835,7 @@ func GetForwardStatsHandler(c *gin.Context) {
 		"total":   totalCount,
 		"success": successCount,
 		"failed":  failCount,
+		"pending": pendingCount,
 		"today":   todayCount,
 	})
 }
@@ -1766,34 +2934,19 @@ func KillProcessHandler(c *gin.Context) {
 	c.JSON(http.StatusForbidden, gin.H{"error": "Remote process control is disabled for security reasons."})
 }
 
-// containsUnsafeTemplateActions 检测模板中是否包含不安全的指令
-// 禁止 {{define}}, {{template}}, {{block}} 等可能导致注入或递归的指令
-func containsUnsafeTemplateActions(tmpl string) bool {
-	unsafePatterns := []string{
-		"{{define", "{{template", "{{block",
-		"{{ define", "{{ template", "{{ block",
-	}
-	lower := strings.ToLower(tmpl)
-	for _, p := range unsafePatterns {
-		if strings.Contains(lower, p) {
-			return true
-		}
-	}
-	return false
-}
-
 // --- Data Cleanup Management (数据清理) ---
 
 // GetCleanupStatsHandler 获取数据统计
 func GetCleanupStatsHandler(c *gin.Context) {
 	// 避免循环导入，直接在此查询
 	var stats struct {
-		EmailLogs   int64 `json:"email_logs"`
-		InboxItems  int64 `json:"inbox_items"`
-		QueueItems  int64 `json:"queue_items"`
-		ForwardLogs int64 `json:"forward_logs"`
-		Attachments int64 `json:"attachments"`
-		TotalSize   int64 `json:"total_size"`
+		EmailLogs      int64 `json:"email_logs"`
+		InboxItems     int64 `json:"inbox_items"`
+		QueueItems     int64 `json:"queue_items"`
+		ForwardLogs    int64 `json:"forward_logs"`
+		Attachments    int64 `json:"attachments"`
+		TrackingEvents int64 `json:"tracking_events"`
+		TotalSize      int64 `json:"total_size"`
 	}
 
 	database.DB.Model(&database.EmailLog{}).Count(&stats.EmailLogs)
@@ -1801,6 +2954,7 @@ func GetCleanupStatsHandler(c *gin.Context) {
 	database.DB.Model(&database.EmailQueue{}).Count(&stats.QueueItems)
 	database.DB.Model(&database.ForwardLog{}).Count(&stats.ForwardLogs)
 	database.DB.Model(&database.AttachmentFile{}).Count(&stats.Attachments)
+	database.DB.Model(&database.TrackingEvent{}).Count(&stats.TrackingEvents)
 
 	// 统计附件总大小
 	var totalSize struct {
@@ -1816,24 +2970,36 @@ func GetCleanupStatsHandler(c *gin.Context) {
 func GetCleanupConfigHandler(c *gin.Context) {
 	cfg := config.AppConfig
 	c.JSON(http.StatusOK, gin.H{
-		"cleanup_enabled":        cfg.CleanupEnabled,
-		"cleanup_email_log_days": cfg.CleanupEmailLogDays,
-		"cleanup_inbox_days":     cfg.CleanupInboxDays,
-		"cleanup_queue_days":     cfg.CleanupQueueDays,
-		"cleanup_forward_days":   cfg.CleanupForwardDays,
-		"cleanup_attach_days":    cfg.CleanupAttachDays,
+		"cleanup_enabled":            cfg.CleanupEnabled,
+		"cleanup_email_log_days":     cfg.CleanupEmailLogDays,
+		"cleanup_inbox_days":         cfg.CleanupInboxDays,
+		"cleanup_inbox_overrides":    cfg.CleanupInboxOverrides,
+		"cleanup_queue_days":         cfg.CleanupQueueDays,
+		"cleanup_forward_days":       cfg.CleanupForwardDays,
+		"cleanup_attach_days":        cfg.CleanupAttachDays,
+		"cleanup_tracking_days":      cfg.CleanupTrackingDays,
+		"cleanup_orphans":            cfg.CleanupOrphans,
+		"cleanup_attach_batch_size":  cfg.CleanupAttachBatchSize,
+		"cleanup_attach_batch_sleep": cfg.CleanupAttachBatchSleep,
+		"cleanup_attach_workers":     cfg.CleanupAttachWorkers,
 	})
 }
 
 // UpdateCleanupConfigHandler 更新清理配置
 func UpdateCleanupConfigHandler(c *gin.Context) {
 	var req struct {
-		CleanupEnabled      *bool `json:"cleanup_enabled"`
-		CleanupEmailLogDays *int  `json:"cleanup_email_log_days"`
-		CleanupInboxDays    *int  `json:"cleanup_inbox_days"`
-		CleanupQueueDays    *int  `json:"cleanup_queue_days"`
-		CleanupForwardDays  *int  `json:"cleanup_forward_days"`
-		CleanupAttachDays   *int  `json:"cleanup_attach_days"`
+		CleanupEnabled          *bool          `json:"cleanup_enabled"`
+		CleanupEmailLogDays     *int           `json:"cleanup_email_log_days"`
+		CleanupInboxDays        *int           `json:"cleanup_inbox_days"`
+		CleanupInboxOverrides   map[string]int `json:"cleanup_inbox_overrides"` // 省略时不修改，{} 清空
+		CleanupQueueDays        *int           `json:"cleanup_queue_days"`
+		CleanupForwardDays      *int           `json:"cleanup_forward_days"`
+		CleanupAttachDays       *int           `json:"cleanup_attach_days"`
+		CleanupTrackingDays     *int           `json:"cleanup_tracking_days"`
+		CleanupOrphans          *bool          `json:"cleanup_orphans"`
+		CleanupAttachBatchSize  *int           `json:"cleanup_attach_batch_size"`
+		CleanupAttachBatchSleep *int           `json:"cleanup_attach_batch_sleep"` // 毫秒，负数表示不休眠
+		CleanupAttachWorkers    *int           `json:"cleanup_attach_workers"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1841,6 +3007,19 @@ func UpdateCleanupConfigHandler(c *gin.Context) {
 		return
 	}
 
+	var inboxOverrides map[string]int
+	if req.CleanupInboxOverrides != nil {
+		inboxOverrides = make(map[string]int, len(req.CleanupInboxOverrides))
+		for key, days := range req.CleanupInboxOverrides {
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" || key == "@" || days < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid inbox retention override %q: %d", key, days)})
+				return
+			}
+			inboxOverrides[key] = days
+		}
+	}
+
 	// 更新配置
 	if req.CleanupEnabled != nil {
 		config.AppConfig.CleanupEnabled = *req.CleanupEnabled
@@ -1851,6 +3030,9 @@ func UpdateCleanupConfigHandler(c *gin.Context) {
 	if req.CleanupInboxDays != nil && *req.CleanupInboxDays > 0 {
 		config.AppConfig.CleanupInboxDays = *req.CleanupInboxDays
 	}
+	if inboxOverrides != nil {
+		config.AppConfig.CleanupInboxOverrides = inboxOverrides
+	}
 	if req.CleanupQueueDays != nil && *req.CleanupQueueDays > 0 {
 		config.AppConfig.CleanupQueueDays = *req.CleanupQueueDays
 	}
@@ -1860,6 +3042,21 @@ func UpdateCleanupConfigHandler(c *gin.Context) {
 	if req.CleanupAttachDays != nil && *req.CleanupAttachDays > 0 {
 		config.AppConfig.CleanupAttachDays = *req.CleanupAttachDays
 	}
+	if req.CleanupTrackingDays != nil && *req.CleanupTrackingDays > 0 {
+		config.AppConfig.CleanupTrackingDays = *req.CleanupTrackingDays
+	}
+	if req.CleanupOrphans != nil {
+		config.AppConfig.CleanupOrphans = *req.CleanupOrphans
+	}
+	if req.CleanupAttachBatchSize != nil && *req.CleanupAttachBatchSize > 0 {
+		config.AppConfig.CleanupAttachBatchSize = min(*req.CleanupAttachBatchSize, 10000)
+	}
+	if req.CleanupAttachBatchSleep != nil {
+		config.AppConfig.CleanupAttachBatchSleep = *req.CleanupAttachBatchSleep
+	}
+	if req.CleanupAttachWorkers != nil && *req.CleanupAttachWorkers > 0 {
+		config.AppConfig.CleanupAttachWorkers = min(*req.CleanupAttachWorkers, 64)
+	}
 
 	// 保存配置
 	if err := config.SaveConfig(config.AppConfig); err != nil {
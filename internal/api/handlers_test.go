@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRenderGalleryTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	tpl := database.GalleryTemplates()[1] // 密码重置：正文与页脚同时使用 {name} 与 {email}
+	req := mailer.SendRequest{Variables: map[string]interface{}{"name": "张三", "email": "zs@example.com"}}
+	if !renderTemplate(c, tpl, &req) {
+		t.Fatal("renderTemplate failed")
+	}
+	if strings.Contains(req.Body, "{name}") || strings.Contains(req.Body, "{email}") {
+		t.Error("brace placeholders rendered literally")
+	}
+	if !strings.Contains(req.Body, "你好 张三") || !strings.Contains(req.Body, "此邮件发送至 zs@example.com") {
+		t.Errorf("variables not substituted:\n%s", req.Body)
+	}
+
+	welcome := database.GalleryTemplates()[0]
+	if !renderTemplate(c, welcome, &req) || req.Subject != "欢迎加入，张三！" {
+		t.Errorf("subject = %q", req.Subject)
+	}
+}
+
+func TestResendLogCarriesTextBodyAndHeaders(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.EmailLog{}, &database.EmailQueue{}, &database.Contact{}, &database.SMTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	entry := database.EmailLog{
+		Recipient:  "a@example.com",
+		Subject:    "Hi",
+		Body:       `<img src="/track/open/old-id">`,
+		TextBody:   "Unsubscribe: /track/unsubscribe/old-id",
+		Headers:    `{"Reply-To":"support@example.com"}`,
+		Status:     "failed",
+		TrackingID: "old-id",
+	}
+	db.Create(&entry)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(entry.ID))}}
+	ResendLogHandler(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var task database.EmailQueue
+	if err := db.First(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+	if task.Headers != entry.Headers {
+		t.Errorf("headers = %q, want %q", task.Headers, entry.Headers)
+	}
+	if task.TextBody != "Unsubscribe: /track/unsubscribe/"+task.TrackingID || task.TrackingID == "old-id" {
+		t.Errorf("text body not carried over with the new tracking ID: %q (tracking %s)", task.TextBody, task.TrackingID)
+	}
+}
+
+func TestDomainDKIMRecordWithoutKey(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Domain{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	domain := database.Domain{Name: "example.com"}
+	db.Create(&domain)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(domain.ID))}}
+	GetDomainDKIMRecordHandler(c)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "no DKIM key") {
+		t.Errorf("status = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+	"goemail/internal/receiver"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minInboxKeyLength 收件加密口令的最小长度
+const minInboxKeyLength = 12
+
+// GetInboxEncryptionHandler 获取收件静态加密状态 (不返回口令)
+// GET /api/v1/inbox/encryption
+func GetInboxEncryptionHandler(c *gin.Context) {
+	var total, encrypted int64
+	database.DB.Model(&database.Inbox{}).Count(&total)
+	database.DB.Model(&database.Inbox{}).Where("body LIKE ? OR raw_data LIKE ?", "enc:%", "enc:%").Count(&encrypted)
+
+	cfg := config.AppConfig
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":            cfg.InboxEncryption,
+		"key_set":            strings.TrimSpace(cfg.InboxEncryptionKey) != "",
+		"previous_keys":      len(cfg.InboxEncryptionPreviousKeys),
+		"encrypted_messages": encrypted,
+		"plain_messages":     total - encrypted,
+	})
+}
+
+// UpdateInboxEncryptionHandler 开关收件加密或轮换口令
+// PUT /api/v1/inbox/encryption
+// 更换口令时旧口令移入 inbox_encryption_previous_keys 继续用于解密，调用 rekey 重写历史数据后清除
+func UpdateInboxEncryptionHandler(c *gin.Context) {
+	var req struct {
+		Enabled *bool   `json:"enabled"`
+		Key     *string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.ConfigMu.Lock()
+	cfg := &config.AppConfig
+	if req.Key != nil {
+		key := strings.TrimSpace(*req.Key)
+		if len(key) < minInboxKeyLength {
+			config.ConfigMu.Unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("key must be at least %d characters", minInboxKeyLength)})
+			return
+		}
+		if old := strings.TrimSpace(cfg.InboxEncryptionKey); old != "" && old != key {
+			cfg.InboxEncryptionPreviousKeys = append(cfg.InboxEncryptionPreviousKeys, old)
+		}
+		cfg.InboxEncryptionKey = key
+	}
+	if req.Enabled != nil {
+		if *req.Enabled && strings.TrimSpace(cfg.InboxEncryptionKey) == "" {
+			config.ConfigMu.Unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Set an encryption key before enabling inbox encryption"})
+			return
+		}
+		cfg.InboxEncryption = *req.Enabled
+	}
+	config.ConfigMu.Unlock()
+
+	if err := config.SaveConfig(config.AppConfig); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Inbox encryption updated"})
+}
+
+// RekeyInboxHandler 按当前设置重写所有收件数据 (加密历史明文、以新口令重新加密，或关闭后还原为明文)
+// POST /api/v1/inbox/encryption/rekey
+func RekeyInboxHandler(c *gin.Context) {
+	result, ran, err := receiver.RekeyInbox()
+	if !ran {
+		c.JSON(http.StatusConflict, gin.H{"error": "A rekey is already running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
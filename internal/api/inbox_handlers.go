@@ -1,16 +1,22 @@
 package api
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"goemail/internal/config"
 	"goemail/internal/database"
+	"goemail/internal/mailer"
 	"goemail/internal/receiver"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 分页限制常量
@@ -41,12 +47,7 @@ func ListInboxHandler(c *gin.Context) {
 	var total int64
 	var messages []database.Inbox
 
-	query := database.DB.Model(&database.Inbox{})
-
-	// 搜索 (可选)
-	if q := c.Query("q"); q != "" {
-		query = query.Where("subject LIKE ? OR from_addr LIKE ?", "%"+q+"%", "%"+q+"%")
-	}
+	query := inboxSearchQuery(c)
 
 	query.Count(&total)
 	
@@ -57,12 +58,13 @@ func ListInboxHandler(c *gin.Context) {
 
 	// 简化返回内容，不返回完整的 RawData 以节省带宽
 	type InboxSummary struct {
-		ID        uint   `json:"id"`
-		CreatedAt string `json:"created_at"`
-		FromAddr  string `json:"from_addr"`
-		ToAddr    string `json:"to_addr"`
-		Subject   string `json:"subject"`
-		IsRead    bool   `json:"is_read"`
+		ID        uint     `json:"id"`
+		CreatedAt string   `json:"created_at"`
+		FromAddr  string   `json:"from_addr"`
+		ToAddr    string   `json:"to_addr"`
+		Subject   string   `json:"subject"`
+		IsRead    bool     `json:"is_read"`
+		Tags      []string `json:"tags"`
 	}
 
 	summary := make([]InboxSummary, len(messages))
@@ -74,6 +76,7 @@ func ListInboxHandler(c *gin.Context) {
 			ToAddr:    m.ToAddr,
 			Subject:   m.Subject,
 			IsRead:    m.IsRead,
+			Tags:      parseTags(m.Tags),
 		}
 	}
 
@@ -85,6 +88,213 @@ func ListInboxHandler(c *gin.Context) {
 	})
 }
 
+// inboxSearchQuery 构建收件箱查询 (支持 q 搜索主题/发件人、thread_id 过滤会话、tag 按标签过滤)
+func inboxSearchQuery(c *gin.Context) *gorm.DB {
+	query := database.DB.Model(&database.Inbox{})
+
+	// 搜索 (可选)
+	if q := c.Query("q"); q != "" {
+		query = query.Where("subject LIKE ? OR from_addr LIKE ?", "%"+q+"%", "%"+q+"%")
+	}
+	if threadID := c.Query("thread_id"); threadID != "" {
+		query = query.Where("thread_id = ?", threadID)
+	}
+	if tag := c.Query("tag"); tag != "" {
+		// 标签在 Tags 中以 JSON 字符串存储 (["spam","vip"])，按带引号的整词匹配
+		if t, err := normalizeTag(tag); err == nil {
+			query = query.Where("tags LIKE ?", `%"`+t+`"%`)
+		} else {
+			query = query.Where("1 = 0")
+		}
+	}
+	return query
+}
+
+// ListInboxThreadsHandler 按会话分组列出收件箱
+// GET /api/v1/inbox/threads?page=1&limit=20&q=
+// 会话内的邮件可通过 GET /api/v1/inbox?thread_id= 获取
+func ListInboxThreadsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	var total int64
+	inboxSearchQuery(c).Distinct("thread_id").Count(&total)
+
+	type threadRow struct {
+		ThreadID     string
+		MessageCount int64
+		UnreadCount  int64
+		LatestID     uint
+	}
+	var rows []threadRow
+	err := inboxSearchQuery(c).
+		Select("thread_id, COUNT(*) AS message_count, SUM(CASE WHEN is_read THEN 0 ELSE 1 END) AS unread_count, MAX(id) AS latest_id").
+		Group("thread_id").
+		Order("latest_id desc").
+		Limit(limit).Offset((page - 1) * limit).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch threads"})
+		return
+	}
+
+	latestIDs := make([]uint, len(rows))
+	for i, r := range rows {
+		latestIDs[i] = r.LatestID
+	}
+	latest := make(map[uint]database.Inbox, len(rows))
+	if len(latestIDs) > 0 {
+		var messages []database.Inbox
+		database.DB.Select("id, created_at, from_addr, to_addr, subject, body").Where("id IN ?", latestIDs).Find(&messages)
+		for _, m := range messages {
+			receiver.OpenInboxItem(&m)
+			latest[m.ID] = m
+		}
+	}
+
+	type ThreadSummary struct {
+		ThreadID     string `json:"thread_id"`
+		Subject      string `json:"subject"`
+		MessageCount int64  `json:"message_count"`
+		UnreadCount  int64  `json:"unread_count"`
+		LatestID     uint   `json:"latest_id"`
+		LatestAt     string `json:"latest_at"`
+		LatestFrom   string `json:"latest_from"`
+		ToAddr       string `json:"to_addr"`
+		Preview      string `json:"preview"`
+	}
+	items := make([]ThreadSummary, 0, len(rows))
+	for _, r := range rows {
+		m := latest[r.LatestID]
+		items = append(items, ThreadSummary{
+			ThreadID:     r.ThreadID,
+			Subject:      m.Subject,
+			MessageCount: r.MessageCount,
+			UnreadCount:  r.UnreadCount,
+			LatestID:     r.LatestID,
+			LatestAt:     m.CreatedAt.Format("2006-01-02 15:04:05"),
+			LatestFrom:   m.FromAddr,
+			ToAddr:       m.ToAddr,
+			Preview:      threadPreview(m.Body),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// threadPreview 生成会话预览文本 (纯文本，最多 120 字)
+func threadPreview(body string) string {
+	text := strings.Join(strings.Fields(mailer.HTMLToText(body)), " ")
+	runes := []rune(text)
+	if len(runes) > 120 {
+		return string(runes[:120]) + "…"
+	}
+	return text
+}
+
+// ExportInboxHandler 导出收件箱 (流式输出，遵循 q 搜索条件)
+// GET /api/v1/inbox/export?format=csv|json|mbox&q=
+func ExportInboxHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	var contentType, ext string
+	switch format {
+	case "csv":
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case "json":
+		contentType, ext = "application/json; charset=utf-8", "json"
+	case "mbox":
+		contentType, ext = "application/mbox", "mbox"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, json or mbox"})
+		return
+	}
+
+	filename := fmt.Sprintf("inbox_%s.%s", time.Now().Format("20060102"), ext)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	var csvWriter *csv.Writer
+	switch format {
+	case "csv":
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"id", "created_at", "from", "to", "subject", "is_read", "tags", "remote_ip"})
+	case "json":
+		w.WriteString("[")
+	}
+
+	// 分批读取，边查边写，避免一次性加载整个收件箱
+	first := true
+	var batch []database.Inbox
+	inboxSearchQuery(c).Order("id asc").FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+		for _, m := range batch {
+			if err := receiver.OpenInboxItem(&m); err != nil {
+				m.Body, m.RawData = "", ""
+			}
+			switch format {
+			case "csv":
+				csvWriter.Write([]string{
+					strconv.FormatUint(uint64(m.ID), 10),
+					m.CreatedAt.Format(time.RFC3339),
+					m.FromAddr, m.ToAddr, m.Subject,
+					strconv.FormatBool(m.IsRead), m.Tags, m.RemoteIP,
+				})
+			case "json":
+				if !first {
+					w.WriteString(",")
+				}
+				data, _ := json.Marshal(m)
+				w.Write(data)
+			case "mbox":
+				writeMboxMessage(w, m)
+			}
+			first = false
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		w.Flush()
+		return nil
+	})
+
+	if format == "json" {
+		w.WriteString("]")
+	}
+}
+
+// writeMboxMessage 以 mboxrd 格式写入一封邮件 ("From " 分隔行，正文中的 From 行加 > 转义)
+func writeMboxMessage(w io.Writer, m database.Inbox) {
+	sender := m.FromAddr
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+	fmt.Fprintf(w, "From %s %s\n", sender, m.CreatedAt.UTC().Format("Mon Jan _2 15:04:05 2006"))
+
+	raw := strings.ReplaceAll(m.RawData, "\r\n", "\n")
+	for _, line := range strings.Split(strings.TrimRight(raw, "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		io.WriteString(w, line+"\n")
+	}
+	io.WriteString(w, "\n")
+}
+
 // GetInboxItemHandler 获取邮件详情
 // GET /api/v1/inbox/:id
 func GetInboxItemHandler(c *gin.Context) {
@@ -95,6 +305,10 @@ func GetInboxItemHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
+	if err := receiver.OpenInboxItem(&msg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt message: " + err.Error()})
+		return
+	}
 
 	// 标记为已读
 	if !msg.IsRead {
@@ -105,6 +319,30 @@ func GetInboxItemHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, msg)
 }
 
+// GetInboxHeadersHandler 获取邮件的原始头部 (保持顺序与重复字段，?format=text 返回原始文本)
+// GET /api/v1/inbox/:id/headers
+func GetInboxHeadersHandler(c *gin.Context) {
+	id := c.Param("id")
+	var msg database.Inbox
+	if err := database.DB.Select("id, raw_data").First(&msg, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err := receiver.OpenInboxItem(&msg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt message: " + err.Error()})
+		return
+	}
+
+	if c.Query("format") == "text" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(receiver.HeaderBlock(msg.RawData)))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      msg.ID,
+		"headers": receiver.ParseHeaderList(msg.RawData),
+	})
+}
+
 // DeleteInboxItemHandler 删除邮件
 // DELETE /api/v1/inbox/:id
 func DeleteInboxItemHandler(c *gin.Context) {
@@ -235,9 +473,34 @@ func GetReceiverConfigHandler(c *gin.Context) {
 		"receiver_tls_key":     config.AppConfig.ReceiverTLSKey,
 		"receiver_rate_limit":  config.AppConfig.ReceiverRateLimit,
 		"receiver_max_msg_size": config.AppConfig.ReceiverMaxMsgSize,
+		"receiver_max_line_len": config.AppConfig.ReceiverMaxLineLen,
+		"receiver_max_msg_bytes": config.AppConfig.ReceiverMaxMsgBytes,
 		"receiver_spam_filter": config.AppConfig.ReceiverSpamFilter,
+		"receiver_spam_max_links":    config.AppConfig.ReceiverSpamMaxLinks,
+		"receiver_spam_caps_min_len": config.AppConfig.ReceiverSpamCapsMinLen,
+		"receiver_ptr_check":         config.AppConfig.ReceiverPTRCheck,
+		"receiver_ptr_reject":        config.AppConfig.ReceiverPTRReject,
 		"receiver_blacklist":   config.AppConfig.ReceiverBlacklist,
 		"receiver_require_tls": config.AppConfig.ReceiverRequireTLS,
+		"receiver_auth_required": config.AppConfig.ReceiverAuthRequired,
+		"receiver_trusted_ips":   config.AppConfig.ReceiverTrustedIPs,
+		"receiver_authserv_ids":  config.AppConfig.ReceiverAuthServIDs,
+		"receiver_dedupe_window": config.AppConfig.ReceiverDedupeWindow,
+		"receiver_max_received":  config.AppConfig.ReceiverMaxReceived,
+		"receiver_image_compress":       config.AppConfig.ReceiverImageCompress,
+		"receiver_image_min_size":       config.AppConfig.ReceiverImageMinSize,
+		"receiver_image_max_dim":        config.AppConfig.ReceiverImageMaxDim,
+		"receiver_image_quality":        config.AppConfig.ReceiverImageQuality,
+		"receiver_image_keep_original":  config.AppConfig.ReceiverImageKeepOriginal,
+		"receiver_contact_group_id": config.AppConfig.ReceiverContactGroupID,
+		"receiver_command_timeout": config.AppConfig.ReceiverCommandTimeout,
+		"receiver_data_timeout":    config.AppConfig.ReceiverDataTimeout,
+		"receiver_auto_block":           config.AppConfig.ReceiverAutoBlock,
+		"receiver_auto_block_threshold": config.AppConfig.ReceiverAutoBlockThreshold,
+		"receiver_auto_block_window":    config.AppConfig.ReceiverAutoBlockWindow,
+		"receiver_auto_block_ttl":       config.AppConfig.ReceiverAutoBlockTTL,
+		"forward_max_retries":           config.AppConfig.ForwardMaxRetries,
+		"forward_dsn":                   config.AppConfig.ForwardDSN,
 	})
 }
 
@@ -252,9 +515,37 @@ func UpdateReceiverConfigHandler(c *gin.Context) {
 		ReceiverTLSKey     *string `json:"receiver_tls_key"`
 		ReceiverRateLimit  *int    `json:"receiver_rate_limit"`
 		ReceiverMaxMsgSize *int    `json:"receiver_max_msg_size"`
+		ReceiverMaxLineLen *int    `json:"receiver_max_line_len"`
+		ReceiverMaxMsgBytes *int64 `json:"receiver_max_msg_bytes"`
 		ReceiverSpamFilter *bool   `json:"receiver_spam_filter"`
+		ReceiverSpamMaxLinks   *int `json:"receiver_spam_max_links"`
+		ReceiverSpamCapsMinLen *int `json:"receiver_spam_caps_min_len"`
+		ReceiverPTRCheck       *bool `json:"receiver_ptr_check"`
+		ReceiverPTRReject      *bool `json:"receiver_ptr_reject"`
 		ReceiverBlacklist  *string `json:"receiver_blacklist"`
 		ReceiverRequireTLS *bool   `json:"receiver_require_tls"`
+		ReceiverAuthRequired *bool   `json:"receiver_auth_required"`
+		ReceiverTrustedIPs   *string `json:"receiver_trusted_ips"`
+		ReceiverAuthServIDs  *string `json:"receiver_authserv_ids"`
+		ReceiverDedupeWindow *int  `json:"receiver_dedupe_window"`
+		ReceiverMaxReceived  *int  `json:"receiver_max_received"`
+
+		ReceiverImageCompress     *bool `json:"receiver_image_compress"`
+		ReceiverImageMinSize      *int  `json:"receiver_image_min_size"`
+		ReceiverImageMaxDim       *int  `json:"receiver_image_max_dim"`
+		ReceiverImageQuality      *int  `json:"receiver_image_quality"`
+		ReceiverImageKeepOriginal *bool `json:"receiver_image_keep_original"`
+		ReceiverContactGroupID *uint `json:"receiver_contact_group_id"`
+		ReceiverCommandTimeout *int  `json:"receiver_command_timeout"`
+		ReceiverDataTimeout    *int  `json:"receiver_data_timeout"`
+
+		ReceiverAutoBlock          *bool `json:"receiver_auto_block"`
+		ReceiverAutoBlockThreshold *int  `json:"receiver_auto_block_threshold"`
+		ReceiverAutoBlockWindow    *int  `json:"receiver_auto_block_window"`
+		ReceiverAutoBlockTTL       *int  `json:"receiver_auto_block_ttl"`
+
+		ForwardMaxRetries *int  `json:"forward_max_retries"`
+		ForwardDSN        *bool `json:"forward_dsn"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -262,6 +553,57 @@ func UpdateReceiverConfigHandler(c *gin.Context) {
 		return
 	}
 
+	// 先校验全部字段，任一字段无效时不修改任何配置
+	for name, v := range map[string]*int{
+		"receiver_auto_block_threshold": req.ReceiverAutoBlockThreshold,
+		"receiver_auto_block_window":    req.ReceiverAutoBlockWindow,
+		"receiver_auto_block_ttl":       req.ReceiverAutoBlockTTL,
+		"receiver_image_min_size":       req.ReceiverImageMinSize,
+		"receiver_image_max_dim":        req.ReceiverImageMaxDim,
+	} {
+		if v != nil && *v < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be >= 1"})
+			return
+		}
+	}
+	for name, v := range map[string]*int{
+		"receiver_command_timeout": req.ReceiverCommandTimeout,
+		"receiver_data_timeout":    req.ReceiverDataTimeout,
+	} {
+		if v != nil && *v < 10 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be >= 10"})
+			return
+		}
+	}
+	for name, v := range map[string]*int{
+		"forward_max_retries":    req.ForwardMaxRetries,
+		"receiver_dedupe_window": req.ReceiverDedupeWindow,
+	} {
+		if v != nil && *v < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be >= 0"})
+			return
+		}
+	}
+	if req.ReceiverMaxLineLen != nil && *req.ReceiverMaxLineLen < 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "receiver_max_line_len must be >= 1000"})
+		return
+	}
+	if req.ReceiverMaxMsgBytes != nil && *req.ReceiverMaxMsgBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "receiver_max_msg_bytes must be >= 0"})
+		return
+	}
+	if req.ReceiverImageQuality != nil && (*req.ReceiverImageQuality < 1 || *req.ReceiverImageQuality > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "receiver_image_quality must be between 1 and 100"})
+		return
+	}
+	if req.ReceiverContactGroupID != nil && *req.ReceiverContactGroupID > 0 {
+		var group database.ContactGroup
+		if err := database.DB.First(&group, *req.ReceiverContactGroupID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Contact group not found"})
+			return
+		}
+	}
+
 	// 更新配置
 	if req.EnableReceiver != nil {
 		config.AppConfig.EnableReceiver = *req.EnableReceiver
@@ -284,15 +626,90 @@ func UpdateReceiverConfigHandler(c *gin.Context) {
 	if req.ReceiverMaxMsgSize != nil {
 		config.AppConfig.ReceiverMaxMsgSize = *req.ReceiverMaxMsgSize
 	}
+	if req.ReceiverMaxLineLen != nil {
+		config.AppConfig.ReceiverMaxLineLen = *req.ReceiverMaxLineLen
+	}
+	if req.ReceiverMaxMsgBytes != nil {
+		config.AppConfig.ReceiverMaxMsgBytes = *req.ReceiverMaxMsgBytes
+	}
+	if req.ReceiverCommandTimeout != nil {
+		config.AppConfig.ReceiverCommandTimeout = *req.ReceiverCommandTimeout
+	}
+	if req.ReceiverDataTimeout != nil {
+		config.AppConfig.ReceiverDataTimeout = *req.ReceiverDataTimeout
+	}
+	if req.ReceiverAutoBlock != nil {
+		config.AppConfig.ReceiverAutoBlock = *req.ReceiverAutoBlock
+	}
+	if req.ReceiverAutoBlockThreshold != nil {
+		config.AppConfig.ReceiverAutoBlockThreshold = *req.ReceiverAutoBlockThreshold
+	}
+	if req.ReceiverAutoBlockWindow != nil {
+		config.AppConfig.ReceiverAutoBlockWindow = *req.ReceiverAutoBlockWindow
+	}
+	if req.ReceiverAutoBlockTTL != nil {
+		config.AppConfig.ReceiverAutoBlockTTL = *req.ReceiverAutoBlockTTL
+	}
+	if req.ForwardMaxRetries != nil {
+		config.AppConfig.ForwardMaxRetries = *req.ForwardMaxRetries
+	}
+	if req.ForwardDSN != nil {
+		config.AppConfig.ForwardDSN = *req.ForwardDSN
+	}
 	if req.ReceiverSpamFilter != nil {
 		config.AppConfig.ReceiverSpamFilter = *req.ReceiverSpamFilter
 	}
+	if req.ReceiverPTRCheck != nil {
+		config.AppConfig.ReceiverPTRCheck = *req.ReceiverPTRCheck
+	}
+	if req.ReceiverPTRReject != nil {
+		config.AppConfig.ReceiverPTRReject = *req.ReceiverPTRReject
+	}
+	if req.ReceiverSpamMaxLinks != nil {
+		config.AppConfig.ReceiverSpamMaxLinks = *req.ReceiverSpamMaxLinks
+	}
+	if req.ReceiverSpamCapsMinLen != nil {
+		config.AppConfig.ReceiverSpamCapsMinLen = *req.ReceiverSpamCapsMinLen
+	}
+	if req.ReceiverMaxReceived != nil {
+		config.AppConfig.ReceiverMaxReceived = *req.ReceiverMaxReceived
+	}
+	if req.ReceiverImageCompress != nil {
+		config.AppConfig.ReceiverImageCompress = *req.ReceiverImageCompress
+	}
+	if req.ReceiverImageKeepOriginal != nil {
+		config.AppConfig.ReceiverImageKeepOriginal = *req.ReceiverImageKeepOriginal
+	}
+	if req.ReceiverImageMinSize != nil {
+		config.AppConfig.ReceiverImageMinSize = *req.ReceiverImageMinSize
+	}
+	if req.ReceiverImageMaxDim != nil {
+		config.AppConfig.ReceiverImageMaxDim = *req.ReceiverImageMaxDim
+	}
+	if req.ReceiverImageQuality != nil {
+		config.AppConfig.ReceiverImageQuality = *req.ReceiverImageQuality
+	}
 	if req.ReceiverBlacklist != nil {
 		config.AppConfig.ReceiverBlacklist = *req.ReceiverBlacklist
 	}
+	if req.ReceiverAuthRequired != nil {
+		config.AppConfig.ReceiverAuthRequired = *req.ReceiverAuthRequired
+	}
+	if req.ReceiverTrustedIPs != nil {
+		config.AppConfig.ReceiverTrustedIPs = *req.ReceiverTrustedIPs
+	}
+	if req.ReceiverAuthServIDs != nil {
+		config.AppConfig.ReceiverAuthServIDs = *req.ReceiverAuthServIDs
+	}
 	if req.ReceiverRequireTLS != nil {
 		config.AppConfig.ReceiverRequireTLS = *req.ReceiverRequireTLS
 	}
+	if req.ReceiverDedupeWindow != nil {
+		config.AppConfig.ReceiverDedupeWindow = *req.ReceiverDedupeWindow
+	}
+	if req.ReceiverContactGroupID != nil {
+		config.AppConfig.ReceiverContactGroupID = *req.ReceiverContactGroupID
+	}
 
 	// 保存配置
 	if err := config.SaveConfig(config.AppConfig); err != nil {
@@ -305,3 +722,19 @@ func UpdateReceiverConfigHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Configuration updated"})
 }
+
+// ListAutoBlockedIPsHandler 获取当前被自动封禁的 IP
+// GET /api/v1/receiver/blocked
+func ListAutoBlockedIPsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": config.AppConfig.ReceiverAutoBlock,
+		"data":    receiver.AutoBlockedIPs(),
+	})
+}
+
+// ClearAutoBlockedIPHandler 手动解除自动封禁 (?ip= 为空时解除全部)
+// DELETE /api/v1/receiver/blocked
+func ClearAutoBlockedIPHandler(c *gin.Context) {
+	cleared := receiver.ClearAutoBlock(strings.TrimSpace(c.Query("ip")))
+	c.JSON(http.StatusOK, gin.H{"message": "Cleared", "cleared": cleared})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goemail/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateReceiverConfigValidatesBeforeApplying(t *testing.T) {
+	prev := config.AppConfig
+	defer func() { config.AppConfig = prev }()
+	config.AppConfig.ReceiverPort = "25"
+	config.AppConfig.ReceiverDedupeWindow = 5
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	// 端口与去重窗口本身有效，但同一请求中的图片质量无效，整个请求都不应生效
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/receiver/config",
+		strings.NewReader(`{"receiver_port":"2525","receiver_dedupe_window":30,"receiver_image_quality":0}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	UpdateReceiverConfigHandler(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if config.AppConfig.ReceiverPort != "25" || config.AppConfig.ReceiverDedupeWindow != 5 {
+		t.Errorf("config partially applied: port=%s dedupe=%d", config.AppConfig.ReceiverPort, config.AppConfig.ReceiverDedupeWindow)
+	}
+}
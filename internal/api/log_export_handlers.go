@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parseExportTime 解析导出时间参数，支持 YYYY-MM-DD 与 RFC3339
+// endOfDay 为 true 时仅日期的值取当天结束 (用于 end，使区间包含当天)
+func parseExportTime(value string, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// exportFilter 应用导出的公共筛选条件：?start=&end= 日期范围、?status= 状态
+func exportFilter(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if start := c.Query("start"); start != "" {
+		t, err := parseExportTime(start, false)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if end := c.Query("end"); end != "" {
+		t, err := parseExportTime(end, true)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at <= ?", t)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query, nil
+}
+
+// startCSVExport 设置下载响应头并返回 CSV 写入器
+func startCSVExport(c *gin.Context, name string, header []string) *csv.Writer {
+	filename := fmt.Sprintf("%s_%s.csv", name, time.Now().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+	return w
+}
+
+// ExportLogsHandler 导出发送日志 (流式输出)
+// GET /api/v1/logs/export.csv?start=&end=&status=&search=
+func ExportLogsHandler(c *gin.Context) {
+	query, err := exportFilter(c, database.DB.Model(&database.EmailLog{}).
+		Select("id, created_at, recipient, subject, status, error_msg, error_category, client_ip, channel, campaign_id, tracking_id, opened, clicked_count, unsubscribed"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search := c.Query("search"); search != "" {
+		query = query.Where("recipient LIKE ? OR subject LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	w := startCSVExport(c, "email_logs", []string{
+		"id", "created_at", "recipient", "subject", "status", "error", "error_category", "client_ip",
+		"channel", "campaign_id", "tracking_id", "opened", "clicked_count", "unsubscribed",
+	})
+
+	// 分批读取，边查边写，不受列表页 200 条上限限制
+	var batch []database.EmailLog
+	query.Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, l := range batch {
+			w.Write([]string{
+				strconv.FormatUint(uint64(l.ID), 10),
+				l.CreatedAt.Format(time.RFC3339),
+				l.Recipient, l.Subject, l.Status, l.ErrorMsg, l.ErrorCategory, l.ClientIP, l.Channel,
+				strconv.FormatUint(uint64(l.CampaignID), 10),
+				l.TrackingID,
+				strconv.FormatBool(l.Opened),
+				strconv.Itoa(l.ClickedCount),
+				strconv.FormatBool(l.Unsubscribed),
+			})
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return nil
+	})
+}
+
+// ExportForwardLogsHandler 导出转发日志 (流式输出)
+// GET /api/v1/forward-logs/export.csv?start=&end=&status=
+func ExportForwardLogsHandler(c *gin.Context) {
+	query, err := exportFilter(c, database.DB.Model(&database.ForwardLog{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w := startCSVExport(c, "forward_logs", []string{
+		"id", "created_at", "rule_id", "from", "to", "forward_to", "subject",
+		"status", "error", "remote_ip", "queue_id", "dsn_status",
+	})
+
+	var batch []database.ForwardLog
+	query.Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, l := range batch {
+			w.Write([]string{
+				strconv.FormatUint(uint64(l.ID), 10),
+				l.CreatedAt.Format(time.RFC3339),
+				strconv.FormatUint(uint64(l.RuleID), 10),
+				l.FromAddr, l.ToAddr, l.ForwardTo, l.Subject,
+				l.Status, l.ErrorMsg, l.RemoteIP,
+				strconv.FormatUint(uint64(l.QueueID), 10),
+				l.DSNStatus,
+			})
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return nil
+	})
+}
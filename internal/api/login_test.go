@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func TestCaptchaRequiredAfterFailures(t *testing.T) {
+	defer func() { config.AppConfig.LoginCaptchaAfter = 0 }()
+	ip := "203.0.113.9"
+	defer loginFailures.Delete(ip)
+
+	if !captchaRequired(ip) {
+		t.Fatal("captcha must always be required when login_captcha_after is 0")
+	}
+	config.AppConfig.LoginCaptchaAfter = 2
+	if captchaRequired(ip) {
+		t.Fatal("captcha required before any failure")
+	}
+	recordLoginFailure(ip)
+	if captchaRequired(ip) {
+		t.Fatal("captcha required after 1 of 2 failures")
+	}
+	recordLoginFailure(ip)
+	if !captchaRequired(ip) {
+		t.Fatal("captcha not required after reaching the threshold")
+	}
+}
+
+func TestLoginFailuresKeyedOnRemoteAddr(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	db.AutoMigrate(&database.User{})
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	db.Create(&database.User{Username: "admin", Password: string(hash)})
+	prevDB := database.DB
+	database.DB = db
+	defer func() { database.DB = prevDB }()
+
+	config.AppConfig.LoginCaptchaAfter = 3
+	config.AppConfig.JWTSecret = "test-secret"
+	defer func() {
+		config.AppConfig.LoginCaptchaAfter = 0
+		config.AppConfig.JWTSecret = ""
+	}()
+	ip := "198.51.100.7"
+	defer loginFailures.Delete(ip)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/login", LoginHandler)
+	login := func(password, forwardedFor string) int {
+		body := fmt.Sprintf(`{"username":"admin","password":%q}`, password)
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.RemoteAddr = ip + ":40000"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 每次伪造不同的 X-Forwarded-For，失败次数仍按连接地址累计
+	login("wrong", "10.0.0.1")
+	login("wrong", "10.0.0.2")
+	if n, _ := loginFailures.Get(ip); n != 2 {
+		t.Fatalf("failures for remote addr = %d, want 2", n)
+	}
+	if code := login("correct-horse", "10.0.0.3"); code != http.StatusOK {
+		t.Fatalf("login status = %d, want 200", code)
+	}
+	if n, ok := loginFailures.Get(ip); ok {
+		t.Errorf("failures = %d after a successful login, want cleared", n)
+	}
+}
+
+func TestLoginClientIP(t *testing.T) {
+	defer func() { config.AppConfig.TrustedProxies = "" }()
+	clientIP := func(remote, forwardedFor string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+		c.Request.RemoteAddr = remote + ":40000"
+		c.Request.Header.Set("X-Forwarded-For", forwardedFor)
+		return loginClientIP(c)
+	}
+
+	// 未配置受信代理时忽略 X-Forwarded-For
+	if got := clientIP("10.0.0.5", "203.0.113.9"); got != "10.0.0.5" {
+		t.Errorf("no trusted proxies: got %s, want connection address", got)
+	}
+	config.AppConfig.TrustedProxies = "10.0.0.0/8, 192.0.2.1"
+	if got := clientIP("10.0.0.5", "198.51.100.1, 203.0.113.9, 192.0.2.1"); got != "203.0.113.9" {
+		t.Errorf("trusted proxy chain: got %s, want 203.0.113.9", got)
+	}
+	if got := clientIP("198.51.100.7", "203.0.113.9"); got != "198.51.100.7" {
+		t.Errorf("untrusted peer: got %s, want connection address", got)
+	}
+	if got := clientIP("10.0.0.5", ""); got != "10.0.0.5" {
+		t.Errorf("no forwarded header: got %s, want proxy address", got)
+	}
+}
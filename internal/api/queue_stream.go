@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 队列事件流的超时与心跳
+const (
+	queueStreamDefaultTimeout = 5 * time.Minute
+	queueStreamMaxTimeout     = time.Hour
+	queueStreamHeartbeat      = 15 * time.Second
+)
+
+// QueueStreamHandler 以 Server-Sent Events 推送队列任务的状态变化及邮件的打开/点击事件
+// GET /api/v1/queue/:id/stream?timeout=秒
+// 连接建立后先推送一次当前状态；任务进入 dead 或无追踪的 completed 时关闭，
+// 已送达且带追踪 ID 的邮件继续推送打开/点击直至超时
+func QueueStreamHandler(c *gin.Context) {
+	timeout := queueStreamDefaultTimeout
+	if v, err := strconv.Atoi(c.Query("timeout")); err == nil && v > 0 {
+		timeout = min(time.Duration(v)*time.Second, queueStreamMaxTimeout)
+	}
+
+	var task database.EmailQueue
+	if err := database.DB.Select("id", "tracking_id").First(&task, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Queue item not found"})
+		return
+	}
+
+	// 先订阅再读取当前状态，避免两者之间发生的状态变化丢失
+	events, cancel := mailer.SubscribeQueue(task.ID, task.TrackingID)
+	defer cancel()
+	if err := database.DB.Select("id", "status", "error_msg", "tracking_id").First(&task, task.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Queue item not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止 Nginx 缓冲
+
+	send := func(ev mailer.QueueEvent) {
+		c.SSEvent(ev.Type, ev)
+		c.Writer.Flush()
+	}
+	// finished 任务状态已不会再变化，且没有后续追踪事件可推送 (已送达的追踪邮件继续推送打开/点击)
+	finished := func(status string) bool {
+		return mailer.IsTerminalQueueStatus(status) && (status == "dead" || task.TrackingID == "")
+	}
+
+	send(mailer.QueueEvent{QueueID: task.ID, Type: "status", Status: task.Status, Error: task.ErrorMsg, Time: time.Now()})
+	if finished(task.Status) {
+		c.SSEvent("end", gin.H{"reason": "terminal"})
+		return
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	heartbeat := time.NewTicker(queueStreamHeartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			c.SSEvent("end", gin.H{"reason": "timeout"})
+			return
+		case <-heartbeat.C:
+			c.Writer.WriteString(": ping\n\n")
+			c.Writer.Flush()
+		case ev := <-events:
+			ev.QueueID = task.ID
+			send(ev)
+			if ev.Type == "status" && finished(ev.Status) {
+				c.SSEvent("end", gin.H{"reason": "terminal"})
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+	"goemail/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 附件保存目录与单个附件大小上限
+const (
+	uploadDir         = "data/uploads"
+	maxAttachmentSize = 10 * 1024 * 1024
+)
+
+// maxSendRequestJSON multipart 请求中 request 字段 (发信参数 JSON) 的大小上限
+const maxSendRequestJSON = 2 * 1024 * 1024
+
+// uploadedFile 已流式写入临时文件的上传附件
+type uploadedFile struct {
+	Filename    string
+	ContentType string
+	Path        string // 临时文件路径 (data/uploads 内)
+	Size        int64
+	Hash        string
+	kept        bool // 已登记为正式附件，不再清理
+}
+
+// parseMultipartSend 解析 multipart/form-data 发信请求：request 字段为发信参数 JSON，其余文件部分作为附件
+// 文件逐个流式写入 data/uploads 下的临时文件并计算 SHA-256，不在内存中缓存完整内容
+// 调用方需在处理结束后调用 cleanupUploads 删除未被登记的临时文件
+func parseMultipartSend(c *gin.Context) (mailer.SendRequest, []*uploadedFile, error) {
+	var req mailer.SendRequest
+	var files []*uploadedFile
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return req, nil, fmt.Errorf("invalid multipart body: %v", err)
+	}
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return req, nil, err
+	}
+
+	gotRequest := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return req, files, fmt.Errorf("invalid multipart body: %v", err)
+		}
+
+		if part.FileName() == "" {
+			if part.FormName() == "request" {
+				data, err := io.ReadAll(io.LimitReader(part, maxSendRequestJSON+1))
+				if err != nil {
+					return req, files, err
+				}
+				if len(data) > maxSendRequestJSON {
+					return req, files, fmt.Errorf("request field exceeds %d bytes", maxSendRequestJSON)
+				}
+				if err := json.Unmarshal(data, &req); err != nil {
+					return req, files, fmt.Errorf("invalid request field: %v", err)
+				}
+				gotRequest = true
+			}
+			part.Close()
+			continue
+		}
+
+		f, err := saveUploadPart(part)
+		part.Close()
+		if f != nil {
+			files = append(files, f)
+		}
+		if err != nil {
+			return req, files, err
+		}
+	}
+	if !gotRequest {
+		return req, files, fmt.Errorf("missing request field")
+	}
+	return req, files, nil
+}
+
+// saveUploadPart 将单个文件部分写入临时文件，超过大小上限时返回错误
+func saveUploadPart(part *multipart.Part) (*uploadedFile, error) {
+	f := &uploadedFile{
+		Filename:    filepath.Base(part.FileName()),
+		ContentType: part.Header.Get("Content-Type"),
+		Path:        filepath.Join(uploadDir, fmt.Sprintf("%d_%s.upload", time.Now().UnixNano(), generateRandomKey()[:8])),
+	}
+
+	out, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hasher), io.LimitReader(part, maxAttachmentSize+1))
+	closeErr := out.Close()
+	f.Size = n
+	f.Hash = hex.EncodeToString(hasher.Sum(nil))
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return f, err
+	}
+	if n > maxAttachmentSize {
+		return f, fmt.Errorf("attachment %s exceeds limit (10MB)", f.Filename)
+	}
+	return f, nil
+}
+
+// cleanupUploads 删除未登记为正式附件的临时文件
+func cleanupUploads(files []*uploadedFile) {
+	for _, f := range files {
+		if !f.kept {
+			os.Remove(f.Path)
+		}
+	}
+}
+
+// scanUpload 对已落盘的上传附件做病毒扫描
+func scanUpload(f *uploadedFile) (string, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return security.ScanAttachmentReader(file)
+}
+
+// uploadAttachment 将上传附件转换为发信附件
+// 同步发送时读取为内联内容 (不经过队列，无法随队列记录释放文件)；异步发送时登记为 AttachmentFile 并以 local:// 引用，
+// 内容相同的已有文件直接复用 (引用计数 +1)
+func uploadAttachment(f *uploadedFile, inline bool, relatedTo string) (mailer.Attachment, error) {
+	att := mailer.Attachment{Filename: f.Filename, ContentType: f.ContentType}
+	if inline {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return att, err
+		}
+		att.Content = base64.StdEncoding.EncodeToString(data)
+		return att, nil
+	}
+
+	var existing database.AttachmentFile
+	if database.DB.Where("content_hash = ?", f.Hash).First(&existing).Error == nil {
+		// 计数未能增加说明记录已被清理任务删除，另存新文件
+		if _, err := os.Stat(existing.FilePath); err == nil &&
+			database.DB.Model(&existing).Update("ref_count", gorm.Expr("ref_count + ?", 1)).RowsAffected == 1 {
+			att.URL = "local://" + existing.FilePath
+			return att, nil
+		}
+	}
+
+	ext := filepath.Ext(f.Filename)
+	if ext == "" {
+		ext = ".dat"
+	}
+	localPath := filepath.Join(uploadDir, fmt.Sprintf("%d_%s%s", time.Now().UnixNano(), generateRandomKey()[:8], ext))
+	if err := os.Rename(f.Path, localPath); err != nil {
+		return att, err
+	}
+	f.kept = true
+	database.DB.Create(&database.AttachmentFile{
+		Filename:    f.Filename,
+		FilePath:    localPath,
+		FileSize:    f.Size,
+		ContentType: f.ContentType,
+		Source:      "api_upload",
+		RelatedTo:   relatedTo,
+		ContentHash: f.Hash,
+		RefCount:    1,
+	})
+	att.URL = "local://" + localPath
+	return att, nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUploadAttachmentDedup(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.AttachmentFile{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(hash string) *uploadedFile {
+		f := &uploadedFile{Filename: "a.txt", Hash: hash, Size: 5, Path: filepath.Join(uploadDir, hash+".upload")}
+		os.WriteFile(f.Path, []byte("hello"), 0644)
+		return f
+	}
+
+	// 已有文件仍在磁盘上：复用并增加引用计数
+	shared := filepath.Join(uploadDir, "shared.txt")
+	os.WriteFile(shared, []byte("hello"), 0644)
+	db.Create(&database.AttachmentFile{FilePath: shared, ContentHash: "h1", RefCount: 1})
+	f := upload("h1")
+	att, err := uploadAttachment(f, false, "to@example.com")
+	if err != nil || att.URL != "local://"+shared || f.kept {
+		t.Fatalf("dedup: url=%q kept=%v err=%v", att.URL, f.kept, err)
+	}
+	var rec database.AttachmentFile
+	db.Where("content_hash = ?", "h1").First(&rec)
+	if rec.RefCount != 2 {
+		t.Errorf("ref_count = %d, want 2", rec.RefCount)
+	}
+
+	// 记录对应的文件已被删除：另存新文件并登记新记录
+	db.Create(&database.AttachmentFile{FilePath: filepath.Join(uploadDir, "gone.txt"), ContentHash: "h2", RefCount: 1})
+	f = upload("h2")
+	att, err = uploadAttachment(f, false, "to@example.com")
+	if err != nil || !f.kept || att.URL == "local://"+filepath.Join(uploadDir, "gone.txt") {
+		t.Fatalf("fallback: url=%q kept=%v err=%v", att.URL, f.kept, err)
+	}
+	var count int64
+	db.Model(&database.AttachmentFile{}).Where("content_hash = ?", "h2").Count(&count)
+	if count != 2 {
+		t.Errorf("%d records for h2, want a new one alongside the stale record", count)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =======================
+// Sender Identity Handlers
+// =======================
+
+// ListSendersHandler 获取发件人身份列表 (含所属域名当前的验证状态)
+func ListSendersHandler(c *gin.Context) {
+	var senders []database.Sender
+	if err := database.DB.Order("id asc").Find(&senders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch senders"})
+		return
+	}
+
+	type SenderWithStatus struct {
+		database.Sender
+		Verified bool   `json:"verified"`
+		Warning  string `json:"warning,omitempty"`
+	}
+	results := make([]SenderWithStatus, 0, len(senders))
+	for _, s := range senders {
+		item := SenderWithStatus{Sender: s, Verified: true}
+		if err := mailer.VerifySenderDomain(s.Email); err != nil {
+			item.Verified = false
+			item.Warning = err.Error()
+		}
+		results = append(results, item)
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// CreateSenderHandler 创建发件人身份 (地址必须属于已验证的域名)
+func CreateSenderHandler(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+		Name  string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	sender := database.Sender{}
+	if err := applySenderFields(&sender, req.Email, req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&sender).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sender"})
+		return
+	}
+	c.JSON(http.StatusCreated, sender)
+}
+
+// UpdateSenderHandler 更新发件人身份
+func UpdateSenderHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var sender database.Sender
+	if err := database.DB.First(&sender, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sender not found"})
+		return
+	}
+
+	var req struct {
+		Email *string `json:"email"`
+		Name  *string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	email, name := sender.Email, sender.Name
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if err := applySenderFields(&sender, email, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&sender).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sender"})
+		return
+	}
+	c.JSON(http.StatusOK, sender)
+}
+
+// DeleteSenderHandler 删除发件人身份 (解除营销任务关联，任务保留原有的名称与地址)
+func DeleteSenderHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	database.DB.Model(&database.Campaign{}).Where("sender_identity_id = ?", id).Update("sender_identity_id", 0)
+	database.DB.Delete(&database.Sender{}, id)
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
+}
+
+// applySenderFields 校验并写入发件人地址与名称，要求地址唯一且所属域名已验证
+func applySenderFields(sender *database.Sender, email, name string) error {
+	email = strings.TrimSpace(email)
+	name = strings.TrimSpace(name)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("invalid sender email")
+	}
+	if strings.ContainsAny(name, "\r\n") {
+		return fmt.Errorf("sender name contains line break")
+	}
+
+	var count int64
+	database.DB.Model(&database.Sender{}).Where("LOWER(email) = ? AND id <> ?", strings.ToLower(email), sender.ID).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("sender %s already exists", email)
+	}
+
+	domain, err := mailer.LookupSenderDomain(email)
+	if err != nil {
+		return err
+	}
+	if err := mailer.VerifySenderDomain(email); err != nil {
+		return err
+	}
+
+	sender.Email = email
+	sender.Name = name
+	sender.DomainID = domain.ID
+	return nil
+}
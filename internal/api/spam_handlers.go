@@ -0,0 +1,140 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"goemail/internal/database"
+	"goemail/internal/receiver"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =======================
+// Spam Keyword Handlers
+// =======================
+
+// ListSpamKeywordsHandler 获取垃圾邮件关键词列表
+// GET /api/v1/receiver/spam-keywords
+func ListSpamKeywordsHandler(c *gin.Context) {
+	var keywords []database.SpamKeyword
+	if err := database.DB.Order("id asc").Find(&keywords).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch spam keywords"})
+		return
+	}
+	c.JSON(http.StatusOK, keywords)
+}
+
+// CreateSpamKeywordHandler 添加垃圾邮件关键词
+// POST /api/v1/receiver/spam-keywords
+func CreateSpamKeywordHandler(c *gin.Context) {
+	var req struct {
+		Keyword string `json:"keyword" binding:"required"`
+		Target  string `json:"target"` // subject / body / both，默认 both
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	keyword := database.SpamKeyword{Enabled: true}
+	if req.Enabled != nil {
+		keyword.Enabled = *req.Enabled
+	}
+	if err := applySpamKeywordFields(&keyword, req.Keyword, req.Target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&keyword).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create spam keyword"})
+		return
+	}
+	receiver.ReloadSpamKeywords()
+	c.JSON(http.StatusCreated, keyword)
+}
+
+// UpdateSpamKeywordHandler 更新垃圾邮件关键词
+// PUT /api/v1/receiver/spam-keywords/:id
+func UpdateSpamKeywordHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var keyword database.SpamKeyword
+	if err := database.DB.First(&keyword, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Spam keyword not found"})
+		return
+	}
+
+	var req struct {
+		Keyword *string `json:"keyword"`
+		Target  *string `json:"target"`
+		Enabled *bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	text, target := keyword.Keyword, keyword.Target
+	if req.Keyword != nil {
+		text = *req.Keyword
+	}
+	if req.Target != nil {
+		target = *req.Target
+	}
+	if req.Enabled != nil {
+		keyword.Enabled = *req.Enabled
+	}
+	if err := applySpamKeywordFields(&keyword, text, target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&keyword).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update spam keyword"})
+		return
+	}
+	receiver.ReloadSpamKeywords()
+	c.JSON(http.StatusOK, keyword)
+}
+
+// DeleteSpamKeywordHandler 删除垃圾邮件关键词
+// DELETE /api/v1/receiver/spam-keywords/:id
+func DeleteSpamKeywordHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	database.DB.Delete(&database.SpamKeyword{}, id)
+	receiver.ReloadSpamKeywords()
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
+}
+
+// applySpamKeywordFields 校验并写入关键词与匹配范围，同一范围内关键词不区分大小写唯一
+func applySpamKeywordFields(keyword *database.SpamKeyword, text, target string) error {
+	text = strings.TrimSpace(text)
+	target = strings.ToLower(strings.TrimSpace(target))
+	if text == "" {
+		return fmt.Errorf("keyword is required")
+	}
+	if target == "" {
+		target = "both"
+	}
+	if target != "subject" && target != "body" && target != "both" {
+		return fmt.Errorf("target must be subject, body or both")
+	}
+
+	var count int64
+	database.DB.Model(&database.SpamKeyword{}).
+		Where("LOWER(keyword) = ? AND target = ? AND id <> ?", strings.ToLower(text), target, keyword.ID).
+		Count(&count)
+	if count > 0 {
+		return fmt.Errorf("keyword %q already exists for target %s", text, target)
+	}
+
+	keyword.Keyword = text
+	keyword.Target = target
+	return nil
+}
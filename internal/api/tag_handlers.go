@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"goemail/internal/database"
+	"goemail/internal/receiver"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagPattern 标签仅允许小写字母、数字、下划线与连字符，保证 JSON 中的 LIKE 过滤无需转义
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// normalizeTag 规范化并校验标签
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(tag) {
+		return "", fmt.Errorf("tag must be 1-50 characters of a-z, 0-9, _ or -")
+	}
+	return tag, nil
+}
+
+// =======================
+// Tag Rule Handlers
+// =======================
+
+// ListTagRulesHandler 获取自动打标签规则列表
+// GET /api/v1/receiver/tag-rules
+func ListTagRulesHandler(c *gin.Context) {
+	var rules []database.TagRule
+	if err := database.DB.Order("id asc").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateTagRuleHandler 添加自动打标签规则
+// POST /api/v1/receiver/tag-rules
+func CreateTagRuleHandler(c *gin.Context) {
+	var req struct {
+		Tag     string `json:"tag" binding:"required"`
+		Field   string `json:"field" binding:"required"` // sender_domain / subject / auth
+		Value   string `json:"value" binding:"required"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	rule := database.TagRule{Enabled: true}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := applyTagRuleFields(&rule, req.Tag, req.Field, req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag rule"})
+		return
+	}
+	receiver.ReloadTagRules()
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateTagRuleHandler 更新自动打标签规则
+// PUT /api/v1/receiver/tag-rules/:id
+func UpdateTagRuleHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var rule database.TagRule
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag rule not found"})
+		return
+	}
+
+	var req struct {
+		Tag     *string `json:"tag"`
+		Field   *string `json:"field"`
+		Value   *string `json:"value"`
+		Enabled *bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	tag, field, value := rule.Tag, rule.Field, rule.Value
+	if req.Tag != nil {
+		tag = *req.Tag
+	}
+	if req.Field != nil {
+		field = *req.Field
+	}
+	if req.Value != nil {
+		value = *req.Value
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := applyTagRuleFields(&rule, tag, field, value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag rule"})
+		return
+	}
+	receiver.ReloadTagRules()
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteTagRuleHandler 删除自动打标签规则
+// DELETE /api/v1/receiver/tag-rules/:id
+func DeleteTagRuleHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	database.DB.Delete(&database.TagRule{}, id)
+	receiver.ReloadTagRules()
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
+}
+
+// applyTagRuleFields 校验并写入规则字段
+func applyTagRuleFields(rule *database.TagRule, tag, field, value string) error {
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	field = strings.ToLower(strings.TrimSpace(field))
+	value = strings.TrimSpace(value)
+	switch field {
+	case "sender_domain":
+		value = strings.TrimPrefix(strings.ToLower(value), "@")
+	case "subject":
+	case "auth":
+		// 形如 spf=fail / dkim=pass / dmarc=fail
+		value = strings.ToLower(value)
+		if method, result, ok := strings.Cut(value, "="); !ok || method == "" || result == "" {
+			return fmt.Errorf("auth value must look like spf=fail, dkim=pass or dmarc=fail")
+		}
+	default:
+		return fmt.Errorf("field must be sender_domain, subject or auth")
+	}
+	if value == "" {
+		return fmt.Errorf("value is required")
+	}
+
+	rule.Tag = tag
+	rule.Field = field
+	rule.Value = value
+	return nil
+}
+
+// =======================
+// Inbox Tag Handlers
+// =======================
+
+// ListInboxTagsHandler 列出收件箱中使用的标签及邮件数
+// GET /api/v1/inbox/tags
+func ListInboxTagsHandler(c *gin.Context) {
+	type tagRow struct {
+		Tags  string
+		Count int64
+	}
+	var rows []tagRow
+	if err := database.DB.Model(&database.Inbox{}).
+		Select("tags, COUNT(*) AS count").
+		Where("tags <> ''").
+		Group("tags").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		for _, tag := range parseTags(row.Tags) {
+			counts[tag] += row.Count
+		}
+	}
+	type tagCount struct {
+		Tag   string `json:"tag"`
+		Count int64  `json:"count"`
+	}
+	items := make([]tagCount, 0, len(counts))
+	for tag, n := range counts {
+		items = append(items, tagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Tag < items[j].Tag
+	})
+	c.JSON(http.StatusOK, items)
+}
+
+// UpdateInboxTagsHandler 手动设置邮件的标签 (整体替换)
+// PUT /api/v1/inbox/:id/tags  body: {"tags": ["support", "vip"]}
+func UpdateInboxTagsHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range req.Tags {
+		tag, err := normalizeTag(t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	value := ""
+	if len(tags) > 0 {
+		data, _ := json.Marshal(tags)
+		value = string(data)
+	}
+
+	result := database.DB.Model(&database.Inbox{}).Where("id = ?", id).Update("tags", value)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tags"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// parseTags 解析 Inbox.Tags 中的 JSON 标签数组，格式错误时返回 nil
+func parseTags(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(value), &tags); err != nil {
+		return nil
+	}
+	return tags
+}
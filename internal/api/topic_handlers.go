@@ -0,0 +1,256 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"goemail/internal/database"
+	"goemail/internal/locale"
+	"goemail/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =======================
+// Unsubscribe Topic Handlers
+// =======================
+
+// ListTopicsHandler 获取退订主题列表 (含退订人数)
+func ListTopicsHandler(c *gin.Context) {
+	var topics []database.UnsubscribeTopic
+	if err := database.DB.Order("id asc").Find(&topics).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch topics"})
+		return
+	}
+
+	type TopicWithCount struct {
+		database.UnsubscribeTopic
+		UnsubscribeCount int64 `json:"unsubscribe_count"`
+	}
+	results := make([]TopicWithCount, 0, len(topics))
+	for _, t := range topics {
+		var count int64
+		database.DB.Model(&database.TopicUnsubscribe{}).Where("topic_id = ?", t.ID).Count(&count)
+		results = append(results, TopicWithCount{UnsubscribeTopic: t, UnsubscribeCount: count})
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// CreateTopicHandler 创建退订主题
+func CreateTopicHandler(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	topic := database.UnsubscribeTopic{Name: strings.TrimSpace(req.Name), Description: req.Description}
+	if err := database.DB.Create(&topic).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create topic"})
+		return
+	}
+	c.JSON(http.StatusCreated, topic)
+}
+
+// UpdateTopicHandler 更新退订主题
+func UpdateTopicHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var topic database.UnsubscribeTopic
+	if err := database.DB.First(&topic, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Topic not found"})
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+		topic.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		topic.Description = *req.Description
+	}
+
+	if err := database.DB.Save(&topic).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update topic"})
+		return
+	}
+	c.JSON(http.StatusOK, topic)
+}
+
+// DeleteTopicHandler 删除退订主题 (同时删除退订记录，并解除营销任务关联)
+func DeleteTopicHandler(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	database.DB.Model(&database.Campaign{}).Where("topic_id = ?", id).Update("topic_id", 0)
+	database.DB.Where("topic_id = ?", id).Delete(&database.TopicUnsubscribe{})
+	database.DB.Delete(&database.UnsubscribeTopic{}, id)
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
+}
+
+// =======================
+// Preference Center (公开页面，通过追踪 ID 或签名的联系人令牌识别收件人)
+// =======================
+
+var preferencePageTmpl = template.Must(template.New("preferences").Parse(`<!DOCTYPE html>
+<html{{if .Lang}} lang="{{.Lang}}"{{end}}><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>body{font-family:Arial,sans-serif;max-width:480px;margin:40px auto;color:#333;padding:0 16px}label{display:block;margin:10px 0}.desc{color:#888;font-size:12px;margin-left:24px}.msg{background:#f0f9ff;border-left:4px solid #2563eb;padding:10px;margin-bottom:20px}button{background:#2563eb;color:#fff;border:0;padding:8px 20px;border-radius:4px;cursor:pointer}</style>
+</head><body>
+<h2>{{.Title}}</h2>
+{{if .Message}}<div class="msg">{{.Message}}</div>{{end}}
+<p>{{.Email}}</p>
+<form method="POST" action="{{.Action}}">
+{{range .Topics}}<label><input type="checkbox" name="topic" value="{{.ID}}"{{if .Subscribed}} checked{{end}}> {{.Name}}</label>{{if .Description}}<div class="desc">{{.Description}}</div>{{end}}
+{{end}}<hr>
+<label><input type="checkbox" name="unsubscribe_all" value="1"{{if .UnsubscribedAll}} checked{{end}}> {{.UnsubscribeAllLabel}}</label>
+<button type="submit">{{.SaveLabel}}</button>
+</form>
+</body></html>`))
+
+// renderPreferencePage 渲染订阅偏好页面，action 为表单提交地址
+func renderPreferencePage(c *gin.Context, action, email, message string) {
+	email = strings.ToLower(email)
+
+	var topics []database.UnsubscribeTopic
+	database.DB.Order("id asc").Find(&topics)
+
+	var suppressedIDs []uint
+	database.DB.Model(&database.TopicUnsubscribe{}).Where("email = ?", email).Pluck("topic_id", &suppressedIDs)
+	suppressed := make(map[uint]bool, len(suppressedIDs))
+	for _, id := range suppressedIDs {
+		suppressed[id] = true
+	}
+
+	type topicView struct {
+		ID          uint
+		Name        string
+		Description string
+		Subscribed  bool
+	}
+	views := make([]topicView, 0, len(topics))
+	for _, t := range topics {
+		views = append(views, topicView{ID: t.ID, Name: t.Name, Description: t.Description, Subscribed: !suppressed[t.ID]})
+	}
+
+	var unsubscribedCount int64
+	database.DB.Model(&database.Contact{}).Where("LOWER(email) = ? AND status = 'unsubscribed'", email).Count(&unsubscribedCount)
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	preferencePageTmpl.Execute(c.Writer, gin.H{
+		"Action":          action,
+		"Email":           email,
+		"Message":         message,
+		"Topics":          views,
+		"UnsubscribedAll": unsubscribedCount > 0,
+
+		"Lang":                locale.Current(),
+		"Title":               locale.T("preferences.title"),
+		"UnsubscribeAllLabel": locale.T("preferences.all"),
+		"SaveLabel":           locale.T("preferences.save"),
+	})
+}
+
+// PreferencesHandler 订阅偏好页面
+// GET /api/v1/track/preferences/:id
+func PreferencesHandler(c *gin.Context) {
+	trackingID := c.Param("id")
+	var log database.EmailLog
+	if err := database.DB.Where("tracking_id = ?", trackingID).First(&log).Error; err != nil {
+		c.String(http.StatusNotFound, locale.T("preferences.invalid_link"))
+		return
+	}
+	renderPreferencePage(c, "/api/v1/track/preferences/"+trackingID, log.Recipient, "")
+}
+
+// UpdatePreferencesHandler 保存订阅偏好 (勾选的主题为订阅，未勾选的为退订)
+// POST /api/v1/track/preferences/:id
+func UpdatePreferencesHandler(c *gin.Context) {
+	trackingID := c.Param("id")
+	var log database.EmailLog
+	if err := database.DB.Where("tracking_id = ?", trackingID).First(&log).Error; err != nil {
+		c.String(http.StatusNotFound, locale.T("preferences.invalid_link"))
+		return
+	}
+	savePreferences(c, log.Recipient)
+	renderPreferencePage(c, "/api/v1/track/preferences/"+trackingID, log.Recipient, locale.T("preferences.saved"))
+}
+
+// savePreferences 按提交的表单保存收件人的主题订阅与全局退订状态
+func savePreferences(c *gin.Context, recipient string) {
+	email := strings.ToLower(recipient)
+
+	subscribed := make(map[uint]bool)
+	for _, v := range c.PostFormArray("topic") {
+		if id, err := strconv.ParseUint(v, 10, 64); err == nil {
+			subscribed[uint(id)] = true
+		}
+	}
+
+	var topics []database.UnsubscribeTopic
+	database.DB.Find(&topics)
+	for _, t := range topics {
+		if subscribed[t.ID] {
+			database.DB.Where("email = ? AND topic_id = ?", email, t.ID).Delete(&database.TopicUnsubscribe{})
+		} else {
+			database.DB.Where(database.TopicUnsubscribe{Email: email, TopicID: t.ID}).
+				FirstOrCreate(&database.TopicUnsubscribe{})
+		}
+	}
+
+	// 全局退订 / 恢复订阅
+	if c.PostForm("unsubscribe_all") == "1" {
+		database.DB.Model(&database.Contact{}).Where("LOWER(email) = ?", email).Update("status", "unsubscribed")
+	} else {
+		database.DB.Model(&database.Contact{}).Where("LOWER(email) = ? AND status = 'unsubscribed'", email).Update("status", "active")
+	}
+}
+
+// preferenceContact 校验签名令牌并返回对应的联系人
+func preferenceContact(c *gin.Context) (*database.Contact, bool) {
+	token := c.Param("token")
+	id, ok := mailer.VerifyPreferenceToken(token)
+	var contact database.Contact
+	if !ok || database.DB.First(&contact, id).Error != nil {
+		c.String(http.StatusNotFound, locale.T("preferences.invalid_link"))
+		return nil, false
+	}
+	return &contact, true
+}
+
+// ContactPreferencesHandler 联系人订阅偏好中心 (签名链接标识联系人而非单封邮件，长期有效)
+// GET /api/v1/track/manage/:token
+func ContactPreferencesHandler(c *gin.Context) {
+	contact, ok := preferenceContact(c)
+	if !ok {
+		return
+	}
+	renderPreferencePage(c, "/api/v1/track/manage/"+c.Param("token"), contact.Email, "")
+}
+
+// UpdateContactPreferencesHandler 保存联系人订阅偏好
+// POST /api/v1/track/manage/:token
+func UpdateContactPreferencesHandler(c *gin.Context) {
+	contact, ok := preferenceContact(c)
+	if !ok {
+		return
+	}
+	savePreferences(c, contact.Email)
+	renderPreferencePage(c, "/api/v1/track/manage/"+c.Param("token"), contact.Email, locale.T("preferences.saved"))
+}
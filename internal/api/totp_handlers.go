@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,17 +14,9 @@ import (
 	"goemail/internal/database"
 )
 
-// 临时存储 TOTP 设置会话 (用于绑定确认)
+// 临时存储 TOTP 设置会话 (用于绑定确认，5 分钟有效)
 // key: username, value: secret (Base32)
-var totpSetupSessions = struct {
-	sync.RWMutex
-	sessions map[string]totpSetupSession
-}{sessions: make(map[string]totpSetupSession)}
-
-type totpSetupSession struct {
-	Secret    string
-	ExpiresAt time.Time
-}
+var totpSetupSessions = newTTLCache[string](1000, 5*time.Minute)
 
 // TOTPSetupHandler 生成 TOTP 密钥和二维码
 // GET /api/v1/totp/setup
@@ -65,12 +56,7 @@ func TOTPSetupHandler(c *gin.Context) {
 	}
 
 	// 存储临时会话 (5分钟有效期)
-	totpSetupSessions.Lock()
-	totpSetupSessions.sessions[usernameStr] = totpSetupSession{
-		Secret:    key.Secret(),
-		ExpiresAt: time.Now().Add(5 * time.Minute),
-	}
-	totpSetupSessions.Unlock()
+	totpSetupSessions.Set(usernameStr, key.Secret())
 
 	c.JSON(http.StatusOK, gin.H{
 		"secret":  key.Secret(), // Base32 格式，供手动输入
@@ -100,18 +86,15 @@ func TOTPEnableHandler(c *gin.Context) {
 	usernameStr := username.(string)
 
 	// 获取临时会话中的密钥
-	totpSetupSessions.RLock()
-	session, exists := totpSetupSessions.sessions[usernameStr]
-	totpSetupSessions.RUnlock()
-
-	if !exists || time.Now().After(session.ExpiresAt) {
+	secret, exists := totpSetupSessions.Get(usernameStr)
+	if !exists {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "设置会话已过期，请重新获取二维码"})
 		return
 	}
 
 	// 验证 TOTP 码
 	code := strings.TrimSpace(req.Code)
-	if !auth.ValidateTOTP(session.Secret, code) {
+	if !auth.ValidateTOTP(secret, code) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误，请检查后重试"})
 		return
 	}
@@ -123,7 +106,7 @@ func TOTPEnableHandler(c *gin.Context) {
 		return
 	}
 
-	user.TOTPSecret = session.Secret
+	user.TOTPSecret = secret
 	user.TOTPEnabled = true
 
 	if err := database.DB.Save(&user).Error; err != nil {
@@ -132,9 +115,7 @@ func TOTPEnableHandler(c *gin.Context) {
 	}
 
 	// 清理临时会话
-	totpSetupSessions.Lock()
-	delete(totpSetupSessions.sessions, usernameStr)
-	totpSetupSessions.Unlock()
+	totpSetupSessions.Delete(usernameStr)
 
 	c.JSON(http.StatusOK, gin.H{"message": "两步验证已启用"})
 }
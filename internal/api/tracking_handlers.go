@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"goemail/internal/database"
+	"goemail/internal/locale"
+	"goemail/internal/mailer"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -45,6 +47,19 @@ func validateRedirectURL(targetURL string) bool {
 	return true
 }
 
+// recordTrackingEvent 记录单次追踪事件，供统计明细与按天汇总使用
+func recordTrackingEvent(c *gin.Context, log database.EmailLog, eventType, targetURL string) {
+	database.DB.Create(&database.TrackingEvent{
+		EmailLogID: log.ID,
+		CampaignID: log.CampaignID,
+		Type:       eventType,
+		URL:        targetURL,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	})
+	mailer.PublishTrackingEvent(log.TrackingID, eventType, targetURL)
+}
+
 // TrackOpenHandler 处理邮件打开追踪像素
 // GET /api/v1/track/open/:id
 func TrackOpenHandler(c *gin.Context) {
@@ -53,6 +68,8 @@ func TrackOpenHandler(c *gin.Context) {
 	// 1. 查找邮件日志
 	var log database.EmailLog
 	if err := database.DB.Where("tracking_id = ?", trackingID).First(&log).Error; err == nil {
+		recordTrackingEvent(c, log, "open", "")
+
 		// 2. 更新打开状态 (如果尚未打开)
 		if !log.Opened {
 			now := time.Now()
@@ -85,13 +102,28 @@ func UnsubscribeHandler(c *gin.Context) {
 	// 1. 查找邮件日志
 	var log database.EmailLog
 	if err := database.DB.Where("tracking_id = ?", trackingID).First(&log).Error; err != nil {
-		c.String(http.StatusNotFound, "Invalid unsubscribe link.")
+		c.String(http.StatusNotFound, locale.T("unsubscribe.invalid_link"))
 		return
 	}
 
+	// 营销任务关联了退订主题时，只退订该主题
+	var topic database.UnsubscribeTopic
+	hasTopic := false
+	if log.CampaignID > 0 {
+		var campaign database.Campaign
+		if err := database.DB.Select("id", "topic_id").First(&campaign, log.CampaignID).Error; err == nil && campaign.TopicID > 0 {
+			hasTopic = database.DB.First(&topic, campaign.TopicID).Error == nil
+		}
+	}
+
 	// 2. 标记日志为已退订
 	if !log.Unsubscribed {
-		database.DB.Model(&log).Update("unsubscribed", true)
+		recordTrackingEvent(c, log, "unsubscribe", "")
+
+		database.DB.Model(&log).Updates(map[string]interface{}{
+			"unsubscribed":    true,
+			"unsubscribed_at": time.Now(),
+		})
 
 		// 3. 增加 Campaign 的退订计数
 		if log.CampaignID > 0 {
@@ -99,15 +131,25 @@ func UnsubscribeHandler(c *gin.Context) {
 				UpdateColumn("unsubscribe_count", gorm.Expr("unsubscribe_count + ?", 1))
 		}
 
-		// 4. 将联系人状态标记为 unsubscribed
-		// 注意：EmailLog 中只有 recipient 字符串，我们需要找到对应的 Contact
-		var contact database.Contact
-		if err := database.DB.Where("email = ?", log.Recipient).First(&contact).Error; err == nil {
-			database.DB.Model(&contact).Update("status", "unsubscribed")
+		if hasTopic {
+			// 4a. 记录主题退订
+			database.DB.Where(database.TopicUnsubscribe{Email: strings.ToLower(log.Recipient), TopicID: topic.ID}).
+				FirstOrCreate(&database.TopicUnsubscribe{})
+		} else {
+			// 4b. 将联系人状态标记为 unsubscribed
+			// 注意：EmailLog 中只有 recipient 字符串，我们需要找到对应的 Contact
+			var contact database.Contact
+			if err := database.DB.Where("email = ?", log.Recipient).First(&contact).Error; err == nil {
+				database.DB.Model(&contact).Update("status", "unsubscribed")
+			}
 		}
 	}
 
-	c.String(http.StatusOK, "You have been successfully unsubscribed. We're sorry to see you go.")
+	message := locale.T("unsubscribe.success")
+	if hasTopic {
+		message = locale.T("unsubscribe.topic", topic.Name)
+	}
+	renderPreferencePage(c, trackingID, log.Recipient, message)
 }
 
 // TrackClickHandler 处理点击追踪
@@ -133,8 +175,13 @@ func TrackClickHandler(c *gin.Context) {
 	// 1. 查找日志
 	var log database.EmailLog
 	if err := database.DB.Where("tracking_id = ?", trackingID).First(&log).Error; err == nil {
-		// 2. 增加点击数
+		recordTrackingEvent(c, log, "click", targetURL)
+
+		// 2. 增加点击数 (记录首次点击时间)
 		database.DB.Model(&log).UpdateColumn("clicked_count", gorm.Expr("clicked_count + ?", 1))
+		if log.ClickedAt == nil {
+			database.DB.Model(&log).UpdateColumn("clicked_at", time.Now())
+		}
 
 		// 3. 增加 Campaign 点击数
 		if log.CampaignID > 0 {
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCache 并发安全的内存缓存：每个条目独立过期，超出容量时淘汰最久未使用的条目 (LRU)
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	order   *list.List // 队首为最近使用
+	items   map[string]*list.Element
+	now     func() time.Time
+}
+
+type ttlCacheEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// newTTLCache 创建缓存，maxSize <= 0 表示不限制容量
+func newTTLCache[V any](maxSize int, ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Set 写入条目 (覆盖同名条目并重新计时)，容量已满时先清理过期条目，仍不足则淘汰最久未使用的条目
+func (c *ttlCache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+// set 写入条目，调用方需持有锁
+func (c *ttlCache[V]) set(key string, value V) {
+	now := c.now()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*ttlCacheEntry[V])
+		entry.value = value
+		entry.expiresAt = now.Add(c.ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+	if c.maxSize > 0 && len(c.items) >= c.maxSize {
+		c.evictExpired(now)
+		for len(c.items) >= c.maxSize {
+			c.remove(c.order.Back())
+		}
+	}
+	c.items[key] = c.order.PushFront(&ttlCacheEntry[V]{key: key, value: value, expiresAt: now.Add(c.ttl)})
+}
+
+// Get 读取未过期的条目并标记为最近使用
+func (c *ttlCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.lookup(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*ttlCacheEntry[V]).value, true
+}
+
+// Take 读取并删除条目 (一次性凭据，如验证码)
+func (c *ttlCache[V]) Take(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.lookup(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.remove(el)
+	return el.Value.(*ttlCacheEntry[V]).value, true
+}
+
+// Update 在同一把锁内读取并写回条目 (原子的读-改-写，如计数)，返回写入的新值
+func (c *ttlCache[V]) Update(key string, fn func(old V, ok bool) V) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var old V
+	el, ok := c.lookup(key)
+	if ok {
+		old = el.Value.(*ttlCacheEntry[V]).value
+	}
+	value := fn(old, ok)
+	c.set(key, value)
+	return value
+}
+
+// Delete 删除条目
+func (c *ttlCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len 返回当前条目数 (可能包含尚未清理的过期条目)
+func (c *ttlCache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// lookup 查找条目，已过期的条目会被顺带删除
+func (c *ttlCache[V]) lookup(key string) (*list.Element, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(el.Value.(*ttlCacheEntry[V]).expiresAt) {
+		c.remove(el)
+		return nil, false
+	}
+	return el, true
+}
+
+func (c *ttlCache[V]) evictExpired(now time.Time) {
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		if !now.Before(el.Value.(*ttlCacheEntry[V]).expiresAt) {
+			c.remove(el)
+		}
+		el = prev
+	}
+}
+
+func (c *ttlCache[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*ttlCacheEntry[V]).key)
+}
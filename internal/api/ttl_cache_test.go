@@ -0,0 +1,71 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCache(maxSize int, ttl time.Duration) (*ttlCache[string], *time.Time) {
+	now := time.Unix(1700000000, 0)
+	c := newTTLCache[string](maxSize, ttl)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestTTLCacheExpiry(t *testing.T) {
+	c, now := newTestCache(10, time.Minute)
+	c.Set("a", "1")
+	*now = now.Add(30 * time.Second)
+	c.Set("b", "2")
+
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Fatalf("Get(a) = %q, %v before expiry", v, ok)
+	}
+	*now = now.Add(31 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should have expired")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b expired early")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expired entry not removed on lookup, len = %d", c.Len())
+	}
+
+	if v, ok := c.Take("b"); !ok || v != "2" {
+		t.Errorf("Take(b) = %q, %v", v, ok)
+	}
+	if _, ok := c.Take("b"); ok {
+		t.Error("Take must remove the entry")
+	}
+}
+
+func TestTTLCacheEviction(t *testing.T) {
+	c, now := newTestCache(3, time.Minute)
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3")
+	c.Get("a") // a 成为最近使用，b 最久未使用
+	c.Set("d", "4")
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry b should be evicted")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s evicted, want kept", k)
+		}
+	}
+
+	// 已满时优先清理过期条目，不淘汰仍有效的条目
+	*now = now.Add(50 * time.Second)
+	c.Set("a", "1") // 刷新 a 的过期时间
+	*now = now.Add(20 * time.Second)
+	c.Set("e", "5")
+	if _, ok := c.Get("a"); !ok {
+		t.Error("unexpired entry a evicted while expired entries existed")
+	}
+	if c.Len() != 2 {
+		t.Errorf("len = %d, want 2 (a, e)", c.Len())
+	}
+}
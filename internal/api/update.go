@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"goemail/internal/config"
+	"goemail/internal/jobs"
 
 	"github.com/gin-gonic/gin"
 	"github.com/minio/selfupdate"
@@ -381,6 +382,11 @@ func doUpdate(downloadURL, fileName string) error {
 	}
 
 	fmt.Println("[Update] 文件替换成功！")
+
+	// 更新后钩子：默认仅作通知，配置为必需时失败则不进入可重启状态
+	if err := runPostUpdateHook(postUpdateInfo{OldVersion: config.Version, FileName: fileName, BackupID: backupID, Binary: currentExe}); err != nil && config.AppConfig.PostUpdateHookRequired {
+		return fmt.Errorf("更新已应用，但更新后钩子失败 (未自动重启): %w", err)
+	}
 	setStatus("completed", 100, "更新完成！请重启服务以应用新版本。")
 	updateMutex.Lock()
 	currentStatus.NeedsRestart = true
@@ -854,6 +860,12 @@ rm -f "$0"
 var autoUpdateRunning bool
 var versionCacheRunning bool
 
+// 版本检测与自动更新的防重叠保护 (网络请求与下载可能较慢)
+var (
+	versionCheckGuard = jobs.NewGuard("version check")
+	autoUpdateGuard   = jobs.NewGuard("auto update")
+)
+
 // StartVersionCacheUpdater 启动版本缓存更新后台任务（每60分钟检测一次）
 func StartVersionCacheUpdater() {
 	if versionCacheRunning {
@@ -876,15 +888,17 @@ func StartVersionCacheUpdater() {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			fmt.Println("[VersionCache] 定时检测版本...")
-			if info, err := checkForUpdateInternal(); err == nil {
-				updateCache(info)
-				if info.HasUpdate {
-					fmt.Printf("[VersionCache] 发现新版本: %s -> %s\n", info.CurrentVersion, info.LatestVersion)
+			versionCheckGuard.Run(func() {
+				fmt.Println("[VersionCache] 定时检测版本...")
+				if info, err := checkForUpdateInternal(); err == nil {
+					updateCache(info)
+					if info.HasUpdate {
+						fmt.Printf("[VersionCache] 发现新版本: %s -> %s\n", info.CurrentVersion, info.LatestVersion)
+					}
+				} else {
+					fmt.Printf("[VersionCache] 检测失败: %v\n", err)
 				}
-			} else {
-				fmt.Printf("[VersionCache] 检测失败: %v\n", err)
-			}
+			})
 		}
 	}()
 
@@ -917,30 +931,7 @@ func StartAutoUpdateChecker() {
 
 			// 检查是否到达更新时间
 			if isAutoUpdateTime() {
-				fmt.Println("[AutoUpdate] 检查更新...")
-				
-				// 检查更新
-				info, err := checkForUpdateInternal()
-				if err != nil {
-					fmt.Printf("[AutoUpdate] 检查更新失败: %v\n", err)
-				} else {
-					// 同步更新缓存
-					updateCache(info)
-					
-					if info.HasUpdate {
-						fmt.Printf("[AutoUpdate] 发现新版本: %s -> %s\n", info.CurrentVersion, info.LatestVersion)
-						
-						// 执行自动更新
-						if err := doUpdate(info.DownloadURL, info.FileName); err != nil {
-							fmt.Printf("[AutoUpdate] 自动更新失败: %v\n", err)
-						} else {
-							fmt.Println("[AutoUpdate] 更新成功，正在重启...")
-							RestartSelf()
-						}
-					} else {
-						fmt.Println("[AutoUpdate] 当前已是最新版本")
-					}
-				}
+				autoUpdateGuard.Run(runAutoUpdate)
 			}
 
 			time.Sleep(time.Duration(interval) * time.Hour)
@@ -950,6 +941,34 @@ func StartAutoUpdateChecker() {
 	fmt.Println("[AutoUpdate] 自动更新检测已启动")
 }
 
+// runAutoUpdate 检查更新并在发现新版本时自动安装、重启
+func runAutoUpdate() {
+	fmt.Println("[AutoUpdate] 检查更新...")
+	
+	// 检查更新
+	info, err := checkForUpdateInternal()
+	if err != nil {
+		fmt.Printf("[AutoUpdate] 检查更新失败: %v\n", err)
+	} else {
+		// 同步更新缓存
+		updateCache(info)
+		
+		if info.HasUpdate {
+			fmt.Printf("[AutoUpdate] 发现新版本: %s -> %s\n", info.CurrentVersion, info.LatestVersion)
+			
+			// 执行自动更新
+			if err := doUpdate(info.DownloadURL, info.FileName); err != nil {
+				fmt.Printf("[AutoUpdate] 自动更新失败: %v\n", err)
+			} else {
+				fmt.Println("[AutoUpdate] 更新成功，正在重启...")
+				RestartSelf()
+			}
+		} else {
+			fmt.Println("[AutoUpdate] 当前已是最新版本")
+		}
+	}
+}
+
 // isAutoUpdateTime 检查是否到达自动更新时间
 func isAutoUpdateTime() bool {
 	updateTime := config.AppConfig.AutoUpdateTime
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+)
+
+// hookOutputLimit 记录到日志的钩子输出上限 (字节)
+const hookOutputLimit = 4096
+
+// postUpdateInfo 传给更新后钩子的信息
+type postUpdateInfo struct {
+	OldVersion string `json:"old_version"`
+	FileName   string `json:"file_name"` // 更新包文件名 (含目标版本号)
+	BackupID   string `json:"backup_id"` // 更新前自动创建的备份
+	Binary     string `json:"binary"`    // 已替换的可执行文件路径
+}
+
+// postUpdateHookTimeout 更新后钩子的超时，默认 60 秒
+func postUpdateHookTimeout() time.Duration {
+	if config.AppConfig.PostUpdateHookTimeout > 0 {
+		return time.Duration(config.AppConfig.PostUpdateHookTimeout) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// runPostUpdateHook 在新版本文件替换完成、重启之前执行更新后钩子 (Webhook 与本地命令均可配置，依次执行)
+// 返回第一个失败的错误；是否因此中止重启由调用方根据 post_update_hook_required 决定
+func runPostUpdateHook(info postUpdateInfo) error {
+	url := strings.TrimSpace(config.AppConfig.PostUpdateHookURL)
+	command := strings.TrimSpace(config.AppConfig.PostUpdateHookCommand)
+	if url == "" && command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postUpdateHookTimeout())
+	defer cancel()
+
+	var firstErr error
+	if url != "" {
+		if err := postUpdateWebhook(ctx, url, info); err != nil {
+			log.Printf("[Update] Post-update webhook failed: %v", err)
+			firstErr = fmt.Errorf("post-update webhook: %w", err)
+		} else {
+			log.Printf("[Update] Post-update webhook delivered to %s", url)
+		}
+	}
+	if command != "" {
+		output, err := runUpdateCommand(ctx, command, info)
+		if output != "" {
+			log.Printf("[Update] Post-update command output:\n%s", output)
+		}
+		if err != nil {
+			log.Printf("[Update] Post-update command failed: %v", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("post-update command: %w", err)
+			}
+		}
+	}
+	return firstErr
+}
+
+func postUpdateWebhook(ctx context.Context, url string, info postUpdateInfo) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event": "update_applied",
+		"data":  info,
+		"time":  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 单独限制 Webhook 超时，避免无响应的接收端耗尽整个钩子时限、导致本地命令无法执行
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runUpdateCommand 通过系统 shell 执行命令，更新信息以 GOEMAIL_* 环境变量传入，返回合并后的输出 (截断)
+func runUpdateCommand(ctx context.Context, command string, info postUpdateInfo) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(),
+		"GOEMAIL_OLD_VERSION="+info.OldVersion,
+		"GOEMAIL_UPDATE_FILE="+info.FileName,
+		"GOEMAIL_BACKUP_ID="+info.BackupID,
+		"GOEMAIL_BINARY="+info.Binary,
+	)
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if len(output) > hookOutputLimit {
+		output = output[:hookOutputLimit] + "\n...(truncated)"
+	}
+	return output, err
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"runtime"
 	"testing"
 )
 
@@ -49,3 +51,16 @@ func TestSplitPreRelease(t *testing.T) {
 		}
 	}
 }
+
+func TestRunUpdateCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out, err := runUpdateCommand(context.Background(), `echo "$GOEMAIL_OLD_VERSION $GOEMAIL_BACKUP_ID"`, postUpdateInfo{OldVersion: "v1.0.0", BackupID: "b1"})
+	if err != nil || out != "v1.0.0 b1" {
+		t.Errorf("output = %q, err = %v", out, err)
+	}
+	if _, err := runUpdateCommand(context.Background(), "exit 3", postUpdateInfo{}); err == nil {
+		t.Error("non-zero exit should return error")
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"goemail/internal/database"
+	"goemail/internal/jobs"
 )
 
 var (
+	schedulerGuard   = jobs.NewGuard("cert check")
 	schedulerOnce    sync.Once
 	schedulerStop    chan struct{}
 	schedulerRunning bool
@@ -25,7 +27,7 @@ func StartScheduler() {
 			log.Println("[CertScheduler] 证书检查调度器已启动")
 			
 			// 启动时立即检查一次
-			checkCertificates()
+			schedulerGuard.Run(checkCertificates)
 			
 			// 每天凌晨 4:00 检查
 			ticker := time.NewTicker(24 * time.Hour)
@@ -41,7 +43,7 @@ func StartScheduler() {
 					// 检查是否是凌晨 4 点附近
 					now := time.Now()
 					if now.Hour() >= 3 && now.Hour() <= 5 {
-						checkCertificates()
+						schedulerGuard.Run(checkCertificates)
 					}
 				}
 			}
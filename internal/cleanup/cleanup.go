@@ -5,32 +5,46 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"goemail/internal/config"
 	"goemail/internal/database"
+	"goemail/internal/jobs"
+	"goemail/internal/mailer"
+
+	"gorm.io/gorm"
 )
 
 // CleanupResult 清理结果统计
 type CleanupResult struct {
-	EmailLogs   int64 `json:"email_logs"`   // 清理的发送日志数
-	InboxItems  int64 `json:"inbox_items"`  // 清理的收件数
-	QueueItems  int64 `json:"queue_items"`  // 清理的队列数
-	ForwardLogs int64 `json:"forward_logs"` // 清理的转发日志数
-	Attachments int64 `json:"attachments"`  // 清理的附件数
-	FreedBytes  int64 `json:"freed_bytes"`  // 释放的磁盘空间 (字节)
-	Duration    int64 `json:"duration_ms"`  // 执行耗时 (毫秒)
+	EmailLogs      int64   `json:"email_logs"`      // 清理的发送日志数
+	InboxItems     int64   `json:"inbox_items"`     // 清理的收件数
+	QueueItems     int64   `json:"queue_items"`     // 清理的队列数
+	ForwardLogs    int64   `json:"forward_logs"`    // 清理的转发日志数
+	Attachments    int64   `json:"attachments"`     // 清理的附件数
+	AttachmentRate float64 `json:"attachment_rate"` // 附件清理吞吐量 (个/秒)
+	FreedBytes     int64   `json:"freed_bytes"`     // 释放的磁盘空间 (字节)
+	TrackingEvents int64   `json:"tracking_events"` // 汇总后清理的追踪事件数
+	OrphanFiles    int64   `json:"orphan_files"`    // 删除的无记录附件文件数
+	MissingRecords int64   `json:"missing_records"` // 删除的文件已丢失的附件记录数
+	RecipientMarks int64   `json:"recipient_marks"` // 删除的已超出最小间隔的收件人发送记录数
+	Duration       int64   `json:"duration_ms"`     // 执行耗时 (毫秒)
 }
 
 // DataStats 数据统计
 type DataStats struct {
-	EmailLogs   int64 `json:"email_logs"`
-	InboxItems  int64 `json:"inbox_items"`
-	QueueItems  int64 `json:"queue_items"`
-	ForwardLogs int64 `json:"forward_logs"`
-	Attachments int64 `json:"attachments"`
-	TotalSize   int64 `json:"total_size"` // 附件总大小 (字节)
+	EmailLogs      int64 `json:"email_logs"`
+	InboxItems     int64 `json:"inbox_items"`
+	QueueItems     int64 `json:"queue_items"`
+	ForwardLogs    int64 `json:"forward_logs"`
+	Attachments    int64 `json:"attachments"`
+	TrackingEvents int64 `json:"tracking_events"`
+	TotalSize      int64 `json:"total_size"` // 附件总大小 (字节)
 }
 
 var (
@@ -50,6 +64,7 @@ func GetStats() DataStats {
 	database.DB.Model(&database.EmailQueue{}).Count(&stats.QueueItems)
 	database.DB.Model(&database.ForwardLog{}).Count(&stats.ForwardLogs)
 	database.DB.Model(&database.AttachmentFile{}).Count(&stats.Attachments)
+	database.DB.Model(&database.TrackingEvent{}).Count(&stats.TrackingEvents)
 
 	// 统计附件总大小
 	var totalSize struct {
@@ -91,8 +106,8 @@ func RunCleanup() CleanupResult {
 	}
 
 	// 2. 清理收件箱
-	if cfg.CleanupInboxDays > 0 {
-		result.InboxItems = cleanInbox(cfg.CleanupInboxDays)
+	if cfg.CleanupInboxDays > 0 || len(cfg.CleanupInboxOverrides) > 0 {
+		result.InboxItems = cleanInbox(cfg.CleanupInboxDays, cfg.CleanupInboxOverrides)
 		log.Printf("[Cleanup] 清理收件箱: %d 条", result.InboxItems)
 	}
 
@@ -110,8 +125,30 @@ func RunCleanup() CleanupResult {
 
 	// 5. 清理附件 (同时删除磁盘文件)
 	if cfg.CleanupAttachDays > 0 {
+		attachStart := time.Now()
 		result.Attachments, result.FreedBytes = cleanAttachments(cfg.CleanupAttachDays)
-		log.Printf("[Cleanup] 清理附件: %d 个, 释放 %.2f MB", result.Attachments, float64(result.FreedBytes)/1024/1024)
+		result.AttachmentRate = throughput(result.Attachments, time.Since(attachStart))
+		log.Printf("[Cleanup] 清理附件: %d 个, 释放 %.2f MB, %.1f 个/秒", result.Attachments, float64(result.FreedBytes)/1024/1024, result.AttachmentRate)
+	}
+
+	// 6. 汇总并清理追踪事件
+	if cfg.CleanupTrackingDays > 0 {
+		result.TrackingEvents = cleanTrackingEvents(cfg.CleanupTrackingDays)
+		log.Printf("[Cleanup] 汇总并清理追踪事件: %d 条", result.TrackingEvents)
+	}
+
+	// 7. 附件对账 (孤立文件与失效记录)
+	if cfg.CleanupOrphans {
+		orphans := purgeOrphans(false)
+		result.OrphanFiles, result.MissingRecords = orphans.OrphanFiles, orphans.MissingRecords
+		result.FreedBytes += orphans.FreedBytes
+		log.Printf("[Cleanup] 附件对账: 孤立文件 %d 个 (%.2f MB), 失效记录 %d 条", orphans.OrphanFiles, float64(orphans.FreedBytes)/1024/1024, orphans.MissingRecords)
+	}
+
+	// 8. 清理已超出最小发送间隔的收件人记录 (不再影响频率限制)
+	result.RecipientMarks = cleanRecipientLastSent(cfg.RecipientMinInterval)
+	if result.RecipientMarks > 0 {
+		log.Printf("[Cleanup] 清理收件人发送记录: %d 条", result.RecipientMarks)
 	}
 
 	result.Duration = time.Since(startTime).Milliseconds()
@@ -140,6 +177,7 @@ func cleanEmailLogs(days int) int64 {
 		result := database.DB.Unscoped().
 			Where("id IN ?", ids).
 			Delete(&database.EmailLog{})
+		database.DB.Where("email_log_id IN ?", ids).Delete(&database.RenderedMessage{})
 
 		total += result.RowsAffected
 		time.Sleep(50 * time.Millisecond) // 短暂休息防止锁表
@@ -148,14 +186,78 @@ func cleanEmailLogs(days int) int64 {
 	return total
 }
 
+// inboxRetention 按收件人覆盖的收件箱保留规则
+type inboxRetention struct {
+	Addresses map[string]int // 完整收件地址 (小写) -> 保留天数
+	Domains   map[string]int // 收件域名 (小写，不含 @) -> 保留天数
+}
+
+// parseInboxRetention 解析 cleanup_inbox_overrides，含 @ 且 @ 前非空的键为地址，其余为域名；忽略空键与负数
+func parseInboxRetention(overrides map[string]int) inboxRetention {
+	r := inboxRetention{Addresses: make(map[string]int), Domains: make(map[string]int)}
+	for key, days := range overrides {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if days < 0 || key == "" || key == "@" {
+			continue
+		}
+		if at := strings.LastIndex(key, "@"); at > 0 {
+			r.Addresses[key] = days
+		} else {
+			r.Domains[strings.TrimPrefix(key, "@")] = days
+		}
+	}
+	return r
+}
+
 // cleanInbox 分批清理收件箱（同时清理关联的附件）
-func cleanInbox(days int) int64 {
+// 先按地址、域名覆盖规则各自的保留天数清理，再对未命中任何规则的收件应用全局天数 (days <= 0 时不清理)
+func cleanInbox(days int, overrides map[string]int) int64 {
+	rules := parseInboxRetention(overrides)
+	addresses := make([]string, 0, len(rules.Addresses))
+	for addr := range rules.Addresses {
+		addresses = append(addresses, addr)
+	}
+	var total int64
+
+	for addr, n := range rules.Addresses {
+		if n > 0 {
+			total += cleanInboxWhere(n, func(q *gorm.DB) *gorm.DB { return q.Where("LOWER(to_addr) = ?", addr) })
+		}
+	}
+	for domain, n := range rules.Domains {
+		if n > 0 {
+			total += cleanInboxWhere(n, func(q *gorm.DB) *gorm.DB {
+				q = q.Where("LOWER(to_addr) LIKE ?", "%@"+domain)
+				if len(addresses) > 0 {
+					q = q.Where("LOWER(to_addr) NOT IN ?", addresses)
+				}
+				return q
+			})
+		}
+	}
+	if days > 0 {
+		total += cleanInboxWhere(days, func(q *gorm.DB) *gorm.DB {
+			if len(addresses) > 0 {
+				q = q.Where("LOWER(to_addr) NOT IN ?", addresses)
+			}
+			for domain := range rules.Domains {
+				q = q.Where("LOWER(to_addr) NOT LIKE ?", "%@"+domain)
+			}
+			return q
+		})
+	}
+
+	return total
+}
+
+// cleanInboxWhere 分批删除满足 scope 条件且超过保留天数的收件及其附件
+func cleanInboxWhere(days int, scope func(*gorm.DB) *gorm.DB) int64 {
 	cutoff := time.Now().AddDate(0, 0, -days)
 	var total int64
 
 	for {
 		var ids []uint
-		database.DB.Model(&database.Inbox{}).
+		scope(database.DB.Model(&database.Inbox{})).
 			Where("created_at < ?", cutoff).
 			Limit(1000).
 			Pluck("id", &ids)
@@ -170,11 +272,7 @@ func cleanInbox(days int) int64 {
 			var attachments []database.AttachmentFile
 			database.DB.Where("related_to = ?", relatedTo).Find(&attachments)
 			for _, att := range attachments {
-				if att.FilePath != "" {
-					fullPath := att.FilePath
-					if !filepath.IsAbs(fullPath) {
-						fullPath = filepath.Join(".", fullPath)
-					}
+				for _, fullPath := range attachmentPaths(att) {
 					os.Remove(fullPath)
 				}
 			}
@@ -208,6 +306,9 @@ func cleanQueue(days int) int64 {
 			break
 		}
 
+		// 正常结束的任务已在完成时释放附件，这里只处理升级前遗留或仍处于 failed 的记录
+		mailer.ReleaseQueueAttachments(ids)
+
 		result := database.DB.Unscoped().
 			Where("id IN ?", ids).
 			Delete(&database.EmailQueue{})
@@ -246,44 +347,263 @@ func cleanForwardLogs(days int) int64 {
 	return total
 }
 
+// cleanRecipientLastSent 删除最近发送时间早于最小间隔 (分钟) 的收件人记录，未启用间隔限制时全部删除
+func cleanRecipientLastSent(intervalMinutes int) int64 {
+	cutoff := time.Now().Add(-time.Duration(max(intervalMinutes, 0)) * time.Minute)
+	return database.DB.Where("last_sent_at < ?", cutoff).Delete(&database.RecipientLastSent{}).RowsAffected
+}
+
+// trackingRollupKey 按营销任务与日期汇总的键
+type trackingRollupKey struct {
+	CampaignID uint
+	Day        string
+}
+
+// cleanTrackingEvents 分批将过期追踪事件汇总到 CampaignDailyStat 后删除
+// 汇总与删除在同一事务内完成，避免中断后重复计数
+func cleanTrackingEvents(days int) int64 {
+	cutoff := time.Now().AddDate(0, 0, -days)
+	var total int64
+
+	for {
+		var events []database.TrackingEvent
+		database.DB.Select("id", "created_at", "campaign_id", "type").
+			Where("created_at < ?", cutoff).
+			Order("id asc").
+			Limit(1000).
+			Find(&events)
+
+		if len(events) == 0 {
+			break
+		}
+
+		rollups := rollupTrackingEvents(events)
+		ids := make([]uint, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for key, stat := range rollups {
+				row := database.CampaignDailyStat{CampaignID: key.CampaignID, Day: key.Day}
+				if err := tx.Where(row).FirstOrCreate(&row).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&row).UpdateColumns(map[string]interface{}{
+					"opens":        gorm.Expr("opens + ?", stat.Opens),
+					"clicks":       gorm.Expr("clicks + ?", stat.Clicks),
+					"unsubscribes": gorm.Expr("unsubscribes + ?", stat.Unsubscribes),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Where("id IN ?", ids).Delete(&database.TrackingEvent{}).Error
+		})
+		if err != nil {
+			log.Printf("[Cleanup] 汇总追踪事件失败: %v", err)
+			break
+		}
+
+		total += int64(len(ids))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return total
+}
+
+// rollupTrackingEvents 将追踪事件按营销任务和日期 (本地时区) 汇总
+// 未关联营销任务的事件不做汇总，直接随批次删除
+func rollupTrackingEvents(events []database.TrackingEvent) map[trackingRollupKey]*database.CampaignDailyStat {
+	rollups := make(map[trackingRollupKey]*database.CampaignDailyStat)
+	for _, e := range events {
+		if e.CampaignID == 0 {
+			continue
+		}
+		key := trackingRollupKey{CampaignID: e.CampaignID, Day: e.CreatedAt.Local().Format("2006-01-02")}
+		stat, ok := rollups[key]
+		if !ok {
+			stat = &database.CampaignDailyStat{CampaignID: key.CampaignID, Day: key.Day}
+			rollups[key] = stat
+		}
+		switch e.Type {
+		case "open":
+			stat.Opens++
+		case "click":
+			stat.Clicks++
+		case "unsubscribe":
+			stat.Unsubscribes++
+		}
+	}
+	return rollups
+}
+
+// CampaignDailyStats 营销任务按天的打开/点击/退订统计 (按日期升序)
+// 已汇总到 CampaignDailyStat 的历史数据与尚未汇总的原始追踪事件合并，清理前后结果一致
+func CampaignDailyStats(campaignID uint) []database.CampaignDailyStat {
+	var rows []database.CampaignDailyStat
+	database.DB.Where("campaign_id = ?", campaignID).Find(&rows)
+	merged := make(map[string]*database.CampaignDailyStat, len(rows))
+	for i := range rows {
+		merged[rows[i].Day] = &rows[i]
+	}
+
+	var batch []database.TrackingEvent
+	database.DB.Select("id", "created_at", "campaign_id", "type").Where("campaign_id = ?", campaignID).
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			for key, stat := range rollupTrackingEvents(batch) {
+				row, ok := merged[key.Day]
+				if !ok {
+					merged[key.Day] = stat
+					continue
+				}
+				row.Opens += stat.Opens
+				row.Clicks += stat.Clicks
+				row.Unsubscribes += stat.Unsubscribes
+			}
+			return nil
+		})
+
+	stats := make([]database.CampaignDailyStat, 0, len(merged))
+	for _, stat := range merged {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Day < stats[j].Day })
+	return stats
+}
+
+// attachBatchSize 附件清理每批处理的记录数
+func attachBatchSize() int {
+	if config.AppConfig.CleanupAttachBatchSize > 0 {
+		return config.AppConfig.CleanupAttachBatchSize
+	}
+	return 500
+}
+
+// attachBatchSleep 附件清理批次间的休眠时长，配置为负数时不休眠
+func attachBatchSleep() time.Duration {
+	switch ms := config.AppConfig.CleanupAttachBatchSleep; {
+	case ms < 0:
+		return 0
+	case ms == 0:
+		return 50 * time.Millisecond
+	default:
+		return time.Duration(ms) * time.Millisecond
+	}
+}
+
+// attachWorkers 每批并发删除磁盘文件的协程数
+// 删除耗时主要在等待文件系统 (网络盘或慢速磁盘上尤为明显)，默认 8 个足以掩盖延迟，又不至于在清理期间挤占在线请求的 IO
+func attachWorkers() int {
+	if config.AppConfig.CleanupAttachWorkers > 0 {
+		return config.AppConfig.CleanupAttachWorkers
+	}
+	return 8
+}
+
+// throughput 计算每秒处理数
+func throughput(count int64, elapsed time.Duration) float64 {
+	if count <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
+
+// removeFiles 使用有限数量的协程并发删除磁盘文件，返回释放的字节数
+// 调用时数据库记录已删除，单个文件失败只记录日志并继续，不中断整批清理；文件已不存在时视为已清理
+func removeFiles(paths []string, workers int) int64 {
+	var freed atomic.Int64
+	pending := make(chan string)
+	var wg sync.WaitGroup
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fullPath := range pending {
+				info, err := os.Stat(fullPath)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						log.Printf("[Cleanup] 读取文件失败 %s: %v", fullPath, err)
+					}
+					continue
+				}
+				if err := os.Remove(fullPath); err != nil {
+					log.Printf("[Cleanup] 删除文件失败 %s: %v", fullPath, err)
+					continue
+				}
+				freed.Add(info.Size())
+			}
+		}()
+	}
+	for _, p := range paths {
+		pending <- p
+	}
+	close(pending)
+	wg.Wait()
+	return freed.Load()
+}
+
+// attachmentPaths 附件记录对应的磁盘文件 (含保留的压缩前原图)
+func attachmentPaths(f database.AttachmentFile) []string {
+	var paths []string
+	for _, p := range []string{f.FilePath, f.OriginalPath} {
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(".", p)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// releasableAttachment 可清理的附件记录：未参与去重，或去重文件已没有邮件引用
+const releasableAttachment = "content_hash = '' OR content_hash IS NULL OR ref_count <= 0"
+
 // cleanAttachments 清理附件 (同时删除磁盘文件)
 func cleanAttachments(days int) (int64, int64) {
 	cutoff := time.Now().AddDate(0, 0, -days)
+	batchSize, pause, workers := attachBatchSize(), attachBatchSleep(), attachWorkers()
 	var freedBytes int64
 	var count int64
 
-	// 分批处理附件
+	// 分批处理附件：批内并发删除磁盘文件，数据库记录按批删除
 	for {
+		// 去重复用的上传文件仍被邮件引用时保留
 		var files []database.AttachmentFile
-		database.DB.Where("created_at < ?", cutoff).Limit(500).Find(&files)
+		database.DB.Where("created_at < ?", cutoff).Where(releasableAttachment).
+			Order("id asc").Limit(batchSize).Find(&files)
 
 		if len(files) == 0 {
 			break
 		}
 
-		var ids []uint
+		ids := make([]uint, 0, len(files))
 		for _, f := range files {
 			ids = append(ids, f.ID)
+		}
 
-			// 删除磁盘文件
-			fullPath := f.FilePath
-			if !filepath.IsAbs(fullPath) {
-				fullPath = filepath.Join(".", fullPath)
-			}
+		// 先删除数据库记录并在同一语句中复核引用计数：选出后又被复用的记录保留，其文件不删除
+		// 复用方增加计数时记录已被删除则会另存新文件
+		res := database.DB.Unscoped().Where("id IN ?", ids).Where(releasableAttachment).Delete(&database.AttachmentFile{})
+		count += res.RowsAffected
 
-			if info, err := os.Stat(fullPath); err == nil {
-				freedBytes += info.Size()
-				if err := os.Remove(fullPath); err != nil {
-					log.Printf("[Cleanup] 删除文件失败 %s: %v", fullPath, err)
-				}
+		var kept []uint
+		if res.RowsAffected < int64(len(ids)) {
+			database.DB.Unscoped().Model(&database.AttachmentFile{}).Where("id IN ?", ids).Pluck("id", &kept)
+		}
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			if slices.Contains(kept, f.ID) {
+				continue
 			}
+			paths = append(paths, attachmentPaths(f)...)
 		}
+		freedBytes += removeFiles(paths, workers)
 
-		// 删除数据库记录
-		database.DB.Unscoped().Where("id IN ?", ids).Delete(&database.AttachmentFile{})
-		count += int64(len(ids))
-
-		time.Sleep(50 * time.Millisecond)
+		if pause > 0 {
+			time.Sleep(pause)
+		}
 	}
 
 	// 尝试清理空目录
@@ -314,6 +634,14 @@ func cleanEmptyDirs(dir string) {
 	}
 }
 
+// schedulerGuard 定时清理的防重叠保护 (大量删除耗时较长)
+var schedulerGuard = jobs.NewGuard("cleanup")
+
+// runScheduledCleanup 定时任务触发的清理
+func runScheduledCleanup() {
+	schedulerGuard.Run(func() { RunCleanup() })
+}
+
 // StartScheduler 启动定时清理任务
 func StartScheduler() {
 	schedulerMu.Lock()
@@ -329,7 +657,7 @@ func StartScheduler() {
 		// 启动时执行一次清理
 		if config.AppConfig.CleanupEnabled {
 			log.Println("[Cleanup] 服务启动，执行初始清理...")
-			RunCleanup()
+			runScheduledCleanup()
 		}
 
 		// 计算下次凌晨 3 点的时间
@@ -347,7 +675,7 @@ func StartScheduler() {
 			case <-timer.C:
 				if config.AppConfig.CleanupEnabled {
 					log.Println("[Cleanup] 执行定时清理任务...")
-					RunCleanup()
+					runScheduledCleanup()
 				}
 				// 重置定时器到下一个凌晨 3 点
 				nextRun = getNextScheduleTime(3, 0)
@@ -0,0 +1,160 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRollupTrackingEvents(t *testing.T) {
+	day1 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	events := []database.TrackingEvent{
+		{CampaignID: 1, Type: "open", CreatedAt: day1},
+		{CampaignID: 1, Type: "open", CreatedAt: day1},
+		{CampaignID: 1, Type: "click", CreatedAt: day1},
+		{CampaignID: 1, Type: "unsubscribe", CreatedAt: day2},
+		{CampaignID: 2, Type: "click", CreatedAt: day2},
+		{CampaignID: 0, Type: "open", CreatedAt: day1},
+	}
+
+	rollups := rollupTrackingEvents(events)
+	if len(rollups) != 3 {
+		t.Fatalf("expected 3 rollups, got %d", len(rollups))
+	}
+
+	got := rollups[trackingRollupKey{CampaignID: 1, Day: "2024-03-01"}]
+	if got == nil || got.Opens != 2 || got.Clicks != 1 || got.Unsubscribes != 0 {
+		t.Errorf("campaign 1 day 1: %+v", got)
+	}
+	got = rollups[trackingRollupKey{CampaignID: 1, Day: "2024-03-02"}]
+	if got == nil || got.Unsubscribes != 1 {
+		t.Errorf("campaign 1 day 2: %+v", got)
+	}
+	got = rollups[trackingRollupKey{CampaignID: 2, Day: "2024-03-02"}]
+	if got == nil || got.Clicks != 1 {
+		t.Errorf("campaign 2 day 2: %+v", got)
+	}
+}
+
+func TestParseInboxRetention(t *testing.T) {
+	r := parseInboxRetention(map[string]int{
+		" Support@Example.com ": 365,
+		"example.com":           7,
+		"@noise.example.org":    1,
+		"archive@example.com":   0,
+		"bad.example.net":       -1,
+		"@":                     5,
+		"":                      5,
+	})
+	if len(r.Addresses) != 2 || r.Addresses["support@example.com"] != 365 {
+		t.Errorf("addresses = %v", r.Addresses)
+	}
+	if days, ok := r.Addresses["archive@example.com"]; !ok || days != 0 {
+		t.Errorf("keep-forever address lost: %v", r.Addresses)
+	}
+	if len(r.Domains) != 2 || r.Domains["example.com"] != 7 || r.Domains["noise.example.org"] != 1 {
+		t.Errorf("domains = %v", r.Domains)
+	}
+}
+
+func TestRemoveFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := range 20 {
+		p := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		os.WriteFile(p, []byte("0123456789"), 0o644)
+		paths = append(paths, p)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	if freed := removeFiles(paths, 4); freed != 200 {
+		t.Errorf("freed = %d, want 200", freed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left behind", len(entries))
+	}
+	if got := throughput(100, 2*time.Second); got != 50 {
+		t.Errorf("throughput = %v, want 50", got)
+	}
+}
+
+// useTestDB 将 database.DB 替换为内存 SQLite，测试结束后还原
+func useTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev })
+	return db
+}
+
+func TestCampaignDailyStatsMergesRollups(t *testing.T) {
+	db := useTestDB(t, &database.CampaignDailyStat{}, &database.TrackingEvent{})
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local)
+	db.Create(&database.CampaignDailyStat{CampaignID: 1, Day: "2024-03-01", Opens: 5, Clicks: 1})
+	db.Create(&database.TrackingEvent{CampaignID: 1, Type: "open", CreatedAt: day})
+	db.Create(&database.TrackingEvent{CampaignID: 1, Type: "click", CreatedAt: day.AddDate(0, 0, 1)})
+	db.Create(&database.TrackingEvent{CampaignID: 2, Type: "open", CreatedAt: day})
+
+	stats := CampaignDailyStats(1)
+	if len(stats) != 2 {
+		t.Fatalf("stats = %+v, want 2 days", stats)
+	}
+	if stats[0].Day != "2024-03-01" || stats[0].Opens != 6 || stats[0].Clicks != 1 {
+		t.Errorf("day 1 = %+v, want rollup plus live event", stats[0])
+	}
+	if stats[1].Day != "2024-03-02" || stats[1].Clicks != 1 {
+		t.Errorf("day 2 = %+v", stats[1])
+	}
+}
+
+func TestCleanAttachmentsKeepsReferencedFiles(t *testing.T) {
+	db := useTestDB(t, &database.AttachmentFile{})
+
+	dir := t.TempDir()
+	old := time.Now().AddDate(0, 0, -30)
+	files := []database.AttachmentFile{
+		{Filename: "plain", ContentHash: ""},
+		{Filename: "released", ContentHash: "aa", RefCount: 0, OriginalPath: filepath.Join(dir, "released.orig")},
+		{Filename: "shared", ContentHash: "bb", RefCount: 2},
+	}
+	for i := range files {
+		files[i].FilePath = filepath.Join(dir, files[i].Filename)
+		files[i].CreatedAt = old
+		files[i].UpdatedAt = old
+		os.WriteFile(files[i].FilePath, []byte("data"), 0o644)
+		db.Create(&files[i])
+	}
+	os.WriteFile(files[1].OriginalPath, []byte("original"), 0o644)
+
+	if count, freed := cleanAttachments(7); count != 2 || freed != 16 {
+		t.Errorf("count = %d, freed = %d, want 2 and 16", count, freed)
+	}
+	if _, err := os.Stat(files[1].OriginalPath); !os.IsNotExist(err) {
+		t.Errorf("kept original not removed: %v", err)
+	}
+	var left []database.AttachmentFile
+	db.Find(&left)
+	if len(left) != 1 || left[0].Filename != "shared" {
+		t.Fatalf("rows left = %+v, want only shared", left)
+	}
+	if _, err := os.Stat(files[2].FilePath); err != nil {
+		t.Errorf("referenced file removed: %v", err)
+	}
+}
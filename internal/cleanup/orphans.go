@@ -0,0 +1,118 @@
+package cleanup
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"goemail/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// orphanScanDirs 对账时扫描的附件目录
+var orphanScanDirs = []string{"data/uploads", "data/inbox_attachments"}
+
+// orphanGracePeriod 修改时间在此范围内的文件不视为孤立 (上传/收信过程中文件先落盘、后写记录)
+const orphanGracePeriod = time.Hour
+
+// OrphanResult 附件对账结果
+type OrphanResult struct {
+	ScannedFiles   int64 `json:"scanned_files"`   // 扫描的磁盘文件数
+	OrphanFiles    int64 `json:"orphan_files"`    // 无对应 AttachmentFile 记录的文件数
+	FreedBytes     int64 `json:"freed_bytes"`     // 删除孤立文件释放的空间 (字节)
+	MissingRecords int64 `json:"missing_records"` // 磁盘文件已不存在的记录数
+	DryRun         bool  `json:"dry_run"`         // 仅统计，未删除
+	Duration       int64 `json:"duration_ms"`
+}
+
+// PurgeOrphanAttachments 对账附件目录与 AttachmentFile 记录：删除无记录的磁盘文件及文件已丢失的记录
+// dryRun 时只统计不删除；与 RunCleanup 互斥，已有清理任务运行时返回 false
+func PurgeOrphanAttachments(dryRun bool) (OrphanResult, bool) {
+	cleanupMutex.Lock()
+	if isRunning {
+		cleanupMutex.Unlock()
+		return OrphanResult{}, false
+	}
+	isRunning = true
+	cleanupMutex.Unlock()
+
+	defer func() {
+		cleanupMutex.Lock()
+		isRunning = false
+		cleanupMutex.Unlock()
+	}()
+
+	return purgeOrphans(dryRun), true
+}
+
+func purgeOrphans(dryRun bool) OrphanResult {
+	startTime := time.Now()
+	result := OrphanResult{DryRun: dryRun}
+
+	// 1. 检查记录：文件已丢失的记录直接删除，其余路径作为已知文件
+	known := make(map[string]bool)
+	var missing []uint
+	var rows []database.AttachmentFile
+	database.DB.Select("id", "file_path", "original_path").FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+		for _, f := range rows {
+			known[absPath(f.FilePath)] = true
+			if f.OriginalPath != "" {
+				known[absPath(f.OriginalPath)] = true
+			}
+			if _, err := os.Stat(f.FilePath); os.IsNotExist(err) {
+				missing = append(missing, f.ID)
+			}
+		}
+		return nil
+	})
+	result.MissingRecords = int64(len(missing))
+	if !dryRun {
+		for start := 0; start < len(missing); start += 500 {
+			end := min(start+500, len(missing))
+			database.DB.Unscoped().Where("id IN ?", missing[start:end]).Delete(&database.AttachmentFile{})
+		}
+	}
+
+	// 2. 扫描磁盘：无记录且超过宽限期的文件视为孤立
+	cutoff := time.Now().Add(-orphanGracePeriod)
+	for _, dir := range orphanScanDirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			result.ScannedFiles++
+			if known[absPath(path)] || info.ModTime().After(cutoff) {
+				return nil
+			}
+			result.OrphanFiles++
+			result.FreedBytes += info.Size()
+			if !dryRun {
+				if err := os.Remove(path); err != nil {
+					log.Printf("[Cleanup] 删除孤立文件失败 %s: %v", path, err)
+				}
+			}
+			return nil
+		})
+		if !dryRun {
+			cleanEmptyDirs(dir)
+		}
+	}
+
+	result.Duration = time.Since(startTime).Milliseconds()
+	return result
+}
+
+// absPath 统一为绝对路径比较 (记录中可能保存相对或绝对路径)
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
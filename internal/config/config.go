@@ -14,17 +14,38 @@ import (
 const Version = "v1.3.4"
 
 type Config struct {
-	Domain         string `json:"domain"`
-	DKIMSelector   string `json:"dkim_selector"`
-	DKIMPrivateKey string `json:"dkim_private_key"`
+	Domain                string              `json:"domain"`
+	DKIMSelector          string              `json:"dkim_selector"`
+	DKIMPrivateKey        string              `json:"dkim_private_key"`
+	DefaultFromName       string              `json:"default_from_name"`       // 默认发件人显示名称 (请求未指定 from_name 时使用)
+	SystemLocale          string              `json:"system_locale"`           // 系统生成内容 (转发横幅、退订页面等) 的语言: zh-CN / en，为空保持默认文案
+	RequireVerifiedDomain bool                `json:"require_verified_domain"` // 拒绝发件域名未通过 SPF+DKIM 验证的邮件
+	EnforceChannelDomain  bool                `json:"enforce_channel_domain"`  // 要求 From 域名属于所用中继的授权域名 (Direct 发送要求为已验证域名)，单次请求可用 X-Allow-Channel-Mismatch 头跳过
+	ArchiveBCC            string              `json:"archive_bcc"`             // 合规归档地址，所有外发邮件以信封 BCC 方式抄送 (不出现在邮件头)
+	FallbackChannelIDs    []uint              `json:"fallback_channel_ids"`    // 通道临时失败时依次尝试的备用 SMTP 通道 (请求未指定时使用)
+	DANEEnabled           bool                `json:"dane_enabled"`            // 直连投递时按 MX 的 TLSA 记录校验证书 (DANE)，不匹配则投递失败
+	DirectRequireTLS      bool                `json:"direct_require_tls"`      // 直连投递强制 STARTTLS：对方不支持或握手失败时投递失败而非明文发送 (默认机会性 TLS，不校验证书)
+	ErrorCategoryRules    []ErrorCategoryRule `json:"error_category_rules"`    // 自定义发送错误分类规则，优先于内置规则
+	OutboundSourceIP      string              `json:"outbound_source_ip"`      // 出站 SMTP 连接绑定的本机源 IP (多 IP 主机)，域名可单独配置 source_ip 覆盖
+	MXCacheTTL            int                 `json:"mx_cache_ttl"`            // 直连投递 MX 查询缓存上限 (秒)，记录 TTL 更短时以记录为准，默认 300，负数表示不缓存
+	DANEResolver          string              `json:"dane_resolver"`           // 用于 TLSA 查询的 DNSSEC 验证解析器 (如 1.1.1.1:53)，为空时使用系统解析器
+	DomainVerifyResolver  string              `json:"domain_verify_resolver"`  // 域名 DNS 验证使用的解析器: 为空时自动 (公共 DNS 可达则用 8.8.8.8，否则系统解析器)，"system" 或指定 host[:port]
+	DomainVerifyTimeout   int                 `json:"domain_verify_timeout"`   // 域名 DNS 验证超时 (秒)，默认 10
+	SinkMode              string              `json:"sink_mode"`               // 测试沙箱: "redirect" 所有外发改投 sink_address (原收件人写入 X-GoEmail-Original-To)，"drop" 不投递仅记录日志，为空关闭
+	SinkAddress           string              `json:"sink_address"`            // 沙箱 redirect 模式的测试收件地址
 
 	// Web Server Config
-	Host      string `json:"host"`       // 监听地址，默认 0.0.0.0
-	Port      string `json:"port"`       // 监听端口
-	BaseURL   string `json:"base_url"`   // 公网访问地址 (用于生成追踪链接)
-	EnableSSL bool   `json:"enable_ssl"` // 是否开启 HTTPS
-	CertFile  string `json:"cert_file"`  // 证书文件路径
-	KeyFile   string `json:"key_file"`   // 私钥文件路径
+	Host           string `json:"host"`            // 监听地址，默认 0.0.0.0
+	Port           string `json:"port"`            // 监听端口
+	BaseURL        string `json:"base_url"`        // 公网访问地址 (用于生成追踪链接)
+	TrustedProxies string `json:"trusted_proxies"` // 受信任的反向代理 IP / CIDR，逗号分隔；登录失败计数仅对这些来源采信 X-Forwarded-For
+	EnableSSL      bool   `json:"enable_ssl"`      // 是否开启 HTTPS
+	CertFile       string `json:"cert_file"`       // 证书文件路径
+	KeyFile        string `json:"key_file"`        // 私钥文件路径
+
+	// TLS 策略 (Web HTTPS 与接收服务 STARTTLS 共用)
+	TLSMinVersion   string   `json:"tls_min_version"`   // 最低 TLS 版本: 1.0 / 1.1 / 1.2 / 1.3，默认 1.2
+	TLSCipherSuites []string `json:"tls_cipher_suites"` // TLS 1.2 套件白名单 (IANA 名称)，为空时使用 Go 默认套件
 
 	// SMTP Receiver Config (邮件接收服务)
 	EnableReceiver  bool   `json:"enable_receiver"`   // 是否启用接收服务
@@ -34,28 +55,147 @@ type Config struct {
 	ReceiverTLSKey  string `json:"receiver_tls_key"`  // STARTTLS 私钥路径
 
 	// 收件安全配置
-	ReceiverRateLimit  int    `json:"receiver_rate_limit"`   // 每 IP 每分钟最大连接数，0 表示不限制
-	ReceiverMaxMsgSize int    `json:"receiver_max_msg_size"` // 最大邮件大小 (KB)，默认 10240 (10MB)
-	ReceiverSpamFilter bool   `json:"receiver_spam_filter"`  // 是否启用垃圾邮件过滤
-	ReceiverBlacklist  string `json:"receiver_blacklist"`    // IP 黑名单，逗号分隔
-	ReceiverRequireTLS bool   `json:"receiver_require_tls"`  // 是否强制要求 TLS
+	ReceiverRateLimit         int    `json:"receiver_rate_limit"`          // 每 IP 每分钟最大连接数，0 表示不限制
+	ReceiverMaxMsgSize        int    `json:"receiver_max_msg_size"`        // 最大邮件大小 (KB)，默认 10240 (10MB)
+	ReceiverMaxMsgBytes       int64  `json:"receiver_max_msg_bytes"`       // 最大邮件大小 (字节)，大于 0 时优先于 receiver_max_msg_size
+	ReceiverMaxLineLen        int    `json:"receiver_max_line_len"`        // 单行最大长度 (字节)，默认 65536
+	ReceiverSpamFilter        bool   `json:"receiver_spam_filter"`         // 是否启用垃圾邮件过滤
+	ReceiverSpamMaxLinks      int    `json:"receiver_spam_max_links"`      // 正文链接数超过该值视为垃圾邮件，默认 10，负数表示不检查
+	ReceiverSpamCapsMinLen    int    `json:"receiver_spam_caps_min_len"`   // 主题长度超过该值且全为大写时视为垃圾邮件，默认 10，负数表示不检查
+	ReceiverPTRCheck          bool   `json:"receiver_ptr_check"`           // 检查来源 IP 的反向解析 (FCrDNS)，失败时为邮件打 no-ptr / ptr-mismatch 标签
+	ReceiverPTRReject         bool   `json:"receiver_ptr_reject"`          // 无 PTR 记录的来源直接拒绝连接 (需启用 receiver_ptr_check)
+	ReceiverBlacklist         string `json:"receiver_blacklist"`           // IP 黑名单，逗号分隔
+	ReceiverRequireTLS        bool   `json:"receiver_require_tls"`         // 是否强制要求 TLS
+	ReceiverAuthRequired      bool   `json:"receiver_auth_required"`       // 非可信来源必须先 AUTH (密码为 API Key) 才能 MAIL FROM，匿名投递返回 530
+	ReceiverTrustedIPs        string `json:"receiver_trusted_ips"`         // 免认证的可信来源 IP / CIDR，逗号分隔 (如上游网关)
+	ReceiverAuthServIDs       string `json:"receiver_authserv_ids"`        // 采信其 Authentication-Results 的 authserv-id (上游网关主机名)，逗号分隔，为空时为本机主机名
+	ReceiverDedupeWindow      int    `json:"receiver_dedupe_window"`       // 重复邮件判定窗口 (分钟)，0 表示不去重
+	ReceiverMaxReceived       int    `json:"receiver_max_received"`        // Received 头超过该数量视为投递环路并丢弃，默认 50，负数表示不检查
+	ReceiverImageCompress     bool   `json:"receiver_image_compress"`      // 压缩收件箱中的大图片附件 (JPEG / PNG)
+	ReceiverImageMinSize      int    `json:"receiver_image_min_size"`      // 超过该大小 (KB) 的图片才压缩，默认 1024
+	ReceiverImageMaxDim       int    `json:"receiver_image_max_dim"`       // 压缩后最长边像素，默认 2048
+	ReceiverImageQuality      int    `json:"receiver_image_quality"`       // JPEG 重新编码质量 (1-100)，默认 80
+	ReceiverImageKeepOriginal bool   `json:"receiver_image_keep_original"` // 压缩时同时保留原图
+	ReceiverContactGroupID    uint   `json:"receiver_contact_group_id"`    // 来信发件人自动加入的联系人分组 ID，0 表示不启用
+	ReceiverCommandTimeout    int    `json:"receiver_command_timeout"`     // 等待下一条命令的空闲超时 (秒)，默认 300
+	ReceiverDataTimeout       int    `json:"receiver_data_timeout"`        // DATA 阶段两次数据到达之间的空闲超时 (秒)，默认 600
+
+	ReceiverAutoBlock          bool `json:"receiver_auto_block"`           // 按滥用分自动临时封禁 IP (超速、拒收收件人、协议错误、垃圾邮件)
+	ReceiverAutoBlockThreshold int  `json:"receiver_auto_block_threshold"` // 窗口内滥用分达到该值时封禁，默认 10
+	ReceiverAutoBlockWindow    int  `json:"receiver_auto_block_window"`    // 滥用分统计窗口 (分钟)，默认 10
+	ReceiverAutoBlockTTL       int  `json:"receiver_auto_block_ttl"`       // 封禁时长 (分钟)，默认 60
+
+	// SSRF 防护
+	SSRFAllowHosts string `json:"ssrf_allow_hosts"` // 允许访问的内网主机白名单 (用于附件 URL)，逗号分隔
+
+	// 附件病毒扫描 (ClamAV)
+	ClamAVEnabled    bool   `json:"clamav_enabled"`     // 是否启用附件扫描
+	ClamAVAddress    string `json:"clamav_address"`     // clamd 地址，如 tcp://127.0.0.1:3310 或 unix:///var/run/clamav/clamd.ctl
+	ClamAVTimeout    int    `json:"clamav_timeout"`     // 单次扫描超时 (秒)，默认 30
+	ClamAVFailClosed bool   `json:"clamav_fail_closed"` // 扫描出错时是否拒绝 (false 则放行)
+
+	// 营销任务
+	CampaignConfirmThreshold int     `json:"campaign_confirm_threshold"` // 收件人数超过此值时启动需确认 (confirm=true)，默认 5000，负数表示不检查
+	CampaignCostPerEmail     float64 `json:"campaign_cost_per_email"`    // 每封邮件的预估成本 (启动确认时估算费用)，0 表示不估算
+	CampaignMaxConcurrent    int     `json:"campaign_max_concurrent"`    // 同时入队的营销任务数上限，超出的任务排队等待，默认 2
+	CampaignSharedBody       bool    `json:"campaign_shared_body"`       // 营销正文只保存一份，队列任务仅记录追踪 ID 等收件人差异，发送时组装
+	CampaignStoreRaw         bool    `json:"campaign_store_raw"`         // 保存每位收件人实际收到的完整原始邮件 (占用空间较大，随发送日志清理)
+	CampaignDisableTracking  bool    `json:"campaign_disable_tracking"`  // 营销任务默认不注入打开像素、不改写点击链接 (任务可单独设置 disable_tracking 覆盖)
+	CampaignSendInterval     int     `json:"campaign_send_interval"`     // 营销邮件逐封间隔 (毫秒)，入队时错开各封的释放时间，通道可单独设置 send_interval，0 表示不错开
+
+	// 正文限制
+	MaxBodySize  int  `json:"max_body_size"` // HTML 与纯文本正文合计大小上限 (KB)，默认 2048，0 或负数表示不限制
+	SanitizeHTML bool `json:"sanitize_html"` // 对营销正文与模板渲染结果做白名单 HTML 净化 (标记为 raw 的模板及直接传入的正文除外)
+
+	// 发送队列
+	QueueVisibilityTimeout int  `json:"queue_visibility_timeout"` // 任务认领后的可见性超时 (秒)，超时未续期的 processing 任务可被重新认领，默认 600
+	QueueMaxAgeHours       int  `json:"queue_max_age_hours"`      // 任务在队列中的最长存活时间 (小时)，超过后直接进入 dead，0 表示不限制
+	DeadLetterAlert        bool `json:"dead_letter_alert"`        // 任务进入 dead 时发送告警 (需配置 alert_webhook_url 或 alert_email)
+	SyncSendTimeout        int  `json:"sync_send_timeout"`        // 同步发送 (sync=true) 的最长等待时间 (秒)，默认 30
+
+	// 邮件转发
+	ForwardMaxRetries int  `json:"forward_max_retries"` // 转发任务最大尝试次数，0 表示使用队列默认值 (3)
+	ForwardDSN        bool `json:"forward_dsn"`         // 转发最终失败时向原始发件人发送投递失败通知 (DSN)，关闭则静默丢弃
+
+	// 运维告警
+	AlertWebhookURL string `json:"alert_webhook_url"` // 告警 Webhook 地址 (POST JSON)
+	AlertEmail      string `json:"alert_email"`       // 告警收件地址 (经队列发送)
+
+	// 出站连通性探测 (启动时及定期连接公共 MX 的 25/587 端口)
+	ConnectivityProbeHosts    []string `json:"connectivity_probe_hosts"`    // 探测主机 (同时用于 25 与 587)，为空时 25 端口探测公共 MX、587 端口探测公共提交服务器
+	ConnectivityProbeInterval int      `json:"connectivity_probe_interval"` // 探测间隔 (分钟)，默认 30，负数表示不探测
+	ConnectivityAlert         bool     `json:"connectivity_alert"`          // 端口可达性变化时发送告警
+
+	// 每日摘要：汇总过去 24 小时的收件、转发、队列与证书情况，经默认通道发送
+	DigestEnabled bool   `json:"digest_enabled"` // 是否发送每日摘要
+	DigestEmail   string `json:"digest_email"`   // 摘要收件地址，为空时使用 alert_email
+	DigestTime    string `json:"digest_time"`    // 发送时间 (本地时间 HH:MM)，默认 "08:00"
+
+	// 收件人频率限制：同一地址两次发送的最小间隔，营销与事务邮件共同计算
+	RecipientMinInterval    int    `json:"recipient_min_interval"`    // 最小间隔 (分钟)，0 表示不限制
+	RecipientIntervalAction string `json:"recipient_interval_action"` // 营销任务启动时的处理: defer (默认，发送时顺延) / skip (直接跳过间隔内的收件人)
+
+	// 收件静态加密：Inbox 正文/原始数据及收件附件文件使用独立口令加密存储 (与 JWTSecret 无关，轮换登录密钥不影响已存邮件)
+	InboxEncryption             bool     `json:"inbox_encryption"`               // 是否加密新收到的邮件
+	InboxEncryptionKey          string   `json:"inbox_encryption_key"`           // 当前加密口令
+	InboxEncryptionPreviousKeys []string `json:"inbox_encryption_previous_keys"` // 轮换前的旧口令，仅用于解密，重新加密完成后清空
 
 	// 数据清理配置
 	CleanupEnabled      bool `json:"cleanup_enabled"`        // 是否启用自动清理
 	CleanupEmailLogDays int  `json:"cleanup_email_log_days"` // 发送日志保留天数
 	CleanupInboxDays    int  `json:"cleanup_inbox_days"`     // 收件箱保留天数
-	CleanupQueueDays    int  `json:"cleanup_queue_days"`     // 队列记录保留天数
-	CleanupForwardDays  int  `json:"cleanup_forward_days"`   // 转发日志保留天数
-	CleanupAttachDays   int  `json:"cleanup_attach_days"`    // 附件保留天数
+	// 按收件人覆盖收件箱保留天数: 键为完整地址 (support@example.com) 或域名 (example.com / @example.com)，
+	// 值为保留天数，0 表示永久保留；地址优先于域名，未匹配的收件沿用 cleanup_inbox_days
+	CleanupInboxOverrides map[string]int `json:"cleanup_inbox_overrides"`
+	CleanupQueueDays      int            `json:"cleanup_queue_days"`    // 队列记录保留天数
+	CleanupForwardDays    int            `json:"cleanup_forward_days"`  // 转发日志保留天数
+	CleanupAttachDays     int            `json:"cleanup_attach_days"`   // 附件保留天数
+	CleanupTrackingDays   int            `json:"cleanup_tracking_days"` // 追踪事件保留天数 (过期事件汇总为按天统计后删除)
+	CleanupOrphans        bool           `json:"cleanup_orphans"`       // 定时清理时对账附件目录，删除无记录的文件及文件已丢失的记录
+	// 附件清理调优：大型附件目录可调大批次与并发
+	CleanupAttachBatchSize  int `json:"cleanup_attach_batch_size"`  // 每批处理的附件数，默认 500
+	CleanupAttachBatchSleep int `json:"cleanup_attach_batch_sleep"` // 批次间休眠 (毫秒)，默认 50，负数表示不休眠
+	CleanupAttachWorkers    int `json:"cleanup_attach_workers"`     // 每批并发删除磁盘文件的协程数，默认 8
 
 	// 自动更新配置
 	AutoUpdateEnabled  bool   `json:"auto_update_enabled"`  // 是否启用自动更新
 	AutoUpdateInterval int    `json:"auto_update_interval"` // 检查间隔（小时），默认 24
 	AutoUpdateTime     string `json:"auto_update_time"`     // 自动更新执行时间，如 "03:00"
 
+	LoginCaptchaAfter int `json:"login_captcha_after"` // 同一 IP 登录失败达到该次数后才要求验证码 (15 分钟内)，0 表示始终要求
+
+	SchedulerSerialize bool `json:"scheduler_serialize"` // 串行执行后台定时任务 (营销调度、清理、证书检查、版本检测)，避免重型任务同时争用数据库
+
+	// 域名信誉保护 (阈值在各域名上配置，见 Domain.BounceThreshold)
+	ReputationWindowHours int `json:"reputation_window_hours"` // 退信率的滚动统计窗口 (小时)，默认 24
+	ReputationMinSent     int `json:"reputation_min_sent"`     // 窗口内发送量低于该值时不判定 (样本太少)，默认 100
+
+	// 备份保留策略 (每次创建备份后按时间从旧到新淘汰)
+	BackupMaxCount  int `json:"backup_max_count"`   // 最多保留的备份数，默认 10
+	BackupMaxSizeMB int `json:"backup_max_size_mb"` // 备份总大小上限 (MB)，0 表示不限制；最新的备份始终保留
+
+	// 更新后钩子 (新版本文件替换完成、重启之前执行)
+	PostUpdateHookURL      string `json:"post_update_hook_url"`      // POST JSON 通知地址
+	PostUpdateHookCommand  string `json:"post_update_hook_command"`  // 本地命令 (sh -c / cmd /C)，只能通过编辑 config.json 设置
+	PostUpdateHookTimeout  int    `json:"post_update_hook_timeout"`  // 钩子整体超时 (秒)，默认 60
+	PostUpdateHookRequired bool   `json:"post_update_hook_required"` // 钩子失败时不自动重启 (默认仅作通知，失败不影响重启)
+
+	// 数据库 (修改后需重启生效，只能通过编辑 config.json 设置)
+	DBDriver       string `json:"db_driver"`         // sqlite (默认) / mysql / postgres
+	DBDSN          string `json:"db_dsn"`            // mysql / postgres 连接串，sqlite 固定使用 goemail.db
+	DBMaxOpenConns int    `json:"db_max_open_conns"` // 最大连接数，默认 25 (sqlite 固定为 1)
+	DBMaxIdleConns int    `json:"db_max_idle_conns"` // 最大空闲连接数，默认 10
+
 	JWTSecret string `json:"jwt_secret"`
 }
 
+// ErrorCategoryRule 自定义发送错误分类规则：原始错误匹配 Pattern (正则，不区分大小写) 时归入 Category 并附带 Hint
+type ErrorCategoryRule struct {
+	Category string `json:"category"`
+	Pattern  string `json:"pattern"`
+	Hint     string `json:"hint"`
+}
+
 var (
 	AppConfig Config
 	ConfigMu  sync.RWMutex // 保护 AppConfig 的并发读写
@@ -71,6 +211,12 @@ func LoadConfig() {
 		BaseURL:      "", // 默认留空，运行时自动推断
 		EnableSSL:    false,
 		JWTSecret:    "", // 默认留空，强制在后续逻辑中生成
+
+		// 以下字段的 0 是有效取值，只在配置文件缺少该字段时使用默认值
+		ReceiverSpamMaxLinks:   10,
+		ReceiverSpamCapsMinLen: 10,
+		ReceiverMaxReceived:    50,
+		MaxBodySize:            2048,
 	}
 
 	file, err := os.Open("config.json")
@@ -131,6 +277,42 @@ func LoadConfig() {
 		AppConfig.ReceiverMaxMsgSize = 10240 // 10MB
 		needsSave = true
 	}
+	if AppConfig.ReceiverMaxLineLen == 0 {
+		AppConfig.ReceiverMaxLineLen = 65536 // 64KB
+		needsSave = true
+	}
+	if AppConfig.ReceiverCommandTimeout == 0 {
+		AppConfig.ReceiverCommandTimeout = 300 // RFC 5321 建议至少 5 分钟
+		needsSave = true
+	}
+	if AppConfig.ReceiverDataTimeout == 0 {
+		AppConfig.ReceiverDataTimeout = 600
+		needsSave = true
+	}
+	if AppConfig.ReceiverImageMinSize == 0 {
+		AppConfig.ReceiverImageMinSize = 1024
+		needsSave = true
+	}
+	if AppConfig.ReceiverImageMaxDim == 0 {
+		AppConfig.ReceiverImageMaxDim = 2048
+		needsSave = true
+	}
+	if AppConfig.ReceiverImageQuality == 0 {
+		AppConfig.ReceiverImageQuality = 80
+		needsSave = true
+	}
+	if AppConfig.ReceiverAutoBlockThreshold == 0 {
+		AppConfig.ReceiverAutoBlockThreshold = 10
+		needsSave = true
+	}
+	if AppConfig.ReceiverAutoBlockWindow == 0 {
+		AppConfig.ReceiverAutoBlockWindow = 10
+		needsSave = true
+	}
+	if AppConfig.ReceiverAutoBlockTTL == 0 {
+		AppConfig.ReceiverAutoBlockTTL = 60
+		needsSave = true
+	}
 
 	// 4. Web 端口 (双重保险)
 	if AppConfig.Port == "" {
@@ -138,7 +320,35 @@ func LoadConfig() {
 		needsSave = true
 	}
 
-	// 5. 数据清理默认值
+	// 5. 营销任务默认值
+	if AppConfig.CampaignConfirmThreshold == 0 {
+		AppConfig.CampaignConfirmThreshold = 5000
+		needsSave = true
+	}
+	if AppConfig.MXCacheTTL == 0 {
+		AppConfig.MXCacheTTL = 300
+		needsSave = true
+	}
+	if AppConfig.DomainVerifyTimeout <= 0 {
+		AppConfig.DomainVerifyTimeout = 10
+		needsSave = true
+	}
+	if AppConfig.CampaignMaxConcurrent == 0 {
+		AppConfig.CampaignMaxConcurrent = 2
+		needsSave = true
+	}
+
+	// 6. 发送队列默认值
+	if AppConfig.QueueVisibilityTimeout == 0 {
+		AppConfig.QueueVisibilityTimeout = 600
+		needsSave = true
+	}
+	if AppConfig.SyncSendTimeout == 0 {
+		AppConfig.SyncSendTimeout = 30
+		needsSave = true
+	}
+
+	// 7. 数据清理默认值
 	if AppConfig.CleanupEmailLogDays == 0 {
 		AppConfig.CleanupEmailLogDays = 30
 		needsSave = true
@@ -159,6 +369,26 @@ func LoadConfig() {
 		AppConfig.CleanupAttachDays = 30
 		needsSave = true
 	}
+	if AppConfig.CleanupTrackingDays == 0 {
+		AppConfig.CleanupTrackingDays = 90
+		needsSave = true
+	}
+
+	// 8. 备份保留数量默认值
+	if AppConfig.BackupMaxCount == 0 {
+		AppConfig.BackupMaxCount = 10
+		needsSave = true
+	}
+
+	// 9. 数据库连接池默认值
+	if AppConfig.DBMaxOpenConns == 0 {
+		AppConfig.DBMaxOpenConns = 25
+		needsSave = true
+	}
+	if AppConfig.DBMaxIdleConns == 0 {
+		AppConfig.DBMaxIdleConns = 10
+		needsSave = true
+	}
 
 	if needsSave {
 		SaveConfig(AppConfig)
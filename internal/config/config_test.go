@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/tls"
+	"os"
 	"testing"
 )
 
@@ -16,3 +18,52 @@ func TestGenerateRandomKey(t *testing.T) {
 		t.Fatalf("Key too short: %d", len(key1))
 	}
 }
+
+func TestParseTLSPolicy(t *testing.T) {
+	version, suites, err := ParseTLSPolicy("", nil)
+	if err != nil || version != tls.VersionTLS12 || suites != nil {
+		t.Fatalf("default policy = %x, %v, %v", version, suites, err)
+	}
+	version, _, err = ParseTLSPolicy("TLS1.3", nil)
+	if err != nil || version != tls.VersionTLS13 {
+		t.Errorf("TLS1.3 = %x, %v", version, err)
+	}
+	_, suites, err = ParseTLSPolicy("1.2", []string{"tls_ecdhe_rsa_with_aes_128_gcm_sha256", " "})
+	if err != nil || len(suites) != 1 || suites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("suite allowlist = %v, %v", suites, err)
+	}
+
+	for _, bad := range []struct {
+		version string
+		suites  []string
+	}{
+		{"1.4", nil},
+		{"1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}}, // 不安全套件
+		{"1.2", []string{"TLS_AES_128_GCM_SHA256"}},   // TLS 1.3 套件
+		{"1.2", []string{"NOT_A_SUITE"}},
+	} {
+		if _, _, err := ParseTLSPolicy(bad.version, bad.suites); err == nil {
+			t.Errorf("ParseTLSPolicy(%q, %v) should fail", bad.version, bad.suites)
+		}
+	}
+}
+
+func TestLoadConfigKeepsExplicitZero(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saved := AppConfig
+	defer func() { AppConfig = saved }()
+
+	if err := os.WriteFile("config.json", []byte(`{"receiver_spam_max_links": 0}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	LoadConfig()
+	if AppConfig.ReceiverSpamMaxLinks != 0 {
+		t.Errorf("receiver_spam_max_links = %d, want explicit 0 kept", AppConfig.ReceiverSpamMaxLinks)
+	}
+	if AppConfig.ReceiverMaxReceived != 50 {
+		t.Errorf("receiver_max_received = %d, want default 50 when absent", AppConfig.ReceiverMaxReceived)
+	}
+	if AppConfig.ReceiverSpamCapsMinLen != 10 {
+		t.Errorf("receiver_spam_caps_min_len = %d, want default 10 when absent", AppConfig.ReceiverSpamCapsMinLen)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// tlsVersions tls_min_version 可选值
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSPolicy 解析 tls_min_version 与 tls_cipher_suites
+// 版本为空时默认 TLS 1.2；套件使用 IANA 名称 (如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)，
+// 仅允许 Go 认为安全的 TLS 1.2 套件，TLS 1.3 套件不可配置；列表为空时使用 Go 默认套件
+func ParseTLSPolicy(minVersion string, cipherSuites []string) (uint16, []uint16, error) {
+	version := uint16(tls.VersionTLS12)
+	if v := strings.TrimSpace(minVersion); v != "" {
+		parsed, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid tls_min_version %q (allowed: 1.0, 1.1, 1.2, 1.3)", minVersion)
+		}
+		version = parsed
+	}
+
+	if len(cipherSuites) == 0 {
+		return version, nil, nil
+	}
+	available := make(map[string]*tls.CipherSuite)
+	for _, s := range tls.CipherSuites() {
+		available[s.Name] = s
+	}
+	var suites []uint16
+	for _, name := range cipherSuites {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		s, ok := available[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		if len(s.SupportedVersions) == 1 && s.SupportedVersions[0] == tls.VersionTLS13 {
+			return 0, nil, fmt.Errorf("cipher suite %s is TLS 1.3 only and cannot be configured", name)
+		}
+		suites = append(suites, s.ID)
+	}
+	return version, suites, nil
+}
+
+// ApplyTLSPolicy 将当前配置的最低版本与套件白名单写入 tls.Config (接收服务 STARTTLS 与 HTTPS 共用)
+// 配置无效时记录日志并保持 TLS 1.2 + 默认套件
+func ApplyTLSPolicy(cfg *tls.Config) {
+	version, suites, err := ParseTLSPolicy(AppConfig.TLSMinVersion, AppConfig.TLSCipherSuites)
+	if err != nil {
+		log.Printf("[Config] %v, falling back to TLS 1.2 defaults", err)
+		version, suites = tls.VersionTLS12, nil
+	}
+	cfg.MinVersion = version
+	cfg.CipherSuites = suites
+}
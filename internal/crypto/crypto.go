@@ -90,3 +90,53 @@ func Decrypt(ciphertext, secret string) (string, error) {
 func IsEncrypted(s string) bool {
 	return strings.HasPrefix(s, encryptedPrefix)
 }
+
+// encryptedFileMagic 加密文件的头部标识
+const encryptedFileMagic = "GOEENC1\n"
+
+// newGCM 由密钥字符串创建 AES-256-GCM
+func newGCM(secret string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptBytes 使用 AES-256-GCM 加密二进制数据 (用于磁盘文件)，输出带头部标识
+func EncryptBytes(data []byte, secret string) ([]byte, error) {
+	aesGCM, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encryptedFileMagic)+len(nonce)+len(data)+aesGCM.Overhead())
+	out = append(out, encryptedFileMagic...)
+	out = append(out, nonce...)
+	return aesGCM.Seal(out, nonce, data, nil), nil
+}
+
+// DecryptBytes 解密 EncryptBytes 的输出；没有头部标识的数据视为明文原样返回
+func DecryptBytes(data []byte, secret string) ([]byte, error) {
+	if !IsEncryptedBytes(data) {
+		return data, nil
+	}
+	aesGCM, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedFileMagic):]
+	if len(data) < aesGCM.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, encrypted := data[:aesGCM.NonceSize()], data[aesGCM.NonceSize():]
+	return aesGCM.Open(nil, nonce, encrypted, nil)
+}
+
+// IsEncryptedBytes 检查二进制数据是否为 EncryptBytes 的输出
+func IsEncryptedBytes(data []byte) bool {
+	return len(data) >= len(encryptedFileMagic) && string(data[:len(encryptedFileMagic)]) == encryptedFileMagic
+}
@@ -74,3 +74,25 @@ func TestIsEncrypted(t *testing.T) {
 		t.Fatal("enc: prefixed string should be detected as encrypted")
 	}
 }
+
+func TestEncryptBytes(t *testing.T) {
+	data := []byte("%PDF-1.4\x00\x01binary")
+	encrypted, err := EncryptBytes(data, "file-key")
+	if err != nil {
+		t.Fatalf("EncryptBytes failed: %v", err)
+	}
+	if !IsEncryptedBytes(encrypted) || IsEncryptedBytes(data) {
+		t.Fatal("IsEncryptedBytes misdetected")
+	}
+
+	decrypted, err := DecryptBytes(encrypted, "file-key")
+	if err != nil || string(decrypted) != string(data) {
+		t.Fatalf("DecryptBytes = %q, %v", decrypted, err)
+	}
+	if _, err := DecryptBytes(encrypted, "wrong-key"); err == nil {
+		t.Fatal("DecryptBytes with wrong key should fail")
+	}
+	if plain, _ := DecryptBytes(data, "file-key"); string(plain) != string(data) {
+		t.Fatal("plaintext should pass through DecryptBytes unchanged")
+	}
+}
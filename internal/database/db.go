@@ -2,11 +2,14 @@ package database
 
 import (
 	"crypto/rand"
+	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"time"
 
-	"github.com/glebarez/sqlite"
+	"goemail/internal/config"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -58,23 +61,33 @@ func InitDB() {
 		},
 	)
 
-	DB, err = gorm.Open(sqlite.Open("goemail.db"), &gorm.Config{
+	dialector, err := openDialector()
+	if err != nil {
+		log.Fatalf("[DB] %v", err)
+	}
+	DB, err = gorm.Open(dialector, &gorm.Config{
 		Logger: newLogger,
 	})
 	if err != nil {
 		log.Fatalf("[DB] Failed to connect: %v", err)
 	}
 
-	// 优化 SQLite 并发性能
 	sqlDB, err := DB.DB()
 	if err == nil {
-		sqlDB.Exec("PRAGMA journal_mode=WAL")
-		sqlDB.Exec("PRAGMA busy_timeout=5000")
-		sqlDB.Exec("PRAGMA synchronous=NORMAL")
-		sqlDB.SetMaxOpenConns(1) // SQLite 单写者模型
+		if IsSQLite() {
+			// 优化 SQLite 并发性能
+			sqlDB.Exec("PRAGMA journal_mode=WAL")
+			sqlDB.Exec("PRAGMA busy_timeout=5000")
+			sqlDB.Exec("PRAGMA synchronous=NORMAL")
+			sqlDB.SetMaxOpenConns(1) // SQLite 单写者模型
+		} else {
+			sqlDB.SetMaxOpenConns(config.AppConfig.DBMaxOpenConns)
+			sqlDB.SetMaxIdleConns(config.AppConfig.DBMaxIdleConns)
+			sqlDB.SetConnMaxLifetime(time.Hour)
+		}
 	}
 
-	log.Println("[DB] Connection established. Starting calibration...")
+	log.Printf("[DB] Connection established (%s). Starting calibration...", Driver())
 
 	// 2. 注册所有模型 (用于 AutoMigrate)
 	models := []interface{}{
@@ -85,15 +98,25 @@ func InitDB() {
 		&Domain{},
 		&Template{},
 		&EmailLog{},
+		&TrackingEvent{},
+		&RenderedMessage{},
+		&RecipientLastSent{},
+		&CampaignDailyStat{},
 		&Sender{},
 		&APIKey{},
 		&EmailQueue{},
 		&AttachmentFile{},
 		&ForwardRule{},
 		&ForwardLog{},
+		&Bounce{},
+		&Complaint{},
+		&SpamKeyword{},
+		&TagRule{},
 		&ContactGroup{},
 		&Contact{},
 		&Campaign{},
+		&UnsubscribeTopic{},
+		&TopicUnsubscribe{},
 		&Inbox{},
 	}
 
@@ -113,6 +136,21 @@ func InitDB() {
 	log.Println("[DB] Database ready.")
 }
 
+// queryIndexes 大表常用查询的复合索引 (迁移 v5 创建)
+// 列表页条件均含软删除的 deleted_at IS NULL 并按 created_at 倒序分页，(deleted_at, created_at) 可直接按索引顺序取第一页，
+// 避免百万级数据时全表扫描 + 临时排序；营销任务进度按 (campaign_id, status) 计数只需扫描索引
+// status 列在模型中限定长度，MySQL 不支持对 TEXT 列直接建索引
+var queryIndexes = []struct {
+	Table   string
+	Name    string
+	Columns string
+}{
+	{"inboxes", "idx_inboxes_deleted_created", "deleted_at, created_at"},               // ListInboxHandler
+	{"email_logs", "idx_email_logs_deleted_created", "deleted_at, created_at"},         // LogsHandler、GetStats 今日发送与趋势
+	{"email_logs", "idx_email_logs_campaign_status", "campaign_id, status"},            // 营销任务失败原因汇总
+	{"email_queues", "idx_email_queues_campaign_status", "campaign_id, status"},        // 营销任务进度、完成判定
+}
+
 // runMigrations 执行版本化迁移
 func runMigrations() {
 	// 定义迁移步骤
@@ -142,6 +180,49 @@ func runMigrations() {
 				return nil
 			},
 		},
+		{
+			Version:     3,
+			Description: "Backfill Inbox Thread IDs",
+			Action: func(db *gorm.DB) error {
+				// 历史邮件没有引用头信息，每封邮件各自成为一个会话
+				var items []Inbox
+				return db.Select("id").Where("thread_id = '' OR thread_id IS NULL").
+					FindInBatches(&items, 500, func(tx *gorm.DB, batch int) error {
+						for _, item := range items {
+							db.Model(&Inbox{}).Where("id = ?", item.ID).Update("thread_id", fmt.Sprintf("inbox-%d", item.ID))
+						}
+						return nil
+					}).Error
+			},
+		},
+		{
+			Version:     4,
+			Description: "Seed Spam Keywords",
+			Action: func(db *gorm.DB) error {
+				// 原先编译在收件服务中的关键词列表，迁移后可通过 API 维护
+				for _, kw := range defaultSpamKeywords {
+					if err := db.Create(&SpamKeyword{Keyword: kw, Target: "both", Enabled: true}).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version:     5,
+			Description: "Add Composite Query Indexes",
+			Action: func(db *gorm.DB) error {
+				for _, idx := range queryIndexes {
+					if db.Migrator().HasIndex(idx.Table, idx.Name) {
+						continue
+					}
+					if err := db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", idx.Name, idx.Table, idx.Columns)).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
 		// 未来示例：如果需要将 email_logs 的 recipient 字段长度扩大，或者做数据转换
 		// {
 		// 	Version: 3,
@@ -174,6 +255,21 @@ func runMigrations() {
 	}
 }
 
+// defaultSpamKeywords 内置的垃圾邮件关键词 (中英文)
+var defaultSpamKeywords = []string{
+	// 英文关键词
+	"viagra", "cialis", "lottery", "winner", "congratulations",
+	"nigerian prince", "inheritance", "million dollars",
+	"click here", "act now", "limited time", "free money",
+	"make money fast", "work from home", "earn cash",
+	"no obligation", "risk free", "credit card",
+	"penis enlargement", "weight loss", "diet pills",
+	// 中文关键词
+	"彩票中奖", "恭喜您获得", "免费赠送", "点击领取",
+	"低价出售", "发票代开", "刷单兼职", "网赚项目",
+	"色情", "赌博", "博彩", "六合彩",
+}
+
 // runSeeding 填充/校准基础数据
 func runSeeding() {
 	// 1. 校准默认管理员
@@ -209,7 +305,10 @@ func runSeeding() {
 		})
 	}
 
-	// 3. 数据完整性检查 (Data Integrity Check)
+	// 3. 内置模板库
+	seedGalleryTemplates()
+
+	// 4. 数据完整性检查 (Data Integrity Check)
 	// 检查是否有缺失文件的附件记录
 	// var lostFiles int64
 	// 这里只做统计，不贸然删除，以免误删
@@ -220,6 +319,62 @@ func runSeeding() {
 	// }
 }
 
+// trendHours 首页趋势图覆盖的小时数 (含当前小时共 trendHours+1 个点)
+const trendHours = 12
+
+// trendStart 趋势图第一个整点 (本地时间)
+func trendStart(now time.Time) time.Time {
+	hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+	return hour.Add(-trendHours * time.Hour)
+}
+
+// trendBucketExpr 按整点区间编号 (0..trendHours) 的 CASE 表达式
+// 区间边界作为参数传入，由驱动按与 created_at 相同的方式处理时区，不依赖各数据库的日期函数
+func trendBucketExpr(start time.Time) (string, []interface{}) {
+	var b strings.Builder
+	args := make([]interface{}, 0, trendHours)
+	b.WriteString("CASE")
+	for i := 1; i <= trendHours; i++ {
+		fmt.Fprintf(&b, " WHEN created_at < ? THEN %d", i-1)
+		args = append(args, start.Add(time.Duration(i)*time.Hour))
+	}
+	fmt.Fprintf(&b, " ELSE %d END", trendHours)
+	return b.String(), args
+}
+
+// hourlyTrend 在数据库中按整点分组统计 now 之前 trendHours 小时的发送量，跨天时按时间先后排列
+func hourlyTrend(now time.Time) ([]TrendPoint, error) {
+	start := trendStart(now)
+	expr, args := trendBucketExpr(start)
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	err := DB.Model(&EmailLog{}).
+		Select(expr+" AS bucket, COUNT(*) AS count", args...).
+		Where("created_at >= ? AND created_at < ?", start, start.Add((trendHours+1)*time.Hour)).
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, trendHours+1)
+	for _, r := range rows {
+		if r.Bucket >= 0 && r.Bucket <= trendHours {
+			counts[r.Bucket] = r.Count
+		}
+	}
+	trend := make([]TrendPoint, 0, trendHours+1)
+	for i, count := range counts {
+		trend = append(trend, TrendPoint{
+			Time:  start.Add(time.Duration(i) * time.Hour).Format("15:00"),
+			Count: count,
+		})
+	}
+	return trend, nil
+}
+
 // GetStats 获取统计信息
 func GetStats() (Stats, error) {
 	var stats Stats
@@ -253,38 +408,8 @@ func GetStats() (Stats, error) {
 	}
 
 	// 趋势数据
-	type TrendResult struct {
-		Hour  string
-		Count int64
-	}
-	var results []TrendResult
-	
-	now := time.Now()
-	startTime := now.Add(-12 * time.Hour)
-
-	err = DB.Model(&EmailLog{}).
-		Select("strftime('%H:00', created_at) as hour, count(*) as count").
-		Where("created_at >= ?", startTime).
-		Group("hour").
-		Order("hour asc").
-		Scan(&results).Error
-	
-	if err == nil {
-		stats.Trend = make([]TrendPoint, 0)
-		resultMap := make(map[string]int64)
-		for _, r := range results {
-			resultMap[r.Hour] = r.Count
-		}
-
-		for i := 12; i >= 0; i-- {
-			t := now.Add(time.Duration(-i) * time.Hour)
-			hourKey := t.Format("15:00")
-			count := resultMap[hourKey]
-			stats.Trend = append(stats.Trend, TrendPoint{
-				Time:  hourKey,
-				Count: count,
-			})
-		}
+	if trend, err := hourlyTrend(time.Now()); err == nil {
+		stats.Trend = trend
 	}
 
 	return stats, nil
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHourlyTrendAcrossDayBoundary(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&EmailLog{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := DB
+	DB = db
+	defer func() { DB = prev }()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2024, 3, 2, 5, 30, 0, 0, loc)
+	for _, at := range []time.Time{
+		time.Date(2024, 3, 1, 16, 59, 0, 0, loc), // 窗口之外
+		time.Date(2024, 3, 1, 17, 0, 0, 0, loc),
+		time.Date(2024, 3, 1, 23, 59, 59, 0, loc),
+		time.Date(2024, 3, 2, 0, 0, 0, 0, loc),
+		time.Date(2024, 3, 2, 0, 10, 0, 0, loc),
+		time.Date(2024, 3, 2, 5, 29, 0, 0, loc),
+	} {
+		db.Create(&EmailLog{Recipient: "a@example.com", Status: "success", CreatedAt: at})
+	}
+
+	trend, err := hourlyTrend(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 13 {
+		t.Fatalf("len(trend) = %d, want 13", len(trend))
+	}
+	if trend[0].Time != "17:00" || trend[12].Time != "05:00" {
+		t.Fatalf("trend spans %s..%s, want 17:00..05:00", trend[0].Time, trend[12].Time)
+	}
+	want := map[string]int64{"17:00": 1, "23:00": 1, "00:00": 2, "05:00": 1}
+	for i, p := range trend {
+		if p.Count != want[p.Time] {
+			t.Errorf("trend[%d] %s = %d, want %d", i, p.Time, p.Count, want[p.Time])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"goemail/internal/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// 数据库驱动 (db_driver)
+const (
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// SQLiteFile SQLite 数据库文件 (sqlite 驱动忽略 db_dsn，备份/导出时直接复制该文件)
+const SQLiteFile = "goemail.db"
+
+// driver 当前连接使用的驱动，InitDB 时确定
+var driver = DriverSQLite
+
+// Driver 返回当前数据库驱动
+func Driver() string {
+	return driver
+}
+
+// IsSQLite 当前是否为 SQLite (WAL、PRAGMA、文件级备份等仅在 SQLite 下有效)
+func IsSQLite() bool {
+	return driver == DriverSQLite
+}
+
+// normalizeDriver 规范化 db_driver，空值为 sqlite
+func normalizeDriver(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", DriverSQLite, "sqlite3":
+		return DriverSQLite, nil
+	case DriverMySQL, "mariadb":
+		return DriverMySQL, nil
+	case DriverPostgres, "postgresql", "pg":
+		return DriverPostgres, nil
+	}
+	return "", fmt.Errorf("unsupported db_driver %q (allowed: sqlite, mysql, postgres)", name)
+}
+
+// openDialector 按配置返回 GORM 方言
+// mysql DSN 形如 user:pass@tcp(host:3306)/goemail?charset=utf8mb4&parseTime=True&loc=Local
+// postgres DSN 形如 host=localhost user=goemail password=xxx dbname=goemail port=5432 sslmode=disable
+func openDialector() (gorm.Dialector, error) {
+	name, err := normalizeDriver(config.AppConfig.DBDriver)
+	if err != nil {
+		return nil, err
+	}
+	dsn := strings.TrimSpace(config.AppConfig.DBDSN)
+	if name != DriverSQLite && dsn == "" {
+		return nil, fmt.Errorf("db_dsn is required for db_driver %s", name)
+	}
+	driver = name
+
+	switch name {
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	}
+	return sqlite.Open(SQLiteFile), nil
+}
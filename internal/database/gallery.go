@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// 模板分类
+const (
+	TemplateCategoryOnboarding    = "onboarding"
+	TemplateCategoryTransactional = "transactional"
+	TemplateCategoryNewsletter    = "newsletter"
+)
+
+// galleryLayout 内置模板的响应式外框 (600px 居中表格，窄屏自适应)
+const galleryLayout = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1">
+<style>
+body{margin:0;padding:0;background:#f4f5f7;font-family:-apple-system,"Segoe UI","PingFang SC","Microsoft YaHei",sans-serif;color:#333}
+.wrap{width:100%%;background:#f4f5f7;padding:24px 0}
+.card{max-width:600px;margin:0 auto;background:#fff;border-radius:8px;overflow:hidden}
+.head{background:#2563eb;color:#fff;padding:24px 32px;font-size:20px;font-weight:bold}
+.body{padding:32px;line-height:1.7;font-size:15px}
+.btn{display:inline-block;background:#2563eb;color:#fff !important;text-decoration:none;padding:12px 28px;border-radius:6px;font-weight:bold}
+.foot{padding:16px 32px;color:#999;font-size:12px;text-align:center}
+table.items{width:100%%;border-collapse:collapse}
+table.items td{padding:8px 0;border-bottom:1px solid #eee}
+@media (max-width:620px){.card{border-radius:0}.body,.head{padding:20px}}
+</style></head>
+<body><div class="wrap"><div class="card">
+<div class="head">%s</div>
+<div class="body">%s</div>
+<div class="foot">此邮件发送至 {email}</div>
+</div></div></body></html>`
+
+// GalleryTemplates 内置模板库，首次启动时写入数据库 (BuiltIn=true，只读)
+func GalleryTemplates() []Template {
+	return []Template{
+		{
+			Name:     "欢迎邮件",
+			Category: TemplateCategoryOnboarding,
+			Subject:  "欢迎加入，{name}！",
+			Body: galleryPage("欢迎加入",
+				`<p>你好 {name}，</p><p>感谢注册！你的账号已经创建成功，现在就可以开始使用了。</p>`+
+					`<p style="text-align:center;margin:32px 0"><a class="btn" href="https://example.com/start">开始使用</a></p>`+
+					`<p>如有任何问题，直接回复此邮件即可联系我们。</p>`),
+			BuiltIn: true,
+		},
+		{
+			Name:     "密码重置",
+			Category: TemplateCategoryTransactional,
+			Subject:  "重置你的密码",
+			Body: galleryPage("密码重置",
+				`<p>你好 {name}，</p><p>我们收到了重置账号 {email} 密码的请求。点击下方按钮设置新密码，链接 30 分钟内有效。</p>`+
+					`<p style="text-align:center;margin:32px 0"><a class="btn" href="https://example.com/reset">重置密码</a></p>`+
+					`<p style="color:#999;font-size:13px">如果这不是你本人的操作，请忽略此邮件，你的密码不会被修改。</p>`),
+			BuiltIn: true,
+		},
+		{
+			Name:     "订单收据",
+			Category: TemplateCategoryTransactional,
+			Subject:  "你的订单收据",
+			Body: galleryPage("订单收据",
+				`<p>你好 {name}，感谢你的购买！以下是本次订单明细：</p>`+
+					`<table class="items"><tr><td>商品名称</td><td style="text-align:right">¥0.00</td></tr>`+
+					`<tr><td>运费</td><td style="text-align:right">¥0.00</td></tr>`+
+					`<tr><td><strong>合计</strong></td><td style="text-align:right"><strong>¥0.00</strong></td></tr></table>`+
+					`<p style="margin-top:24px">如需发票或售后服务，请回复此邮件。</p>`),
+			BuiltIn: true,
+		},
+		{
+			Name:     "新闻通讯",
+			Category: TemplateCategoryNewsletter,
+			Subject:  "本期精选",
+			Body: galleryPage("本期精选",
+				`<p>你好 {name}，以下是本期的精选内容：</p>`+
+					`<h3 style="margin-bottom:4px">文章标题一</h3><p style="margin-top:0">文章摘要，简要介绍内容。<a href="https://example.com/1">阅读全文 →</a></p>`+
+					`<h3 style="margin-bottom:4px">文章标题二</h3><p style="margin-top:0">文章摘要，简要介绍内容。<a href="https://example.com/2">阅读全文 →</a></p>`+
+					`<p style="text-align:center;margin:32px 0"><a class="btn" href="https://example.com">查看更多</a></p>`),
+			BuiltIn: true,
+		},
+	}
+}
+
+func galleryPage(title, content string) string {
+	return fmt.Sprintf(galleryLayout, title, content)
+}
+
+// seedGalleryTemplates 写入内置模板库 (已存在内置模板时跳过)
+func seedGalleryTemplates() {
+	var count int64
+	DB.Model(&Template{}).Where("built_in = ?", true).Count(&count)
+	if count > 0 {
+		return
+	}
+	log.Println("[DB] Seeding template gallery...")
+	for _, tpl := range GalleryTemplates() {
+		DB.Create(&tpl)
+	}
+}
@@ -14,20 +14,71 @@ type EmailLog struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Recipient string `json:"recipient"`
+	FromAddr  string `json:"from_addr"` // 发件地址 (重发时使用)
+	FromName  string `json:"from_name"` // 发件人显示名称
 	Subject   string `json:"subject"`
 	Body      string `json:"body"`
-	Status    string `json:"status"` // "success" or "failed"
+	TextBody  string `json:"text_body"` // 纯文本备选正文 (重发时使用)
+	Headers   string `json:"headers"`   // JSON encoded map[string]string (附加邮件头，重发时使用)
+	Status    string `json:"status" gorm:"size:32"` // "success" or "failed"
 	ErrorMsg  string `json:"error_msg"`
+	ErrorCategory string `json:"error_category" gorm:"index"` // 失败原因分类 (rate_limited, blacklisted, invalid_recipient 等)
+	ErrorHint     string `json:"error_hint"`                  // 针对该分类的处理建议
 	ClientIP  string `json:"client_ip"`
 	Channel    string `json:"channel"` // "direct" or "smtp_config_id"
+	TriedChannels string `json:"tried_channels,omitempty"` // 故障转移时依次尝试的通道 (如 smtp_1,smtp_3,direct)，未切换通道时为空
+	RawHash    string `json:"raw_hash"` // 实际发出的原始邮件 (含 DKIM 签名) 的 SHA-256，用于核对复现内容
 	CampaignID uint   `json:"campaign_id" gorm:"index"`
+	ContactID  uint   `json:"contact_id" gorm:"index"` // 营销任务发送时关联的联系人
 
 	// 追踪字段
-	TrackingID   string     `json:"tracking_id" gorm:"index"`
-	Opened       bool       `json:"opened"`
-	OpenedAt     *time.Time `json:"opened_at"`
-	ClickedCount int        `json:"clicked_count"`
-	Unsubscribed bool       `json:"unsubscribed"`
+	TrackingID     string     `json:"tracking_id" gorm:"index"`
+	Opened         bool       `json:"opened"`
+	OpenedAt       *time.Time `json:"opened_at"`
+	ClickedCount   int        `json:"clicked_count"`
+	ClickedAt      *time.Time `json:"clicked_at"` // 首次点击时间
+	Unsubscribed   bool       `json:"unsubscribed"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at"`
+}
+
+// RenderedMessage 营销邮件实际发出的完整原始邮件 (campaign_store_raw 开启时保存)
+// 单独存表，避免追踪、日志列表等读取 EmailLog 时加载大字段；随发送日志一起清理
+type RenderedMessage struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	EmailLogID uint      `json:"email_log_id" gorm:"uniqueIndex"`
+	CampaignID uint      `json:"campaign_id" gorm:"index"`
+	Raw        string    `json:"-"`
+}
+
+// RecipientLastSent 每个收件地址最近一次发送的时间 (recipient_min_interval 频率限制使用)
+type RecipientLastSent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Email      string    `json:"email" gorm:"size:191;uniqueIndex"` // 小写收件地址
+	LastSentAt time.Time `json:"last_sent_at" gorm:"index"`
+}
+
+// TrackingEvent 单次追踪事件 (打开/点击/退订)，超过保留期限后汇总到 CampaignDailyStat 再删除
+type TrackingEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	EmailLogID uint   `gorm:"index" json:"email_log_id"`
+	CampaignID uint   `gorm:"index" json:"campaign_id"`
+	Type       string `gorm:"size:20" json:"type"` // "open", "click", "unsubscribe"
+	URL        string `json:"url"`                 // 点击事件的目标链接
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+}
+
+// CampaignDailyStat 营销任务按天汇总的追踪统计 (原始事件清理后保留历史总数)
+type CampaignDailyStat struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	CampaignID   uint   `gorm:"uniqueIndex:idx_campaign_day" json:"campaign_id"`
+	Day          string `gorm:"size:10;uniqueIndex:idx_campaign_day" json:"day"` // YYYY-MM-DD
+	Opens        int64  `json:"opens"`
+	Clicks       int64  `json:"clicks"`
+	Unsubscribes int64  `json:"unsubscribes"`
 }
 
 // EmailQueue 邮件发送队列
@@ -38,17 +89,40 @@ type EmailQueue struct {
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
 	From        string    `json:"from"`
+	FromName    string    `json:"from_name"` // 发件人显示名称
 	To          string    `json:"to"`
 	Subject     string    `json:"subject"`
 	Body        string    `json:"body"`
+	TextBody    string    `json:"text_body"`   // 纯文本备选正文 (可选)
+	ICal        string    `json:"ical" gorm:"column:ical"` // iCalendar 会议邀请 (可选)
 	Attachments string    `json:"attachments"` // JSON encoded []Attachment
+	Headers     string    `json:"headers"`     // JSON encoded map[string]string (自定义邮件头)
+	FallbackChannels string    `json:"fallback_channels"` // JSON encoded []uint (备用通道)
 	ChannelID   uint      `json:"channel_id"`
-	Status      string    `json:"status" gorm:"index"` // pending, processing, failed, completed
+	Status      string    `json:"status" gorm:"size:32;index"` // pending, processing, failed, completed
 	Retries     int       `json:"retries"`
 	NextRetry   time.Time `json:"next_retry" gorm:"index"`
 	ErrorMsg    string    `json:"error_msg"`
 	CampaignID  uint      `json:"campaign_id" gorm:"index"`
+	ContactID   uint      `json:"contact_id"`               // 关联的联系人 (营销任务)
 	TrackingID  string    `json:"tracking_id"`              // 预生成的追踪ID
+
+	ClaimedAt  *time.Time `json:"claimed_at" gorm:"index"`  // 认领 (或最近一次续期) 时间，超过可见性超时视为 Worker 已失联
+	WorkerID   string     `json:"worker_id" gorm:"size:64"` // 认领该任务的 Worker 标识
+	HardBounce bool       `json:"hard_bounce"`              // 进入 dead 时最终错误是否为硬退信 (5xx 永久拒绝)
+	MaxRetries int        `json:"max_retries"`              // 最大尝试次数，0 表示使用全局默认
+
+	AttachmentsReleased bool `json:"-"` // 引用的本地附件已在任务结束 (completed / dead) 时释放，清理记录时不再重复释放
+
+	SharedBody    bool   `json:"shared_body"`    // 正文不落在队列中，发送时由营销任务正文按收件人组装
+	RecipientName string `json:"recipient_name"` // 共享正文组装时替换 {name} 的收件人姓名
+
+	AllowUnverifiedDomain bool `json:"allow_unverified_domain"` // 跳过发件域名验证检查
+	ChannelDomainOverride string `json:"channel_domain_override"` // 跳过 From 域名与通道匹配检查的原因 (发送时记录审计日志)
+	SkipBCC               bool `json:"skip_bcc"`                // 不附加归档 BCC
+	SkipFooter            bool `json:"skip_footer"`             // 不注入域名页脚
+	EnvelopeFrom          string `json:"envelope_from"`         // 信封发件人，为空时与 From 相同
+	BypassRecipientInterval bool `json:"bypass_recipient_interval"` // 不受收件人最小发送间隔限制
 }
 
 // ContactGroup 联系人分组
@@ -88,8 +162,14 @@ type Campaign struct {
 	Subject    string `json:"subject"`
 	TemplateID uint   `json:"template_id"` // 可选
 	Body       string `json:"body"`        // HTML内容
-	SenderID   uint   `json:"sender_id"`   // SMTP Config ID
+	TextBody   string `json:"text_body"`   // 纯文本备选正文 (为空时由 HTML 自动生成)
+	SenderID   uint   `json:"sender_id"`   // SMTP Config ID (仅负责传输)
 	SenderName string `json:"sender_name"` // 发件人显示名称
+	TopicID    uint   `json:"topic_id" gorm:"index"` // 退订主题 (0 表示退订即全局退订)
+
+	SenderEmail      string `json:"sender_email"`                      // 发件人地址 (为空时使用 SMTP 通道用户名)
+	SenderIdentityID uint   `json:"sender_identity_id"`                // 发件人身份 ID，非 0 时覆盖 SenderName/SenderEmail
+	SenderWarning    string `json:"sender_warning,omitempty" gorm:"-"` // 发件域名未验证时的提示 (不入库)
 
 	TargetType    string `json:"target_type"`     // "group" or "manual"
 	TargetGroupID uint   `json:"target_group_id"` // 关联的分组ID
@@ -98,11 +178,23 @@ type Campaign struct {
 	Status      string     `json:"status"`       // draft, scheduled, processing, completed, paused, failed
 	ScheduledAt *time.Time `json:"scheduled_at"` // 计划发送时间
 
+	// 按收件人本地时间发送：设置 LocalSendTime 后每个联系人的邮件延后到其时区 (MetaData.timezone) 的该时刻，
+	// 联系人未设置时区时使用 Timezone，两者都为空时使用服务器时区
+	Timezone      string `json:"timezone"`        // IANA 时区名称，如 Asia/Shanghai
+	LocalSendTime string `json:"local_send_time"` // 本地发送时间 HH:MM，为空表示入队后立即发送
+
+	// 关闭打开/点击追踪 (仍附加退订链接)，为空时使用全局 campaign_disable_tracking
+	DisableTracking *bool `json:"disable_tracking"`
+
+	// 启动时展开局部模板后的正文，共享正文的队列任务发送时直接使用，不再逐封展开
+	ExpandedBody string `json:"-" gorm:"type:text"`
+
 	// 统计快照 (任务完成后更新，或定期更新)
 	TotalCount   int `json:"total_count"`
 	SentCount    int `json:"sent_count"`
 	SuccessCount int `json:"success_count"`
 	FailCount    int `json:"fail_count"`
+	SkippedCount int `json:"skipped_count"` // 启动时因收件人最小发送间隔被跳过的人数
 	
 	// 进阶统计
 	OpenCount        int `json:"open_count"`
@@ -110,6 +202,26 @@ type Campaign struct {
 	UnsubscribeCount int `json:"unsubscribe_count"`
 }
 
+// UnsubscribeTopic 退订主题 (如 "营销推广"、"产品通知")，联系人可按主题单独退订
+type UnsubscribeTopic struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TopicUnsubscribe 按主题退订记录
+type TopicUnsubscribe struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Email   string `json:"email" gorm:"size:191;uniqueIndex:idx_topic_unsub_email"`
+	TopicID uint   `json:"topic_id" gorm:"uniqueIndex:idx_topic_unsub_email"`
+}
+
 // SMTPConfig 邮件发送通道配置
 type SMTPConfig struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
@@ -117,33 +229,42 @@ type SMTPConfig struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Name      string `json:"name"`
-	Host      string `json:"host"`
+	Name      string `json:"name" gorm:"index"`
+	Host      string `json:"host" gorm:"index"`
 	Port      int    `json:"port"`
 	Username  string `json:"username"`
 	Password  string `json:"password"`
 	SSL       bool   `json:"ssl"`
 	IsDefault bool   `json:"is_default"` // 默认通道
+
+	SkipTLSVerify bool   `json:"skip_tls_verify"` // 跳过证书校验 (仅用于自签名证书的中继)
+	TLSServerName string `json:"tls_server_name"` // 证书校验使用的主机名，为空时使用 Host
+	SendInterval  int    `json:"send_interval"`   // 营销邮件逐封间隔 (毫秒)，0 时使用全局 campaign_send_interval
+
+	AllowedDomains string `json:"allowed_domains"` // 该中继授权发信的 From 域名 (逗号分隔)，为空时取 Username 的域名；仅 enforce_channel_domain 开启时检查
+
+	// TLS 客户端证书 (中继要求双向 TLS 时配置)，SSL 与 STARTTLS 握手时出示
+	ClientCert string `json:"client_cert" gorm:"type:text"` // 证书链 (PEM)
+	ClientKey  string `json:"client_key" gorm:"type:text"`  // 私钥 (PEM，加密存储，接口返回 ******)
 }
 
-// Sender 发件人别名 (预留功能，用于下拉选择 From 地址)
-// 注意: 该模型当前未启用，留作未来扩展
-// 预期功能: 允许用户配置多个发件人别名，如 "客服 <support@example.com>"
-// 在发送邮件时可从下拉列表选择发件人
+// Sender 发件人身份，如 "客服 <support@example.com>"
+// 地址必须属于已验证的域名，发信请求与营销任务可通过 ID 引用以统一 From 名称与地址
 type Sender struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Email string `json:"email"` // support@example.com
-	Name  string `json:"name"`  // "Customer Support"
+	Email    string `json:"email"`                  // support@example.com
+	Name     string `json:"name"`                   // "Customer Support"
+	DomainID uint   `json:"domain_id" gorm:"index"` // 所属域名
 }
 
 // User 管理员用户
 type User struct {
 	ID          uint   `gorm:"primaryKey"`
-	Username    string `gorm:"uniqueIndex"`
+	Username    string `gorm:"size:191;uniqueIndex"`
 	Password    string // 支持明文、SHA256 或 Bcrypt 哈希
 	TOTPSecret  string `json:"-"`              // TOTP 密钥 (Base32编码)，不通过 JSON 返回
 	TOTPEnabled bool   `gorm:"default:false"`  // 是否启用两步验证 (2FA)
@@ -156,7 +277,7 @@ type APIKey struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Key      string     `json:"key" gorm:"uniqueIndex"`
+	Key      string     `json:"key" gorm:"size:191;uniqueIndex"`
 	Name     string     `json:"name"`
 	LastUsed *time.Time `json:"last_used"`
 }
@@ -168,7 +289,7 @@ type Domain struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Name           string `json:"name" gorm:"uniqueIndex"` // example.com
+	Name           string `json:"name" gorm:"size:191;uniqueIndex"` // example.com
 	DKIMSelector   string `json:"dkim_selector"`           // default
 	DKIMPrivateKey string `json:"-"`                        // PEM format (不返回给前端)
 	DKIMPublicKey  string `json:"dkim_public_key"`         // PEM format
@@ -177,10 +298,43 @@ type Domain struct {
 	MailSubdomainPrefix string `json:"mail_subdomain_prefix"` // e.g., "mail", "smtp", "sec-mail". If empty, use root domain.
 
 	// 验证状态 (缓存)
-	SPFVerified   bool `json:"spf_verified"`
-	DKIMVerified  bool `json:"dkim_verified"`
-	DMARCVerified bool `json:"dmarc_verified"`
-	MXVerified    bool `json:"mx_verified"`
+	SPFVerified   bool   `json:"spf_verified"`
+	DKIMVerified  bool   `json:"dkim_verified"`
+	DMARCVerified bool   `json:"dmarc_verified"`
+	MXVerified    bool   `json:"mx_verified"`
+	RootAVerified bool   `json:"root_a_verified"` // 根域名存在 A/AAAA 记录 (网站访问)
+	MailAVerified bool   `json:"mail_a_verified"` // 邮件主机名 (前缀.域名) 存在 A/AAAA 记录
+	PTRVerified   bool   `json:"ptr_verified"`    // 服务器 IP 的反向解析与邮件主机名一致
+	PTRName       string `json:"ptr_name"`        // 最近一次验证查到的 PTR 记录
+	PTRIP         string `json:"ptr_ip"`          // 反向解析所检查的服务器 IP
+
+	// 收件配置
+	CatchAll          bool   `json:"catch_all"`            // 无匹配规则的收件人也接收并存入收件箱
+	CatchAllForwardTo string `json:"catch_all_forward_to"` // Catch-all 邮件的默认转发地址 (可选)
+	AutoCaptureContacts bool `json:"auto_capture_contacts"` // 自动将来信发件人加入联系人分组 (分组见收件配置)
+
+	// 发信页脚 (如公司地址、法律声明)，追加到该域名发出的每封邮件
+	FooterHTML string `json:"footer_html"`
+	FooterText string `json:"footer_text"` // 纯文本页脚，为空时由 footer_html 自动转换
+
+	// 预热 (Warmup): 新域名按日限量发送，上限逐日递增，超出部分顺延到次日
+	WarmupEnabled   bool       `json:"warmup_enabled"`
+	WarmupStartedAt *time.Time `json:"warmup_started_at"`
+	WarmupStartCap  int        `json:"warmup_start_cap"`  // 第 1 天的发送上限 (0 使用默认值 50)
+	WarmupGrowth    float64    `json:"warmup_growth"`     // 每日上限增长倍数 (0 使用默认值 2)
+	WarmupMaxCap    int        `json:"warmup_max_cap"`    // 日上限达到此值后预热自动结束 (0 表示不自动结束)
+	WarmupSentDate  string     `json:"warmup_sent_date"`  // 当日计数所属日期 (YYYY-MM-DD)
+	WarmupSentCount int        `json:"warmup_sent_count"` // 当日已占用的发送额度
+
+	// 信誉保护：滚动窗口内硬退信率或投诉率超过阈值时自动暂停该域名的所有营销任务，需手动解除后才能恢复
+	BounceThreshold       float64    `json:"bounce_threshold"`        // 硬退信率阈值 (%)，0 表示不检查
+	ComplaintThreshold    float64    `json:"complaint_threshold"`     // 投诉率阈值 (%)，0 表示不检查
+	ReputationPausedAt    *time.Time `json:"reputation_paused_at"`    // 自动暂停时间，非空时禁止启动或恢复该域名的营销任务
+	ReputationPauseReason string     `json:"reputation_pause_reason"` // 触发暂停时的统计
+	ReputationResumedAt   *time.Time `json:"reputation_resumed_at"`   // 最近一次手动解除，此前的发送与退信不再计入
+
+	// 出站源 IP：该域名发出的邮件绑定此本机地址 (多 IP 主机区分信誉)，为空时使用全局 outbound_source_ip
+	SourceIP string `json:"source_ip"`
 
 	// 关联的 SSL 证书 (用于 STARTTLS)
 	CertificateID *uint        `json:"certificate_id" gorm:"index"`
@@ -222,9 +376,12 @@ type Template struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Name    string `json:"name"`
-	Subject string `json:"subject"`
-	Body    string `json:"body"` // HTML content
+	Name     string `json:"name" gorm:"index"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`                  // HTML content
+	Category string `json:"category" gorm:"index"` // 分类: onboarding, transactional, newsletter...
+	BuiltIn  bool   `json:"built_in" gorm:"index"` // 内置模板库 (只读，需复制后编辑)
+	Raw      bool   `json:"raw"`                   // 可信 HTML (如事务邮件)，启用 sanitize_html 时不净化渲染结果
 }
 
 // Stats 统计数据结构
@@ -256,6 +413,12 @@ type AttachmentFile struct {
 	ContentType string `json:"content_type"` // MIME 类型
 	Source      string `json:"source"`       // "api_base64", "api_url"
 	RelatedTo   string `json:"related_to"`   // 关联的收件人或 QueueID (备注)
+
+	ContentHash string `gorm:"index" json:"content_hash"` // 内容 SHA256 (API 上传去重)
+	RefCount    int    `json:"ref_count"`                 // 引用该文件的待发/已发邮件数
+
+	OriginalSize int64  `json:"original_size,omitempty"` // 图片压缩前的字节数，0 表示未压缩
+	OriginalPath string `json:"-"`                       // 保留的原图路径 (receiver_image_keep_original)
 }
 
 // ForwardRule 邮件转发规则
@@ -271,6 +434,60 @@ type ForwardRule struct {
 	ForwardTo string `json:"forward_to"`                        // 转发目标邮箱，如 "admin@gmail.com"
 	Enabled   bool   `json:"enabled" gorm:"default:true"`       // 是否启用
 	Remark    string `json:"remark"`                            // 备注
+	Bounce    bool   `json:"bounce"`                            // 退信邮箱：收到的邮件交给 DSN 解析器处理，不转发
+
+	ReplyTo       string `json:"reply_to"`       // 转发邮件的 Reply-To: sender (原发件人，默认) / list (原收件地址) / none (不设置)
+	RewriteSender bool   `json:"rewrite_sender"` // 信封发件人改写为本域名的 VERP 退信地址 (bounce+fwd-<规则ID>.<签名>@)，退信不再发回原发件人
+}
+
+// Bounce 从退信邮箱解析出的投递状态通知 (DSN, RFC 3464)
+type Bounce struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+
+	InboxID    uint   `json:"inbox_id" gorm:"index"`  // 原始退信所在的收件箱记录
+	Mailbox    string `json:"mailbox"`                // 接收退信的地址 (如 bounce+token@example.com)
+	Token      string `json:"token"`                  // 签名校验通过的 VERP 标记 (bounce+<token>.<签名>@ 中的 token)
+	Recipient  string `json:"recipient" gorm:"index"` // 投递失败的收件人 (Final-Recipient)
+	Action     string `json:"action"`                 // failed / delayed
+	Status     string `json:"status"`                 // 增强状态码，如 5.1.1
+	Diagnostic string `json:"diagnostic"`             // Diagnostic-Code
+	Hard       bool   `json:"hard"`                   // 永久失败 (action=failed 且状态码为 5.x.x)
+}
+
+// Complaint 收件人投诉记录 (退信邮箱收到的 ARF 反馈报告，RFC 5965)
+type Complaint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+
+	InboxID      uint   `json:"inbox_id" gorm:"index"`  // 原始反馈报告所在的收件箱记录
+	Mailbox      string `json:"mailbox"`                // 接收反馈报告的地址
+	FeedbackType string `json:"feedback_type"`          // abuse / fraud / virus / other 等
+	Recipient    string `json:"recipient" gorm:"index"` // 投诉的收件人 (Original-Rcpt-To)
+	Sender       string `json:"sender"`                 // 被投诉邮件的发件地址 (Original-Mail-From，缺失时取原邮件 From)
+}
+
+// SpamKeyword 收件垃圾邮件过滤关键词 (不区分大小写)
+type SpamKeyword struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Keyword string `json:"keyword" gorm:"size:200"`
+	Target  string `json:"target" gorm:"size:10"` // 匹配范围: subject / body / both
+	Enabled bool   `json:"enabled"`
+}
+
+// TagRule 收件自动打标签规则
+type TagRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Tag     string `json:"tag" gorm:"size:50"`    // 命中时添加的标签
+	Field   string `json:"field" gorm:"size:20"`  // 匹配字段: sender_domain / subject / auth
+	Value   string `json:"value" gorm:"size:200"` // 匹配值: 发件域名 (含子域名) / 主题关键词 / 认证结果 (如 spf=fail)
+	Enabled bool   `json:"enabled"`
 }
 
 // ForwardLog 转发日志
@@ -279,14 +496,16 @@ type ForwardLog struct {
 	CreatedAt time.Time      `json:"created_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	RuleID      uint   `json:"rule_id" gorm:"index"`   // 关联的规则ID
+	RuleID      uint   `json:"rule_id" gorm:"index"`   // 关联的规则ID (0 表示 Catch-all 转发)
 	FromAddr    string `json:"from_addr"`              // 原始发件人
 	ToAddr      string `json:"to_addr"`                // 原始收件人 (域名邮箱)
 	ForwardTo   string `json:"forward_to"`             // 转发到
 	Subject     string `json:"subject"`                // 邮件主题
-	Status      string `json:"status"`                 // "success" / "failed"
+	QueueID     uint   `json:"queue_id" gorm:"index"`  // 关联的发送队列任务 ID
+	Status      string `json:"status"`                 // "pending" (已入队) / "success" / "failed"
 	ErrorMsg    string `json:"error_msg"`              // 错误信息
 	RemoteIP    string `json:"remote_ip"`              // 来源IP
+	DSNStatus   string `json:"dsn_status"`             // 投递失败通知: "" (未发送) / "sent" / "failed" / "skipped" (空发件人)
 }
 
 // Inbox 收件箱
@@ -304,6 +523,15 @@ type Inbox struct {
 	IsRead   bool   `json:"is_read"`   // 已读状态
 	Tags     string `json:"tags"`      // JSON 标签 (例如 ["reply", "support"])
 	RemoteIP string `json:"remote_ip"` // 来源 IP
+
+	MessageHash string `gorm:"index" json:"-"` // 邮件指纹 (用于重复投递去重)
+
+	// 会话 (Thread) 归并
+	MessageID     string `json:"message_id" gorm:"index"`                     // Message-ID 头 (<id@host>)
+	InReplyTo     string `json:"in_reply_to"`                                 // In-Reply-To 头
+	References    string `json:"references" gorm:"column:message_references"` // References 头 (空格分隔；references 为 SQL 保留字)
+	ThreadID      string `json:"thread_id" gorm:"index"`                      // 会话标识 (会话根邮件的 Message-ID)
+	ThreadSubject string `json:"-" gorm:"index"`                              // 规范化主题 (去除 Re:/Fwd: 前缀，用于无引用头时归并)
 }
 
 // SchemaVersion 数据库版本控制
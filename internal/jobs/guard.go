@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"goemail/internal/config"
+)
+
+// serialMu scheduler_serialize 启用时串行化所有后台定时任务 (SQLite 单写者下避免重型任务互相争用)
+var serialMu sync.Mutex
+
+// Guard 后台定时任务的防重叠保护：上一次执行尚未结束时跳过本次并记录日志，而不是堆积执行
+type Guard struct {
+	name    string
+	running atomic.Bool
+}
+
+// NewGuard 创建防重叠保护，name 用于日志
+func NewGuard(name string) *Guard {
+	return &Guard{name: name}
+}
+
+// Run 执行一次任务，返回是否实际执行 (上一次仍在运行时返回 false)
+// 启用 scheduler_serialize 时还需等待其他后台任务结束后再执行
+func (g *Guard) Run(fn func()) bool {
+	if !g.running.CompareAndSwap(false, true) {
+		log.Printf("[Jobs] %s: previous run still in progress, skipping this tick", g.name)
+		return false
+	}
+	defer g.running.Store(false)
+
+	if config.AppConfig.SchedulerSerialize {
+		serialMu.Lock()
+		defer serialMu.Unlock()
+	}
+	fn()
+	return true
+}
+
+// Running 任务当前是否正在执行
+func (g *Guard) Running() bool {
+	return g.running.Load()
+}
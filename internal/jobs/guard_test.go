@@ -0,0 +1,20 @@
+package jobs
+
+import "testing"
+
+func TestGuardSkipsOverlappingRun(t *testing.T) {
+	g := NewGuard("test")
+	var inner bool
+	outer := g.Run(func() {
+		if !g.Running() {
+			t.Error("Running() = false during run")
+		}
+		inner = g.Run(func() { t.Error("overlapping run executed") })
+	})
+	if !outer || inner {
+		t.Fatalf("outer ran = %v, inner ran = %v; want true, false", outer, inner)
+	}
+	if g.Running() || !g.Run(func() {}) {
+		t.Error("guard should be released after the run finishes")
+	}
+}
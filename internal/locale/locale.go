@@ -0,0 +1,157 @@
+package locale
+
+import (
+	"fmt"
+	"strings"
+
+	"goemail/internal/config"
+)
+
+// defaults 未配置语言时使用的文案 (保持历史版本的原有文字)
+var defaults = map[string]string{
+	"forward.subject":                  "[转发] %s",
+	"forward.banner":                   "📧 转发邮件",
+	"forward.original_from":            "原始发件人",
+	"forward.original_to":              "原始收件人",
+	"unsubscribe.success":              "You have been successfully unsubscribed. We're sorry to see you go.",
+	"unsubscribe.topic":                "You have been unsubscribed from \"%s\".",
+	"unsubscribe.invalid_link":         "Invalid unsubscribe link.",
+	"preferences.title":                "Subscription Preferences",
+	"preferences.all":                  "Unsubscribe from all emails",
+	"preferences.save":                 "Save",
+	"preferences.saved":                "Your preferences have been saved.",
+	"preferences.invalid_link":         "Invalid preferences link.",
+	"campaign.test_subject":            "[测试] %s",
+	"campaign.test_name":               "测试用户",
+	"template.test_subject":            "[TEST] %s",
+	"digest.subject":                   "[GoEmail] 每日摘要 %s",
+	"digest.received":                  "收到邮件",
+	"digest.spam":                      "其中垃圾邮件",
+	"digest.top_senders":               "主要发件人",
+	"digest.sent":                      "发送成功 / 失败",
+	"digest.forwards":                  "转发成功 / 失败",
+	"digest.queue_backlog":             "队列积压 (待发 / 处理中 / 顺延)",
+	"digest.dead_letters":              "新增死信",
+	"digest.certs":                     "即将到期的证书",
+	"digest.none":                      "无",
+	"error_hint.auth_failed":           "The SMTP channel rejected its username or password. Update the channel credentials (some providers require an app password).",
+	"error_hint.relay_denied":          "The server refused to relay this message. Check that the channel authenticates and that the From address is allowed on it.",
+	"error_hint.rate_limited":          "The receiving server is throttling this sender. Lower the sending rate or spread the campaign over a longer period; the queue will retry.",
+	"error_hint.blacklisted":           "The sending IP or domain is on a blocklist. Look it up on a blocklist checker, fix the cause (e.g. compromised account, bad lists) and request delisting.",
+	"error_hint.invalid_recipient":     "The recipient address does not exist. Remove it from the contact list to protect sender reputation.",
+	"error_hint.sender_authentication": "The message failed sender authentication. Publish and verify SPF, DKIM and DMARC records for the sending domain.",
+	"error_hint.content_rejected":      "The message content was rejected. Review the subject, links and attachments for spam triggers and send a test to a seed address.",
+	"error_hint.connection":            "The server could not be reached. Check DNS, firewall rules and whether the host allows outbound port 25 (many cloud providers block it).",
+	"error_hint.tls":                   "The TLS handshake or certificate check failed. Set tls_server_name on the channel, or enable skip_tls_verify only for trusted self-signed relays.",
+}
+
+// catalogs 各语言的系统文案，缺失的键回退到 defaults
+var catalogs = map[string]map[string]string{
+	"zh-CN": {
+		"forward.subject":                  "[转发] %s",
+		"forward.banner":                   "📧 转发邮件",
+		"forward.original_from":            "原始发件人",
+		"forward.original_to":              "原始收件人",
+		"unsubscribe.success":              "您已成功退订，很遗憾看到您离开。",
+		"unsubscribe.topic":                "您已退订「%s」。",
+		"unsubscribe.invalid_link":         "退订链接无效。",
+		"preferences.title":                "订阅偏好",
+		"preferences.all":                  "退订所有邮件",
+		"preferences.save":                 "保存",
+		"preferences.saved":                "您的订阅偏好已保存。",
+		"preferences.invalid_link":         "订阅偏好链接无效。",
+		"campaign.test_subject":            "[测试] %s",
+		"campaign.test_name":               "测试用户",
+		"template.test_subject":            "[测试] %s",
+		"digest.subject":                   "[GoEmail] 每日摘要 %s",
+		"digest.received":                  "收到邮件",
+		"digest.spam":                      "其中垃圾邮件",
+		"digest.top_senders":               "主要发件人",
+		"digest.sent":                      "发送成功 / 失败",
+		"digest.forwards":                  "转发成功 / 失败",
+		"digest.queue_backlog":             "队列积压 (待发 / 处理中 / 顺延)",
+		"digest.dead_letters":              "新增死信",
+		"digest.certs":                     "即将到期的证书",
+		"digest.none":                      "无",
+		"error_hint.auth_failed":           "SMTP 通道拒绝了用户名或密码，请更新通道凭据 (部分服务商需要使用应用专用密码)。",
+		"error_hint.relay_denied":          "服务器拒绝中继此邮件，请确认通道已认证且发件地址允许通过该通道发送。",
+		"error_hint.rate_limited":          "收件服务器正在限制此发件人的发送频率，请降低发送速率或延长营销任务的发送周期；队列会自动重试。",
+		"error_hint.blacklisted":           "发件 IP 或域名被列入黑名单，请使用黑名单查询工具确认，排除原因 (如账号被盗用、名单质量差) 后申请移除。",
+		"error_hint.invalid_recipient":     "收件地址不存在，请将其从联系人列表中移除以保护发件信誉。",
+		"error_hint.sender_authentication": "邮件未通过发件人认证，请为发件域名发布并验证 SPF、DKIM 与 DMARC 记录。",
+		"error_hint.content_rejected":      "邮件内容被拒收，请检查主题、链接与附件中可能触发垃圾邮件过滤的内容，并先发送测试邮件到种子地址。",
+		"error_hint.connection":            "无法连接服务器，请检查 DNS、防火墙规则以及主机是否允许出站 25 端口 (许多云服务商默认封禁)。",
+		"error_hint.tls":                   "TLS 握手或证书校验失败，请为通道设置 tls_server_name，仅对可信的自签名中继开启 skip_tls_verify。",
+	},
+	"en": {
+		"forward.subject":                  "[Fwd] %s",
+		"forward.banner":                   "📧 Forwarded message",
+		"forward.original_from":            "Original sender",
+		"forward.original_to":              "Original recipient",
+		"unsubscribe.success":              "You have been successfully unsubscribed. We're sorry to see you go.",
+		"unsubscribe.topic":                "You have been unsubscribed from \"%s\".",
+		"unsubscribe.invalid_link":         "Invalid unsubscribe link.",
+		"preferences.title":                "Subscription Preferences",
+		"preferences.all":                  "Unsubscribe from all emails",
+		"preferences.save":                 "Save",
+		"preferences.saved":                "Your preferences have been saved.",
+		"preferences.invalid_link":         "Invalid preferences link.",
+		"campaign.test_subject":            "[Test] %s",
+		"campaign.test_name":               "Test User",
+		"template.test_subject":            "[TEST] %s",
+		"digest.subject":                   "[GoEmail] Daily digest %s",
+		"digest.received":                  "Mail received",
+		"digest.spam":                      "Of which spam",
+		"digest.top_senders":               "Top senders",
+		"digest.sent":                      "Sent / failed",
+		"digest.forwards":                  "Forwarded / failed",
+		"digest.queue_backlog":             "Queue backlog (pending / processing / deferred)",
+		"digest.dead_letters":              "New dead letters",
+		"digest.certs":                     "Expiring certificates",
+		"digest.none":                      "None",
+		"error_hint.auth_failed":           "The SMTP channel rejected its username or password. Update the channel credentials (some providers require an app password).",
+		"error_hint.relay_denied":          "The server refused to relay this message. Check that the channel authenticates and that the From address is allowed on it.",
+		"error_hint.rate_limited":          "The receiving server is throttling this sender. Lower the sending rate or spread the campaign over a longer period; the queue will retry.",
+		"error_hint.blacklisted":           "The sending IP or domain is on a blocklist. Look it up on a blocklist checker, fix the cause (e.g. compromised account, bad lists) and request delisting.",
+		"error_hint.invalid_recipient":     "The recipient address does not exist. Remove it from the contact list to protect sender reputation.",
+		"error_hint.sender_authentication": "The message failed sender authentication. Publish and verify SPF, DKIM and DMARC records for the sending domain.",
+		"error_hint.content_rejected":      "The message content was rejected. Review the subject, links and attachments for spam triggers and send a test to a seed address.",
+		"error_hint.connection":            "The server could not be reached. Check DNS, firewall rules and whether the host allows outbound port 25 (many cloud providers block it).",
+		"error_hint.tls":                   "The TLS handshake or certificate check failed. Set tls_server_name on the channel, or enable skip_tls_verify only for trusted self-signed relays.",
+	},
+}
+
+// Supported 返回支持的语言列表
+func Supported() []string {
+	return []string{"zh-CN", "en"}
+}
+
+// Current 返回配置的系统文案语言 (未配置或不支持时为空，表示使用默认文案)
+func Current() string {
+	lang := strings.TrimSpace(config.AppConfig.SystemLocale)
+	for _, l := range Supported() {
+		if strings.EqualFold(l, lang) {
+			return l
+		}
+	}
+	return ""
+}
+
+// T 按当前语言返回系统文案，args 非空时按 fmt.Sprintf 格式化
+func T(key string, args ...interface{}) string {
+	return Lookup(Current(), key, args...)
+}
+
+// Lookup 按指定语言返回系统文案
+func Lookup(lang, key string, args ...interface{}) string {
+	text, ok := catalogs[lang][key]
+	if !ok {
+		if text, ok = defaults[key]; !ok {
+			text = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,27 @@
+package locale
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	if got := Lookup("", "forward.subject", "Hello"); got != "[转发] Hello" {
+		t.Errorf("default forward subject = %q", got)
+	}
+	if got := Lookup("en", "forward.subject", "Hello"); got != "[Fwd] Hello" {
+		t.Errorf("en forward subject = %q", got)
+	}
+	if got := Lookup("fr", "preferences.save"); got != "Save" {
+		t.Errorf("unsupported locale should fall back to defaults, got %q", got)
+	}
+	if got := Lookup("en", "missing.key"); got != "missing.key" {
+		t.Errorf("missing key = %q", got)
+	}
+
+	// 所有语言必须覆盖默认文案的全部键
+	for lang, catalog := range catalogs {
+		for key := range defaults {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("%s catalog missing key %s", lang, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+)
+
+// alertHeader 标记系统告警邮件，告警邮件自身投递失败时不再触发告警，避免循环
+const alertHeader = "X-GoEmail-Alert"
+
+// SendAlert 向运维人员发送告警：POST JSON 到 alert_webhook_url，并发送邮件到 alert_email
+// 两者均未配置时不做任何事；发送在后台进行，不阻塞调用方
+func SendAlert(event, subject string, data map[string]interface{}) {
+	webhook := strings.TrimSpace(config.AppConfig.AlertWebhookURL)
+	to := strings.TrimSpace(config.AppConfig.AlertEmail)
+	if webhook == "" && to == "" {
+		return
+	}
+
+	go func() {
+		if webhook != "" {
+			if err := postAlertWebhook(webhook, event, subject, data); err != nil {
+				log.Printf("[Alert] Webhook for %s failed: %v", event, err)
+			}
+		}
+		if to != "" {
+			req := SendRequest{
+				From:                  "noreply@" + config.AppConfig.Domain,
+				To:                    to,
+				Subject:               "[GoEmail] " + subject,
+				Body:                  alertBody(subject, data),
+				Headers:               map[string]string{alertHeader: event},
+				AllowUnverifiedDomain: true,
+				SkipBCC:               true,
+				SkipFooter:            true,
+
+				BypassRecipientInterval: true,
+			}
+			if _, err := SendEmailAsync(req); err != nil {
+				log.Printf("[Alert] Email for %s failed: %v", event, err)
+			}
+		}
+	}()
+}
+
+func postAlertWebhook(url, event, subject string, data map[string]interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":   event,
+		"subject": subject,
+		"data":    data,
+		"time":    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// alertBody 将告警数据渲染为简单的 HTML 表格 (按键名排序)
+func alertBody(subject string, data map[string]interface{}) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("<h3>" + html.EscapeString(subject) + "</h3><table cellpadding=\"4\">")
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("<tr><td><b>%s</b></td><td>%s</td></tr>", html.EscapeString(k), html.EscapeString(fmt.Sprint(data[k]))))
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// campaignLinkPattern 匹配正文中的 <a href="...">，用于点击追踪改写
+var campaignLinkPattern = regexp.MustCompile(`(?i)<a\s+[^>]*href=["']([^"']+)["'][^>]*>`)
+
+// trackingBaseURL 返回追踪链接使用的对外地址
+func trackingBaseURL() string {
+	baseURL := strings.TrimSuffix(config.AppConfig.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://%s:%s", config.AppConfig.Host, config.AppConfig.Port) // Fallback
+	}
+	return baseURL
+}
+
+// CampaignTrackingEnabled 营销任务是否注入打开/点击追踪，任务未单独设置时使用全局 campaign_disable_tracking
+func CampaignTrackingEnabled(campaign *database.Campaign) bool {
+	if campaign.DisableTracking != nil {
+		return !*campaign.DisableTracking
+	}
+	return !config.AppConfig.CampaignDisableTracking
+}
+
+// PersonalizeCampaignBody 为单个收件人生成营销邮件正文：替换 {name}/{email}，注入退订链接，
+// contactID 非 0 时同时注入订阅偏好中心链接 (正文中的 {preferences_url} 也会被替换)，
+// tracking 为 true 时同时注入追踪像素并改写点击追踪链接
+// 返回最终 HTML 与退订链接
+func PersonalizeCampaignBody(body, name, email, trackingID string, contactID uint, tracking bool) (string, string) {
+	// 对用户输入进行 HTML 转义
+	body = strings.ReplaceAll(body, "{name}", html.EscapeString(name))
+	body = strings.ReplaceAll(body, "{email}", html.EscapeString(email))
+
+	baseURL := trackingBaseURL()
+
+	// 注入追踪像素 (Tracking Pixel)
+	pixel := ""
+	if tracking {
+		pixel = fmt.Sprintf(`<img src="%s/api/v1/track/open/%s" width="1" height="1" style="display:none;" />`, baseURL, trackingID)
+	}
+
+	// 注入退订链接 (Unsubscribe Link)
+	unsubscribeLink := fmt.Sprintf("%s/api/v1/track/unsubscribe/%s", baseURL, trackingID)
+	preferencesHTML := ""
+	preferenceLink := unsubscribeLink // 手动收件人没有联系人记录，{preferences_url} 退化为退订链接
+	if contactID > 0 {
+		preferenceLink = PreferenceURL(contactID)
+		preferencesHTML = fmt.Sprintf(` or <a href="%s">manage your preferences</a>`, preferenceLink)
+	}
+	body = strings.ReplaceAll(body, "{preferences_url}", preferenceLink)
+	unsubscribeHTML := fmt.Sprintf(`<br/><br/><hr/><p style="font-size:12px;color:#888;">If you do not wish to receive these emails, <a href="%s">unsubscribe here</a>%s.</p>`, unsubscribeLink, preferencesHTML)
+
+	// 如果是 HTML 邮件，在 </body> 前插入
+	if strings.Contains(body, "</body>") {
+		body = strings.Replace(body, "</body>", pixel+unsubscribeHTML+"</body>", 1)
+	} else {
+		// 简单的追加
+		body = body + pixel + unsubscribeHTML
+	}
+
+	if !tracking {
+		return body, unsubscribeLink
+	}
+
+	// 点击追踪替换 (Click Tracking)
+	body = campaignLinkPattern.ReplaceAllStringFunc(body, func(match string) string {
+		matches := campaignLinkPattern.FindStringSubmatch(match)
+		if len(matches) < 2 {
+			return match
+		}
+		originalURL := matches[1]
+
+		// 跳过退订链接和已经是追踪链接的
+		if strings.Contains(originalURL, "/api/v1/track/") {
+			return match
+		}
+		// 仅追踪 http/https
+		if !strings.HasPrefix(originalURL, "http") {
+			return match
+		}
+
+		encodedURL := base64.URLEncoding.EncodeToString([]byte(originalURL))
+		trackingURL := fmt.Sprintf("%s/api/v1/track/click/%s?url=%s", baseURL, trackingID, encodedURL)
+		return strings.Replace(match, originalURL, trackingURL, 1)
+	})
+
+	return body, unsubscribeLink
+}
+
+// CampaignTextBody 生成营销邮件的纯文本备选正文
+// textTemplate 非空时使用其内容 (替换变量并追加退订链接)，否则从最终 HTML 自动生成
+// {preferences_url} 与 HTML 正文一致：有联系人时为偏好中心链接，否则退化为退订链接
+func CampaignTextBody(textTemplate, name, email, htmlBody, unsubscribeLink string, contactID uint) string {
+	if strings.TrimSpace(textTemplate) == "" {
+		return HTMLToText(htmlBody)
+	}
+	text := strings.ReplaceAll(textTemplate, "{name}", name)
+	text = strings.ReplaceAll(text, "{email}", email)
+	preferenceLink := unsubscribeLink
+	if contactID > 0 {
+		preferenceLink = PreferenceURL(contactID)
+	}
+	text = strings.ReplaceAll(text, "{preferences_url}", preferenceLink)
+	if unsubscribeLink != "" {
+		text += "\n\n--\nUnsubscribe: " + unsubscribeLink
+	}
+	return text
+}
+
+// assembleSharedBody 为共享正文的营销任务在发送时生成个性化正文 (正文只在营销任务中保存一份)
+func assembleSharedBody(task *database.EmailQueue) error {
+	var campaign database.Campaign
+	if err := database.DB.Unscoped().Select("id", "body", "expanded_body", "text_body", "disable_tracking").First(&campaign, task.CampaignID).Error; err != nil {
+		return fmt.Errorf("campaign %d content not found: %v", task.CampaignID, err)
+	}
+	// 局部模板已在启动时展开；升级前入队的任务没有展开结果，此时现场展开
+	expanded := campaign.ExpandedBody
+	if expanded == "" {
+		var err error
+		if expanded, err = ExpandCampaignPartials(campaign.Body); err != nil {
+			return fmt.Errorf("campaign %d partials: %v", task.CampaignID, err)
+		}
+	}
+	body, unsubscribeLink := PersonalizeCampaignBody(expanded, task.RecipientName, task.To, task.TrackingID, task.ContactID, CampaignTrackingEnabled(&campaign))
+	task.Body = body
+	task.TextBody = CampaignTextBody(campaign.TextBody, task.RecipientName, task.To, body, unsubscribeLink, task.ContactID)
+	return nil
+}
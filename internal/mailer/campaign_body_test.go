@@ -0,0 +1,152 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPersonalizeCampaignBody(t *testing.T) {
+	config.AppConfig.BaseURL = "https://mail.example.com/"
+	body, unsub := PersonalizeCampaignBody(`<html><body>Hi {name} <a href="https://shop.example.com">shop</a><a href="mailto:x@y.z">mail</a></body></html>`, "<Bob>", "bob@example.com", "tid-1", 0, true)
+
+	if unsub != "https://mail.example.com/api/v1/track/unsubscribe/tid-1" {
+		t.Errorf("unsubscribe link = %q", unsub)
+	}
+	if !strings.Contains(body, "Hi &lt;Bob&gt;") {
+		t.Error("name should be HTML-escaped")
+	}
+	if !strings.Contains(body, "/api/v1/track/click/tid-1?url=") || strings.Contains(body, `href="https://shop.example.com"`) {
+		t.Error("http link should be rewritten for click tracking")
+	}
+	if !strings.Contains(body, `href="mailto:x@y.z"`) {
+		t.Error("non-http link should be left alone")
+	}
+	if !strings.Contains(body, "/api/v1/track/open/tid-1") || !strings.HasSuffix(body, "</body></html>") {
+		t.Error("tracking pixel should be inserted before </body>")
+	}
+}
+
+func TestPersonalizeCampaignBodyWithoutTracking(t *testing.T) {
+	config.AppConfig.BaseURL = "https://mail.example.com"
+	body, unsub := PersonalizeCampaignBody(`<body><a href="https://shop.example.com">shop</a></body>`, "Bob", "bob@example.com", "tid-2", 0, false)
+
+	if strings.Contains(body, "/api/v1/track/open/") || strings.Contains(body, "/api/v1/track/click/") {
+		t.Error("tracking disabled but pixel or click link injected")
+	}
+	if !strings.Contains(body, `href="https://shop.example.com"`) {
+		t.Error("link should be left untouched")
+	}
+	if unsub == "" || !strings.Contains(body, unsub) {
+		t.Error("unsubscribe link must still be appended")
+	}
+}
+
+func TestPreferenceToken(t *testing.T) {
+	config.AppConfig.JWTSecret = "test-secret-for-preferences"
+	config.AppConfig.BaseURL = "https://mail.example.com"
+	token := PreferenceToken(42)
+	if id, ok := VerifyPreferenceToken(token); !ok || id != 42 {
+		t.Fatalf("VerifyPreferenceToken(%q) = %d, %v", token, id, ok)
+	}
+	_, sig, _ := strings.Cut(token, ".")
+	for _, bad := range []string{"43." + sig, "42." + sig[1:], "42", "0." + sig, ""} {
+		if _, ok := VerifyPreferenceToken(bad); ok {
+			t.Errorf("tampered token %q accepted", bad)
+		}
+	}
+
+	body, _ := PersonalizeCampaignBody(`<body><a href="{preferences_url}">prefs</a></body>`, "Bob", "bob@example.com", "tid-3", 42, true)
+	link := "https://mail.example.com/api/v1/track/manage/" + token
+	if strings.Count(body, `href="`+link+`"`) != 2 {
+		t.Errorf("preferences link should replace the placeholder and appear in the footer, untracked:\n%s", body)
+	}
+
+	if text := CampaignTextBody("Prefs: {preferences_url}", "Bob", "bob@example.com", body, "https://u", 42); !strings.HasPrefix(text, "Prefs: "+link+"\n") {
+		t.Errorf("text body should replace {preferences_url} with the preferences link: %q", text)
+	}
+	if text := CampaignTextBody("Prefs: {preferences_url}", "", "x@example.com", body, "https://u", 0); !strings.HasPrefix(text, "Prefs: https://u\n") {
+		t.Errorf("text body without a contact should fall back to the unsubscribe link: %q", text)
+	}
+}
+
+func TestParseTemplateSet(t *testing.T) {
+	lib := map[string]string{
+		"footer": `<p>Bye {{.name}}</p>`,
+		"layout": `<div>{{template "footer" .}}</div>`,
+		"loop-a": `{{template "loop-b" .}}`,
+		"loop-b": `{{template "loop-a" .}}`,
+		"evil":   `{{define "footer"}}x{{end}}`,
+	}
+	load := func(name string) (string, bool) {
+		body, ok := lib[name]
+		return body, ok
+	}
+
+	tpl, err := parseTemplateSet("main", `Hi{{template "layout" .}}`, load)
+	if err != nil {
+		t.Fatalf("nested partials: %v", err)
+	}
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, map[string]string{"name": "Bob"}); err != nil || sb.String() != "Hi<div><p>Bye Bob</p></div>" {
+		t.Errorf("rendered %q, %v", sb.String(), err)
+	}
+
+	for _, src := range []string{`{{template "missing" .}}`, `{{template "loop-a" .}}`, `{{template "evil" .}}`} {
+		if _, err := parseTemplateSet("main", src, load); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func TestExpandPartialsKeepsPlaceholdersInHref(t *testing.T) {
+	load := func(name string) (string, bool) {
+		if name == "footer" {
+			return `<a href="https://example.com/u?e={{.email}}">{{.name}}</a>`, true
+		}
+		return "", false
+	}
+	got, err := expandPartials(`<a href="mailto:{email}">Hi</a>{{template &#34;footer&#34; .}}`, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<a href="mailto:{email}">Hi</a><a href="https://example.com/u?e={email}">{name}</a>`
+	if got != want {
+		t.Errorf("expandPartials = %q, want %q", got, want)
+	}
+	body, _ := PersonalizeCampaignBody(got, "Bob", "bob@example.com", "", 0, false)
+	if !strings.Contains(body, `href="mailto:bob@example.com"`) || !strings.Contains(body, `e=bob@example.com`) {
+		t.Errorf("placeholders in href not personalized: %q", body)
+	}
+}
+
+func TestAssembleSharedBodyUsesExpandedBody(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Campaign{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	// 正文引用的局部模板不存在：若发送时重新展开会失败，应直接使用启动时保存的展开结果
+	campaign := database.Campaign{Body: `{{template "gone" .}}`, ExpandedBody: "<p>Hi {name}</p>"}
+	db.Create(&campaign)
+	task := database.EmailQueue{CampaignID: campaign.ID, To: "a@example.com", RecipientName: "Ann", TrackingID: "t1"}
+	if err := assembleSharedBody(&task); err != nil {
+		t.Fatalf("assembleSharedBody: %v", err)
+	}
+	if !strings.Contains(task.Body, "<p>Hi Ann</p>") {
+		t.Errorf("body = %q", task.Body)
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// ChannelDomainOverrideHeader 发信接口中跳过 From 域名与通道匹配检查的 HTTP 请求头 (值为 true)
+const ChannelDomainOverrideHeader = "X-Allow-Channel-Mismatch"
+
+// channelDomains 返回中继通道授权发信的域名：allowed_domains 为空时取登录用户名的域名
+func channelDomains(cfg database.SMTPConfig) []string {
+	var domains []string
+	for _, d := range strings.Split(cfg.AllowedDomains, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		if d := strings.ToLower(extractDomain(cfg.Username)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// checkChannelDomain 启用 enforce_channel_domain 时检查 From 域名与发送通道是否匹配
+// 中继通道要求 From 域名属于通道授权域名且已验证；cfg 为 nil 表示 Direct 发送，仅要求已验证
+// 请求带有 ChannelDomainOverride 时跳过检查并记录审计日志
+func checkChannelDomain(req SendRequest, cfg *database.SMTPConfig) error {
+	if !config.AppConfig.EnforceChannelDomain {
+		return nil
+	}
+	from := req.From
+	if from == "" {
+		from = "noreply@" + config.AppConfig.Domain
+	}
+	channel := "direct"
+	if cfg != nil {
+		channel = fmt.Sprintf("smtp_%d", cfg.ID)
+	}
+	if req.ChannelDomainOverride != "" {
+		log.Printf("[Audit] Channel domain check skipped for From %s via %s to %s: %s", from, channel, logRecipient(req), req.ChannelDomainOverride)
+		return nil
+	}
+
+	if cfg != nil {
+		domain := strings.ToLower(extractDomain(from))
+		allowed := channelDomains(*cfg)
+		if len(allowed) == 0 {
+			return fmt.Errorf("channel %s has no authorized domains (set allowed_domains)", cfg.Name)
+		}
+		if !slices.Contains(allowed, domain) {
+			return fmt.Errorf("from domain %s is not authorized for channel %s (allowed: %s)", domain, cfg.Name, strings.Join(allowed, ", "))
+		}
+	}
+	return VerifySenderDomain(from)
+}
@@ -0,0 +1,195 @@
+package mailer
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/jobs"
+)
+
+// connectivityProbePorts 探测的出站端口：25 决定能否直连投递，587 决定能否使用提交端口中继
+var connectivityProbePorts = []int{25, 587}
+
+// defaultProbeHosts 未配置 connectivity_probe_hosts 时各端口使用的公共主机 (25 为 MX，587 为提交服务器)
+var defaultProbeHosts = map[int][]string{
+	25:  {"gmail-smtp-in.l.google.com", "mx1.mail.yahoo.com"},
+	587: {"smtp.gmail.com", "smtp.office365.com"},
+}
+
+// PortStatus 单个出站端口的可达性
+type PortStatus struct {
+	Port      int    `json:"port"`
+	Reachable bool   `json:"reachable"`
+	Host      string `json:"host"`            // 应答的主机 (不可达时为最后尝试的主机)
+	LatencyMS int64  `json:"latency_ms"`      // 收到 220 问候的耗时
+	Error     string `json:"error,omitempty"` // 全部主机失败时最后一个错误
+}
+
+// ConnectivityStatus 最近一次出站连通性探测结果
+type ConnectivityStatus struct {
+	CheckedAt *time.Time   `json:"checked_at"` // 为空表示尚未探测
+	ChangedAt *time.Time   `json:"changed_at"` // 最近一次可达性变化的时间
+	Ports     []PortStatus `json:"ports"`
+}
+
+var (
+	connectivityMu     sync.RWMutex
+	connectivityStatus ConnectivityStatus
+	connectivityGuard  = jobs.NewGuard("connectivity probe")
+)
+
+// GetConnectivityStatus 返回最近一次探测结果
+func GetConnectivityStatus() ConnectivityStatus {
+	connectivityMu.RLock()
+	defer connectivityMu.RUnlock()
+	status := connectivityStatus
+	status.Ports = append([]PortStatus(nil), connectivityStatus.Ports...)
+	return status
+}
+
+// port25Blocked 最近一次探测确认出站 25 端口不可达
+func port25Blocked() bool {
+	connectivityMu.RLock()
+	defer connectivityMu.RUnlock()
+	for _, p := range connectivityStatus.Ports {
+		if p.Port == 25 {
+			return !p.Reachable
+		}
+	}
+	return false
+}
+
+func connectivityProbeInterval() time.Duration {
+	if config.AppConfig.ConnectivityProbeInterval > 0 {
+		return time.Duration(config.AppConfig.ConnectivityProbeInterval) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// connectivityProbeHosts 指定端口的探测主机，配置了 connectivity_probe_hosts 时所有端口均使用该列表
+func connectivityProbeHosts(port int) []string {
+	var hosts []string
+	for _, h := range config.AppConfig.ConnectivityProbeHosts {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return defaultProbeHosts[port]
+	}
+	return hosts
+}
+
+// StartConnectivityProbe 启动时及之后定期探测出站 25/587 端口，可达性变化时记录日志并告警
+// connectivity_probe_interval 为负数时不探测
+func StartConnectivityProbe() {
+	if config.AppConfig.ConnectivityProbeInterval < 0 {
+		return
+	}
+	go func() {
+		connectivityGuard.Run(ProbeConnectivity)
+		for {
+			time.Sleep(connectivityProbeInterval())
+			connectivityGuard.Run(ProbeConnectivity)
+		}
+	}()
+}
+
+// ProbeConnectivity 立即执行一次探测并更新状态
+func ProbeConnectivity() {
+	ports := make([]PortStatus, 0, len(connectivityProbePorts))
+	for _, port := range connectivityProbePorts {
+		ports = append(ports, probePort(connectivityProbeHosts(port), port))
+	}
+	now := time.Now()
+
+	connectivityMu.Lock()
+	first := connectivityStatus.CheckedAt == nil
+	changed := connectivityChanges(connectivityStatus.Ports, ports)
+	connectivityStatus.CheckedAt = &now
+	connectivityStatus.Ports = ports
+	if first || len(changed) > 0 {
+		connectivityStatus.ChangedAt = &now
+	}
+	connectivityMu.Unlock()
+
+	if first {
+		for _, p := range ports {
+			if !p.Reachable {
+				log.Printf("[Connectivity] Outbound port %d unreachable: %s", p.Port, p.Error)
+			}
+		}
+		if port25Blocked() {
+			log.Printf("[Connectivity] Direct delivery is unavailable from this host, use an SMTP relay channel")
+		}
+		return
+	}
+	for _, p := range changed {
+		state := "unreachable"
+		if p.Reachable {
+			state = "reachable"
+		}
+		log.Printf("[Connectivity] Outbound port %d is now %s (%s)", p.Port, state, p.Host)
+		if config.AppConfig.ConnectivityAlert {
+			SendAlert("connectivity.changed", fmt.Sprintf("Outbound port %d is now %s", p.Port, state), map[string]interface{}{
+				"port":      p.Port,
+				"reachable": p.Reachable,
+				"host":      p.Host,
+				"error":     p.Error,
+			})
+		}
+	}
+}
+
+// connectivityChanges 返回可达性与上次探测相比发生变化的端口 (首次探测无上次结果，不视为变化)
+func connectivityChanges(prev, cur []PortStatus) []PortStatus {
+	before := make(map[int]bool, len(prev))
+	for _, p := range prev {
+		before[p.Port] = p.Reachable
+	}
+	var changed []PortStatus
+	for _, p := range cur {
+		if reachable, ok := before[p.Port]; ok && reachable != p.Reachable {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+// probePort 依次连接探测主机的指定端口，任一主机返回 220 问候即视为可达
+// 只读取问候行后立即断开，不发送任何 SMTP 命令
+func probePort(hosts []string, port int) PortStatus {
+	status := PortStatus{Port: port}
+	for _, host := range hosts {
+		status.Host = host
+		start := time.Now()
+		conn, err := dialSMTP("", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			status.Error = err.Error()
+			continue
+		}
+		conn.SetReadDeadline(time.Now().Add(smtpDialTimeout))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil {
+			status.Error = "no greeting: " + err.Error()
+			continue
+		}
+		if !strings.HasPrefix(line, "220") {
+			status.Error = "unexpected greeting: " + strings.TrimSpace(line)
+			continue
+		}
+		status.Reachable = true
+		status.LatencyMS = time.Since(start).Milliseconds()
+		status.Error = ""
+		return status
+	}
+	return status
+}
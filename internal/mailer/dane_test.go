@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newTestCert(t *testing.T, cn string, dnsNames []string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func tlsaFor(t *testing.T, usage, selector, matching int, cert *x509.Certificate) *dns.TLSA {
+	t.Helper()
+	rr := &dns.TLSA{}
+	if err := rr.Sign(usage, selector, matching, cert); err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func TestVerifyDANE(t *testing.T) {
+	ca, caKey := newTestCert(t, "Test CA", nil, nil, nil, true)
+	leaf, _ := newTestCert(t, "mx.example.com", []string{"mx.example.com"}, ca, caKey, false)
+	other, _ := newTestCert(t, "other", []string{"other.example.com"}, nil, nil, false)
+	chain := []*x509.Certificate{leaf, ca}
+
+	tests := []struct {
+		name    string
+		host    string
+		records []*dns.TLSA
+		wantErr bool
+	}{
+		{"EE spki sha256", "mx.example.com", []*dns.TLSA{tlsaFor(t, 3, 1, 1, leaf)}, false},
+		{"EE ignores hostname", "mx2.example.com", []*dns.TLSA{tlsaFor(t, 3, 0, 2, leaf)}, false},
+		{"TA matches issuer", "mx.example.com", []*dns.TLSA{tlsaFor(t, 2, 0, 1, ca)}, false},
+		{"TA checks hostname", "mx2.example.com", []*dns.TLSA{tlsaFor(t, 2, 0, 1, ca)}, true},
+		{"no match", "mx.example.com", []*dns.TLSA{tlsaFor(t, 3, 1, 1, other)}, true},
+		{"second record matches", "mx.example.com", []*dns.TLSA{tlsaFor(t, 3, 1, 1, other), tlsaFor(t, 3, 1, 1, leaf)}, false},
+	}
+	for _, tt := range tests {
+		err := verifyDANE(tt.host, chain, tt.records)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMXFromAnswer(t *testing.T) {
+	answer := []dns.RR{
+		&dns.MX{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeMX, Ttl: 600}, Preference: 20, Mx: "mx2.example.com."},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeCNAME, Ttl: 30}, Target: "x.example.com."},
+		&dns.MX{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeMX, Ttl: 120}, Preference: 10, Mx: "mx1.example.com."},
+	}
+	records, ttl := mxFromAnswer(answer)
+	if len(records) != 2 || records[1].Host != "mx1.example.com." || records[1].Pref != 10 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if ttl != 120*time.Second {
+		t.Fatalf("ttl = %v, want 120s (minimum of MX records)", ttl)
+	}
+}
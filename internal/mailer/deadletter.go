@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// smtpPermanentCode 匹配错误信息中的 5xx 回复码 (后跟空格或多行续行符 "-"，排除 ":587:" 这类端口号)
+var smtpPermanentCode = regexp.MustCompile(`(?:^|[\s:])(5\d\d)[\s-]`)
+
+// IsHardBounce 根据最终错误信息判断是否为硬退信 (收件方永久拒绝或收件域不存在)
+// 530/534/535/538 为认证类错误，属于本端配置问题而非退信
+func IsHardBounce(errMsg string) bool {
+	if strings.Contains(errMsg, "no MX records") || strings.Contains(errMsg, "no such host") {
+		return true
+	}
+	for _, m := range smtpPermanentCode.FindAllStringSubmatch(errMsg, -1) {
+		switch m[1] {
+		case "530", "534", "535", "538":
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// onDeadLetter 任务进入 dead 状态后的统一处理：释放附件、更新营销统计、回写转发日志并发送告警
+func onDeadLetter(t database.EmailQueue, errMsg string, hardBounce bool) {
+	ReleaseQueueAttachments([]uint{t.ID})
+	if t.CampaignID > 0 {
+		updateCampaignStats(t.CampaignID, false)
+	}
+	updateForwardLogStatus(t.ID, "failed", errMsg)
+	sendForwardDSN(t, errMsg, hardBounce)
+
+	if !config.AppConfig.DeadLetterAlert || strings.Contains(t.Headers, alertHeader) {
+		return
+	}
+	SendAlert("queue.dead", fmt.Sprintf("Email to %s permanently failed", t.To), map[string]interface{}{
+		"queue_id":    t.ID,
+		"from":        t.From,
+		"to":          t.To,
+		"subject":     t.Subject,
+		"campaign_id": t.CampaignID,
+		"retries":     t.Retries,
+		"error":       errMsg,
+		"hard_bounce": hardBounce,
+	})
+}
+
+// expireQueuedTasks 将超过 queue_max_age_hours 仍未投递成功的任务直接标记为 dead
+// 0 表示不限制，任务按重试次数自然结束
+func expireQueuedTasks(now time.Time) {
+	maxAge := config.AppConfig.QueueMaxAgeHours
+	if maxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-time.Duration(maxAge) * time.Hour)
+	var expired []database.EmailQueue
+	database.DB.Where("created_at < ? AND status IN ?", cutoff, []string{"pending", "deferred", "failed"}).
+		Limit(100).Find(&expired)
+
+	for _, t := range expired {
+		errMsg := fmt.Sprintf("expired after %dh in queue", maxAge)
+		if t.ErrorMsg != "" {
+			errMsg += ", last error: " + t.ErrorMsg
+		}
+		hardBounce := IsHardBounce(t.ErrorMsg)
+		result := database.DB.Model(&database.EmailQueue{}).
+			Where("id = ? AND status IN ?", t.ID, []string{"pending", "deferred", "failed"}).
+			Updates(map[string]interface{}{
+				"status":      "dead",
+				"error_msg":   errMsg,
+				"hard_bounce": hardBounce,
+			})
+		if result.RowsAffected == 0 {
+			continue
+		}
+		log.Printf("[Queue] Task %d expired after %dh", t.ID, maxAge)
+		onDeadLetter(t, errMsg, hardBounce)
+	}
+}
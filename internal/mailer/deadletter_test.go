@@ -0,0 +1,21 @@
+package mailer
+
+import "testing"
+
+func TestIsHardBounce(t *testing.T) {
+	cases := map[string]bool{
+		"smtp_send_failed: 550 5.1.1 <a@b.com>: Recipient address rejected": true,
+		"direct_send_failed: 554 Message rejected":                          true,
+		"mx_lookup_failed: no MX records for example.invalid":               true,
+		"smtp_auth_failed: 535 5.7.8 Authentication failed":                 false,
+		"dial tcp 1.2.3.4:25: i/o timeout (Firewall blocked port 25)":       false,
+		"dial tcp smtp.example.com:587: connection refused":                 false,
+		"451 4.7.1 Greylisted, try again later":                             false,
+		"visibility timeout expired (worker h-1-ab), reclaimed":             false,
+	}
+	for msg, want := range cases {
+		if got := IsHardBounce(msg); got != want {
+			t.Errorf("IsHardBounce(%q) = %v, want %v", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+	"goemail/internal/jobs"
+	"goemail/internal/locale"
+)
+
+// digestHeader 标记每日摘要邮件
+const digestHeader = "X-GoEmail-Digest"
+
+// digestCertDays 证书剩余天数不足该值时列入摘要
+const digestCertDays = 30
+
+// SenderCount 发件人及其邮件数
+type SenderCount struct {
+	FromAddr string `json:"from_addr"`
+	Count    int64  `json:"count"`
+}
+
+// CertExpiry 即将到期的证书
+type CertExpiry struct {
+	Name     string    `json:"name"`
+	Domains  string    `json:"domains"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
+// Digest 每日摘要统计 (统计区间为 Since 至 Until)
+type Digest struct {
+	Since         time.Time     `json:"since"`
+	Until         time.Time     `json:"until"`
+	Received      int64         `json:"received"`
+	Spam          int64         `json:"spam"`
+	TopSenders    []SenderCount `json:"top_senders"`
+	Sent          int64         `json:"sent"`
+	SendFailed    int64         `json:"send_failed"`
+	Forwarded     int64         `json:"forwarded"`
+	ForwardFailed int64         `json:"forward_failed"`
+	QueuePending  int64         `json:"queue_pending"`
+	QueueRunning  int64         `json:"queue_processing"`
+	QueueDeferred int64         `json:"queue_deferred"`
+	DeadLetters   int64         `json:"dead_letters"`
+	ExpiringCerts []CertExpiry  `json:"expiring_certs"`
+}
+
+// digestTemplate 内置摘要模板 (文案由 locale 提供)
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{"t": locale.T}).Parse(`<h3>{{t "digest.subject" .Period}}</h3>
+<table cellpadding="4" style="border-collapse:collapse">
+<tr><td><b>{{t "digest.received"}}</b></td><td>{{.Received}}</td></tr>
+<tr><td><b>{{t "digest.spam"}}</b></td><td>{{.Spam}}</td></tr>
+<tr><td><b>{{t "digest.sent"}}</b></td><td>{{.Sent}} / {{.SendFailed}}</td></tr>
+<tr><td><b>{{t "digest.forwards"}}</b></td><td>{{.Forwarded}} / {{.ForwardFailed}}</td></tr>
+<tr><td><b>{{t "digest.queue_backlog"}}</b></td><td>{{.QueuePending}} / {{.QueueRunning}} / {{.QueueDeferred}}</td></tr>
+<tr><td><b>{{t "digest.dead_letters"}}</b></td><td>{{.DeadLetters}}</td></tr>
+</table>
+<h4>{{t "digest.top_senders"}}</h4>
+{{if .TopSenders}}<ol>{{range .TopSenders}}<li>{{.FromAddr}} ({{.Count}})</li>{{end}}</ol>{{else}}<p>{{t "digest.none"}}</p>{{end}}
+<h4>{{t "digest.certs"}}</h4>
+{{if .ExpiringCerts}}<ul>{{range .ExpiringCerts}}<li>{{.Name}} ({{.Domains}}): {{.NotAfter.Format "2006-01-02"}}, {{.DaysLeft}}d</li>{{end}}</ul>{{else}}<p>{{t "digest.none"}}</p>{{end}}
+`))
+
+var (
+	digestGuard   = jobs.NewGuard("daily digest")
+	lastDigestDay string
+)
+
+// digestRecipient 摘要收件地址，未单独配置时使用告警地址
+func digestRecipient() string {
+	if to := strings.TrimSpace(config.AppConfig.DigestEmail); to != "" {
+		return to
+	}
+	return strings.TrimSpace(config.AppConfig.AlertEmail)
+}
+
+// digestClock 解析 digest_time (HH:MM)，格式错误时使用 08:00
+func digestClock(value string) (int, int) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 8, 0
+	}
+	return t.Hour(), t.Minute()
+}
+
+// digestDue 当前是否到达今日的摘要发送时间且今日尚未发送
+func digestDue(now time.Time, clock, lastDay string) bool {
+	hour, minute := digestClock(clock)
+	at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	return !now.Before(at) && lastDay != now.Format("2006-01-02")
+}
+
+// digestStartDay 调度启动时视为已发送的日期：当天已过发送时间的不补发，尚未到达时当天照常发送
+func digestStartDay(now time.Time, clock string) string {
+	if digestDue(now, clock, "") {
+		return now.Format("2006-01-02")
+	}
+	return ""
+}
+
+// StartDigestScheduler 启动每日摘要调度 (每分钟检查一次是否到达发送时间)
+func StartDigestScheduler() {
+	go func() {
+		lastDigestDay = digestStartDay(time.Now(), config.AppConfig.DigestTime)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if !config.AppConfig.DigestEnabled || !digestDue(now, config.AppConfig.DigestTime, lastDigestDay) {
+				continue
+			}
+			lastDigestDay = now.Format("2006-01-02")
+			digestGuard.Run(func() {
+				if _, err := SendDigest(); err != nil {
+					log.Printf("[Digest] Failed to send daily digest: %v", err)
+				}
+			})
+		}
+	}()
+}
+
+// BuildDigest 汇总过去 24 小时的运行情况
+func BuildDigest(now time.Time) Digest {
+	since := now.Add(-24 * time.Hour)
+	d := Digest{Since: since, Until: now}
+
+	database.DB.Model(&database.Inbox{}).Where("created_at >= ?", since).Count(&d.Received)
+	database.DB.Model(&database.Inbox{}).Where("created_at >= ? AND tags LIKE ?", since, `%"spam"%`).Count(&d.Spam)
+	database.DB.Model(&database.Inbox{}).Where("created_at >= ?", since).
+		Select("from_addr, COUNT(*) AS count").Group("from_addr").Order("count desc").Limit(5).Scan(&d.TopSenders)
+
+	database.DB.Model(&database.EmailLog{}).Where("created_at >= ? AND status = ?", since, "success").Count(&d.Sent)
+	database.DB.Model(&database.EmailLog{}).Where("created_at >= ? AND status = ?", since, "failed").Count(&d.SendFailed)
+	database.DB.Model(&database.ForwardLog{}).Where("created_at >= ? AND status = ?", since, "success").Count(&d.Forwarded)
+	database.DB.Model(&database.ForwardLog{}).Where("created_at >= ? AND status = ?", since, "failed").Count(&d.ForwardFailed)
+
+	database.DB.Model(&database.EmailQueue{}).Where("status = ?", "pending").Count(&d.QueuePending)
+	database.DB.Model(&database.EmailQueue{}).Where("status = ?", "processing").Count(&d.QueueRunning)
+	database.DB.Model(&database.EmailQueue{}).Where("status = ?", "deferred").Count(&d.QueueDeferred)
+	database.DB.Model(&database.EmailQueue{}).Where("status = ? AND updated_at >= ?", "dead", since).Count(&d.DeadLetters)
+
+	var certs []database.Certificate
+	database.DB.Select("id", "name", "domains", "not_after").
+		Where("not_after < ?", now.AddDate(0, 0, digestCertDays)).Order("not_after asc").Find(&certs)
+	for _, c := range certs {
+		d.ExpiringCerts = append(d.ExpiringCerts, CertExpiry{
+			Name:     c.Name,
+			Domains:  c.Domains,
+			NotAfter: c.NotAfter,
+			DaysLeft: int(c.NotAfter.Sub(now).Hours() / 24),
+		})
+	}
+	return d
+}
+
+// renderDigest 使用内置模板渲染摘要正文
+func renderDigest(d Digest) (string, error) {
+	var buf bytes.Buffer
+	err := digestTemplate.Execute(&buf, struct {
+		Digest
+		Period string
+	}{d, d.Until.Format("2006-01-02")})
+	return buf.String(), err
+}
+
+// SendDigest 立即生成并经默认通道发送摘要，返回摘要内容
+func SendDigest() (Digest, error) {
+	to := digestRecipient()
+	if to == "" {
+		return Digest{}, fmt.Errorf("digest_email and alert_email are both empty")
+	}
+	d := BuildDigest(time.Now())
+	body, err := renderDigest(d)
+	if err != nil {
+		return d, err
+	}
+	_, err = SendEmailAsync(SendRequest{
+		From:                  "noreply@" + config.AppConfig.Domain,
+		To:                    to,
+		Subject:               locale.T("digest.subject", d.Until.Format("2006-01-02")),
+		Body:                  body,
+		Headers:               map[string]string{digestHeader: "daily"},
+		AllowUnverifiedDomain: true,
+		SkipBCC:               true,
+		SkipFooter:            true,
+
+		BypassRecipientInterval: true,
+	})
+	return d, err
+}
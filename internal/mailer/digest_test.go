@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestDue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)
+	if !digestDue(now, "08:00", "2024-04-30") {
+		t.Error("digest should be due after the configured time")
+	}
+	if digestDue(now, "08:00", "2024-05-01") {
+		t.Error("digest already sent today")
+	}
+	if digestDue(now, "09:15", "2024-04-30") {
+		t.Error("digest should wait for 09:15")
+	}
+	if day := digestStartDay(now, "08:00"); day != "2024-05-01" {
+		t.Errorf("started after digest_time: lastDay = %q, want today", day)
+	}
+	if day := digestStartDay(now, "09:15"); day != "" {
+		t.Errorf("started before digest_time: lastDay = %q, want empty", day)
+	}
+	if h, m := digestClock("bad"); h != 8 || m != 0 {
+		t.Errorf("invalid digest_time parsed as %02d:%02d", h, m)
+	}
+
+	body, err := renderDigest(Digest{Until: now, Received: 3, TopSenders: []SenderCount{{FromAddr: "<a@b.c>", Count: 3}}})
+	if err != nil || !strings.Contains(body, "&lt;a@b.c&gt; (3)") {
+		t.Errorf("renderDigest = %q, %v", body, err)
+	}
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// txtChunkSize DNS TXT 单个字符串的最大长度 (RFC 1035)
+const txtChunkSize = 255
+
+// DKIMRecordValue 将 PEM 格式的 DKIM 公钥转换为 DNS TXT 记录值 (v=DKIM1; k=rsa; p=<base64 DER>)
+// 同时兼容 PKIX ("PUBLIC KEY") 与 PKCS#1 ("RSA PUBLIC KEY") 两种编码，输出统一为 PKIX DER
+func DKIMRecordValue(pubPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(pubPEM)))
+	if block == nil {
+		return "", fmt.Errorf("invalid DKIM public key PEM")
+	}
+
+	var pub *rsa.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("parse DKIM public key: %w", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("DKIM public key is not RSA")
+		}
+		pub = rsaKey
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("parse DKIM public key: %w", err)
+		}
+		pub = key
+	default:
+		return "", fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+}
+
+// SplitTXT 将超过 255 字符的 TXT 记录值拆分为多个字符串 (2048 位密钥必须拆分)
+func SplitTXT(value string) []string {
+	var chunks []string
+	for len(value) > txtChunkSize {
+		chunks = append(chunks, value[:txtChunkSize])
+		value = value[txtChunkSize:]
+	}
+	return append(chunks, value)
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestDKIMRecordValue(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkixDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	want := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pkixDER)
+
+	pkix := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER}))
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+	for name, in := range map[string]string{"pkix": pkix, "pkcs1": pkcs1} {
+		got, err := DKIMRecordValue(in)
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, err %v", name, got, err)
+		}
+	}
+
+	if _, err := DKIMRecordValue("not a key"); err == nil {
+		t.Error("expected error for invalid PEM")
+	}
+
+	chunks := SplitTXT(want)
+	if len(chunks) < 2 || strings.Join(chunks, "") != want {
+		t.Errorf("SplitTXT produced %d chunks", len(chunks))
+	}
+	for _, c := range chunks {
+		if len(c) > 255 {
+			t.Errorf("chunk too long: %d", len(c))
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// enhancedStatusCode 匹配错误信息中的增强状态码 (RFC 3463，如 5.1.1)
+var enhancedStatusCode = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+
+// DSNInfo 生成投递失败通知 (DSN) 所需的信息
+type DSNInfo struct {
+	ReportingDomain string    // 报告方域名 (收件域名)，用于 Reporting-MTA 与 MAILER-DAEMON 地址
+	Sender          string    // 原始发件人，DSN 的收件人
+	Recipient       string    // 投递失败的收件人 (对发件人可见的原始收件地址)
+	Subject         string    // 原始邮件主题
+	Diagnostic      string    // 最终错误信息
+	Hard            bool      // 是否为永久失败
+	ArrivalDate     time.Time // 原始邮件到达时间
+}
+
+// dsnStatus 返回 DSN 的 Status 字段：优先使用错误信息中的增强状态码，否则按软/硬失败给出通用码
+func dsnStatus(info DSNInfo) string {
+	if m := enhancedStatusCode.FindStringSubmatch(info.Diagnostic); m != nil && m[1][0] != '2' {
+		return m[1]
+	}
+	if info.Hard {
+		return "5.0.0"
+	}
+	// 重试耗尽的临时失败 (RFC 3463 4.4.7: delivery time expired)
+	return "4.4.7"
+}
+
+// BuildDSN 生成 multipart/report; report-type=delivery-status 格式的投递失败通知 (RFC 3464)
+func BuildDSN(info DSNInfo) []byte {
+	boundary := randomBoundary()
+	now := time.Now()
+	mailerDaemon := "MAILER-DAEMON@" + info.ReportingDomain
+	diagnostic := strings.Join(strings.Fields(info.Diagnostic), " ")
+
+	var b bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&b, "%s: %s\r\n", name, value) }
+	header("From", "Mail Delivery System <"+mailerDaemon+">")
+	header("To", "<"+info.Sender+">")
+	header("Subject", "Undelivered Mail Returned to Sender")
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), boundary[:8], info.ReportingDomain))
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+	header("Content-Type", fmt.Sprintf("multipart/report; report-type=delivery-status; boundary=\"%s\"", boundary))
+	b.WriteString("\r\n")
+
+	// 1. 人类可读说明
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "This is the mail system at %s.\r\n\r\n", info.ReportingDomain)
+	fmt.Fprintf(&b, "Your message to <%s> could not be delivered.\r\n", info.Recipient)
+	if !info.Hard {
+		b.WriteString("Delivery was retried but did not succeed. No further attempts will be made.\r\n")
+	}
+	fmt.Fprintf(&b, "\r\nReason: %s\r\n\r\n", diagnostic)
+
+	// 2. 机器可读投递状态 (per-message 字段块 + per-recipient 字段块)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: message/delivery-status\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "Reporting-MTA: dns; %s\r\n", info.ReportingDomain)
+	if !info.ArrivalDate.IsZero() {
+		fmt.Fprintf(&b, "Arrival-Date: %s\r\n", info.ArrivalDate.Format(time.RFC1123Z))
+	}
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "Final-Recipient: rfc822; %s\r\n", info.Recipient)
+	b.WriteString("Action: failed\r\n")
+	fmt.Fprintf(&b, "Status: %s\r\n", dsnStatus(info))
+	fmt.Fprintf(&b, "Diagnostic-Code: smtp; %s\r\n\r\n", diagnostic)
+
+	// 3. 原始邮件头 (仅保留转发日志中记录的字段)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/rfc822-headers\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "From: <%s>\r\n", info.Sender)
+	fmt.Fprintf(&b, "To: <%s>\r\n", info.Recipient)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", info.Subject))
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+func randomBoundary() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// isNullSender 是否为空发件人或系统退信地址 (不得再向其发送 DSN，避免退信循环)
+func isNullSender(addr string) bool {
+	addr = strings.ToLower(strings.Trim(strings.TrimSpace(addr), "<>"))
+	if addr == "" || !strings.Contains(addr, "@") {
+		return true
+	}
+	local := addr[:strings.Index(addr, "@")]
+	return local == "mailer-daemon" || local == "postmaster"
+}
+
+// sendForwardDSN 转发任务最终失败时向原始发件人发送 DSN (需启用 forward_dsn)
+// 每条转发日志只发送一次；DSN 以空信封发件人 (MAIL FROM:<>) 直接投递，结果记录到转发日志的 dsn_status
+func sendForwardDSN(t database.EmailQueue, errMsg string, hardBounce bool) {
+	if !config.AppConfig.ForwardDSN {
+		return
+	}
+	var fwd database.ForwardLog
+	if err := database.DB.Where("queue_id = ?", t.ID).First(&fwd).Error; err != nil || fwd.DSNStatus != "" {
+		return
+	}
+	if isNullSender(fwd.FromAddr) {
+		database.DB.Model(&fwd).Update("dsn_status", "skipped")
+		return
+	}
+
+	// 诊断信息中不暴露转发目标地址
+	diagnostic := errMsg
+	if fwd.ForwardTo != "" {
+		diagnostic = regexp.MustCompile(`(?i)`+regexp.QuoteMeta(fwd.ForwardTo)).ReplaceAllString(diagnostic, fwd.ToAddr)
+	}
+	reportingDomain := extractDomain(fwd.ToAddr)
+	msg := BuildDSN(DSNInfo{
+		ReportingDomain: reportingDomain,
+		Sender:          fwd.FromAddr,
+		Recipient:       fwd.ToAddr,
+		Subject:         fwd.Subject,
+		Diagnostic:      diagnostic,
+		Hard:            hardBounce,
+		ArrivalDate:     fwd.CreatedAt,
+	})
+
+	// 测试沙箱与普通发信一致：改投 sink_address 并记录原收件人，或直接丢弃
+	rcpt := fwd.FromAddr
+	sink := sinkMode()
+	if sink == sinkRedirect {
+		rcpt = strings.TrimSpace(config.AppConfig.SinkAddress)
+		msg = append([]byte(sinkOriginalHeader+": "+fwd.FromAddr+"\r\n"), msg...)
+	}
+
+	go func() {
+		status := "sent"
+		if sink == sinkDrop {
+			log.Printf("[Forward] Sink mode: dropped DSN for forward %d to %s", fwd.ID, fwd.FromAddr)
+		} else if err := directDeliverHelo(reportingDomain, "", rcpt, msg); err != nil {
+			status = "failed"
+			log.Printf("[Forward] DSN for forward %d to %s failed: %v", fwd.ID, rcpt, err)
+		} else {
+			log.Printf("[Forward] DSN for forward %d sent to %s", fwd.ID, rcpt)
+		}
+		database.DB.Model(&database.ForwardLog{}).Where("id = ?", fwd.ID).Update("dsn_status", status)
+	}()
+}
@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"log"
+	"regexp"
+	"sync"
+
+	"goemail/internal/config"
+	"goemail/internal/locale"
+)
+
+// 发送失败的错误分类
+const (
+	ErrCategoryRateLimited      = "rate_limited"
+	ErrCategoryBlacklisted      = "blacklisted"
+	ErrCategoryInvalidRecipient = "invalid_recipient"
+	ErrCategoryRelayDenied      = "relay_denied"
+	ErrCategoryAuthFailed       = "auth_failed"
+	ErrCategoryAuthentication   = "sender_authentication"
+	ErrCategoryContentRejected  = "content_rejected"
+	ErrCategoryTLS              = "tls"
+	ErrCategoryConnection       = "connection"
+	ErrCategoryUnknown          = "unknown"
+)
+
+type errorRule struct {
+	category string
+	pattern  *regexp.Regexp
+	hint     string // 内置规则为 locale 文案键，自定义规则为原文
+}
+
+// builtinErrorRules 内置的常见 SMTP 拒收模式，按顺序匹配
+// 5.7.1 同时用于中继拒绝与黑名单，中继规则需在前；连接错误需在 TLS 之前 (smtp_tls_dial_failed 也可能是超时)
+// 域名解析失败仅在查询收件域名 MX 时归为无效收件人，中继主机解析失败属于连接错误
+// hint 为 locale 文案键，按 system_locale 输出
+var builtinErrorRules = []errorRule{
+	{ErrCategoryAuthFailed, regexp.MustCompile(`(?i)smtp_auth_failed|\b535\b|authentication (failed|credentials invalid)|username and password not accepted`),
+		"error_hint.auth_failed"},
+	{ErrCategoryRelayDenied, regexp.MustCompile(`(?i)relay(ing)? (access )?(denied|not permitted|prohibited)|not permitted to relay|unable to relay|relay not allowed`),
+		"error_hint.relay_denied"},
+	{ErrCategoryRateLimited, regexp.MustCompile(`(?i)rate.?limit|too many (messages|connections|recipients|emails)|throttl|sending quota|try again later|\b4\.7\.28\b|\b421[ -]4\.7\.0\b`),
+		"error_hint.rate_limited"},
+	{ErrCategoryBlacklisted, regexp.MustCompile(`(?i)black.?list|block.?list|spamhaus|spamcop|barracuda|\b(rbl|dnsbl)\b|listed (at|in|on|by)|poor reputation|ip reputation|\b5\.7\.(1|606)\b.*(block|banned|denied)`),
+		"error_hint.blacklisted"},
+	{ErrCategoryInvalidRecipient, regexp.MustCompile(`(?i)user unknown|unknown (user|recipient)|no such (user|recipient|mailbox)|mailbox (unavailable|not found|does not exist)|recipient (address )?(rejected|not found|unknown)|address rejected|invalid recipient|does not exist|\b5\.1\.[0-3]\b|no MX records for|mx_lookup_failed: .*no such host`),
+		"error_hint.invalid_recipient"},
+	{ErrCategoryAuthentication, regexp.MustCompile(`(?i)\bspf\b|\bdkim\b|\bdmarc\b|\b5\.7\.(23|25|26|27)\b|unauthenticated|sender (is )?not authenticated|sender domain .* not verified`),
+		"error_hint.sender_authentication"},
+	{ErrCategoryContentRejected, regexp.MustCompile(`(?i)\bspam\b|content (rejected|policy)|message (rejected|refused)|suspicious|virus|\b5\.7\.0\b`),
+		"error_hint.content_rejected"},
+	{ErrCategoryConnection, regexp.MustCompile(`(?i)timeout|timed out|connection refused|connection reset|no route to host|network is unreachable|dial tcp|no such host|port 25`),
+		"error_hint.connection"},
+	{ErrCategoryTLS, regexp.MustCompile(`(?i)tls|certificate|x509|dane_`),
+		"error_hint.tls"},
+}
+
+var (
+	customRulesMu  sync.Mutex
+	customRulesSrc []config.ErrorCategoryRule
+	customRules    []errorRule
+)
+
+// loadCustomErrorRules 编译配置中的自定义错误分类规则 (error_category_rules)，配置未变化时复用
+func loadCustomErrorRules() []errorRule {
+	src := config.AppConfig.ErrorCategoryRules
+	customRulesMu.Lock()
+	defer customRulesMu.Unlock()
+	if sameErrorRules(src, customRulesSrc) {
+		return customRules
+	}
+	rules := make([]errorRule, 0, len(src))
+	for _, r := range src {
+		if r.Category == "" || r.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			log.Printf("[Mailer] Ignoring invalid error category pattern %q: %v", r.Pattern, err)
+			continue
+		}
+		rules = append(rules, errorRule{category: r.Category, pattern: re, hint: r.Hint})
+	}
+	customRulesSrc = append([]config.ErrorCategoryRule(nil), src...)
+	customRules = rules
+	return rules
+}
+
+func sameErrorRules(a, b []config.ErrorCategoryRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ClassifyError 将原始发送错误归类并给出处理建议，自定义规则优先于内置规则
+// 无法识别时返回 unknown 与空建议
+func ClassifyError(errMsg string) (string, string) {
+	if errMsg == "" {
+		return "", ""
+	}
+	for _, r := range loadCustomErrorRules() {
+		if r.pattern.MatchString(errMsg) {
+			return r.category, r.hint
+		}
+	}
+	return classifyBuiltin(errMsg)
+}
+
+func classifyBuiltin(errMsg string) (string, string) {
+	for _, r := range builtinErrorRules {
+		if r.pattern.MatchString(errMsg) {
+			return r.category, locale.T(r.hint)
+		}
+	}
+	return ErrCategoryUnknown, ""
+}
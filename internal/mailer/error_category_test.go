@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"goemail/internal/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	config.AppConfig.ErrorCategoryRules = nil
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"smtp_auth_failed: 535 5.7.8 Username and Password not accepted", ErrCategoryAuthFailed},
+		{"smtp_rcpt_to_failed: 550 5.7.1 Relaying denied", ErrCategoryRelayDenied},
+		{"direct_send_failed: 421 4.7.0 Try again later, closing connection", ErrCategoryRateLimited},
+		{"direct_send_failed: 554 5.7.1 Service unavailable; Client host [192.0.2.1] blocked using zen.spamhaus.org", ErrCategoryBlacklisted},
+		{"direct_send_failed: 550 5.1.1 The email account that you tried to reach does not exist", ErrCategoryInvalidRecipient},
+		{"mx_lookup_failed: lookup nodomain.invalid: no such host", ErrCategoryInvalidRecipient},
+		{"mx_lookup_failed: no MX records for example.invalid", ErrCategoryInvalidRecipient},
+		{"smtp_dial_failed: lookup smtp.relay.example: no such host", ErrCategoryConnection},
+		{"direct_send_failed: 550 5.7.26 This message does not pass authentication checks (SPF and DKIM)", ErrCategoryAuthentication},
+		{"smtp_data_failed: 554 5.7.0 Message rejected as spam", ErrCategoryContentRejected},
+		{"smtp_tls_dial_failed: dial tcp 192.0.2.1:465: i/o timeout", ErrCategoryConnection},
+		{"smtp_tls_verify_failed: certificate of mail.example.com could not be verified", ErrCategoryTLS},
+		{"something odd happened", ErrCategoryUnknown},
+	}
+	for _, tt := range tests {
+		if got, _ := ClassifyError(tt.msg); got != tt.want {
+			t.Errorf("ClassifyError(%q) = %s, want %s", tt.msg, got, tt.want)
+		}
+	}
+	if cat, hint := ClassifyError(""); cat != "" || hint != "" {
+		t.Errorf("empty error classified as %q", cat)
+	}
+
+	// 内置建议按 system_locale 输出
+	config.AppConfig.SystemLocale = "zh-CN"
+	_, hint := ClassifyError("smtp_auth_failed: 535 5.7.8 Username and Password not accepted")
+	config.AppConfig.SystemLocale = ""
+	if !strings.Contains(hint, "SMTP 通道") {
+		t.Errorf("hint not localized: %q", hint)
+	}
+
+	// 自定义规则优先于内置规则
+	config.AppConfig.ErrorCategoryRules = []config.ErrorCategoryRule{
+		{Category: "provider_quota", Pattern: `daily sending quota`, Hint: "Upgrade the plan"},
+		{Category: "broken", Pattern: `(`},
+	}
+	defer func() { config.AppConfig.ErrorCategoryRules = nil }()
+	if cat, hint := ClassifyError("smtp_data_failed: 550 Daily sending quota exceeded"); cat != "provider_quota" || hint != "Upgrade the plan" {
+		t.Errorf("custom rule not applied: %s %q", cat, hint)
+	}
+}
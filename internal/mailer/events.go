@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"sync"
+	"time"
+
+	"goemail/internal/database"
+)
+
+// QueueEvent 队列任务的实时事件 (状态变化或打开/点击)，推送给 /queue/:id/stream 订阅者
+type QueueEvent struct {
+	QueueID uint      `json:"queue_id,omitempty"`
+	Type    string    `json:"type"`             // status / open / click
+	Status  string    `json:"status,omitempty"` // Type 为 status 时的新状态
+	Error   string    `json:"error,omitempty"`
+	URL     string    `json:"url,omitempty"` // 点击事件的目标链接
+	Time    time.Time `json:"time"`
+}
+
+// queueEventBuffer 单个订阅者的缓冲长度，写满后丢弃新事件，不阻塞发信与追踪
+const queueEventBuffer = 16
+
+type queueSubscriber struct {
+	queueID    uint
+	trackingID string
+	ch         chan QueueEvent
+}
+
+// 进程内订阅表，订阅者数量很少 (仅打开中的 SSE 连接)，发布时线性扫描即可
+var (
+	queueSubsMu sync.Mutex
+	queueSubs   = make(map[*queueSubscriber]struct{})
+)
+
+// SubscribeQueue 订阅指定队列任务的状态事件，trackingID 非空时同时接收该邮件的打开/点击事件
+// 返回事件通道与取消函数，调用方必须在结束时调用取消函数
+func SubscribeQueue(queueID uint, trackingID string) (<-chan QueueEvent, func()) {
+	sub := &queueSubscriber{queueID: queueID, trackingID: trackingID, ch: make(chan QueueEvent, queueEventBuffer)}
+	queueSubsMu.Lock()
+	queueSubs[sub] = struct{}{}
+	queueSubsMu.Unlock()
+	return sub.ch, func() {
+		queueSubsMu.Lock()
+		delete(queueSubs, sub)
+		queueSubsMu.Unlock()
+	}
+}
+
+// publish 向匹配的订阅者非阻塞投递事件
+func publish(match func(*queueSubscriber) bool, ev QueueEvent) {
+	queueSubsMu.Lock()
+	defer queueSubsMu.Unlock()
+	for sub := range queueSubs {
+		if !match(sub) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// publishQueueStatus 队列任务状态变化时通知订阅者
+func publishQueueStatus(t database.EmailQueue, status, errMsg string) {
+	publish(func(s *queueSubscriber) bool { return s.queueID == t.ID }, QueueEvent{
+		QueueID: t.ID,
+		Type:    "status",
+		Status:  status,
+		Error:   errMsg,
+		Time:    time.Now(),
+	})
+}
+
+// PublishTrackingEvent 邮件被打开或点击时通知按追踪 ID 订阅的连接
+func PublishTrackingEvent(trackingID, eventType, targetURL string) {
+	if trackingID == "" {
+		return
+	}
+	publish(func(s *queueSubscriber) bool { return s.trackingID == trackingID }, QueueEvent{
+		Type: eventType,
+		URL:  targetURL,
+		Time: time.Now(),
+	})
+}
+
+// IsTerminalQueueStatus 任务不会再发生状态变化 (completed 成功，dead 超过重试次数)
+func IsTerminalQueueStatus(status string) bool {
+	return status == "completed" || status == "dead"
+}
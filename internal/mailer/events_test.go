@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"testing"
+
+	"goemail/internal/database"
+)
+
+func TestQueueEventRouting(t *testing.T) {
+	events, cancel := SubscribeQueue(7, "trk-7")
+	other, cancelOther := SubscribeQueue(8, "")
+	defer cancelOther()
+
+	publishQueueStatus(database.EmailQueue{ID: 7}, "completed", "")
+	PublishTrackingEvent("trk-7", "open", "")
+	if ev := <-events; ev.Type != "status" || ev.Status != "completed" {
+		t.Fatalf("first event = %+v, want completed status", ev)
+	}
+	if ev := <-events; ev.Type != "open" {
+		t.Fatalf("second event = %+v, want open", ev)
+	}
+	if len(other) != 0 {
+		t.Errorf("unrelated subscriber received %d events", len(other))
+	}
+
+	cancel()
+	publishQueueStatus(database.EmailQueue{ID: 7}, "dead", "")
+	if len(events) != 0 {
+		t.Error("events delivered after cancel")
+	}
+}
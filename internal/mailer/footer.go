@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"strings"
+
+	"goemail/internal/database"
+)
+
+// applyDomainFooter 为发件域名配置的页脚注入邮件正文 (HTML 插入 </body> 之前，纯文本追加到末尾)
+// 营销邮件始终注入 (保证 CAN-SPAM 要求的实际地址)，其余邮件可通过 skip_footer 跳过
+func applyDomainFooter(req *SendRequest, fromAddr string) {
+	if req.SkipFooter && req.CampaignID == 0 {
+		return
+	}
+	domainName := strings.ToLower(extractDomain(fromAddr))
+	if domainName == "" {
+		return
+	}
+	var domain database.Domain
+	if err := database.DB.Select("footer_html", "footer_text").Where("LOWER(name) = ?", domainName).First(&domain).Error; err != nil {
+		return
+	}
+	req.Body, req.TextBody = injectFooter(req.Body, req.TextBody, domain.FooterHTML, domain.FooterText)
+}
+
+// injectFooter 将页脚拼接到 HTML 与纯文本正文，纯文本页脚为空时由 HTML 页脚生成
+func injectFooter(htmlBody, textBody, footerHTML, footerText string) (string, string) {
+	if strings.TrimSpace(footerHTML) != "" {
+		if idx := strings.LastIndex(strings.ToLower(htmlBody), "</body>"); idx >= 0 {
+			htmlBody = htmlBody[:idx] + footerHTML + htmlBody[idx:]
+		} else {
+			htmlBody += footerHTML
+		}
+	}
+	if textBody != "" {
+		if strings.TrimSpace(footerText) == "" && footerHTML != "" {
+			footerText = HTMLToText(footerHTML)
+		}
+		if strings.TrimSpace(footerText) != "" {
+			textBody = strings.TrimRight(textBody, "\r\n") + "\n\n" + footerText
+		}
+	}
+	return htmlBody, textBody
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import "testing"
+
+func TestInjectFooter(t *testing.T) {
+	html, text := injectFooter("<html><body><p>Hi</p></BODY></html>", "Hi\n", "<p>ACME, 1 Main St</p>", "")
+	if html != "<html><body><p>Hi</p><p>ACME, 1 Main St</p></BODY></html>" {
+		t.Errorf("html = %q", html)
+	}
+	if text != "Hi\n\nACME, 1 Main St" {
+		t.Errorf("text = %q", text)
+	}
+
+	html, text = injectFooter("<p>Hi</p>", "", "<p>Footer</p>", "Footer")
+	if html != "<p>Hi</p><p>Footer</p>" || text != "" {
+		t.Errorf("no </body>: html = %q, text = %q", html, text)
+	}
+
+	html, text = injectFooter("<p>Hi</p>", "Hi", "", "")
+	if html != "<p>Hi</p>" || text != "Hi" {
+		t.Errorf("empty footer changed body: %q, %q", html, text)
+	}
+}
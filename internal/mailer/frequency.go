@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// RecipientIntervalReason 因收件人最小发送间隔顺延的任务 error_msg 前缀
+const RecipientIntervalReason = "recipient_interval"
+
+// ErrRecipientInterval 收件人距上次发送未满最小间隔
+var ErrRecipientInterval = errors.New(RecipientIntervalReason + ": recipient was mailed too recently")
+
+// recipientIntervalChunk 批量查询最近发送记录时每次 IN 的地址数
+const recipientIntervalChunk = 500
+
+var (
+	recipientMu       sync.Mutex
+	recipientInFlight = make(map[string]bool) // 已通过检查、尚未结束投递的收件地址
+)
+
+// RecipientMinInterval 同一收件地址两次发送的最小间隔，0 表示不限制
+func RecipientMinInterval() time.Duration {
+	if config.AppConfig.RecipientMinInterval > 0 {
+		return time.Duration(config.AppConfig.RecipientMinInterval) * time.Minute
+	}
+	return 0
+}
+
+// SkipRecentRecipients 营销任务启动时是否直接跳过间隔内的收件人 (默认在发送时顺延)
+func SkipRecentRecipients() bool {
+	return RecipientMinInterval() > 0 && strings.EqualFold(strings.TrimSpace(config.AppConfig.RecipientIntervalAction), "skip")
+}
+
+// recipientAvailableAt 上次发送后最早可再次发送的时间；返回 false 表示当前即可发送
+func recipientAvailableAt(lastSent, now time.Time, interval time.Duration) (time.Time, bool) {
+	if interval <= 0 || lastSent.IsZero() {
+		return time.Time{}, false
+	}
+	next := lastSent.Add(interval)
+	return next, next.After(now)
+}
+
+// reserveRecipientSlot 检查收件人是否已满最小间隔，满足时将其标记为投递中
+// 返回 false 时附带最早可发送时间；检查与标记在同一把锁内完成，同批任务中的重复收件人只会放行一封
+// 放行后须在投递结束时调用返回的 done：仅 sent 为 true 时记录本次发送时间，预热顺延或投递失败不占用间隔
+func reserveRecipientSlot(to string, now time.Time) (bool, time.Time, func(sent bool)) {
+	interval := RecipientMinInterval()
+	email := strings.ToLower(strings.TrimSpace(to))
+	if interval <= 0 || email == "" {
+		return true, time.Time{}, func(bool) {}
+	}
+
+	recipientMu.Lock()
+	defer recipientMu.Unlock()
+
+	if recipientInFlight[email] {
+		return false, now.Add(interval), nil
+	}
+	var row database.RecipientLastSent
+	if database.DB.Where("email = ?", email).First(&row).Error == nil {
+		if next, wait := recipientAvailableAt(row.LastSentAt, now, interval); wait {
+			return false, next, nil
+		}
+	}
+	recipientInFlight[email] = true
+
+	return true, time.Time{}, func(sent bool) {
+		recipientMu.Lock()
+		defer recipientMu.Unlock()
+		delete(recipientInFlight, email)
+		if sent {
+			recordRecipientSent(email, time.Now())
+		}
+	}
+}
+
+// recordRecipientSent 记录收件地址最近一次成功发送的时间
+func recordRecipientSent(email string, at time.Time) {
+	res := database.DB.Model(&database.RecipientLastSent{}).Where("email = ?", email).Update("last_sent_at", at)
+	if res.Error == nil && res.RowsAffected == 0 {
+		database.DB.Create(&database.RecipientLastSent{Email: email, LastSentAt: at})
+	}
+}
+
+// RecentlyMailedRecipients 返回给定地址中仍处于最小间隔内的地址 (小写)
+func RecentlyMailedRecipients(emails []string, now time.Time) map[string]bool {
+	recent := make(map[string]bool)
+	interval := RecipientMinInterval()
+	if interval <= 0 || len(emails) == 0 {
+		return recent
+	}
+	lower := make([]string, 0, len(emails))
+	for _, e := range emails {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			lower = append(lower, e)
+		}
+	}
+	for start := 0; start < len(lower); start += recipientIntervalChunk {
+		end := min(start+recipientIntervalChunk, len(lower))
+		var hits []string
+		database.DB.Model(&database.RecipientLastSent{}).
+			Where("email IN ? AND last_sent_at > ?", lower[start:end], now.Add(-interval)).
+			Pluck("email", &hits)
+		for _, e := range hits {
+			recent[e] = true
+		}
+	}
+	return recent
+}
+
+// recipientIntervalMessage 顺延任务记录的原因 (营销进度按前缀统计)
+func recipientIntervalMessage(next time.Time) string {
+	return fmt.Sprintf("%s, deferred to %s", ErrRecipientInterval.Error(), next.Format(time.RFC3339))
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecipientAvailableAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, wait := recipientAvailableAt(time.Time{}, now, time.Hour); wait {
+		t.Error("never-mailed recipient should be available")
+	}
+	if _, wait := recipientAvailableAt(now.Add(-time.Minute), now, 0); wait {
+		t.Error("zero interval should not limit")
+	}
+	next, wait := recipientAvailableAt(now.Add(-20*time.Minute), now, time.Hour)
+	if !wait || !next.Equal(now.Add(40*time.Minute)) {
+		t.Errorf("recent recipient: next=%v wait=%v", next, wait)
+	}
+	if _, wait := recipientAvailableAt(now.Add(-time.Hour), now, time.Hour); wait {
+		t.Error("recipient should be available once the interval has elapsed")
+	}
+}
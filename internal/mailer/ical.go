@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// icalMethods RFC 5546 定义的 iTIP 方法
+var icalMethods = map[string]bool{
+	"PUBLISH": true, "REQUEST": true, "REPLY": true, "ADD": true,
+	"CANCEL": true, "REFRESH": true, "COUNTER": true, "DECLINECOUNTER": true,
+}
+
+// ValidateICal 校验 iCalendar 内容是否为结构完整的 VCALENDAR
+func ValidateICal(ical string) error {
+	_, _, err := prepareICal(ical)
+	return err
+}
+
+// prepareICal 校验 iCalendar 内容，返回统一为 CRLF 换行的内容及 METHOD (缺省为 REQUEST)
+func prepareICal(ical string) (string, string, error) {
+	raw := strings.Split(strings.ReplaceAll(strings.TrimSpace(ical), "\r\n", "\n"), "\n")
+
+	// 展开折叠行 (以空格或制表符开头的行属于上一行)
+	var lines []string
+	for _, line := range raw {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) < 2 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") || !strings.EqualFold(lines[len(lines)-1], "END:VCALENDAR") {
+		return "", "", fmt.Errorf("ical must start with BEGIN:VCALENDAR and end with END:VCALENDAR")
+	}
+
+	method := "REQUEST"
+	hasVersion := false
+	events := 0
+	var stack []string
+	var eventProps map[string]bool
+
+	for i, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return "", "", fmt.Errorf("ical line %d is not a valid content line", i+1)
+		}
+		name := strings.ToUpper(line[:colon])
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name = name[:semi]
+		}
+		value := strings.TrimSpace(line[colon+1:])
+
+		switch name {
+		case "BEGIN":
+			component := strings.ToUpper(value)
+			stack = append(stack, component)
+			if component == "VEVENT" {
+				eventProps = map[string]bool{}
+			}
+		case "END":
+			component := strings.ToUpper(value)
+			if len(stack) == 0 || stack[len(stack)-1] != component {
+				return "", "", fmt.Errorf("ical line %d: unexpected END:%s", i+1, value)
+			}
+			stack = stack[:len(stack)-1]
+			if component == "VEVENT" {
+				if !eventProps["UID"] || !eventProps["DTSTART"] {
+					return "", "", fmt.Errorf("ical VEVENT requires UID and DTSTART")
+				}
+				events++
+			}
+		default:
+			if len(stack) == 1 {
+				switch name {
+				case "VERSION":
+					hasVersion = true
+				case "METHOD":
+					method = strings.ToUpper(value)
+				}
+			} else if len(stack) == 2 && stack[1] == "VEVENT" {
+				eventProps[name] = true
+			}
+		}
+	}
+
+	if len(stack) != 0 {
+		return "", "", fmt.Errorf("ical has unclosed component %s", stack[len(stack)-1])
+	}
+	if !hasVersion {
+		return "", "", fmt.Errorf("ical VCALENDAR requires VERSION")
+	}
+	if events == 0 {
+		return "", "", fmt.Errorf("ical must contain at least one VEVENT")
+	}
+	if !icalMethods[method] {
+		return "", "", fmt.Errorf("unsupported ical METHOD %s", method)
+	}
+
+	// 保留原始折叠格式，仅统一换行符
+	var content strings.Builder
+	for _, line := range raw {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		content.WriteString(line)
+		content.WriteString("\r\n")
+	}
+	return content.String(), method, nil
+}
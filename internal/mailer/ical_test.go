@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+const testInvite = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//GoEmail//Test//EN
+METHOD:REQUEST
+BEGIN:VEVENT
+UID:123@example.com
+DTSTART:20240301T100000Z
+DTEND:20240301T110000Z
+SUMMARY:Weekly sync with a rather long summary that is
+  folded onto the next line
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+END:VCALENDAR`
+
+func TestPrepareICal(t *testing.T) {
+	content, method, err := prepareICal(testInvite)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != "REQUEST" {
+		t.Errorf("method = %q, want REQUEST", method)
+	}
+	if !strings.HasSuffix(content, "END:VCALENDAR\r\n") || strings.Contains(strings.ReplaceAll(content, "\r\n", ""), "\n") {
+		t.Errorf("content not normalized to CRLF: %q", content)
+	}
+
+	cancel := strings.Replace(testInvite, "METHOD:REQUEST", "METHOD:cancel", 1)
+	if _, method, err := prepareICal(cancel); err != nil || method != "CANCEL" {
+		t.Errorf("cancel invite: method=%q err=%v", method, err)
+	}
+}
+
+func TestPrepareICalInvalid(t *testing.T) {
+	cases := map[string]string{
+		"not calendar":   "BEGIN:VEVENT\nEND:VEVENT",
+		"unbalanced":     strings.Replace(testInvite, "END:VALARM\n", "", 1),
+		"missing uid":    strings.Replace(testInvite, "UID:123@example.com\n", "", 1),
+		"missing events": "BEGIN:VCALENDAR\nVERSION:2.0\nEND:VCALENDAR",
+		"no version":     strings.Replace(testInvite, "VERSION:2.0\n", "", 1),
+		"bad method":     strings.Replace(testInvite, "METHOD:REQUEST", "METHOD:INVITE", 1),
+		"bad line":       strings.Replace(testInvite, "DTEND:20240301T110000Z", "DTEND 20240301T110000Z", 1),
+	}
+	for name, ical := range cases {
+		if err := ValidateICal(ical); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+type mxEntry struct {
+	records []*net.MX
+	expires time.Time
+}
+
+// mxCache 直连投递的 MX 查询缓存，所有 Worker 共享
+var (
+	mxCacheMu sync.RWMutex
+	mxCache   = map[string]mxEntry{}
+)
+
+// mxCacheTTL 缓存时间上限 (mx_cache_ttl 秒)，记录 TTL 更短时以记录为准；返回 0 表示不缓存
+func mxCacheTTL() time.Duration {
+	if config.AppConfig.MXCacheTTL <= 0 {
+		return 0
+	}
+	return time.Duration(config.AppConfig.MXCacheTTL) * time.Second
+}
+
+// lookupMX 查询域名的 MX 记录 (按优先级排序)，命中缓存时直接返回
+// 查询失败时清除该域名的缓存，下次重新查询
+func lookupMX(domain string) ([]*net.MX, error) {
+	domain = strings.ToLower(domain)
+	maxTTL := mxCacheTTL()
+	now := time.Now()
+
+	if maxTTL > 0 {
+		mxCacheMu.RLock()
+		e, ok := mxCache[domain]
+		mxCacheMu.RUnlock()
+		if ok && now.Before(e.expires) {
+			return e.records, nil
+		}
+	}
+
+	records, ttl, err := resolveMX(domain)
+	if err == nil && len(records) == 0 {
+		err = fmt.Errorf("no MX records for %s", domain)
+	}
+	if err != nil {
+		mxCacheMu.Lock()
+		delete(mxCache, domain)
+		mxCacheMu.Unlock()
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Pref < records[j].Pref })
+
+	if maxTTL > 0 {
+		if ttl <= 0 || ttl > maxTTL {
+			ttl = maxTTL
+		}
+		mxCacheMu.Lock()
+		mxCache[domain] = mxEntry{records: records, expires: now.Add(ttl)}
+		mxCacheMu.Unlock()
+	}
+	return records, nil
+}
+
+// resolveMX 通过 DNS 查询 MX 记录并返回最小 TTL；无法直接查询时回退到系统解析器 (TTL 未知，返回 0)
+func resolveMX(domain string) ([]*net.MX, time.Duration, error) {
+	server, err := dnsServer()
+	if err == nil {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(domain), dns.TypeMX)
+		client := &dns.Client{Timeout: 5 * time.Second}
+		r, _, err := client.Exchange(m, server)
+		if err == nil && r.Truncated {
+			client.Net = "tcp"
+			r, _, err = client.Exchange(m, server)
+		}
+		if err == nil {
+			switch r.Rcode {
+			case dns.RcodeSuccess:
+				records, ttl := mxFromAnswer(r.Answer)
+				return records, ttl, nil
+			case dns.RcodeNameError:
+				return nil, 0, fmt.Errorf("lookup %s: no such host", domain)
+			}
+		}
+	}
+
+	records, err := net.LookupMX(domain)
+	return records, 0, err
+}
+
+// mxFromAnswer 提取应答中的 MX 记录及其最小 TTL
+func mxFromAnswer(answer []dns.RR) ([]*net.MX, time.Duration) {
+	var records []*net.MX
+	var minTTL uint32
+	for _, rr := range answer {
+		mx, ok := rr.(*dns.MX)
+		if !ok {
+			continue
+		}
+		records = append(records, &net.MX{Host: mx.Mx, Pref: mx.Preference})
+		if minTTL == 0 || mx.Hdr.Ttl < minTTL {
+			minTTL = mx.Hdr.Ttl
+		}
+	}
+	return records, time.Duration(minTTL) * time.Second
+}
+
+// dnsServer 返回直接 DNS 查询使用的解析器地址 (优先 dane_resolver，其次 /etc/resolv.conf)
+func dnsServer() (string, error) {
+	server := strings.TrimSpace(config.AppConfig.DANEResolver)
+	if server == "" {
+		cc, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil || len(cc.Servers) == 0 {
+			return "", fmt.Errorf("no DNS resolver available")
+		}
+		return net.JoinHostPort(cc.Servers[0], cc.Port), nil
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return server, nil
+}
@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// maxPartialDepth 局部模板嵌套引用的最大深度
+const maxPartialDepth = 5
+
+var (
+	// partialRefPattern 匹配 {{template "name" ...}} 引用 (名称只能是字符串常量)
+	partialRefPattern = regexp.MustCompile(`\{\{-?\s*template\s+"([^"]+)"`)
+	// escapedPartialRefPattern 经 HTML 净化后引号被转义的引用 ({{template &#34;name&#34; .}})
+	escapedPartialRefPattern = regexp.MustCompile(`(\{\{-?\s*template\s+)&#34;([^&"]+)&#34;`)
+	// unsafeTemplatePattern 禁止的模板指令：define/block 可覆盖或重定义其他模板
+	unsafeTemplatePattern = regexp.MustCompile(`(?i)\{\{-?\s*(define|block)\b`)
+)
+
+// ContainsUnsafeTemplateActions 检测模板中是否包含 {{define}}、{{block}} 等不允许的指令
+// {{template "name" .}} 用于引用模板库中的局部模板 (页眉、页脚等)，允许使用
+func ContainsUnsafeTemplateActions(tmpl string) bool {
+	return unsafeTemplatePattern.MatchString(tmpl)
+}
+
+// HasPartials 模板源码是否引用了其他模板
+func HasPartials(src string) bool {
+	return partialRefPattern.MatchString(src)
+}
+
+// partialRefs 返回模板源码引用的模板名 (按出现顺序去重)
+func partialRefs(src string) []string {
+	var names []string
+	for _, m := range partialRefPattern.FindAllStringSubmatch(src, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// loadPartial 按名称从模板库加载局部模板，同名时自定义模板优先于内置模板
+func loadPartial(name string) (string, bool) {
+	var tpl database.Template
+	if err := database.DB.Select("id", "body").Where("name = ?", name).Order("built_in asc, id asc").First(&tpl).Error; err != nil {
+		return "", false
+	}
+	return tpl.Body, true
+}
+
+// ParseTemplate 解析模板，并把其引用的局部模板 (逐级) 从模板库加载到同一模板集中
+// 引用缺失、循环引用或嵌套超过 maxPartialDepth 层时返回错误
+func ParseTemplate(name, src string) (*template.Template, error) {
+	return parseTemplateSet(name, src, loadPartial)
+}
+
+func parseTemplateSet(name, src string, load func(string) (string, bool)) (*template.Template, error) {
+	root, err := template.New(name).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	err = includePartials(name, src, load, func(ref, body string) error {
+		_, err := root.New(ref).Parse(body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// includePartials 逐级加载 src 引用的局部模板，并通过 add 加入调用方的模板集 (html/template 或 text/template)
+func includePartials(name, src string, load func(string) (string, bool), add func(ref, body string) error) error {
+	loaded := map[string]bool{name: true}
+
+	var include func(src string, chain []string) error
+	include = func(src string, chain []string) error {
+		for _, ref := range partialRefs(src) {
+			if slices.Contains(chain, ref) {
+				return fmt.Errorf("template %q includes itself: %s", ref, strings.Join(append(chain, ref), " -> "))
+			}
+			if len(chain) > maxPartialDepth {
+				return fmt.Errorf("partials nested deeper than %d levels: %s", maxPartialDepth, strings.Join(append(chain, ref), " -> "))
+			}
+			if loaded[ref] {
+				continue
+			}
+			body, ok := load(ref)
+			if !ok {
+				return fmt.Errorf("partial template %q not found", ref)
+			}
+			if ContainsUnsafeTemplateActions(body) {
+				return fmt.Errorf("partial template %q contains unsafe directives", ref)
+			}
+			if err := add(ref, body); err != nil {
+				return fmt.Errorf("partial template %q: %w", ref, err)
+			}
+			loaded[ref] = true
+			if err := include(body, append(chain, ref)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return include(src, []string{name})
+}
+
+// ExpandCampaignPartials 展开营销正文中引用的局部模板
+// 营销正文以 {name}/{email} 占位符逐封个性化，局部模板中的 {{.name}}/{{.email}} 会展开为对应占位符
+// 未引用局部模板时原样返回；启用 sanitize_html 时对展开结果重新净化
+func ExpandCampaignPartials(body string) (string, error) {
+	expanded, err := expandPartials(body, loadPartial)
+	if err != nil || expanded == body {
+		return expanded, err
+	}
+	if config.AppConfig.SanitizeHTML {
+		return SanitizeHTML(expanded), nil
+	}
+	return expanded, nil
+}
+
+// expandPartials 使用 text/template 展开局部模板
+// 展开结果仍是待替换占位符的 HTML 源码，不能按 html/template 做上下文转义：href 等属性中的 {email} 会被编码成 %7bemail%7d，
+// 逐封替换时无法再匹配；收件人数据在替换占位符时才转义 (见 PersonalizeCampaignBody)
+func expandPartials(body string, load func(string) (string, bool)) (string, error) {
+	// 保存时经过净化的正文中引号被转义，先还原引用语法
+	body = escapedPartialRefPattern.ReplaceAllString(body, `$1"$2"`)
+	if !HasPartials(body) {
+		return body, nil
+	}
+	if ContainsUnsafeTemplateActions(body) {
+		return "", fmt.Errorf("campaign body contains unsafe template directives")
+	}
+	root, err := texttemplate.New("campaign").Parse(body)
+	if err != nil {
+		return "", err
+	}
+	err = includePartials("campaign", body, load, func(ref, src string) error {
+		_, err := root.New(ref).Parse(src)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := root.Execute(&buf, map[string]string{"name": "{name}", "email": "{email}"}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
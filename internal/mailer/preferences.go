@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"goemail/internal/config"
+)
+
+// preferenceSignature 计算订阅偏好链接签名: HMAC-SHA256(JWTSecret, "preferences:<contactID>") 的前 128 位
+// 链接长期有效，修改 jwt_secret 会使所有已发出的链接失效
+func preferenceSignature(contactID uint) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	fmt.Fprintf(mac, "preferences:%d", contactID)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// PreferenceToken 生成标识联系人的订阅偏好令牌 (<contactID>.<签名>)
+func PreferenceToken(contactID uint) string {
+	return fmt.Sprintf("%d.%s", contactID, preferenceSignature(contactID))
+}
+
+// VerifyPreferenceToken 校验订阅偏好令牌，返回联系人 ID (签名使用常量时间比较)
+func VerifyPreferenceToken(token string) (uint, bool) {
+	idPart, sig, ok := strings.Cut(token, ".")
+	if !ok || sig == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(preferenceSignature(uint(id)))) {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// PreferenceURL 联系人的订阅偏好中心地址 (跨邮件长期有效)
+func PreferenceURL(contactID uint) string {
+	return fmt.Sprintf("%s/api/v1/track/manage/%s", trackingBaseURL(), PreferenceToken(contactID))
+}
@@ -1,12 +1,19 @@
 package mailer
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
+	"goemail/internal/config"
 	"goemail/internal/database"
+
+	"gorm.io/gorm"
 )
 
 const (
@@ -18,6 +25,24 @@ const (
 // workerSemaphore 控制最大并发 goroutine 数量
 var workerSemaphore = make(chan struct{}, WorkerPool)
 
+// workerID 当前进程的 Worker 标识 (主机名-进程号-随机后缀)，写入认领的队列任务
+var workerID = newWorkerID()
+
+func newWorkerID() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// visibilityTimeout 返回队列任务的可见性超时
+func visibilityTimeout() time.Duration {
+	if config.AppConfig.QueueVisibilityTimeout > 0 {
+		return time.Duration(config.AppConfig.QueueVisibilityTimeout) * time.Second
+	}
+	return 10 * time.Minute
+}
+
 // SendEmailAsync 将邮件请求加入队列
 func SendEmailAsync(req SendRequest) (uint, error) {
 	// 序列化附件
@@ -25,13 +50,42 @@ func SendEmailAsync(req SendRequest) (uint, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal attachments: %v", err)
 	}
+	headersJSON := ""
+	if len(req.Headers) > 0 {
+		data, err := json.Marshal(req.Headers)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal headers: %v", err)
+		}
+		headersJSON = string(data)
+	}
+	fallbackJSON := ""
+	if len(req.FallbackChannels) > 0 {
+		data, err := json.Marshal(req.FallbackChannels)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal fallback channels: %v", err)
+		}
+		fallbackJSON = string(data)
+	}
 
 	task := database.EmailQueue{
 		From:        req.From,
+		FromName:    req.FromName,
 		To:          req.To,
 		Subject:     req.Subject,
 		Body:        req.Body,
+		TextBody:    req.TextBody,
+		ICal:        req.ICal,
 		Attachments: string(attachmentsJSON),
+		Headers:     headersJSON,
+
+		FallbackChannels:      fallbackJSON,
+		AllowUnverifiedDomain: req.AllowUnverifiedDomain,
+		ChannelDomainOverride: req.ChannelDomainOverride,
+		SkipBCC:               req.SkipBCC,
+		SkipFooter:            req.SkipFooter,
+		MaxRetries:            req.MaxRetries,
+		EnvelopeFrom:          req.EnvelopeFrom,
+		BypassRecipientInterval: req.BypassRecipientInterval,
 		ChannelID:   req.ChannelID,
 		Status:      "pending",
 		Retries:     0,
@@ -45,6 +99,30 @@ func SendEmailAsync(req SendRequest) (uint, error) {
 	return task.ID, nil
 }
 
+// ErrWarmupCapReached 发件域名当日预热额度已用尽
+var ErrWarmupCapReached = fmt.Errorf("warmup daily cap reached")
+
+// SendEmailSync 不经过队列直接投递，与队列任务一样受域名预热额度限制
+func SendEmailSync(req SendRequest) error {
+	recipientDone := func(bool) {}
+	if !req.BypassRecipientInterval {
+		ok, next, done := reserveRecipientSlot(req.To, time.Now())
+		if !ok {
+			return fmt.Errorf("%w, retry after %s", ErrRecipientInterval, next.Format(time.RFC3339))
+		}
+		recipientDone = done
+	}
+	ok, retryAt, warmupDone := reserveWarmupSlot(req.From)
+	if !ok {
+		recipientDone(false)
+		return fmt.Errorf("%w, retry after %s", ErrWarmupCapReached, retryAt.Format(time.RFC3339))
+	}
+	err := SendEmail(req)
+	recipientDone(err == nil)
+	warmupDone(err == nil)
+	return err
+}
+
 // StartQueueWorker 启动后台队列处理器
 func StartQueueWorker() {
 	log.Println("Starting Email Queue Worker...")
@@ -63,9 +141,14 @@ func StartQueueWorker() {
 func processQueue() {
 	var tasks []database.EmailQueue
 	
-	// 查找待处理任务：Pending 或 Failed 且到达重试时间
+	// 查找待处理任务：Pending，或 Failed/Deferred 且到达重试时间
 	// 排除暂停中的 Campaign 的任务
 	now := time.Now()
+
+	// 回收认领后超时未续期的任务 (Worker 崩溃或进程被杀)
+	reclaimExpiredTasks(now)
+	// 超过最长存活时间的任务直接进入 dead
+	expireQueuedTasks(now)
 	
 	// 获取暂停中的 Campaign IDs
 	var pausedCampaignIDs []uint
@@ -74,8 +157,8 @@ func processQueue() {
 		Pluck("id", &pausedCampaignIDs)
 	
 	query := database.DB.Where(
-		"(status = 'pending') OR (status = 'failed' AND retries < ? AND next_retry <= ?)", 
-		MaxRetries, now,
+		"(status = 'pending') OR (status = 'failed' AND retries < CASE WHEN max_retries > 0 THEN max_retries ELSE ? END AND next_retry <= ?) OR (status = 'deferred' AND next_retry <= ?)", 
+		MaxRetries, now, now,
 	)
 	
 	// 排除暂停的 Campaign 的任务
@@ -96,60 +179,223 @@ func processQueue() {
 
 	for _, task := range tasks {
 		// 使用原子更新防止竞争条件
-		// 只有当 status 仍为 pending/failed 时才更新为 processing
+		// 只有当 status 仍为 pending/failed/deferred 时才更新为 processing
 		// 这可以防止多个 worker (如果部署了多个实例) 处理同一任务
 		result := database.DB.Model(&database.EmailQueue{}).
-			Where("id = ? AND (status = 'pending' OR status = 'failed')", task.ID).
-			Update("status", "processing")
+			Where("id = ? AND status IN ('pending', 'failed', 'deferred')", task.ID).
+			Updates(map[string]interface{}{
+				"status":     "processing",
+				"claimed_at": time.Now(),
+				"worker_id":  workerID,
+			})
 		
 		if result.RowsAffected == 0 {
 			continue // 已经被其他 worker 抢占
 		}
+		publishQueueStatus(task, "processing", "")
+
+		// 收件人频率限制：距上次发送未满最小间隔时顺延，不消耗重试次数 (先于预热检查，避免占用预热额度)
+		recipientDone := func(bool) {}
+		if !task.BypassRecipientInterval {
+			ok, next, done := reserveRecipientSlot(task.To, now)
+			if !ok {
+				msg := recipientIntervalMessage(next)
+				database.DB.Model(&task).Updates(map[string]interface{}{
+					"status":     "deferred",
+					"next_retry": next,
+					"error_msg":  msg,
+				})
+				publishQueueStatus(task, "deferred", msg)
+				continue
+			}
+			recipientDone = done
+		}
+
+		// 域名预热：当日额度用尽时顺延到次日，不消耗重试次数
+		ok, retryAt, warmupDone := reserveWarmupSlot(task.From)
+		if !ok {
+			recipientDone(false)
+			database.DB.Model(&task).Updates(map[string]interface{}{
+				"status":     "deferred",
+				"next_retry": retryAt,
+				"error_msg":  "warmup daily cap reached, deferred to next day",
+			})
+			publishQueueStatus(task, "deferred", "warmup daily cap reached, deferred to next day")
+			continue
+		}
 		
 		// 获取信号量槽位，限制最大并发数
 		t := task
 		workerSemaphore <- struct{}{}
 		go func(t database.EmailQueue) {
 			defer func() { <-workerSemaphore }() // 释放信号量
-			if err := executeTask(t); err != nil {
+			stop := startHeartbeat(t.ID)
+			err := executeTask(t)
+			close(stop)
+			recipientDone(err == nil)
+			warmupDone(err == nil)
+
+			// 仅在任务仍归属本 Worker 时回写结果，已被其他 Worker 回收的任务以对方结果为准
+			owned := database.DB.Model(&t).Where("worker_id = ? AND status = 'processing'", workerID)
+			if err != nil {
 				// 失败处理
 				newRetries := t.Retries + 1
 				status := "failed"
 				isFinalFailure := false
-				if newRetries >= MaxRetries {
+				if newRetries >= retryLimit(t) {
 					// 超过重试次数，永久失败
 					status = "dead"
 					isFinalFailure = true
 				}
 				
-				database.DB.Model(&t).Updates(map[string]interface{}{
-					"status":     status,
-					"retries":    newRetries,
-					"next_retry": time.Now().Add(RetryInterval * time.Duration(newRetries)),
-					"error_msg":  err.Error(),
+				hardBounce := isFinalFailure && IsHardBounce(err.Error())
+				result := owned.Updates(map[string]interface{}{
+					"status":      status,
+					"retries":     newRetries,
+					"next_retry":  time.Now().Add(RetryInterval * time.Duration(newRetries)),
+					"error_msg":   err.Error(),
+					"hard_bounce": hardBounce,
 				})
+				if result.RowsAffected == 0 {
+					log.Printf("[Queue] Task %d was reclaimed by another worker, result discarded: %v", t.ID, err)
+					return
+				}
+				publishQueueStatus(t, status, err.Error())
 
-				// 只有最终失败（超过重试次数）才计入统计
-				if isFinalFailure && t.CampaignID > 0 {
-					updateCampaignStats(t.CampaignID, false)
+				// 只有最终失败（超过重试次数）才计入统计并告警
+				if isFinalFailure {
+					t.Retries = newRetries
+					onDeadLetter(t, err.Error(), hardBounce)
 				}
 			} else {
 				// 成功
-				database.DB.Model(&t).Updates(map[string]interface{}{
+				result := owned.Updates(map[string]interface{}{
 					"status":    "completed",
 					"error_msg": "",
 				})
+				if result.RowsAffected == 0 {
+					log.Printf("[Queue] Task %d was reclaimed by another worker after it had been sent", t.ID)
+					return
+				}
+				publishQueueStatus(t, "completed", "")
+				ReleaseQueueAttachments([]uint{t.ID})
 
 				// 更新 Campaign 统计
 				if t.CampaignID > 0 {
 					updateCampaignStats(t.CampaignID, true)
 				}
+				updateForwardLogStatus(t.ID, "success", "")
 			}
 		}(t)
 	}
 }
 
+// ReleaseQueueAttachments 释放队列记录引用的本地附件 (引用计数减一)
+// 每条记录只释放一次：任务完成或进入 dead 时释放，清理队列记录时补充释放未释放过的记录
+func ReleaseQueueAttachments(ids []uint) {
+	var rows []database.EmailQueue
+	database.DB.Select("id", "attachments").
+		Where("id IN ? AND attachments_released = ? AND attachments LIKE ?", ids, false, "%local://%").
+		Find(&rows)
+
+	for _, row := range rows {
+		// 条件更新抢占释放权，避免完成回写与清理任务重复扣减
+		if database.DB.Model(&database.EmailQueue{}).
+			Where("id = ? AND attachments_released = ?", row.ID, false).
+			UpdateColumn("attachments_released", true).RowsAffected != 1 {
+			continue
+		}
+		var atts []struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(row.Attachments), &atts); err != nil {
+			continue
+		}
+		for _, att := range atts {
+			if !strings.HasPrefix(att.URL, "local://") {
+				continue
+			}
+			database.DB.Model(&database.AttachmentFile{}).
+				Where("file_path = ? AND content_hash <> '' AND ref_count > 0", strings.TrimPrefix(att.URL, "local://")).
+				UpdateColumn("ref_count", gorm.Expr("ref_count - ?", 1))
+		}
+	}
+}
+
+// retryLimit 返回任务的最大尝试次数 (任务未单独指定时使用全局 MaxRetries)
+func retryLimit(t database.EmailQueue) int {
+	if t.MaxRetries > 0 {
+		return t.MaxRetries
+	}
+	return MaxRetries
+}
+
+// startHeartbeat 定期续期任务的认领时间，避免耗时较长的发送被误判为超时
+// 关闭返回的 channel 即停止续期
+func startHeartbeat(taskID uint) chan struct{} {
+	stop := make(chan struct{})
+	interval := visibilityTimeout() / 3
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				database.DB.Model(&database.EmailQueue{}).
+					Where("id = ? AND worker_id = ? AND status = 'processing'", taskID, workerID).
+					Update("claimed_at", time.Now())
+			}
+		}
+	}()
+	return stop
+}
+
+// reclaimExpiredTasks 将超过可见性超时仍为 processing 的任务重新放回队列
+// 回收计为一次失败尝试 (进程可能在投递过程中崩溃)，超过重试次数则标记为 dead
+// 条件更新保证多个实例同时回收时只有一个生效；claimed_at 为空的任务来自旧版本，直接回收
+func reclaimExpiredTasks(now time.Time) {
+	cutoff := now.Add(-visibilityTimeout())
+	var stale []database.EmailQueue
+	database.DB.Where("status = 'processing' AND (claimed_at IS NULL OR claimed_at < ?)", cutoff).
+		Limit(100).Find(&stale)
+
+	for _, t := range stale {
+		newRetries := t.Retries + 1
+		status := "failed"
+		if newRetries >= retryLimit(t) {
+			status = "dead"
+		}
+		errMsg := fmt.Sprintf("visibility timeout expired (worker %s), reclaimed", t.WorkerID)
+		result := database.DB.Model(&database.EmailQueue{}).
+			Where("id = ? AND status = 'processing' AND (claimed_at IS NULL OR claimed_at < ?)", t.ID, cutoff).
+			Updates(map[string]interface{}{
+				"status":     status,
+				"retries":    gorm.Expr("retries + 1"),
+				"next_retry": now,
+				"error_msg":  errMsg,
+				"worker_id":  "",
+			})
+		if result.RowsAffected == 0 {
+			continue
+		}
+		log.Printf("[Queue] Task %d reclaimed from worker %q (status -> %s)", t.ID, t.WorkerID, status)
+		publishQueueStatus(t, status, errMsg)
+		if status == "dead" {
+			t.Retries = newRetries
+			onDeadLetter(t, errMsg, false)
+		}
+	}
+}
+
 func executeTask(task database.EmailQueue) error {
+	if task.SharedBody {
+		if err := assembleSharedBody(&task); err != nil {
+			return err
+		}
+	}
+
 	// 反序列化附件
 	var attachments []Attachment
 	if task.Attachments != "" {
@@ -157,21 +403,56 @@ func executeTask(task database.EmailQueue) error {
 			return fmt.Errorf("failed to unmarshal attachments: %v", err)
 		}
 	}
+	var headers map[string]string
+	if task.Headers != "" {
+		if err := json.Unmarshal([]byte(task.Headers), &headers); err != nil {
+			return fmt.Errorf("failed to unmarshal headers: %v", err)
+		}
+	}
+	var fallbackChannels []uint
+	if task.FallbackChannels != "" {
+		if err := json.Unmarshal([]byte(task.FallbackChannels), &fallbackChannels); err != nil {
+			return fmt.Errorf("failed to unmarshal fallback channels: %v", err)
+		}
+	}
 
 	req := SendRequest{
 		From:        task.From,
+		FromName:    task.FromName,
 		To:          task.To,
 		Subject:     task.Subject,
 		Body:        task.Body,
+		TextBody:    task.TextBody,
+		ICal:        task.ICal,
 		Attachments: attachments,
 		ChannelID:   task.ChannelID,
 		TrackingID:  task.TrackingID,
+		CampaignID:  task.CampaignID,
+		ContactID:   task.ContactID,
+		Headers:     headers,
+
+		FallbackChannels:      fallbackChannels,
+		AllowUnverifiedDomain: task.AllowUnverifiedDomain,
+		ChannelDomainOverride: task.ChannelDomainOverride,
+		SkipBCC:               task.SkipBCC,
+		SkipFooter:            task.SkipFooter,
+		EnvelopeFrom:          task.EnvelopeFrom,
 	}
 
 	// 调用同步发送逻辑
 	return SendEmail(req)
 }
 
+// updateForwardLogStatus 根据队列任务的最终结果回写关联的转发日志
+func updateForwardLogStatus(queueID uint, status, errMsg string) {
+	database.DB.Model(&database.ForwardLog{}).
+		Where("queue_id = ?", queueID).
+		Updates(map[string]interface{}{
+			"status":    status,
+			"error_msg": errMsg,
+		})
+}
+
 // updateCampaignStats 更新营销任务的统计数据
 func updateCampaignStats(campaignID uint, success bool) {
 	if campaignID == 0 {
@@ -214,7 +495,7 @@ func checkCampaignCompletion(campaignID uint) {
 	// 注意：failed 状态如果还有重试机会，不算完成；dead 状态才是最终失败
 	var pendingCount int64
 	database.DB.Model(&database.EmailQueue{}).
-		Where("campaign_id = ? AND status IN ('pending', 'processing')", campaignID).
+		Where("campaign_id = ? AND status IN ('pending', 'processing', 'deferred')", campaignID).
 		Count(&pendingCount)
 
 	// 检查是否有可重试的失败任务
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"testing"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReleaseQueueAttachmentsOnce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.EmailQueue{}, &database.AttachmentFile{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	file := database.AttachmentFile{FilePath: "data/uploads/a.pdf", ContentHash: "h", RefCount: 2}
+	db.Create(&file)
+	task := database.EmailQueue{To: "a@example.com", Status: "completed", Attachments: `[{"filename":"a.pdf","url":"local://data/uploads/a.pdf"}]`}
+	db.Create(&task)
+
+	// 任务完成时释放一次，之后清理同一记录不再重复扣减
+	ReleaseQueueAttachments([]uint{task.ID})
+	ReleaseQueueAttachments([]uint{task.ID})
+
+	db.First(&file, file.ID)
+	if file.RefCount != 1 {
+		t.Errorf("ref_count = %d, want 1", file.RefCount)
+	}
+	db.First(&task, task.ID)
+	if !task.AttachmentsReleased {
+		t.Error("task not marked as released")
+	}
+}
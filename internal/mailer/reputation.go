@@ -0,0 +1,195 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+	"goemail/internal/jobs"
+
+	"gorm.io/gorm/clause"
+)
+
+// ErrDomainReputationPaused 发件域名因退信率超标被自动暂停，需手动解除
+var ErrDomainReputationPaused = errors.New("sender domain paused by reputation protection")
+
+// reputationCheckInterval 信誉检查周期
+const reputationCheckInterval = 5 * time.Minute
+
+var reputationGuard = jobs.NewGuard("reputation check")
+
+// fromColumn email_queues.from 是 SQL 保留字，交由方言加引号
+var fromColumn = clause.Column{Name: "from"}
+
+// ReputationStats 域名在滚动窗口内的发送质量
+type ReputationStats struct {
+	Since              time.Time `json:"since"`               // 统计起点 (窗口起点与最近一次手动解除取较晚者)
+	Sent               int64     `json:"sent"`                // 发送成功数 + 同步硬退信数
+	Bounces            int64     `json:"bounces"`             // 硬退信数 (DSN 退信 + 投递时 5xx 拒绝)
+	BounceRate         float64   `json:"bounce_rate"`         // 硬退信率 (%)
+	Threshold          float64   `json:"threshold"`           // 域名配置的退信率阈值 (%)，0 表示不检查
+	Complaints         int64     `json:"complaints"`          // 投诉数 (FBL 反馈报告)
+	ComplaintRate      float64   `json:"complaint_rate"`      // 投诉率 (%)
+	ComplaintThreshold float64   `json:"complaint_threshold"` // 域名配置的投诉率阈值 (%)，0 表示不检查
+	MinSent            int64     `json:"min_sent"`            // 判定所需的最小发送量
+	Exceeded           bool      `json:"exceeded"`            // 样本足够且退信率或投诉率超过阈值
+}
+
+func reputationWindow() time.Duration {
+	if config.AppConfig.ReputationWindowHours > 0 {
+		return time.Duration(config.AppConfig.ReputationWindowHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func reputationMinSent() int64 {
+	if config.AppConfig.ReputationMinSent > 0 {
+		return int64(config.AppConfig.ReputationMinSent)
+	}
+	return 100
+}
+
+// bounceRateExceeded 样本量足够且退信率 (或投诉率) 超过阈值 (threshold 为百分比，0 表示不检查)
+func bounceRateExceeded(sent, bounces, minSent int64, threshold float64) bool {
+	if threshold <= 0 || sent <= 0 || sent < minSent {
+		return false
+	}
+	return float64(bounces)*100/float64(sent) > threshold
+}
+
+// DomainReputation 统计域名在滚动窗口内的硬退信率与投诉率
+// 发送量取发送日志中的成功记录，退信取退信邮箱解析出的硬退信 (DSN) 与投递时即被 5xx 拒绝的死信，投诉取退信邮箱收到的 ARF 反馈报告
+func DomainReputation(domain database.Domain, now time.Time) ReputationStats {
+	since := now.Add(-reputationWindow())
+	if domain.ReputationResumedAt != nil && domain.ReputationResumedAt.After(since) {
+		since = *domain.ReputationResumedAt
+	}
+	suffix := "%@" + strings.ToLower(domain.Name)
+
+	var delivered, rejected, dsn, complaints int64
+	database.DB.Model(&database.EmailLog{}).
+		Where("status = ? AND LOWER(from_addr) LIKE ? AND created_at >= ?", "success", suffix, since).
+		Count(&delivered)
+	database.DB.Model(&database.EmailQueue{}).
+		Where("status = ? AND hard_bounce = ? AND LOWER(?) LIKE ? AND updated_at >= ?", "dead", true, fromColumn, suffix, since).
+		Count(&rejected)
+	database.DB.Model(&database.Bounce{}).
+		Where("hard = ? AND LOWER(mailbox) LIKE ? AND created_at >= ?", true, suffix, since).
+		Count(&dsn)
+	database.DB.Model(&database.Complaint{}).
+		Where("LOWER(sender) LIKE ? AND created_at >= ?", suffix, since).
+		Count(&complaints)
+
+	stats := ReputationStats{
+		Since:     since,
+		Sent:      delivered + rejected,
+		Bounces:   rejected + dsn,
+		Threshold: domain.BounceThreshold,
+		MinSent:   reputationMinSent(),
+
+		Complaints:         complaints,
+		ComplaintThreshold: domain.ComplaintThreshold,
+	}
+	if stats.Sent > 0 {
+		stats.BounceRate = float64(stats.Bounces) * 100 / float64(stats.Sent)
+		stats.ComplaintRate = float64(stats.Complaints) * 100 / float64(stats.Sent)
+	}
+	stats.Exceeded = bounceRateExceeded(stats.Sent, stats.Bounces, stats.MinSent, stats.Threshold) ||
+		bounceRateExceeded(stats.Sent, stats.Complaints, stats.MinSent, stats.ComplaintThreshold)
+	return stats
+}
+
+// CheckDomainReputation 发件域名已被信誉保护暂停时返回 ErrDomainReputationPaused (启动/恢复营销任务前调用)
+func CheckDomainReputation(from string) error {
+	domainName := strings.ToLower(extractDomain(from))
+	if domainName == "" {
+		return nil
+	}
+	var domain database.Domain
+	if err := database.DB.Where("LOWER(name) = ?", domainName).First(&domain).Error; err != nil {
+		return nil
+	}
+	if domain.ReputationPausedAt != nil {
+		return fmt.Errorf("%w: %s (%s), resume the domain first", ErrDomainReputationPaused, domain.Name, domain.ReputationPauseReason)
+	}
+	return nil
+}
+
+// StartReputationMonitor 定期检查配置了退信率或投诉率阈值的域名，超标时暂停其营销任务并告警
+func StartReputationMonitor() {
+	ticker := time.NewTicker(reputationCheckInterval)
+	go func() {
+		for range ticker.C {
+			reputationGuard.Run(func() { checkDomainReputations(time.Now()) })
+		}
+	}()
+}
+
+func checkDomainReputations(now time.Time) {
+	var domains []database.Domain
+	database.DB.Where("(bounce_threshold > 0 OR complaint_threshold > 0) AND reputation_paused_at IS NULL").Find(&domains)
+	for _, domain := range domains {
+		stats := DomainReputation(domain, now)
+		if !stats.Exceeded {
+			continue
+		}
+		pauseDomainCampaigns(domain, stats, now)
+	}
+}
+
+// pauseDomainCampaigns 标记域名为暂停状态，并暂停该域名仍有待发邮件的营销任务 (队列 worker 跳过暂停任务的邮件)
+// 仅在域名由正常变为暂停时记录日志与告警，已处于暂停状态 (如其他实例已处理) 时直接返回
+func pauseDomainCampaigns(domain database.Domain, stats ReputationStats, now time.Time) {
+	reason := reputationPauseReason(stats)
+	transitioned := database.DB.Model(&database.Domain{}).
+		Where("id = ? AND reputation_paused_at IS NULL", domain.ID).
+		Updates(map[string]interface{}{
+			"reputation_paused_at":    now,
+			"reputation_pause_reason": reason,
+		}).RowsAffected
+	if transitioned == 0 {
+		return
+	}
+
+	var campaignIDs []uint
+	database.DB.Model(&database.EmailQueue{}).
+		Where("campaign_id > 0 AND status IN ? AND LOWER(?) LIKE ?",
+			[]string{"pending", "processing", "deferred", "failed"}, fromColumn, "%@"+strings.ToLower(domain.Name)).
+		Distinct().Pluck("campaign_id", &campaignIDs)
+	var paused int64
+	if len(campaignIDs) > 0 {
+		paused = database.DB.Model(&database.Campaign{}).
+			Where("id IN ? AND status = ?", campaignIDs, "processing").
+			Update("status", "paused").RowsAffected
+	}
+
+	log.Printf("[Reputation] Domain %s paused: %s, %d campaign(s) paused", domain.Name, reason, paused)
+	SendAlert("domain.reputation_paused", fmt.Sprintf("Domain %s paused: %s", domain.Name, reason), map[string]interface{}{
+		"domain":              domain.Name,
+		"bounce_rate":         stats.BounceRate,
+		"bounces":             stats.Bounces,
+		"sent":                stats.Sent,
+		"threshold":           stats.Threshold,
+		"complaints":          stats.Complaints,
+		"complaint_rate":      stats.ComplaintRate,
+		"complaint_threshold": stats.ComplaintThreshold,
+		"since":               stats.Since,
+		"paused_campaigns":    campaignIDs,
+	})
+}
+
+// reputationPauseReason 描述触发暂停的指标 (退信率与投诉率同时超标时一并列出)
+func reputationPauseReason(stats ReputationStats) string {
+	var parts []string
+	if bounceRateExceeded(stats.Sent, stats.Bounces, stats.MinSent, stats.Threshold) {
+		parts = append(parts, fmt.Sprintf("bounce rate %.2f%% (%d/%d) exceeded %.2f%%", stats.BounceRate, stats.Bounces, stats.Sent, stats.Threshold))
+	}
+	if bounceRateExceeded(stats.Sent, stats.Complaints, stats.MinSent, stats.ComplaintThreshold) {
+		parts = append(parts, fmt.Sprintf("complaint rate %.2f%% (%d/%d) exceeded %.2f%%", stats.ComplaintRate, stats.Complaints, stats.Sent, stats.ComplaintThreshold))
+	}
+	return strings.Join(parts, "; ")
+}
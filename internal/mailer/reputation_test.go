@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBounceRateExceeded(t *testing.T) {
+	cases := []struct {
+		sent, bounces, minSent int64
+		threshold              float64
+		want                   bool
+	}{
+		{1000, 60, 100, 5, true},
+		{1000, 50, 100, 5, false},  // 恰好等于阈值不触发
+		{50, 40, 100, 5, false},    // 样本不足
+		{1000, 900, 100, 0, false}, // 未配置阈值
+		{0, 0, 0, 5, false},
+	}
+	for _, tc := range cases {
+		if got := bounceRateExceeded(tc.sent, tc.bounces, tc.minSent, tc.threshold); got != tc.want {
+			t.Errorf("bounceRateExceeded(%d, %d, %d, %v) = %v, want %v", tc.sent, tc.bounces, tc.minSent, tc.threshold, got, tc.want)
+		}
+	}
+}
+
+func TestPauseDomainCampaignsOnlyOnTransition(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&database.Domain{}, &database.Campaign{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	// 域名已被暂停 (如另一轮检查已处理)：不覆盖原因、不重复暂停任务
+	pausedAt := time.Now().Add(-time.Hour)
+	domain := database.Domain{Name: "example.com", ReputationPausedAt: &pausedAt, ReputationPauseReason: "earlier"}
+	db.Create(&domain)
+	domain.ReputationPausedAt = nil
+	pauseDomainCampaigns(domain, ReputationStats{BounceRate: 9, Bounces: 9, Sent: 100, Threshold: 5}, time.Now())
+
+	var got database.Domain
+	db.First(&got, domain.ID)
+	if got.ReputationPauseReason != "earlier" {
+		t.Errorf("pause reason = %q, want unchanged", got.ReputationPauseReason)
+	}
+}
+
+func TestDomainReputationCountsComplaints(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&database.EmailLog{}, &database.EmailQueue{}, &database.Bounce{}, &database.Complaint{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	for i := 0; i < 100; i++ {
+		db.Create(&database.EmailLog{Status: "success", FromAddr: "news@Example.com"})
+	}
+	for i := 0; i < 2; i++ {
+		db.Create(&database.Complaint{Sender: "bounce+t1@example.com", Recipient: "u@isp.example"})
+	}
+	db.Create(&database.Complaint{Sender: "news@other.example"})
+
+	domain := database.Domain{Name: "example.com", ComplaintThreshold: 1}
+	stats := DomainReputation(domain, time.Now())
+	if stats.Complaints != 2 || stats.ComplaintRate != 2 || !stats.Exceeded {
+		t.Fatalf("stats = %+v, want 2 complaints (2%%) exceeding 1%%", stats)
+	}
+	if reason := reputationPauseReason(stats); !strings.HasPrefix(reason, "complaint rate 2.00%") {
+		t.Errorf("pause reason = %q", reason)
+	}
+
+	domain.ComplaintThreshold = 5
+	if DomainReputation(domain, time.Now()).Exceeded {
+		t.Error("complaint rate below the threshold should not pause")
+	}
+}
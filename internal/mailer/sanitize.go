@@ -0,0 +1,147 @@
+package mailer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// sanitizeAllowedTags 邮件 HTML 净化保留的标签 (常见排版与表格布局)
+var sanitizeAllowedTags = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true,
+	"a": true, "abbr": true, "b": true, "blockquote": true, "br": true, "center": true, "code": true,
+	"div": true, "em": true, "font": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"hr": true, "i": true, "img": true, "li": true, "ol": true, "p": true, "pre": true, "s": true,
+	"small": true, "span": true, "strong": true, "sub": true, "sup": true, "u": true, "ul": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	"caption": true, "col": true, "colgroup": true,
+}
+
+// sanitizeDropContent 连同内容一起丢弃的标签
+// <style> 中的选择器作用于整个页面，在 Web 邮件预览中会改写外层界面的样式，仅保留行内 style 属性
+var sanitizeDropContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "applet": true,
+	"svg": true, "math": true, "noscript": true, "template": true, "frameset": true, "frame": true,
+}
+
+// sanitizeAllowedAttrs 保留的属性 (事件处理器 on* 等一律丢弃)
+// 不保留 http-equiv：<meta http-equiv="refresh"> 可在预览时跳转到任意地址，charset 与 viewport 不受影响
+var sanitizeAllowedAttrs = map[string]bool{
+	"href": true, "src": true, "alt": true, "title": true, "width": true, "height": true,
+	"style": true, "class": true, "id": true, "align": true, "valign": true, "border": true,
+	"cellpadding": true, "cellspacing": true, "bgcolor": true, "color": true, "colspan": true,
+	"rowspan": true, "target": true, "dir": true, "lang": true, "face": true, "size": true,
+	"charset": true, "content": true, "name": true,
+}
+
+// SanitizeHTML 按白名单净化邮件 HTML：移除脚本类元素、事件属性、注释以及 javascript: 等危险链接
+// 用于营销与模板正文，可信的事务邮件 HTML 不经过此处理
+func SanitizeHTML(body string) string {
+	z := html.NewTokenizer(strings.NewReader(body))
+	var b strings.Builder
+	skip := 0 // 位于需整体丢弃的元素内部时的嵌套深度
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			b.WriteString(html.EscapeString(string(z.Text())))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if sanitizeDropContent[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 || !sanitizeAllowedTags[tok.Data] {
+				continue
+			}
+			writeSanitizedTag(&b, tok, tt == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			tok := z.Token()
+			if sanitizeDropContent[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 || !sanitizeAllowedTags[tok.Data] {
+				continue
+			}
+			b.WriteString("</" + tok.Data + ">")
+		case html.DoctypeToken:
+			if skip == 0 {
+				b.Write(z.Raw())
+			}
+		case html.CommentToken:
+			// 注释 (含 Outlook 条件注释) 一律丢弃
+		}
+	}
+}
+
+func writeSanitizedTag(b *strings.Builder, tok html.Token, selfClosing bool) {
+	b.WriteString("<" + tok.Data)
+	for _, attr := range tok.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !sanitizeAllowedAttrs[key] {
+			continue
+		}
+		switch key {
+		case "href":
+			if !safeURL(attr.Val, false) {
+				continue
+			}
+		case "src":
+			if !safeURL(attr.Val, true) {
+				continue
+			}
+		case "style":
+			if !safeStyle(attr.Val) {
+				continue
+			}
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	if selfClosing {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+}
+
+// safeURL 仅允许相对地址及 http/https/mailto/tel/cid 协议，allowDataImage 时另外允许 data:image/
+func safeURL(value string, allowDataImage bool) bool {
+	// 去除空白与控制字符，防止 "java\tscript:" 之类的绕过
+	u := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, value))
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true // 相对地址
+	}
+	switch u[:i] {
+	case "http", "https", "mailto", "tel", "cid":
+		return true
+	case "data":
+		return allowDataImage && strings.HasPrefix(u, "data:image/") && !strings.HasPrefix(u, "data:image/svg")
+	}
+	return false
+}
+
+// safeStyle 拒绝可执行脚本的 CSS (IE expression、behavior、javascript: 链接等)
+func safeStyle(value string) bool {
+	v := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	for _, bad := range []string{"expression(", "javascript:", "vbscript:", "behavior:", "-moz-binding", "@import"} {
+		if strings.Contains(v, bad) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package mailer
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"script", `<p>Hi</p><script>alert(1)</script><p>Bye</p>`, `<p>Hi</p><p>Bye</p>`},
+		{"event handler", `<img src="https://example.com/a.png" onerror="alert(1)" alt="a">`, `<img src="https://example.com/a.png" alt="a">`},
+		{"javascript href", `<a href=" java	script:alert(1)">x</a>`, `<a>x</a>`},
+		{"relative and mailto", `<a href="/u?id=1">u</a><a href="mailto:a@b.c">m</a>`, `<a href="/u?id=1">u</a><a href="mailto:a@b.c">m</a>`},
+		{"data image", `<img src="data:image/png;base64,AA"><img src="data:text/html,x">`, `<img src="data:image/png;base64,AA"><img>`},
+		{"style attr", `<div style="width:expression(alert(1))">x</div><div style="color:red">y</div>`, `<div>x</div><div style="color:red">y</div>`},
+		{"style block dropped", `<style>body { display: none }</style><p style="color:red">x</p>`, `<p style="color:red">x</p>`},
+		{"unknown tag unwrapped", `<form action="/x"><b>bold</b></form>`, `<b>bold</b>`},
+		{"nested drop", `<svg><svg></svg><text>inner</text></svg>after`, `after`},
+		{"comment", `<!--[if mso]><table><![endif]-->ok`, `ok`},
+		{"meta refresh", `<meta charset="utf-8"><meta http-equiv="refresh" content="0;url=https://evil.example">`, `<meta charset="utf-8"><meta content="0;url=https://evil.example">`},
+		{"text escaped", `a &lt;b&gt; &amp; c`, `a &lt;b&gt; &amp; c`},
+	}
+	for _, c := range cases {
+		if got := SanitizeHTML(c.in); got != c.want {
+			t.Errorf("%s: SanitizeHTML() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
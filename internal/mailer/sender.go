@@ -2,18 +2,24 @@ package mailer
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +29,7 @@ import (
 	"goemail/internal/security"
 
 	"github.com/emersion/go-msgauth/dkim"
+	"github.com/miekg/dns"
 	"github.com/wneessen/go-mail"
 )
 
@@ -37,34 +44,302 @@ type Attachment struct {
 // SendRequest 定义发送请求结构
 type SendRequest struct {
 	From        string                 `json:"from"`
+	FromName    string                 `json:"from_name"` // 发件人显示名称，为空时使用全局默认
 	To          string                 `json:"to"`
 	Subject     string                 `json:"subject"`
 	Body        string                 `json:"body"`
+	TextBody    string                 `json:"text_body"` // 纯文本备选正文，非空时以 multipart/alternative 发送
+	ICal        string                 `json:"ical"`      // iCalendar 会议邀请内容，非空时附加 text/calendar 部分
 	Attachments []Attachment           `json:"attachments"`
 	ChannelID   uint                   `json:"channel_id"` // 0 = Direct, >0 = SMTP Config ID
 	TemplateID  uint                   `json:"template_id"`
 	Variables   map[string]interface{} `json:"variables"`
 	TrackingID  string                 `json:"tracking_id"` // 用于追踪
+	CampaignID  uint                   `json:"-"`           // 所属营销任务 (由队列填充)
+	ContactID   uint                   `json:"-"`           // 关联的联系人 (由队列填充)
+
+	FallbackChannels []uint `json:"fallback_channels"`  // 主通道临时失败时依次尝试的备用通道，为空时使用全局配置
+	SenderIdentityID uint   `json:"sender_identity_id"` // 发件人身份 ID，非 0 时以该身份的名称与地址覆盖 from/from_name
+
+	AllowUnverifiedDomain bool `json:"allow_unverified_domain"` // 跳过发件域名验证检查 (测试用)
+	SkipBCC               bool `json:"skip_bcc"`                // 本次发送不附加归档 BCC
+	SkipFooter            bool `json:"skip_footer"`             // 本次发送不注入域名页脚 (营销邮件无效)
+	DryRun                bool `json:"dry_run"`                 // 仅构建并返回原始邮件，不加入队列
+	Sync                  bool `json:"sync"`                    // 在请求内同步投递并返回结果，不经过队列
+
+	MaxRetries   int    `json:"-"` // 队列最大尝试次数，0 表示使用全局默认 (由转发等内部调用方填充)
+	OriginalTo   string `json:"-"` // 测试沙箱改投前的原收件人
+	EnvelopeFrom string `json:"-"` // 信封发件人 (MAIL FROM)，为空时与 From 相同 (转发改写为 VERP 退信地址时填充)
+
+	Headers map[string]string `json:"-"` // 附加邮件头，仅供告警、摘要、转发等内部邮件使用，API 请求不可设置
+
+	ChannelDomainOverride string `json:"-"` // 非空时跳过 From 域名与通道匹配检查，内容为原因 (写入审计日志)
+
+	TriedChannels   string `json:"-"` // 故障转移时依次尝试的通道 (如 smtp_1,smtp_3)，随最终结果写入发送日志
+	DeferFailureLog bool   `json:"-"` // 故障转移中的单次尝试失败时不写日志，由 sendWithFallback 的调用方记录最终结果
+
+	BypassRecipientInterval bool `json:"bypass_recipient_interval"` // 关键事务邮件 (验证码、密码重置等) 不受收件人最小发送间隔限制
+}
+
+// reservedHeaders 由系统生成、不允许通过自定义头覆盖的邮件头
+var reservedHeaders = map[string]bool{
+	"from": true, "to": true, "cc": true, "bcc": true, "subject": true,
+	"date": true, "message-id": true, "mime-version": true,
+	"content-type": true, "content-transfer-encoding": true, "dkim-signature": true,
+}
+
+// ValidateHeaders 校验发信请求中会写入邮件头的字段，防止 CR/LF 头注入
+func ValidateHeaders(req SendRequest) error {
+	fields := map[string]string{
+		"from":      req.From,
+		"from_name": req.FromName,
+		"to":        req.To,
+		"subject":   req.Subject,
+
+		"envelope_from": req.EnvelopeFrom,
+	}
+	for name, value := range fields {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s contains line break", name)
+		}
+	}
+	for name, value := range req.Headers {
+		if !isValidHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if reservedHeaders[strings.ToLower(name)] {
+			return fmt.Errorf("header %s cannot be overridden", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s contains line break", name)
+		}
+	}
+	return nil
+}
+
+// isValidHeaderName 检查邮件头名称是否仅包含可见 ASCII 字符 (不含冒号)
+func isValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= 32 || r >= 127 || r == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeHeaderValue 移除邮件头值中的 CR/LF (用于内部来源的数据，如转发邮件的主题)
+func sanitizeHeaderValue(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// MaxAttachmentDownloadSize 远程附件最大下载大小 (10MB)
+const MaxAttachmentDownloadSize = 10 * 1024 * 1024
+
+// ErrBlockedURL 附件 URL 指向内网
+var ErrBlockedURL = fmt.Errorf("access to internal network is blocked")
+
+// FetchRemoteAttachment 下载远程附件
+// 带连接/整体超时，超过 MaxAttachmentDownloadSize 直接报错 (不截断)，每次下载都做 SSRF 检查
+// 实际连接使用 SafeDialContext 固定到已校验的 IP (含重定向)
+func FetchRemoteAttachment(url string) ([]byte, error) {
+	if security.IsInternalURL(url) {
+		return nil, ErrBlockedURL
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:           security.SafeDialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > MaxAttachmentDownloadSize {
+		return nil, fmt.Errorf("attachment exceeds limit (%d bytes)", MaxAttachmentDownloadSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxAttachmentDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxAttachmentDownloadSize {
+		return nil, fmt.Errorf("attachment exceeds limit (%d bytes)", MaxAttachmentDownloadSize)
+	}
+	return data, nil
 }
 
 // SendEmail 统一发送入口
 func SendEmail(req SendRequest) error {
+	// 测试沙箱：改投测试地址，或照常构建邮件后直接丢弃 (仍写发送日志)
+	sink := sinkMode()
+	if sink == sinkRedirect {
+		applySinkRedirect(&req)
+	}
+	fromAddr, msgBytes, _, err := buildMessage(&req, func(reason string, err error) error {
+		return logAndReturnError(req, reason, err)
+	})
+	if err != nil {
+		return err
+	}
+	if sink == sinkDrop {
+		log.Printf("[Mailer] Sink mode: dropped message to %s", req.To)
+		logSuccess(req, "sink", msgBytes)
+		return nil
+	}
+
+	// 5. 选择发送通道 (含故障转移)
+	channels, direct := sendRoute(req)
+	if !direct {
+		// 指定通道，临时失败时依次尝试备用通道
+		last, err := sendWithFallback(req, fromAddr, msgBytes, channels)
+		if err != nil {
+			logFailure(last, err.Error())
+		}
+		return err
+	}
+	// 自动路由：优先尝试默认通道及备用通道，失败则尝试 Direct
+	if len(channels) > 0 {
+		last, err := sendWithFallback(req, fromAddr, msgBytes, channels)
+		if err == nil {
+			return nil
+		}
+		if !isTransientSendError(err) {
+			logFailure(last, err.Error())
+			return err // 收件方明确拒绝，换 Direct 也无意义
+		}
+		// 中继通道均失败，继续尝试 Direct (Direct 的结果连同已尝试的通道记录为一条日志)
+		req.TriedChannels = last.TriedChannels + ",direct"
+	}
+	// Direct Send
+	return sendByDirect(req, fromAddr, req.To, msgBytes)
+}
+
+// PreviewResult 试运行结果：完整的原始邮件及将使用的信封与路由
+type PreviewResult struct {
+	MailFrom   string   `json:"mail_from"`
+	RcptTo     []string `json:"rcpt_to"`
+	Channels   []uint   `json:"channels"`    // 依次尝试的中继通道
+	Direct     bool     `json:"direct"`      // 中继不可用时是否直连投递
+	Sink       string   `json:"sink,omitempty"` // 生效的测试沙箱模式 (redirect / drop)
+	DKIMSigned bool     `json:"dkim_signed"` // 是否已完成 DKIM 签名
+	Size       int      `json:"size"`
+	Raw        string   `json:"raw"`
+}
+
+// PreviewEmail 按真实发送流程构建邮件 (含页脚、附件与 DKIM 签名)，但不投递也不写发送日志
+func PreviewEmail(req SendRequest) (*PreviewResult, error) {
+	sink := sinkMode()
+	if sink == sinkRedirect {
+		applySinkRedirect(&req)
+	}
+	fromAddr, msgBytes, signed, err := buildMessage(&req, func(reason string, err error) error {
+		return fmt.Errorf("%s: %w", reason, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rcptTo := []string{req.To}
+	if bcc := archiveBCC(req); bcc != "" {
+		rcptTo = append(rcptTo, bcc)
+	}
+	channels, direct := sendRoute(req)
+	return &PreviewResult{
+		MailFrom:   fromAddr,
+		RcptTo:     rcptTo,
+		Channels:   channels,
+		Direct:     direct,
+		Sink:       sink,
+		DKIMSigned: signed,
+		Size:       len(msgBytes),
+		Raw:        string(msgBytes),
+	}, nil
+}
+
+// sendRoute 返回依次尝试的中继通道，以及是否允许直连投递 (未指定通道时)
+func sendRoute(req SendRequest) ([]uint, bool) {
+	if req.ChannelID > 0 {
+		return append([]uint{req.ChannelID}, fallbackChannels(req)...), false
+	}
+	var channels []uint
+	var defaultSMTP database.SMTPConfig
+	if err := database.DB.Where("is_default = ?", true).First(&defaultSMTP).Error; err == nil {
+		channels = append(channels, defaultSMTP.ID)
+	}
+	return append(channels, fallbackChannels(req)...), true
+}
+
+// buildMessage 构建并签名 MIME 消息，返回信封发件人、原始字节及是否已 DKIM 签名
+// 会就地清理/补全 req (主题、页脚等)；fail 决定错误的记录方式
+func buildMessage(req *SendRequest, fail func(reason string, err error) error) (string, []byte, bool, error) {
 	// 1. 准备发件人
+	// 地址类字段出现换行一律拒绝；主题、显示名称来自内部数据时仅做清理
+	req.Subject = sanitizeHeaderValue(req.Subject)
+	req.FromName = sanitizeHeaderValue(req.FromName)
+	if err := ValidateHeaders(*req); err != nil {
+		return "", nil, false, fail("header_injection", err)
+	}
+
 	fromAddr := req.From
 	if fromAddr == "" {
 		fromAddr = fmt.Sprintf("noreply@%s", config.AppConfig.Domain)
 	}
+	if !req.AllowUnverifiedDomain {
+		if err := CheckSenderDomain(fromAddr); err != nil {
+			return "", nil, false, fail("unverified_sender_domain", err)
+		}
+	}
+	fromName := req.FromName
+	if fromName == "" {
+		fromName = config.AppConfig.DefaultFromName
+	}
+	// 注入域名页脚 (必须在构建消息与 DKIM 签名之前)
+	applyDomainFooter(req, fromAddr)
 
 	// 2. 使用 go-mail 构建标准 MIME 消息
 	m := mail.NewMsg()
-	if err := m.From(fromAddr); err != nil {
-		return logAndReturnError(req, "invalid_from", err)
+	if fromName != "" {
+		if err := m.FromFormat(fromName, fromAddr); err != nil {
+			return "", nil, false, fail("invalid_from", err)
+		}
+	} else if err := m.From(fromAddr); err != nil {
+		return "", nil, false, fail("invalid_from", err)
 	}
 	if err := m.To(req.To); err != nil {
-		return logAndReturnError(req, "invalid_to", err)
+		return "", nil, false, fail("invalid_to", err)
 	}
 	m.Subject(req.Subject)
-	m.SetBodyString(mail.TypeTextHTML, req.Body)
+	for name, value := range req.Headers {
+		m.SetGenHeader(mail.Header(name), value)
+	}
+	if req.TextBody != "" {
+		// 纯文本在前、HTML 在后，客户端优先展示最后一个可识别的部分
+		m.SetBodyString(mail.TypeTextPlain, req.TextBody)
+		m.AddAlternativeString(mail.TypeTextHTML, req.Body)
+	} else {
+		m.SetBodyString(mail.TypeTextHTML, req.Body)
+	}
+	if req.ICal != "" {
+		// 会议邀请作为 alternative 的最后一部分，客户端据此显示"添加到日历"
+		icalContent, method, err := prepareICal(req.ICal)
+		if err != nil {
+			return "", nil, false, fail("invalid_ical", err)
+		}
+		m.AddAlternativeString(mail.ContentType("text/calendar; method="+method), icalContent)
+	}
 	m.SetDate()      // 显式设置日期，确保签名时一致
 	m.SetMessageID() // 显式设置 Message-ID
 
@@ -77,7 +352,7 @@ func SendEmail(req SendRequest) error {
 			// 1. 优先使用 Base64 内容
 			data, err = base64.StdEncoding.DecodeString(att.Content)
 			if err != nil {
-				return logAndReturnError(req, "invalid_attachment_base64", err)
+				return "", nil, false, fail("invalid_attachment_base64", err)
 			}
 		} else if att.URL != "" {
 			// 2. 检查是否为本地文件 (由 Handler 预处理并保存)
@@ -92,69 +367,39 @@ func SendEmail(req SendRequest) error {
 				allowedDir, _ := filepath.Abs("data/uploads")
 				absPath, err := filepath.Abs(localPath)
 				if err != nil || !strings.HasPrefix(absPath, allowedDir) {
-					return logAndReturnError(req, fmt.Sprintf("blocked_path_traversal: %s", localPath), fmt.Errorf("access to path outside allowed directory is blocked"))
+					return "", nil, false, fail(fmt.Sprintf("blocked_path_traversal: %s", localPath), fmt.Errorf("access to path outside allowed directory is blocked"))
 				}
 
-				// 读取本地文件
-				fileData, err := os.ReadFile(absPath)
-				if err != nil {
-					return logAndReturnError(req, fmt.Sprintf("failed_read_local_attachment: %s", localPath), err)
+				// 本地文件在生成邮件时直接从磁盘流式编码，不预先读入内存
+				if _, err := os.Stat(absPath); err != nil {
+					return "", nil, false, fail(fmt.Sprintf("failed_read_local_attachment: %s", localPath), err)
 				}
-				data = fileData
+				m.AttachFile(absPath, mail.WithFileName(att.Filename), mail.WithFileContentType(attachmentContentType(att)))
+				continue
 			} else {
-				// 3. 尝试从远程 URL 下载 (SSRF 防护)
-				// 创建安全的 HTTP Client
-				client := &http.Client{
-					Timeout: 10 * time.Second,
-					Transport: &http.Transport{
-						DialContext: (&net.Dialer{
-							Timeout:   5 * time.Second,
-							KeepAlive: 30 * time.Second,
-						}).DialContext,
-					},
-				}
-
-			// 检查 URL 是否指向内网
-			if security.IsInternalURL(att.URL) {
-					return logAndReturnError(req, fmt.Sprintf("blocked_internal_url: %s", att.URL), fmt.Errorf("access to internal network is blocked"))
-				}
-
-				resp, err := client.Get(att.URL)
-				if err != nil {
-					return logAndReturnError(req, fmt.Sprintf("failed_download_attachment: %s", att.URL), err)
-				}
-				defer resp.Body.Close()
-				
-				if resp.StatusCode != http.StatusOK {
-					return logAndReturnError(req, fmt.Sprintf("failed_download_attachment_status_%d", resp.StatusCode), fmt.Errorf("status %d", resp.StatusCode))
+				// 3. 尝试从远程 URL 下载 (SSRF 防护，队列重试时也会重新校验)
+				data, err = FetchRemoteAttachment(att.URL)
+				if err == ErrBlockedURL {
+					return "", nil, false, fail(fmt.Sprintf("blocked_internal_url: %s", att.URL), err)
 				}
-				
-				// 限制大小 (例如 10MB)
-				const MaxDownloadSize = 10 * 1024 * 1024
-				data, err = io.ReadAll(io.LimitReader(resp.Body, MaxDownloadSize))
 				if err != nil {
-					return logAndReturnError(req, "failed_read_attachment_body", err)
+					return "", nil, false, fail(fmt.Sprintf("failed_download_attachment: %s", att.URL), err)
 				}
 			}
 		} else {
 			continue // 跳过无效附件
 		}
 		
-		// 自动推断 ContentType 或使用提供的
-		contentType := mail.TypeAppOctetStream
-		if att.ContentType != "" {
-			contentType = mail.ContentType(att.ContentType)
-		}
-		
-		m.AttachReader(att.Filename, bytes.NewReader(data), mail.WithFileContentType(contentType))
+		m.AttachReadSeeker(att.Filename, bytes.NewReader(data), mail.WithFileContentType(attachmentContentType(att)))
 	}
 
 	// 3. 获取原始字节流
 	var msgBuffer bytes.Buffer
 	if _, err := m.WriteTo(&msgBuffer); err != nil {
-		return logAndReturnError(req, "msg_build_failed", err)
+		return "", nil, false, fail("msg_build_failed", err)
 	}
 	msgBytes := msgBuffer.Bytes()
+	signed := false
 
 	// 4. DKIM 签名 (仅当 Direct Send 时，且配置了域名私钥)
 	senderDomain := extractDomain(fromAddr)
@@ -191,6 +436,7 @@ func SendEmail(req SendRequest) error {
 					// 注意：dkim.Sign 函数签名通常是 Sign(w io.Writer, r io.Reader, options *SignOptions) error
 					if err := dkim.Sign(&signedBuffer, bytes.NewReader(msgBytes), options); err == nil {
 						msgBytes = signedBuffer.Bytes() // 替换为已签名内容
+						signed = true
 					} else {
 						// 记录 DKIM 签名失败，但不阻止发送
 						// 在实际生产中应该记录到日志文件
@@ -201,22 +447,118 @@ func SendEmail(req SendRequest) error {
 		}
 	}
 
-	// 5. 选择发送通道 (含故障转移)
-	if req.ChannelID > 0 {
-		// 指定通道
-		return sendByRelay(req, fromAddr, req.To, msgBytes, req.ChannelID)
-	} else {
-		// 自动路由：优先尝试默认通道，失败则尝试 Direct
-		var defaultSMTP database.SMTPConfig
-		if err := database.DB.Where("is_default = ?", true).First(&defaultSMTP).Error; err == nil {
-			if err := sendWithSMTPConfig(req, fromAddr, req.To, msgBytes, defaultSMTP); err == nil {
-				return nil
+	if req.EnvelopeFrom != "" {
+		return req.EnvelopeFrom, msgBytes, signed, nil
+	}
+	return fromAddr, msgBytes, signed, nil
+}
+
+// CheckSenderDomain 启用 RequireVerifiedDomain 时，要求发件域名已添加且 SPF、DKIM 均已验证
+func CheckSenderDomain(from string) error {
+	if !config.AppConfig.RequireVerifiedDomain {
+		return nil
+	}
+	return VerifySenderDomain(from)
+}
+
+// VerifySenderDomain 检查发件域名是否已添加且 SPF、DKIM 均已验证 (不受 RequireVerifiedDomain 影响)
+func VerifySenderDomain(from string) error {
+	domain, err := LookupSenderDomain(from)
+	if err != nil {
+		return err
+	}
+	if !domain.SPFVerified || !domain.DKIMVerified {
+		return fmt.Errorf("sender domain %s is not verified (SPF: %v, DKIM: %v)", domain.Name, domain.SPFVerified, domain.DKIMVerified)
+	}
+	return nil
+}
+
+// LookupSenderDomain 返回发件地址所属的已配置域名 (不检查验证状态)
+func LookupSenderDomain(from string) (*database.Domain, error) {
+	domainName := strings.ToLower(extractDomain(from))
+	if domainName == "" {
+		return nil, fmt.Errorf("invalid sender address %s", from)
+	}
+
+	var domain database.Domain
+	if err := database.DB.Where("LOWER(name) = ?", domainName).First(&domain).Error; err != nil {
+		return nil, fmt.Errorf("sender domain %s is not configured", domainName)
+	}
+	return &domain, nil
+}
+
+// ResolveSender 加载发件人身份，并确认其所属域名在发送时仍已验证
+func ResolveSender(id uint) (*database.Sender, error) {
+	var sender database.Sender
+	if err := database.DB.First(&sender, id).Error; err != nil {
+		return nil, fmt.Errorf("sender %d not found", id)
+	}
+	if err := VerifySenderDomain(sender.Email); err != nil {
+		return nil, fmt.Errorf("sender %s cannot be used: %w", sender.Email, err)
+	}
+	return &sender, nil
+}
+
+// fallbackChannels 返回本次发送的备用通道列表 (请求优先，其次全局配置)
+func fallbackChannels(req SendRequest) []uint {
+	if len(req.FallbackChannels) > 0 {
+		return req.FallbackChannels
+	}
+	return config.AppConfig.FallbackChannelIDs
+}
+
+// sendWithFallback 按顺序尝试各中继通道，遇到临时错误切换下一个通道
+// 永久性拒绝 (5xx) 直接返回，避免在其他通道重复被拒；成功通道记录在发送日志的 channel 字段中
+// 各次尝试的失败不单独写日志：成功时写一条成功日志，失败时返回最后一次尝试的请求，由调用方记录最终结果
+func sendWithFallback(req SendRequest, from string, msg []byte, channels []uint) (SendRequest, error) {
+	var lastErr error
+	last := req
+	var tried []string
+	seen := make(map[uint]bool, len(channels))
+	for _, id := range channels {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		tried = append(tried, fmt.Sprintf("smtp_%d", id))
+
+		attempt := req
+		attempt.ChannelID = id
+		attempt.TriedChannels = strings.Join(tried, ",")
+		attempt.DeferFailureLog = true
+		last = attempt
+		err := sendByRelay(attempt, from, req.To, msg, id)
+		if err == nil {
+			if lastErr != nil {
+				log.Printf("[Mailer] Delivered to %s via fallback channel %d", req.To, id)
 			}
-			// 默认通道失败，继续尝试 Direct
+			return attempt, nil
 		}
-		// Direct Send
-		return sendByDirect(req, fromAddr, req.To, msgBytes)
+		lastErr = err
+		if !isTransientSendError(err) {
+			return attempt, err
+		}
+		log.Printf("[Mailer] Channel %d failed for %s, trying next channel: %v", id, req.To, err)
+	}
+	last.DeferFailureLog = false
+	return last, lastErr
+}
+
+// isTransientSendError 判断发送错误是否值得换通道重试
+// SMTP 5xx 表示收件方或内容被永久拒绝；但认证类 5xx (530/534/535/538) 只与当前通道的凭据有关，仍可切换通道
+func isTransientSendError(err error) bool {
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return true // 网络、TLS、配置等非协议错误
+	}
+	if tpErr.Code < 500 {
+		return true
+	}
+	switch tpErr.Code {
+	case 530, 534, 535, 538:
+		return true
 	}
+	return false
 }
 
 // sendByRelay 包装器
@@ -225,12 +567,15 @@ func sendByRelay(req SendRequest, from, to string, msg []byte, channelID uint) e
 	if err := database.DB.First(&cfg, channelID).Error; err != nil {
 		return logAndReturnError(req, "smtp_config_not_found", err)
 	}
+	if err := checkChannelDomain(req, &cfg); err != nil {
+		return logAndReturnError(req, "channel_domain_mismatch", err)
+	}
 	return sendWithSMTPConfig(req, from, to, msg, cfg)
 }
 
 // sendWithSMTPConfig 核心 SMTP 发送逻辑
 func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg database.SMTPConfig) error {
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
 	// 解密 SMTP 密码（兼容旧版未加密密码）
 	smtpPassword, err := crypto.Decrypt(cfg.Password, config.AppConfig.JWTSecret)
 	if err != nil {
@@ -238,17 +583,26 @@ func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg databa
 	}
 	auth := smtp.PlainAuth("", cfg.Username, smtpPassword, cfg.Host)
 
-	// 默认强制 TLS 验证
-	// 为了兼容性，我们暂时使用 InsecureSkipVerify: false (安全模式)
-	// 如果用户使用的是自签名证书，需要在 SMTP 配置中添加 SkipVerify 选项 (DB Schema 需升级)
-	// 鉴于本次是代码修复，先设为 false，提升安全性。
-	tlsConfig := &tls.Config{InsecureSkipVerify: false, ServerName: cfg.Host}
+	// 默认校验证书链与主机名，自签名证书的中继可按通道关闭
+	tlsConfig := relayTLSConfig(cfg)
+	clientCert, err := relayClientCertificate(cfg)
+	if err != nil {
+		return logAndReturnError(req, "smtp_client_cert_invalid", err)
+	}
+	if clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	// 按发件域名绑定出站源 IP (多 IP 主机区分信誉)
+	sourceIP := outboundSourceIP(extractDomain(from))
+	dialer, network := smtpDialer(sourceIP)
 
 	if cfg.SSL {
 		// 隐式 SSL (通常端口 465)
-		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		conn, err := tls.DialWithDialer(dialer, network, addr, tlsConfig)
 		if err != nil {
-			return logAndReturnError(req, "smtp_tls_dial_failed", err)
+			reason, err := relayTLSError("smtp_tls_dial_failed", tlsConfig.ServerName, err)
+			return logAndReturnError(req, reason, err)
 		}
 		defer conn.Close()
 
@@ -267,6 +621,7 @@ func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg databa
 		if err = c.Rcpt(to); err != nil {
 			return logAndReturnError(req, "smtp_rcpt_to_failed", err)
 		}
+		addArchiveRcpt(c, req)
 		w, err := c.Data()
 		if err != nil {
 			return logAndReturnError(req, "smtp_data_failed", err)
@@ -282,16 +637,25 @@ func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg databa
 		// 覆盖 smtp.SendMail 以强制使用我们的 tlsConfig (smtp.SendMail 默认会尝试 StartTLS 但使用默认 InsecureSkipVerify=true 如果没有提供 config)
 		// 标准库 smtp.SendMail 不接受 tlsConfig，所以我们必须手动实现 Dial/StartTLS
 		
-		c, err := smtp.Dial(addr)
+		conn, err := dialer.Dial(network, addr)
+		if err != nil {
+			return logAndReturnError(req, "smtp_dial_failed", err)
+		}
+		c, err := smtp.NewClient(conn, cfg.Host)
 		if err != nil {
+			conn.Close()
 			return logAndReturnError(req, "smtp_dial_failed", err)
 		}
 		defer c.Quit()
 
 		if ok, _ := c.Extension("STARTTLS"); ok {
 			if err = c.StartTLS(tlsConfig); err != nil {
-				return logAndReturnError(req, "smtp_starttls_failed", err)
+				reason, err := relayTLSError("smtp_starttls_failed", tlsConfig.ServerName, err)
+				return logAndReturnError(req, reason, err)
 			}
+		} else if clientCert != nil {
+			// 配置了客户端证书却无法建立 TLS，不降级为明文发送
+			return logAndReturnError(req, "smtp_starttls_required", fmt.Errorf("%s does not offer STARTTLS, client certificate cannot be presented", cfg.Host))
 		}
 
 		if err = c.Auth(auth); err != nil {
@@ -303,6 +667,7 @@ func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg databa
 		if err = c.Rcpt(to); err != nil {
 			return logAndReturnError(req, "smtp_rcpt_to_failed", err)
 		}
+		addArchiveRcpt(c, req)
 		w, err := c.Data()
 		if err != nil {
 			return logAndReturnError(req, "smtp_data_failed", err)
@@ -315,27 +680,109 @@ func sendWithSMTPConfig(req SendRequest, from, to string, msg []byte, cfg databa
 		}
 	}
 
-	logSuccess(req, fmt.Sprintf("smtp_%d", cfg.ID))
+	logSuccess(req, fmt.Sprintf("smtp_%d", cfg.ID), msg)
 	return nil
 }
 
+// relayTLSConfig 构建中继连接的 TLS 配置
+func relayTLSConfig(cfg database.SMTPConfig) *tls.Config {
+	serverName := strings.TrimSpace(cfg.TLSServerName)
+	if serverName == "" {
+		serverName = cfg.Host
+	}
+	return &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify, ServerName: serverName}
+}
+
+// relayClientCertificate 解析通道配置的 TLS 客户端证书 (私钥以 JWT Secret 加密存储)，未配置时返回 nil
+func relayClientCertificate(cfg database.SMTPConfig) (*tls.Certificate, error) {
+	if strings.TrimSpace(cfg.ClientCert) == "" && cfg.ClientKey == "" {
+		return nil, nil
+	}
+	key, err := crypto.Decrypt(cfg.ClientKey, config.AppConfig.JWTSecret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt client key: %w", err)
+	}
+	cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// relayTLSError 将证书校验失败归类为 smtp_tls_verify_failed，并给出明确提示
+func relayTLSError(reason, serverName string, err error) (string, error) {
+	var verifyErr *tls.CertificateVerificationError
+	var hostErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &verifyErr) || errors.As(err, &hostErr) || errors.As(err, &authorityErr) || errors.As(err, &invalidErr) {
+		return "smtp_tls_verify_failed", fmt.Errorf("certificate of %s could not be verified (set tls_server_name or enable skip_tls_verify for self-signed relays): %w", serverName, err)
+	}
+	return reason, err
+}
+
 // sendByDirect 直接投递
 func sendByDirect(req SendRequest, from, to string, msg []byte) error {
-	domain := extractDomain(to)
-	mxRecords, err := net.LookupMX(domain)
-	if err != nil || len(mxRecords) == 0 {
-		return logAndReturnError(req, "mx_lookup_failed", err)
+	if err := checkChannelDomain(req, nil); err != nil {
+		return logAndReturnError(req, "channel_domain_mismatch", err)
+	}
+	if err := directDeliver(from, to, msg); err != nil {
+		var mxErr *mxLookupError
+		if errors.As(err, &mxErr) {
+			return logAndReturnError(req, "mx_lookup_failed", mxErr.err)
+		}
+		return logAndReturnError(req, "direct_send_failed", err)
+	}
+	logSuccess(req, "direct", msg)
+
+	// 归档副本单独投递到归档邮箱的 MX，失败不影响主邮件
+	if bcc := archiveBCC(req); bcc != "" {
+		if err := directDeliver(from, bcc, msg); err != nil {
+			log.Printf("[Mailer] Archive BCC delivery to %s failed: %v", bcc, err)
+		}
 	}
+	return nil
+}
+
+// directDeliver 查询收件域名 MX 并依次尝试投递
+// 使用发件人域名作为 HELO 主机名，这有助于通过 SPF/DMARC 检查
+// 如果是子域名发信 (如 support@mail.example.com)，这里会自动使用 mail.example.com
+func directDeliver(from, to string, msg []byte) error {
+	return directDeliverHelo(extractDomain(from), from, to, msg)
+}
+
+// mxLookupError 收件域名 MX 查询失败 (未连接任何 MX)
+type mxLookupError struct{ err error }
 
-	sort.Slice(mxRecords, func(i, j int) bool { return mxRecords[i].Pref < mxRecords[j].Pref })
+func (e *mxLookupError) Error() string { return "mx_lookup_failed: " + e.err.Error() }
+
+func (e *mxLookupError) Unwrap() error { return e.err }
+
+// directDeliverHelo 以指定 HELO 主机名直接投递 (from 为空时即空信封发件人 MAIL FROM:<>，用于 DSN)
+func directDeliverHelo(helo, from, to string, msg []byte) error {
+	domain := extractDomain(to)
+	mxRecords, err := lookupMX(domain)
+	if err != nil {
+		return &mxLookupError{err}
+	}
 
 	var lastErr error
 	for _, mx := range mxRecords {
 		host := strings.TrimSuffix(mx.Host, ".")
 		addr := fmt.Sprintf("%s:25", host) // 直连通常只走 25
 
-		// 建立连接
-		conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+		// DANE：MX 发布了经 DNSSEC 验证的 TLSA 记录时，强制 STARTTLS 并按记录校验证书
+		var tlsaRecords []*dns.TLSA
+		if config.AppConfig.DANEEnabled {
+			tlsaRecords, err = lookupTLSA(host)
+			if err != nil {
+				lastErr = fmt.Errorf("dane_lookup_failed: %w", err)
+				continue
+			}
+		}
+
+		// 建立连接 (按 HELO 所属发件域名绑定出站源 IP)
+		conn, err := dialSMTP(helo, addr)
 		if err != nil {
 			lastErr = err
 			continue
@@ -349,11 +796,8 @@ func sendByDirect(req SendRequest, from, to string, msg []byte) error {
 		}
 
 		// 发送正确的 HELO/EHLO 主机名
-		// 使用发件人域名作为 HELO 主机名，这有助于通过 SPF/DMARC 检查
-		// 如果是子域名发信 (如 support@mail.example.com)，这里会自动使用 mail.example.com
-		senderDomain := extractDomain(from)
-		if senderDomain != "" {
-			if err := c.Hello(senderDomain); err != nil {
+		if helo != "" {
+			if err := c.Hello(helo); err != nil {
 				// 如果 Hello 失败，尝试继续（虽然后面可能会被拒）
 				// fmt.Printf("HELO failed: %v\n", err)
 			}
@@ -361,8 +805,25 @@ func sendByDirect(req SendRequest, from, to string, msg []byte) error {
 
 		// 尝试 StartTLS
 		if ok, _ := c.Extension("STARTTLS"); ok {
-			// Direct Send 连接对方 MX，无法预知证书情况，通常保持 InsecureSkipVerify: true
-			_ = c.StartTLS(&tls.Config{InsecureSkipVerify: true, ServerName: host})
+			if len(tlsaRecords) > 0 {
+				if err := c.StartTLS(daneTLSConfig(host, tlsaRecords)); err != nil {
+					c.Close()
+					lastErr = fmt.Errorf("dane_verify_failed: %w", err)
+					continue
+				}
+			} else if err := c.StartTLS(&tls.Config{InsecureSkipVerify: true, ServerName: host}); err != nil && config.AppConfig.DirectRequireTLS {
+				// 无 TLSA 记录时无法预知对方证书情况，保持 InsecureSkipVerify: true (仅保证加密，不校验身份)
+				// 机会性 TLS 下握手失败沿用原行为；强制 TLS 时放弃该 MX，不以明文继续
+				c.Close()
+				log.Printf("[Mailer] TLS handshake with %s failed, not sending in plaintext (direct_require_tls): %v", host, err)
+				lastErr = fmt.Errorf("starttls_failed: %s: %w", host, err)
+				continue
+			}
+		} else if err := missingSTARTTLSError(host, len(tlsaRecords) > 0, config.AppConfig.DirectRequireTLS); err != nil {
+			c.Close()
+			log.Printf("[Mailer] Direct delivery to %s aborted: %v", host, err)
+			lastErr = err
+			continue
 		}
 
 		if err = c.Mail(from); err != nil { c.Close(); lastErr = err; continue }
@@ -375,7 +836,6 @@ func sendByDirect(req SendRequest, from, to string, msg []byte) error {
 		c.Quit()
 		
 		if err == nil {
-			logSuccess(req, "direct")
 			return nil
 		}
 		lastErr = err
@@ -383,9 +843,45 @@ func sendByDirect(req SendRequest, from, to string, msg []byte) error {
 
 	// 错误处理优化
 	if lastErr != nil && strings.Contains(lastErr.Error(), "timeout") {
-		lastErr = fmt.Errorf("%v (Firewall blocked port 25)", lastErr)
+		if port25Blocked() {
+			lastErr = fmt.Errorf("%v (outbound port 25 is blocked on this host, use an SMTP relay channel)", lastErr)
+		} else {
+			lastErr = fmt.Errorf("%v (Firewall blocked port 25)", lastErr)
+		}
+	}
+	return lastErr
+}
+
+// missingSTARTTLSError MX 未提供 STARTTLS 时是否中止投递：DANE 记录或 direct_require_tls 要求加密时返回错误，否则允许明文
+func missingSTARTTLSError(host string, dane, required bool) error {
+	switch {
+	case dane:
+		return fmt.Errorf("dane_starttls_required: %s does not offer STARTTLS", host)
+	case required:
+		return fmt.Errorf("starttls_required: %s does not offer STARTTLS and direct_require_tls forbids plaintext delivery", host)
+	}
+	return nil
+}
+
+// archiveBCC 返回需要附加的归档 BCC 地址 (未配置或本次发送选择跳过时为空)
+func archiveBCC(req SendRequest) string {
+	if req.SkipBCC {
+		return ""
+	}
+	bcc := strings.TrimSpace(config.AppConfig.ArchiveBCC)
+	if bcc == "" || strings.EqualFold(bcc, req.To) {
+		return ""
+	}
+	return bcc
+}
+
+// addArchiveRcpt 在同一 SMTP 事务中追加归档 BCC 信封收件人 (不写入邮件头，不影响 DKIM)
+func addArchiveRcpt(c *smtp.Client, req SendRequest) {
+	if bcc := archiveBCC(req); bcc != "" {
+		if err := c.Rcpt(bcc); err != nil {
+			log.Printf("[Mailer] Archive BCC recipient %s rejected: %v", bcc, err)
+		}
 	}
-	return logAndReturnError(req, "direct_send_failed", lastErr)
 }
 
 func extractDomain(email string) string {
@@ -396,11 +892,27 @@ func extractDomain(email string) string {
 	return parts[1]
 }
 
+// attachmentContentType 返回附件的 Content-Type，未提供时使用 application/octet-stream
+func attachmentContentType(att Attachment) mail.ContentType {
+	if att.ContentType != "" {
+		return mail.ContentType(att.ContentType)
+	}
+	return mail.TypeAppOctetStream
+}
+
 func logAndReturnError(req SendRequest, reason string, err error) error {
 	msg := ""
 	if err != nil {
 		msg = err.Error()
 	}
+	if !req.DeferFailureLog {
+		logFailure(req, fmt.Sprintf("%s: %s", reason, msg))
+	}
+	return fmt.Errorf("%s: %w", reason, err)
+}
+
+// logFailure 记录发送失败日志
+func logFailure(req SendRequest, errMsg string) {
 	// 简单记录 channel 类型，不必太精确
 	channel := "unknown"
 	if req.ChannelID > 0 {
@@ -409,25 +921,68 @@ func logAndReturnError(req SendRequest, reason string, err error) error {
 		channel = "auto"
 	}
 
+	category, hint := ClassifyError(errMsg)
 	database.DB.Create(&database.EmailLog{
-		Recipient:  req.To,
+		Recipient:  logRecipient(req),
+		FromAddr:   req.From,
+		FromName:   req.FromName,
 		Subject:    req.Subject,
 		Body:       req.Body, // 保存正文
+		TextBody:   req.TextBody,
+		Headers:    logHeaders(req.Headers),
 		Status:     "failed",
-		ErrorMsg:   fmt.Sprintf("%s: %s", reason, msg),
+		ErrorMsg:   errMsg,
+		ErrorCategory: category,
+		ErrorHint:     hint,
 		Channel:    channel,
+		TriedChannels: triedChannels(req),
+		CampaignID: req.CampaignID,
+		ContactID:  req.ContactID,
 		TrackingID: req.TrackingID,
 	})
-	return fmt.Errorf("%s: %v", reason, err)
 }
 
-func logSuccess(req SendRequest, channel string) {
-	database.DB.Create(&database.EmailLog{
-		Recipient:  req.To,
+// logHeaders 将附加邮件头编码为 JSON 写入发送日志，重发时原样还原
+func logHeaders(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(headers)
+	return string(data)
+}
+
+// triedChannels 发生过通道切换时返回依次尝试的通道，只尝试了一个通道时为空
+func triedChannels(req SendRequest) string {
+	if strings.Contains(req.TriedChannels, ",") {
+		return req.TriedChannels
+	}
+	return ""
+}
+
+// logSuccess 记录发送成功日志，msg 为实际发出的原始邮件
+func logSuccess(req SendRequest, channel string, msg []byte) {
+	sum := sha256.Sum256(msg)
+	entry := database.EmailLog{
+		Recipient:  logRecipient(req),
+		FromAddr:   req.From,
+		FromName:   req.FromName,
 		Subject:    req.Subject,
 		Body:       req.Body, // 保存正文
+		TextBody:   req.TextBody,
+		Headers:    logHeaders(req.Headers),
 		Status:     "success",
 		Channel:    channel,
+		TriedChannels: triedChannels(req),
+		CampaignID: req.CampaignID,
+		ContactID:  req.ContactID,
 		TrackingID: req.TrackingID,
-	})
+		RawHash:    hex.EncodeToString(sum[:]),
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		return
+	}
+	// 营销邮件按收件人保存完整原始邮件，便于事后复现与审计
+	if req.CampaignID > 0 && config.AppConfig.CampaignStoreRaw {
+		database.DB.Create(&database.RenderedMessage{EmailLogID: entry.ID, CampaignID: req.CampaignID, Raw: string(msg)})
+	}
 }
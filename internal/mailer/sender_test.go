@@ -0,0 +1,189 @@
+package mailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/crypto"
+	"goemail/internal/database"
+)
+
+func TestValidateHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       SendRequest
+		expectErr bool
+	}{
+		{"normal", SendRequest{From: "a@example.com", FromName: "Support", To: "b@example.com", Subject: "Hello"}, false},
+		{"subject LF injection", SendRequest{To: "b@example.com", Subject: "Hi\nBcc: victim@example.com"}, true},
+		{"subject CRLF injection", SendRequest{To: "b@example.com", Subject: "Hi\r\nBcc: victim@example.com"}, true},
+		{"from injection", SendRequest{From: "a@example.com\r\nBcc: victim@example.com", To: "b@example.com"}, true},
+		{"from name injection", SendRequest{FromName: "Support\rBcc: victim@example.com", To: "b@example.com"}, true},
+		{"to injection", SendRequest{To: "b@example.com\nCc: victim@example.com"}, true},
+		{"custom header ok", SendRequest{To: "b@example.com", Headers: map[string]string{"X-Campaign": "spring"}}, false},
+		{"custom header value injection", SendRequest{To: "b@example.com", Headers: map[string]string{"X-Campaign": "a\r\nBcc: victim@example.com"}}, true},
+		{"custom header name injection", SendRequest{To: "b@example.com", Headers: map[string]string{"X-A\r\nBcc": "v"}}, true},
+		{"custom header name with colon", SendRequest{To: "b@example.com", Headers: map[string]string{"Bcc: victim@example.com\r\nX-A": "v"}}, true},
+		{"reserved header", SendRequest{To: "b@example.com", Headers: map[string]string{"bcc": "victim@example.com"}}, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateHeaders(tt.req)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("%s: ValidateHeaders() error = %v, expectErr %v", tt.name, err, tt.expectErr)
+		}
+	}
+
+	// 附加邮件头仅供内部调用，API 请求体中的 headers 不生效
+	var req SendRequest
+	if err := json.Unmarshal([]byte(`{"to":"b@example.com","headers":{"X-Campaign":"spring"}}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Headers != nil {
+		t.Errorf("headers from request body = %v, want nil", req.Headers)
+	}
+}
+
+func TestSanitizeHeaderValue(t *testing.T) {
+	got := sanitizeHeaderValue("Hi\r\nBcc: victim@example.com\nX")
+	if got != "Hi Bcc: victim@example.com X" {
+		t.Errorf("sanitizeHeaderValue() = %q", got)
+	}
+}
+
+func TestIsTransientSendError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("smtp_dial_failed: %w", errors.New("connection refused")), true},
+		{fmt.Errorf("smtp_rcpt_to_failed: %w", &textproto.Error{Code: 451, Msg: "try again later"}), true},
+		{fmt.Errorf("smtp_rcpt_to_failed: %w", &textproto.Error{Code: 550, Msg: "no such user"}), false},
+		{fmt.Errorf("smtp_data_failed: %w", &textproto.Error{Code: 554, Msg: "rejected"}), false},
+		{fmt.Errorf("smtp_auth_failed: %w", &textproto.Error{Code: 535, Msg: "bad credentials"}), true},
+	}
+	for _, c := range cases {
+		if got := isTransientSendError(c.err); got != c.want {
+			t.Errorf("isTransientSendError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRelayTLS(t *testing.T) {
+	cfg := relayTLSConfig(database.SMTPConfig{Host: "10.0.0.5", TLSServerName: " smtp.example.com "})
+	if cfg.ServerName != "smtp.example.com" || cfg.InsecureSkipVerify {
+		t.Errorf("unexpected tls config: server=%q skip=%v", cfg.ServerName, cfg.InsecureSkipVerify)
+	}
+	if cfg := relayTLSConfig(database.SMTPConfig{Host: "smtp.example.com", SkipTLSVerify: true}); cfg.ServerName != "smtp.example.com" || !cfg.InsecureSkipVerify {
+		t.Errorf("unexpected tls config: server=%q skip=%v", cfg.ServerName, cfg.InsecureSkipVerify)
+	}
+
+	reason, err := relayTLSError("smtp_tls_dial_failed", "smtp.example.com", fmt.Errorf("handshake: %w", x509.UnknownAuthorityError{}))
+	if reason != "smtp_tls_verify_failed" || !errors.As(err, new(x509.UnknownAuthorityError)) {
+		t.Errorf("verify error not classified: %s %v", reason, err)
+	}
+	if reason, _ := relayTLSError("smtp_tls_dial_failed", "smtp.example.com", errors.New("connection refused")); reason != "smtp_tls_dial_failed" {
+		t.Errorf("non-verify error reclassified as %s", reason)
+	}
+}
+
+func TestSMTPDialer(t *testing.T) {
+	d, network := smtpDialer(nil)
+	if d.LocalAddr != nil || network != "tcp" {
+		t.Errorf("unbound dialer: LocalAddr=%v network=%s", d.LocalAddr, network)
+	}
+	d, network = smtpDialer(net.ParseIP("192.0.2.10"))
+	if addr, ok := d.LocalAddr.(*net.TCPAddr); !ok || !addr.IP.Equal(net.ParseIP("192.0.2.10")) || network != "tcp4" {
+		t.Errorf("IPv4 source: LocalAddr=%v network=%s", d.LocalAddr, network)
+	}
+	if _, network = smtpDialer(net.ParseIP("2001:db8::10")); network != "tcp6" {
+		t.Errorf("IPv6 source should dial tcp6, got %s", network)
+	}
+}
+
+func TestCheckChannelDomain(t *testing.T) {
+	config.AppConfig.EnforceChannelDomain = true
+	defer func() { config.AppConfig.EnforceChannelDomain = false }()
+
+	cfg := &database.SMTPConfig{ID: 3, Name: "relay", Username: "Mailer@Example.com"}
+	if got := channelDomains(*cfg); len(got) != 1 || got[0] != "example.com" {
+		t.Fatalf("channelDomains() = %v, want username domain", got)
+	}
+	cfg.AllowedDomains = " a.test, B.test ,"
+	if got := channelDomains(*cfg); len(got) != 2 || got[1] != "b.test" {
+		t.Fatalf("channelDomains() = %v, want [a.test b.test]", got)
+	}
+
+	req := SendRequest{From: "news@other.test", To: "user@example.net"}
+	if err := checkChannelDomain(req, cfg); err == nil {
+		t.Error("mismatched From domain should be rejected")
+	}
+	req.ChannelDomainOverride = "test"
+	if err := checkChannelDomain(req, cfg); err != nil {
+		t.Errorf("override should skip the check, got %v", err)
+	}
+}
+
+func TestConnectivityChanges(t *testing.T) {
+	if got := connectivityChanges(nil, []PortStatus{{Port: 25}}); len(got) != 0 {
+		t.Errorf("first probe reported changes: %v", got)
+	}
+	prev := []PortStatus{{Port: 25, Reachable: true}, {Port: 587, Reachable: true}}
+	cur := []PortStatus{{Port: 25, Reachable: false}, {Port: 587, Reachable: true}}
+	got := connectivityChanges(prev, cur)
+	if len(got) != 1 || got[0].Port != 25 || got[0].Reachable {
+		t.Errorf("changes = %+v, want port 25 unreachable", got)
+	}
+	if got := connectivityChanges(cur, cur); len(got) != 0 {
+		t.Errorf("unchanged probe reported changes: %v", got)
+	}
+}
+
+func TestRelayClientCertificate(t *testing.T) {
+	if cert, err := relayClientCertificate(database.SMTPConfig{}); cert != nil || err != nil {
+		t.Fatalf("unset client cert = %v, %v", cert, err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	config.AppConfig.JWTSecret = "test-secret"
+	encrypted, _ := crypto.Encrypt(keyPEM, config.AppConfig.JWTSecret)
+	cert, err := relayClientCertificate(database.SMTPConfig{ClientCert: certPEM, ClientKey: encrypted})
+	if err != nil || cert == nil || len(cert.Certificate) != 1 {
+		t.Fatalf("client cert = %v, %v", cert, err)
+	}
+
+	if _, err := relayClientCertificate(database.SMTPConfig{ClientCert: certPEM}); err == nil {
+		t.Error("certificate without key should fail")
+	}
+}
+
+func TestMissingSTARTTLSError(t *testing.T) {
+	if err := missingSTARTTLSError("mx.example.com", false, false); err != nil {
+		t.Errorf("opportunistic TLS should allow plaintext, got %v", err)
+	}
+	if err := missingSTARTTLSError("mx.example.com", false, true); err == nil || !strings.HasPrefix(err.Error(), "starttls_required") {
+		t.Errorf("direct_require_tls: err = %v", err)
+	}
+	if err := missingSTARTTLSError("mx.example.com", true, false); err == nil || !strings.HasPrefix(err.Error(), "dane_starttls_required") {
+		t.Errorf("DANE: err = %v", err)
+	}
+}
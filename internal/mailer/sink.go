@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"strings"
+
+	"goemail/internal/config"
+)
+
+// sinkOriginalHeader 沙箱改投时记录原收件人的邮件头
+const sinkOriginalHeader = "X-GoEmail-Original-To"
+
+// 测试沙箱模式 (sink_mode)
+const (
+	sinkRedirect = "redirect" // 所有外发改投 sink_address
+	sinkDrop     = "drop"     // 不投递，仅记录发送日志
+)
+
+// sinkMode 返回当前生效的沙箱模式，redirect 未配置 sink_address 时按 drop 处理 (宁可不发也不发给真实收件人)
+func sinkMode() string {
+	switch strings.ToLower(strings.TrimSpace(config.AppConfig.SinkMode)) {
+	case sinkRedirect:
+		if strings.TrimSpace(config.AppConfig.SinkAddress) == "" {
+			return sinkDrop
+		}
+		return sinkRedirect
+	case sinkDrop:
+		return sinkDrop
+	}
+	return ""
+}
+
+// applySinkRedirect 将收件人改为 sink_address，原收件人写入邮件头并保留在发送日志中
+// 同时跳过归档 BCC，保证沙箱模式下没有任何邮件发往配置以外的地址
+func applySinkRedirect(req *SendRequest) {
+	headers := make(map[string]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	headers[sinkOriginalHeader] = req.To
+	req.Headers = headers
+	req.OriginalTo = req.To
+	req.To = strings.TrimSpace(config.AppConfig.SinkAddress)
+	req.SkipBCC = true
+}
+
+// logRecipient 返回写入发送日志的收件人 (沙箱改投时为原收件人，便于按真实数据核对营销结果)
+func logRecipient(req SendRequest) string {
+	if req.OriginalTo != "" {
+		return req.OriginalTo
+	}
+	return req.To
+}
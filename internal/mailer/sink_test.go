@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"testing"
+
+	"goemail/internal/config"
+)
+
+func TestApplySinkRedirect(t *testing.T) {
+	config.AppConfig.SinkMode = "redirect"
+	config.AppConfig.SinkAddress = ""
+	defer func() { config.AppConfig.SinkMode, config.AppConfig.SinkAddress = "", "" }()
+
+	if got := sinkMode(); got != sinkDrop {
+		t.Fatalf("redirect without sink_address: sinkMode() = %q, want drop", got)
+	}
+	config.AppConfig.SinkAddress = "sink@test.local"
+	if got := sinkMode(); got != sinkRedirect {
+		t.Fatalf("sinkMode() = %q, want redirect", got)
+	}
+
+	orig := map[string]string{"X-Campaign": "7"}
+	req := SendRequest{To: "user@example.com", Headers: orig}
+	applySinkRedirect(&req)
+	if req.To != "sink@test.local" || !req.SkipBCC {
+		t.Errorf("To = %q, SkipBCC = %v", req.To, req.SkipBCC)
+	}
+	if req.Headers[sinkOriginalHeader] != "user@example.com" || req.Headers["X-Campaign"] != "7" {
+		t.Errorf("headers = %v", req.Headers)
+	}
+	if _, ok := orig[sinkOriginalHeader]; ok {
+		t.Error("caller's header map must not be modified")
+	}
+	if logRecipient(req) != "user@example.com" {
+		t.Errorf("logRecipient() = %q, want original recipient", logRecipient(req))
+	}
+}
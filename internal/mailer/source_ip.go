@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// smtpDialTimeout 出站 SMTP 建立 TCP 连接的超时
+const smtpDialTimeout = 10 * time.Second
+
+// outboundSourceIP 返回发件域名对应的出站源 IP：域名单独配置 source_ip 优先，其次全局 outbound_source_ip
+// 均未配置时返回 nil (由系统选择)
+func outboundSourceIP(senderDomain string) net.IP {
+	value := ""
+	if name := strings.ToLower(strings.TrimSpace(senderDomain)); name != "" {
+		var domain database.Domain
+		if err := database.DB.Select("id", "name", "source_ip").Where("LOWER(name) = ?", name).First(&domain).Error; err == nil {
+			value = strings.TrimSpace(domain.SourceIP)
+		}
+	}
+	if value == "" {
+		value = strings.TrimSpace(config.AppConfig.OutboundSourceIP)
+	}
+	if value == "" {
+		return nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		log.Printf("[Mailer] Ignoring invalid outbound source IP %q for %s", value, senderDomain)
+	}
+	return ip
+}
+
+// smtpDialer 返回绑定源 IP 的拨号器及应使用的网络类型 (绑定 IPv4 时只连 IPv4 地址，IPv6 同理)
+func smtpDialer(sourceIP net.IP) (*net.Dialer, string) {
+	d := &net.Dialer{Timeout: smtpDialTimeout}
+	if sourceIP == nil {
+		return d, "tcp"
+	}
+	d.LocalAddr = &net.TCPAddr{IP: sourceIP}
+	if sourceIP.To4() != nil {
+		return d, "tcp4"
+	}
+	return d, "tcp6"
+}
+
+// dialSMTP 按发件域名的源 IP 配置建立出站连接
+func dialSMTP(senderDomain, addr string) (net.Conn, error) {
+	sourceIP := outboundSourceIP(senderDomain)
+	d, network := smtpDialer(sourceIP)
+	conn, err := d.Dial(network, addr)
+	if err != nil && sourceIP != nil {
+		return nil, fmt.Errorf("dial %s from %s: %w", addr, sourceIP, err)
+	}
+	return conn, err
+}
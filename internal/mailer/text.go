@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlInvisibleRe = regexp.MustCompile(`(?is)<(head|style|script|title)[^>]*>.*?</(head|style|script|title)>`)
+	htmlCommentRe   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlLinkRe      = regexp.MustCompile(`(?is)<a\s[^>]*href=["']([^"']+)["'][^>]*>(.*?)</a>`)
+	htmlBreakRe     = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlockEndRe  = regexp.MustCompile(`(?i)</(p|div|h[1-6]|tr|table|ul|ol|blockquote)>|<hr\s*/?>`)
+	htmlListItemRe  = regexp.MustCompile(`(?i)<li[^>]*>`)
+	htmlTagRe       = regexp.MustCompile(`(?s)<[^>]+>`)
+	spaceRunRe      = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesRe    = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText 将 HTML 正文转换为纯文本备选正文
+// 链接保留为 "文字 (URL)"，块级元素转换为换行，其余标签剥离
+func HTMLToText(body string) string {
+	s := htmlInvisibleRe.ReplaceAllString(body, "")
+	s = htmlCommentRe.ReplaceAllString(s, "")
+	s = htmlLinkRe.ReplaceAllStringFunc(s, func(match string) string {
+		m := htmlLinkRe.FindStringSubmatch(match)
+		url := m[1]
+		text := strings.TrimSpace(htmlTagRe.ReplaceAllString(m[2], ""))
+		if text == "" || text == url {
+			return url
+		}
+		return text + " (" + url + ")"
+	})
+	// 源码中的换行不具有语义，先折叠为空格
+	s = strings.ReplaceAll(s, "\n", " ")
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlBlockEndRe.ReplaceAllString(s, "\n\n")
+	s = htmlListItemRe.ReplaceAllString(s, "\n- ")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = strings.ReplaceAll(s, " ", " ")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaceRunRe.ReplaceAllString(line, " "))
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
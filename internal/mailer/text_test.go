@@ -0,0 +1,22 @@
+package mailer
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"links", `<p>Read <a href="https://example.com/a">the post</a></p>`, "Read the post (https://example.com/a)"},
+		{"bare link", `<a href="https://example.com">https://example.com</a>`, "https://example.com"},
+		{"blocks", "<h1>Hi</h1>\n<p>Line one<br>Line two</p><p>Next</p>", "Hi\n\nLine one\nLine two\n\nNext"},
+		{"strip head", `<html><head><style>p{color:red}</style></head><body><p>A &amp; B</p></body></html>`, "A & B"},
+		{"list", `<ul><li>one</li><li>two</li></ul>`, "- one\n- two"},
+	}
+	for _, c := range cases {
+		if got := HTMLToText(c.in); got != c.want {
+			t.Errorf("%s: HTMLToText() = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
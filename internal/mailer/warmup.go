@@ -0,0 +1,147 @@
+package mailer
+
+import (
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/database"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultWarmupStartCap = 50
+	DefaultWarmupGrowth   = 2.0
+)
+
+// warmupMu 串行化额度占用，避免并发 worker 超发
+var warmupMu sync.Mutex
+
+// WarmupStatus 域名预热的当日状态
+type WarmupStatus struct {
+	Day       int       `json:"day"`        // 预热第几天 (从 1 开始)
+	TodayCap  int       `json:"today_cap"`  // 当日发送上限
+	SentToday int       `json:"sent_today"` // 当日已发送
+	Remaining int       `json:"remaining"`  // 当日剩余额度
+	Completed bool      `json:"completed"`  // 上限已达到 warmup_max_cap，预热结束
+	Schedule  []int     `json:"schedule"`   // 未来 7 天 (含今天) 的上限
+	ResetAt   time.Time `json:"reset_at"`   // 额度重置时间 (次日零点)
+}
+
+// WarmupDailyCap 计算预热第 day 天 (从 1 开始) 的发送上限
+func WarmupDailyCap(startCap int, growth float64, maxCap int, day int) int {
+	if startCap <= 0 {
+		startCap = DefaultWarmupStartCap
+	}
+	if growth < 1 {
+		growth = DefaultWarmupGrowth
+	}
+	if day < 1 {
+		day = 1
+	}
+	capacity := float64(startCap) * math.Pow(growth, float64(day-1))
+	if maxCap > 0 && capacity >= float64(maxCap) {
+		return maxCap
+	}
+	if capacity > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(capacity)
+}
+
+// WarmupStartDay 开启预热时记录的起始日：次日零点
+// 当天剩余的时间不足一整天，按第 1 天的上限发送且不计入天数，上限从次日开始逐日递增
+func WarmupStartDay(now time.Time) time.Time {
+	return startOfDay(now).AddDate(0, 0, 1)
+}
+
+// warmupDay 计算 now 所在日期是预热的第几天 (按自然日计算，从 1 开始；起始日之前按第 1 天计算)
+func warmupDay(startedAt *time.Time, now time.Time) int {
+	if startedAt == nil {
+		return 1
+	}
+	start := startOfDay(startedAt.In(now.Location()))
+	days := int(startOfDay(now).Sub(start).Hours()/24) + 1
+	if days < 1 {
+		return 1
+	}
+	return days
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// GetWarmupStatus 计算域名当日的预热状态
+func GetWarmupStatus(d database.Domain, now time.Time) WarmupStatus {
+	day := warmupDay(d.WarmupStartedAt, now)
+	status := WarmupStatus{
+		Day:      day,
+		TodayCap: WarmupDailyCap(d.WarmupStartCap, d.WarmupGrowth, d.WarmupMaxCap, day),
+		ResetAt:  startOfDay(now).AddDate(0, 0, 1),
+	}
+	if d.WarmupSentDate == now.Format("2006-01-02") {
+		status.SentToday = d.WarmupSentCount
+	}
+	status.Remaining = status.TodayCap - status.SentToday
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	status.Completed = d.WarmupMaxCap > 0 && status.TodayCap >= d.WarmupMaxCap
+	for i := 0; i < 7; i++ {
+		status.Schedule = append(status.Schedule, WarmupDailyCap(d.WarmupStartCap, d.WarmupGrowth, d.WarmupMaxCap, day+i))
+	}
+	return status
+}
+
+// reserveWarmupSlot 为发件域名占用一个当日发送额度
+// 域名未配置或未开启预热时直接放行；额度用尽时返回 false 及下次可发送的时间
+// 放行时返回的 done 须在发送结束后调用，发送失败时归还占用的额度
+func reserveWarmupSlot(from string) (bool, time.Time, func(sent bool)) {
+	noop := func(bool) {}
+	domainName := strings.ToLower(extractDomain(from))
+	if domainName == "" {
+		return true, time.Time{}, noop
+	}
+
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+
+	var domain database.Domain
+	if err := database.DB.Where("LOWER(name) = ? AND warmup_enabled = ?", domainName, true).First(&domain).Error; err != nil {
+		return true, time.Time{}, noop
+	}
+
+	now := time.Now()
+	status := GetWarmupStatus(domain, now)
+	if status.Completed {
+		// 日上限已达到目标值，自动结束预热
+		database.DB.Model(&domain).Update("warmup_enabled", false)
+		log.Printf("[Warmup] Domain %s finished warmup on day %d (cap %d)", domain.Name, status.Day, status.TodayCap)
+		return true, time.Time{}, noop
+	}
+	if status.Remaining <= 0 {
+		return false, status.ResetAt, nil
+	}
+
+	today := now.Format("2006-01-02")
+	database.DB.Model(&domain).Updates(map[string]interface{}{
+		"warmup_sent_date":  today,
+		"warmup_sent_count": status.SentToday + 1,
+	})
+	return true, time.Time{}, func(sent bool) {
+		if sent {
+			return
+		}
+		// 只归还当日的额度，跨天后计数已重置
+		warmupMu.Lock()
+		defer warmupMu.Unlock()
+		database.DB.Model(&database.Domain{}).
+			Where("id = ? AND warmup_sent_date = ? AND warmup_sent_count > 0", domain.ID, today).
+			Update("warmup_sent_count", gorm.Expr("warmup_sent_count - 1"))
+	}
+}
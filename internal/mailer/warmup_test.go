@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestWarmupDailyCap(t *testing.T) {
+	cases := []struct {
+		start  int
+		growth float64
+		max    int
+		day    int
+		want   int
+	}{
+		{50, 2, 0, 1, 50},
+		{50, 2, 0, 2, 100},
+		{50, 2, 0, 4, 400},
+		{50, 2, 1000, 10, 1000},
+		{0, 0, 0, 3, 200}, // 默认值: 50, 翻倍
+		{100, 1.5, 0, 3, 225},
+	}
+	for _, c := range cases {
+		if got := WarmupDailyCap(c.start, c.growth, c.max, c.day); got != c.want {
+			t.Errorf("WarmupDailyCap(%d, %v, %d, %d) = %d, want %d", c.start, c.growth, c.max, c.day, got, c.want)
+		}
+	}
+}
+
+func TestWarmupDay(t *testing.T) {
+	start := time.Date(2024, 3, 1, 23, 30, 0, 0, time.Local)
+	if got := warmupDay(&start, start); got != 1 {
+		t.Errorf("same day = %d, want 1", got)
+	}
+	if got := warmupDay(&start, time.Date(2024, 3, 2, 0, 10, 0, 0, time.Local)); got != 2 {
+		t.Errorf("next calendar day = %d, want 2", got)
+	}
+	if got := warmupDay(nil, start); got != 1 {
+		t.Errorf("nil start = %d, want 1", got)
+	}
+
+	// 晚间开启预热：当天与次日都按第 1 天的上限，第 3 个自然日才进入第 2 天
+	enabled := time.Date(2024, 3, 1, 23, 0, 0, 0, time.Local)
+	first := WarmupStartDay(enabled)
+	for at, want := range map[time.Time]int{
+		enabled: 1,
+		time.Date(2024, 3, 2, 12, 0, 0, 0, time.Local): 1,
+		time.Date(2024, 3, 3, 0, 5, 0, 0, time.Local):  2,
+	} {
+		if got := warmupDay(&first, at); got != want {
+			t.Errorf("warmupDay at %s = %d, want %d", at.Format(time.DateTime), got, want)
+		}
+	}
+}
+
+func TestReserveWarmupSlotReleasedOnFailure(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Domain{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	domain := database.Domain{Name: "example.com", WarmupEnabled: true, WarmupStartCap: 1, WarmupMaxCap: 100}
+	db.Create(&domain)
+
+	ok, _, done := reserveWarmupSlot("news@example.com")
+	if !ok {
+		t.Fatal("first message should fit the daily cap")
+	}
+	if ok, _, _ := reserveWarmupSlot("news@example.com"); ok {
+		t.Fatal("cap of 1 should be used up while the first message is in flight")
+	}
+	done(false)
+	ok, _, done = reserveWarmupSlot("news@example.com")
+	if !ok {
+		t.Fatal("failed send should return its slot")
+	}
+	done(true)
+	if ok, _, _ := reserveWarmupSlot("news@example.com"); ok {
+		t.Error("successful send should keep its slot")
+	}
+}
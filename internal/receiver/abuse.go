@@ -0,0 +1,181 @@
+package receiver
+
+import (
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+)
+
+// 滥用行为的计分权重
+const (
+	abuseRateLimited  = 1 // 连接超过速率限制
+	abuseRejectedRcpt = 1 // 收件人被拒绝 (探测有效地址)
+	abuseProtocol     = 1 // 非法命令、超长行等协议错误
+	abuseSpam         = 3 // 投递被判定为垃圾邮件
+)
+
+// BlockedIP 自动封禁的 IP
+type BlockedIP struct {
+	IP        string    `json:"ip"`
+	Score     int       `json:"score"`  // 触发封禁时窗口内的滥用分
+	Reason    string    `json:"reason"` // 触发封禁的最后一次行为
+	BlockedAt time.Time `json:"blocked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type abuseEvent struct {
+	at     time.Time
+	weight int
+}
+
+// abuseTracker 按 IP 统计滑动窗口内的滥用分，超过阈值后临时封禁 (仅内存，重启后清空)
+// 与配置文件中的静态黑名单相互独立
+type abuseTracker struct {
+	mu        sync.Mutex
+	events    map[string][]abuseEvent
+	blocked   map[string]BlockedIP
+	lastSweep time.Time // 上次清理过期 IP 的时间
+}
+
+var abuse = &abuseTracker{
+	events:  make(map[string][]abuseEvent),
+	blocked: make(map[string]BlockedIP),
+}
+
+// record 记录一次滥用行为，返回本次是否触发封禁
+func (t *abuseTracker) record(ip, reason string, weight, threshold int, window, ttl time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b, ok := t.blocked[ip]; ok && now.Before(b.ExpiresAt) {
+		return false
+	}
+
+	cutoff := now.Add(-window)
+	// 每个窗口周期清理一次：只来过一次的扫描器 IP 不会再被 record 访问，否则会一直留在内存中
+	if now.Sub(t.lastSweep) >= window {
+		t.evictExpired(cutoff, now)
+		t.lastSweep = now
+	}
+	valid := t.events[ip][:0]
+	score := 0
+	for _, e := range t.events[ip] {
+		if e.at.After(cutoff) {
+			valid = append(valid, e)
+			score += e.weight
+		}
+	}
+	valid = append(valid, abuseEvent{at: now, weight: weight})
+	score += weight
+
+	if score < threshold {
+		t.events[ip] = valid
+		return false
+	}
+	delete(t.events, ip)
+	t.blocked[ip] = BlockedIP{IP: ip, Score: score, Reason: reason, BlockedAt: now, ExpiresAt: now.Add(ttl)}
+	return true
+}
+
+// evictExpired 删除最后一次事件已在窗口外的 IP 与已过期的封禁，调用方需持有锁
+func (t *abuseTracker) evictExpired(cutoff, now time.Time) {
+	for ip, events := range t.events {
+		if len(events) == 0 || !events[len(events)-1].at.After(cutoff) {
+			delete(t.events, ip)
+		}
+	}
+	for ip, b := range t.blocked {
+		if !now.Before(b.ExpiresAt) {
+			delete(t.blocked, ip)
+		}
+	}
+}
+
+// isBlocked 检查 IP 是否处于封禁期，过期记录顺带清除
+func (t *abuseTracker) isBlocked(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.blocked[ip]
+	if !ok {
+		return false
+	}
+	if !now.Before(b.ExpiresAt) {
+		delete(t.blocked, ip)
+		return false
+	}
+	return true
+}
+
+func (t *abuseTracker) list(now time.Time) []BlockedIP {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]BlockedIP, 0, len(t.blocked))
+	for ip, b := range t.blocked {
+		if !now.Before(b.ExpiresAt) {
+			delete(t.blocked, ip)
+			continue
+		}
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].BlockedAt.After(result[j].BlockedAt) })
+	return result
+}
+
+// clear 解除封禁，ip 为空时清空全部；返回解除的数量
+func (t *abuseTracker) clear(ip string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ip == "" {
+		n := len(t.blocked)
+		t.blocked = make(map[string]BlockedIP)
+		t.events = make(map[string][]abuseEvent)
+		return n
+	}
+	delete(t.events, ip)
+	if _, ok := t.blocked[ip]; ok {
+		delete(t.blocked, ip)
+		return 1
+	}
+	return 0
+}
+
+// hostOnly 去掉地址中的端口
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// recordAbuse 记录远端 IP 的滥用行为 (未启用 receiver_auto_block 时忽略)
+func recordAbuse(remoteAddr, reason string, weight int) {
+	cfg := config.AppConfig
+	if !cfg.ReceiverAutoBlock {
+		return
+	}
+	ip := hostOnly(remoteAddr)
+	window := time.Duration(cfg.ReceiverAutoBlockWindow) * time.Minute
+	ttl := time.Duration(cfg.ReceiverAutoBlockTTL) * time.Minute
+	if abuse.record(ip, reason, weight, cfg.ReceiverAutoBlockThreshold, window, ttl, time.Now()) {
+		log.Printf("[Receiver] Auto-blocked IP %s for %s (reason: %s)", ip, ttl, reason)
+	}
+}
+
+// isAutoBlocked 检查 IP 是否被自动封禁
+func isAutoBlocked(remoteAddr string) bool {
+	return abuse.isBlocked(hostOnly(remoteAddr), time.Now())
+}
+
+// AutoBlockedIPs 返回当前处于封禁期的 IP
+func AutoBlockedIPs() []BlockedIP {
+	return abuse.list(time.Now())
+}
+
+// ClearAutoBlock 手动解除自动封禁，ip 为空时解除全部
+func ClearAutoBlock(ip string) int {
+	return abuse.clear(ip)
+}
@@ -0,0 +1,238 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"goemail/internal/config"
+	"goemail/internal/crypto"
+	"goemail/internal/database"
+	"goemail/internal/jobs"
+
+	"gorm.io/gorm"
+)
+
+// ErrInboxKeyMissing 启用了收件加密但未配置口令
+var ErrInboxKeyMissing = errors.New("inbox_encryption is enabled but inbox_encryption_key is empty")
+
+// rekeyGuard 重新加密任务的防重叠保护
+var rekeyGuard = jobs.NewGuard("inbox-rekey")
+
+// RekeyResult 重新加密结果统计
+type RekeyResult struct {
+	Messages       int64 `json:"messages"`        // 重写的邮件数
+	Files          int64 `json:"files"`           // 重写的附件文件数
+	FailedMessages int64 `json:"failed_messages"` // 所有口令均无法解密的邮件数
+	FailedFiles    int64 `json:"failed_files"`    // 无法读取或解密的附件文件数
+	Encrypted      bool  `json:"encrypted"`       // 重写后是否为加密状态
+}
+
+// inboxSealKey 新写入数据使用的口令；未启用加密时返回空 (明文存储)
+func inboxSealKey() (string, error) {
+	if !config.AppConfig.InboxEncryption {
+		return "", nil
+	}
+	key := strings.TrimSpace(config.AppConfig.InboxEncryptionKey)
+	if key == "" {
+		return "", ErrInboxKeyMissing
+	}
+	return key, nil
+}
+
+// inboxOpenKeys 解密时依次尝试的口令：当前口令优先，其次为轮换前的旧口令
+// 关闭加密后仍保留口令，可继续读取已加密的历史邮件
+func inboxOpenKeys() []string {
+	var keys []string
+	for _, k := range append([]string{config.AppConfig.InboxEncryptionKey}, config.AppConfig.InboxEncryptionPreviousKeys...) {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// openInboxString 解密单个字段，明文原样返回
+func openInboxString(s string, keys []string) (string, error) {
+	if !crypto.IsEncrypted(s) {
+		return s, nil
+	}
+	for _, k := range keys {
+		if plain, err := crypto.Decrypt(s, k); err == nil {
+			return plain, nil
+		}
+	}
+	return "", errors.New("no inbox encryption key can decrypt this message")
+}
+
+// openInboxBytes 解密附件文件内容，明文原样返回
+func openInboxBytes(data []byte, keys []string) ([]byte, error) {
+	if !crypto.IsEncryptedBytes(data) {
+		return data, nil
+	}
+	for _, k := range keys {
+		if plain, err := crypto.DecryptBytes(data, k); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, errors.New("no inbox encryption key can decrypt this file")
+}
+
+// sealInboxItem 按配置加密邮件正文与原始数据 (入库前调用)
+func sealInboxItem(m *database.Inbox) error {
+	key, err := inboxSealKey()
+	if err != nil || key == "" {
+		return err
+	}
+	if m.Body, err = crypto.Encrypt(m.Body, key); err != nil {
+		return err
+	}
+	m.RawData, err = crypto.Encrypt(m.RawData, key)
+	return err
+}
+
+// OpenInboxItem 解密从数据库读取的邮件正文与原始数据 (未加密的字段保持不变)
+func OpenInboxItem(m *database.Inbox) error {
+	keys := inboxOpenKeys()
+	body, err := openInboxString(m.Body, keys)
+	if err != nil {
+		return err
+	}
+	raw, err := openInboxString(m.RawData, keys)
+	if err != nil {
+		return err
+	}
+	m.Body, m.RawData = body, raw
+	return nil
+}
+
+// writeInboxFile 按配置加密后写入收件附件文件
+func writeInboxFile(path string, data []byte) error {
+	key, err := inboxSealKey()
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if data, err = crypto.EncryptBytes(data, key); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadInboxFile 读取附件文件，加密存储时透明解密
+func ReadInboxFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return openInboxBytes(data, inboxOpenKeys())
+}
+
+// RekeyInbox 按当前配置重写所有收件数据：启用加密时以当前口令重新加密 (含历史明文)，关闭时还原为明文
+// 全部成功后清空旧口令列表；返回 false 表示已有重新加密任务在运行
+func RekeyInbox() (RekeyResult, bool, error) {
+	var result RekeyResult
+	var runErr error
+	ran := rekeyGuard.Run(func() {
+		result, runErr = rekeyInbox()
+	})
+	return result, ran, runErr
+}
+
+func rekeyInbox() (RekeyResult, error) {
+	key, err := inboxSealKey()
+	if err != nil {
+		return RekeyResult{}, err
+	}
+	keys := inboxOpenKeys()
+	result := RekeyResult{Encrypted: key != ""}
+
+	seal := func(s string) (string, error) {
+		if key == "" {
+			return s, nil
+		}
+		return crypto.Encrypt(s, key)
+	}
+
+	// 包含软删除的记录，避免恢复后留下无法解密的数据
+	var batch []database.Inbox
+	err = database.DB.Unscoped().Select("id", "body", "raw_data").Order("id asc").
+		FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+			for _, m := range batch {
+				body, err1 := openInboxString(m.Body, keys)
+				raw, err2 := openInboxString(m.RawData, keys)
+				if err1 != nil || err2 != nil {
+					result.FailedMessages++
+					continue
+				}
+				if body, err1 = seal(body); err1 != nil {
+					return err1
+				}
+				if raw, err2 = seal(raw); err2 != nil {
+					return err2
+				}
+				database.DB.Unscoped().Model(&database.Inbox{}).Where("id = ?", m.ID).
+					UpdateColumns(map[string]interface{}{"body": body, "raw_data": raw})
+				result.Messages++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return result, err
+	}
+
+	var files []database.AttachmentFile
+	database.DB.Unscoped().Select("id", "file_path", "original_path").Where("source = ?", "inbox").Find(&files)
+	for _, f := range files {
+		for _, path := range []string{f.FilePath, f.OriginalPath} {
+			if path == "" {
+				continue
+			}
+			if err := rekeyInboxFile(path, key, keys); err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("[Receiver] Failed to rekey attachment %s: %v", path, err)
+					result.FailedFiles++
+				}
+				continue
+			}
+			result.Files++
+		}
+	}
+
+	if result.FailedMessages == 0 && result.FailedFiles == 0 && len(config.AppConfig.InboxEncryptionPreviousKeys) > 0 {
+		config.ConfigMu.Lock()
+		config.AppConfig.InboxEncryptionPreviousKeys = nil
+		config.ConfigMu.Unlock()
+		if err := config.SaveConfig(config.AppConfig); err != nil {
+			return result, fmt.Errorf("rekey finished but clearing previous keys failed: %w", err)
+		}
+	}
+	log.Printf("[Receiver] Inbox rekey done: %d messages, %d files, %d/%d failed, encrypted=%v",
+		result.Messages, result.Files, result.FailedMessages, result.FailedFiles, result.Encrypted)
+	return result, nil
+}
+
+// rekeyInboxFile 以目标口令重写单个附件文件 (先写临时文件再替换)
+func rekeyInboxFile(path, key string, keys []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plain, err := openInboxBytes(data, keys)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if plain, err = crypto.EncryptBytes(plain, key); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".rekey"
+	if err := os.WriteFile(tmp, plain, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
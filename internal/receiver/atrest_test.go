@@ -0,0 +1,44 @@
+package receiver
+
+import (
+	"strings"
+	"testing"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+func TestInboxEncryptionRotation(t *testing.T) {
+	saved := config.AppConfig
+	defer func() { config.AppConfig = saved }()
+
+	config.AppConfig.InboxEncryption = true
+	config.AppConfig.InboxEncryptionKey = ""
+	if err := sealInboxItem(&database.Inbox{Body: "x"}); err != ErrInboxKeyMissing {
+		t.Fatalf("missing key: err = %v", err)
+	}
+
+	config.AppConfig.InboxEncryptionKey = "old-passphrase-1"
+	m := database.Inbox{Body: "<p>secret</p>", RawData: "Subject: hi\r\n\r\nsecret"}
+	if err := sealInboxItem(&m); err != nil || !strings.HasPrefix(m.Body, "enc:") || !strings.HasPrefix(m.RawData, "enc:") {
+		t.Fatalf("sealInboxItem = %+v, %v", m, err)
+	}
+
+	// 轮换后旧口令仍可解密
+	config.AppConfig.InboxEncryptionKey = "new-passphrase-2"
+	config.AppConfig.InboxEncryptionPreviousKeys = []string{"old-passphrase-1"}
+	opened := m
+	if err := OpenInboxItem(&opened); err != nil || opened.Body != "<p>secret</p>" {
+		t.Fatalf("OpenInboxItem = %q, %v", opened.Body, err)
+	}
+
+	config.AppConfig.InboxEncryptionPreviousKeys = nil
+	if err := OpenInboxItem(&m); err == nil {
+		t.Error("message sealed with a dropped key should not open")
+	}
+
+	plain := database.Inbox{Body: "plain"}
+	if err := OpenInboxItem(&plain); err != nil || plain.Body != "plain" {
+		t.Errorf("plaintext message = %q, %v", plain.Body, err)
+	}
+}
@@ -0,0 +1,213 @@
+package receiver
+
+import (
+	"encoding/base64"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// abuseAuthFailed AUTH 认证失败计入的滥用分
+const abuseAuthFailed = 2
+
+var (
+	trustedMu   sync.RWMutex
+	trustedNets []*net.IPNet
+)
+
+// updateTrustedNetworks 解析 receiver_trusted_ips (逗号分隔的 IP 或 CIDR)
+func updateTrustedNetworks() {
+	nets := parseTrustedNetworks(config.AppConfig.ReceiverTrustedIPs)
+	trustedMu.Lock()
+	trustedNets = nets
+	trustedMu.Unlock()
+
+	if config.AppConfig.ReceiverAuthRequired && tlsConfig == nil {
+		log.Println("[Receiver] Warning: receiver_auth_required is enabled but STARTTLS is not, only trusted IPs can deliver")
+	}
+}
+
+// parseTrustedNetworks 解析 IP / CIDR 列表，单个 IP 视为 /32 (IPv6 为 /128)，无效项忽略
+func parseTrustedNetworks(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				log.Printf("[Receiver] Ignoring invalid trusted IP: %s", item)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("[Receiver] Ignoring invalid trusted network: %s", item)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isTrustedIP 检查来源 IP 是否在免认证的可信列表中
+func isTrustedIP(remoteAddr string) bool {
+	ip := net.ParseIP(hostOnly(remoteAddr))
+	if ip == nil {
+		return false
+	}
+	trustedMu.RLock()
+	defer trustedMu.RUnlock()
+	for _, n := range trustedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authRequired 当前会话在 MAIL FROM 之前是否必须先认证
+func (s *SMTPSession) authRequired() bool {
+	return config.AppConfig.ReceiverAuthRequired && !s.authenticated && !isTrustedIP(s.remoteIP)
+}
+
+// authAvailable 是否向客户端提供 AUTH (仅在启用认证要求且已建立 TLS 时，避免明文传输凭据)
+func (s *SMTPSession) authAvailable() bool {
+	return config.AppConfig.ReceiverAuthRequired && s.tlsEnabled
+}
+
+// handleAuth 处理 AUTH PLAIN / AUTH LOGIN (RFC 4954)，密码为 API Key，用户名仅用于记录
+func (s *SMTPSession) handleAuth(line string) {
+	if !s.authAvailable() {
+		if config.AppConfig.ReceiverAuthRequired {
+			s.send("538 5.7.11 Encryption required for requested authentication mechanism")
+		} else {
+			s.send("502 Command not implemented")
+		}
+		return
+	}
+	if s.authenticated {
+		s.send("503 Already authenticated")
+		return
+	}
+	if s.from != "" {
+		s.send("503 AUTH not allowed during a mail transaction")
+		return
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		s.send("501 Syntax error")
+		return
+	}
+
+	var username, password string
+	var ok bool
+	switch strings.ToUpper(fields[1]) {
+	case "PLAIN":
+		resp := ""
+		if len(fields) > 2 {
+			resp = fields[2]
+		} else if resp, ok = s.authChallenge(""); !ok {
+			return
+		}
+		username, password, ok = decodeAuthPlain(resp)
+	case "LOGIN":
+		var u, p string
+		if len(fields) > 2 {
+			u = fields[2]
+		} else if u, ok = s.authChallenge("VXNlcm5hbWU6"); !ok { // "Username:"
+			return
+		}
+		if p, ok = s.authChallenge("UGFzc3dvcmQ6"); !ok { // "Password:"
+			return
+		}
+		username, ok = decodeBase64(u)
+		if ok {
+			password, ok = decodeBase64(p)
+		}
+	default:
+		s.send("504 5.5.4 Unrecognized authentication type")
+		return
+	}
+	if !ok {
+		s.send("501 5.5.2 Cannot decode response")
+		return
+	}
+
+	if !verifyAuthKey(password) {
+		log.Printf("[Receiver] AUTH failed from %s (user %q)", s.remoteIP, username)
+		recordAbuse(s.remoteIP, "auth_failed", abuseAuthFailed)
+		s.send("535 5.7.8 Authentication credentials invalid")
+		return
+	}
+	s.authenticated = true
+	s.authUser = username
+	log.Printf("[Receiver] AUTH succeeded from %s (user %q)", s.remoteIP, username)
+	s.send("235 2.7.0 Authentication successful")
+}
+
+// authChallenge 发送 334 质询并读取客户端响应，客户端以 "*" 取消时返回 false
+func (s *SMTPSession) authChallenge(challenge string) (string, bool) {
+	s.send("334 " + challenge)
+	s.conn.SetDeadline(time.Now().Add(s.idleTimeout()))
+	resp, err := readLine(s.reader, config.AppConfig.ReceiverMaxLineLen)
+	if err != nil {
+		return "", false
+	}
+	resp = strings.TrimSpace(resp)
+	if resp == "*" {
+		s.send("501 5.0.0 Authentication cancelled")
+		return "", false
+	}
+	return resp, true
+}
+
+// decodeAuthPlain 解码 AUTH PLAIN 响应 (authzid \0 authcid \0 passwd)
+func decodeAuthPlain(resp string) (string, string, bool) {
+	raw, ok := decodeBase64(resp)
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.Split(raw, "\x00")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func decodeBase64(s string) (string, bool) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// verifyAuthKey 校验 AUTH 密码是否为有效的 API Key，成功时更新最后使用时间
+func verifyAuthKey(key string) bool {
+	if !strings.HasPrefix(key, "sk_") {
+		return false
+	}
+	var apiKey database.APIKey
+	if err := database.DB.Where(&database.APIKey{Key: key}).First(&apiKey).Error; err != nil {
+		return false
+	}
+	now := time.Now()
+	database.DB.Model(&apiKey).Update("last_used", &now)
+	return true
+}
@@ -0,0 +1,92 @@
+package receiver
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"goemail/internal/database"
+)
+
+// ARFReport 反馈回路 (FBL) 投诉报告 (RFC 5965 message/feedback-report)
+type ARFReport struct {
+	FeedbackType string
+	Recipient    string // 投诉的收件人
+	Sender       string // 被投诉邮件的发件地址
+}
+
+// parseARF 解析 multipart/report; report-type=feedback-report 邮件，非反馈报告返回 nil
+// 收件人与发件人优先取报告字段 (Original-Rcpt-To / Original-Mail-From)，缺失时取附带的原邮件头
+func parseARF(raw string) *ARFReport {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "feedback-report") || params["boundary"] == "" {
+		return nil
+	}
+
+	var report *ARFReport
+	var original textproto.MIMEHeader
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/feedback-report":
+			fields, _ := textproto.NewReader(bufio.NewReader(part)).ReadMIMEHeader()
+			report = &ARFReport{
+				FeedbackType: strings.ToLower(strings.TrimSpace(fields.Get("Feedback-Type"))),
+				Recipient:    arfAddress(fields.Get("Original-Rcpt-To")),
+				Sender:       arfAddress(fields.Get("Original-Mail-From")),
+			}
+		case "message/rfc822", "text/rfc822-headers":
+			original, _ = textproto.NewReader(bufio.NewReader(io.LimitReader(part, 64*1024))).ReadMIMEHeader()
+		}
+	}
+	if report == nil {
+		return nil
+	}
+	if report.Recipient == "" && original != nil {
+		report.Recipient = arfAddress(original.Get("To"))
+	}
+	if report.Sender == "" && original != nil {
+		report.Sender = arfAddress(original.Get("From"))
+	}
+	return report
+}
+
+// arfAddress 从报告字段或邮件头中提取小写邮箱地址 (兼容 "<a@b>"、"Name <a@b>" 及空信封 "<>")
+func arfAddress(value string) string {
+	value = strings.TrimSpace(value)
+	if addr, err := mail.ParseAddress(value); err == nil {
+		return strings.ToLower(addr.Address)
+	}
+	return strings.ToLower(strings.Trim(value, "<>"))
+}
+
+// handleComplaint 记录反馈报告中的投诉，并将对应联系人标记为退订，不再向其发送营销邮件
+func handleComplaint(inboxID uint, mailbox string, report *ARFReport) {
+	database.DB.Create(&database.Complaint{
+		InboxID:      inboxID,
+		Mailbox:      mailbox,
+		FeedbackType: report.FeedbackType,
+		Recipient:    report.Recipient,
+		Sender:       report.Sender,
+	})
+	if report.Recipient != "" {
+		database.DB.Model(&database.Contact{}).
+			Where("LOWER(email) = ? AND status = ?", report.Recipient, "active").
+			Update("status", "unsubscribed")
+	}
+	log.Printf("[Receiver] Complaint (%s) from %s about mail sent by %s", report.FeedbackType, report.Recipient, report.Sender)
+}
@@ -0,0 +1,51 @@
+package receiver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseARF(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: fbl@isp.example",
+		"Subject: FW: Spring sale",
+		"MIME-Version: 1.0",
+		`Content-Type: multipart/report; report-type=feedback-report; boundary="b1"`,
+		"",
+		"--b1",
+		"Content-Type: text/plain",
+		"",
+		"This is an email abuse report.",
+		"--b1",
+		"Content-Type: message/feedback-report",
+		"",
+		"Feedback-Type: abuse",
+		"User-Agent: ISP-FBL/1.0",
+		"Version: 1",
+		"Original-Rcpt-To: <User@isp.example>",
+		"",
+		"--b1",
+		"Content-Type: text/rfc822-headers",
+		"",
+		"From: Shop <news@shop.example>",
+		"To: user@isp.example",
+		"Subject: Spring sale",
+		"",
+		"--b1--",
+		"",
+	}, "\r\n")
+
+	report := parseARF(raw)
+	if report == nil {
+		t.Fatal("feedback report not recognized")
+	}
+	// 缺少 Original-Mail-From 时发件人取自附带的原邮件头
+	if report.FeedbackType != "abuse" || report.Recipient != "user@isp.example" || report.Sender != "news@shop.example" {
+		t.Errorf("parseARF = %+v", report)
+	}
+
+	dsn := strings.Replace(raw, "report-type=feedback-report", "report-type=delivery-status", 1)
+	if parseARF(dsn) != nil {
+		t.Error("delivery status report parsed as a complaint")
+	}
+}
@@ -0,0 +1,216 @@
+package receiver
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// bounceLocalPart 自动创建的退信邮箱地址 (bounce@ 及 VERP 形式 bounce+<token>@)
+const bounceLocalPart = "bounce"
+
+// DSNReport 投递状态通知中单个收件人的状态 (RFC 3464 per-recipient 字段)
+type DSNReport struct {
+	Recipient  string
+	Action     string
+	Status     string
+	Diagnostic string
+}
+
+// Hard 是否为永久失败
+func (r DSNReport) Hard() bool {
+	return r.Action == "failed" && strings.HasPrefix(r.Status, "5")
+}
+
+// parseDSN 解析 multipart/report; report-type=delivery-status 邮件，返回各收件人的投递状态
+// 非 DSN 邮件 (如自动回复) 返回空
+func parseDSN(raw string) []DSNReport {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["boundary"] == "" {
+		return nil
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if partType == "message/delivery-status" || partType == "message/global-delivery-status" {
+			return parseDeliveryStatus(part)
+		}
+	}
+}
+
+// parseDeliveryStatus 解析 delivery-status 正文：首个字段块为 per-message 字段，其后每块对应一个收件人
+func parseDeliveryStatus(r io.Reader) []DSNReport {
+	tp := textproto.NewReader(bufio.NewReader(r))
+	var reports []DSNReport
+	first := true
+	for {
+		fields, err := tp.ReadMIMEHeader()
+		if len(fields) > 0 {
+			if first {
+				first = false
+			} else if report := dsnFromFields(fields); report.Recipient != "" {
+				reports = append(reports, report)
+			}
+		}
+		if err != nil {
+			return reports
+		}
+	}
+}
+
+func dsnFromFields(fields textproto.MIMEHeader) DSNReport {
+	recipient := fields.Get("Final-Recipient")
+	if recipient == "" {
+		recipient = fields.Get("Original-Recipient")
+	}
+	// 字段格式为 "rfc822; user@example.com"
+	if idx := strings.Index(recipient, ";"); idx >= 0 {
+		recipient = recipient[idx+1:]
+	}
+	diagnostic := fields.Get("Diagnostic-Code")
+	if idx := strings.Index(diagnostic, ";"); idx >= 0 {
+		diagnostic = diagnostic[idx+1:]
+	}
+	status := strings.TrimSpace(fields.Get("Status"))
+	if idx := strings.IndexAny(status, " ("); idx >= 0 {
+		status = status[:idx]
+	}
+	return DSNReport{
+		Recipient:  strings.ToLower(strings.Trim(strings.TrimSpace(recipient), "<>")),
+		Action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+		Status:     status,
+		Diagnostic: strings.TrimSpace(diagnostic),
+	}
+}
+
+// verpToken 提取退信地址中的 VERP 标记 (bounce+token@example.com -> token)
+func verpToken(mailbox string) string {
+	local := mailbox
+	if idx := strings.Index(local, "@"); idx >= 0 {
+		local = local[:idx]
+	}
+	if idx := strings.Index(local, "+"); idx >= 0 {
+		return local[idx+1:]
+	}
+	return ""
+}
+
+// verpSignature 计算 VERP 标记签名: HMAC-SHA256(JWTSecret, "verp:<token>") 的前 64 位 (控制本地部分长度)
+func verpSignature(token string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	mac.Write([]byte("verp:" + token))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// signVERPToken 为 VERP 标记附加签名 (<token>.<签名>)，退信地址中的标记不可被伪造
+func signVERPToken(token string) string {
+	return token + "." + verpSignature(token)
+}
+
+// verifyVERPToken 校验带签名的 VERP 标记，返回原始标记 (签名使用常量时间比较)
+func verifyVERPToken(signed string) (string, bool) {
+	idx := strings.LastIndex(signed, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	token, sig := signed[:idx], strings.ToLower(signed[idx+1:])
+	if !hmac.Equal([]byte(sig), []byte(verpSignature(token))) {
+		return "", false
+	}
+	return token, true
+}
+
+// handleBounce 解析退信邮箱收到的 DSN 并记录；永久失败的收件人对应的联系人标记为 bounced
+// 反馈回路 (FBL) 的投诉报告同样投递到退信邮箱，按投诉记录
+func handleBounce(inboxID uint, mailbox, raw string) {
+	if report := parseARF(raw); report != nil {
+		handleComplaint(inboxID, mailbox, report)
+		return
+	}
+	reports := parseDSN(raw)
+	if len(reports) == 0 {
+		log.Printf("[Receiver] Mail to bounce mailbox %s is not a DSN or feedback report, kept in inbox", mailbox)
+		return
+	}
+	// 伪造的退信可以任意构造 bounce+<token>@ 地址，签名无效的标记视为普通退信地址，不关联到任何记录
+	signed := verpToken(mailbox)
+	token, ok := verifyVERPToken(signed)
+	if !ok && signed != "" {
+		log.Printf("[Receiver] Bounce mailbox %s carries an invalid VERP token, ignoring it", mailbox)
+	}
+	for _, r := range reports {
+		if r.Action != "failed" && r.Action != "delayed" {
+			continue
+		}
+		database.DB.Create(&database.Bounce{
+			InboxID:    inboxID,
+			Mailbox:    mailbox,
+			Token:      token,
+			Recipient:  r.Recipient,
+			Action:     r.Action,
+			Status:     r.Status,
+			Diagnostic: r.Diagnostic,
+			Hard:       r.Hard(),
+		})
+		if r.Hard() {
+			database.DB.Model(&database.Contact{}).
+				Where("LOWER(email) = ? AND status = ?", r.Recipient, "active").
+				Update("status", "bounced")
+		}
+		log.Printf("[Receiver] Bounce for %s: action=%s status=%s", r.Recipient, r.Action, r.Status)
+	}
+}
+
+// EnsureBounceMailbox 为域名创建退信邮箱规则 (bounce@ 精确匹配与 bounce+ 前缀匹配)，已存在时跳过
+// 规则仅收入收件箱并交给 DSN 解析器，不转发
+func EnsureBounceMailbox(domainID uint) ([]database.ForwardRule, error) {
+	wanted := []database.ForwardRule{
+		{DomainID: domainID, MatchType: "exact", MatchAddr: bounceLocalPart},
+		{DomainID: domainID, MatchType: "prefix", MatchAddr: bounceLocalPart + "+"},
+	}
+	rules := make([]database.ForwardRule, 0, len(wanted))
+	for _, w := range wanted {
+		var rule database.ForwardRule
+		err := database.DB.Where("domain_id = ? AND match_type = ? AND LOWER(match_addr) = ?", domainID, w.MatchType, w.MatchAddr).
+			First(&rule).Error
+		if err == nil {
+			if !rule.Bounce || !rule.Enabled {
+				rule.Bounce = true
+				rule.Enabled = true
+				if err := database.DB.Save(&rule).Error; err != nil {
+					return nil, err
+				}
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		w.Enabled = true
+		w.Bounce = true
+		w.Remark = "退信邮箱 (DSN 解析)"
+		if err := database.DB.Create(&w).Error; err != nil {
+			return nil, err
+		}
+		rules = append(rules, w)
+	}
+	return rules, nil
+}
@@ -0,0 +1,60 @@
+package receiver
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"goemail/internal/database"
+)
+
+// 转发邮件的 Reply-To 模式 (ForwardRule.ReplyTo)
+const (
+	replyToSender = "sender" // 回复原发件人 (默认)
+	replyToList   = "list"   // 回复原收件地址，经转发规则再次分发 (类似邮件列表)
+	replyToNone   = "none"   // 不设置 Reply-To
+)
+
+// ValidReplyToMode 校验 reply_to，空值视为 sender
+func ValidReplyToMode(mode string) bool {
+	switch mode {
+	case "", replyToSender, replyToList, replyToNone:
+		return true
+	}
+	return false
+}
+
+// forwardReplyTo 返回转发邮件的 Reply-To 头
+// 转发邮件按新邮件重新构建，不设置时目标邮箱"回复"只会回到转发地址；
+// sender 模式优先沿用原邮件的 Reply-To，其次 From 头，最后信封发件人
+func forwardReplyTo(rule *database.ForwardRule, parsed ParsedEmail, envelopeFrom, rcpt string) string {
+	mode := replyToSender
+	if rule != nil && rule.ReplyTo != "" {
+		mode = rule.ReplyTo
+	}
+	switch mode {
+	case replyToNone:
+		return ""
+	case replyToList:
+		return rcpt
+	}
+	for _, candidate := range []string{parsed.ReplyTo, parsed.From} {
+		if list, err := mail.ParseAddressList(decodeRFC2047(candidate)); err == nil && len(list) > 0 {
+			addrs := make([]string, len(list))
+			for i, a := range list {
+				addrs[i] = a.String()
+			}
+			return strings.Join(addrs, ", ")
+		}
+	}
+	return envelopeFrom
+}
+
+// forwardEnvelopeFrom 规则启用 rewrite_sender 时返回改写后的信封发件人 (VERP 退信地址)
+// 退信由本域名的退信邮箱接收并交给 DSN 解析器，同时使 SPF 按本域名校验；VERP 标记带签名 (bounce+fwd-<规则ID>.<签名>@)
+func forwardEnvelopeFrom(rule *database.ForwardRule, domain *database.Domain) string {
+	if rule == nil || !rule.RewriteSender || domain == nil || domain.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s+%s@%s", bounceLocalPart, signVERPToken(fmt.Sprintf("fwd-%d", rule.ID)), domain.Name)
+}
@@ -0,0 +1,94 @@
+package receiver
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestCompressImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 1200; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, ok := compressImage(buf.Bytes(), "image/jpeg; name=photo.jpg", 300, 70)
+	if !ok || len(out) >= buf.Len() {
+		t.Fatalf("expected smaller output, ok=%v %d -> %d", ok, buf.Len(), len(out))
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || format != "jpeg" || cfg.Width != 300 || cfg.Height != 150 {
+		t.Errorf("got %s %dx%d (%v), want jpeg 300x150", format, cfg.Width, cfg.Height, err)
+	}
+
+	if _, ok := compressImage(buf.Bytes(), "application/pdf", 300, 70); ok {
+		t.Error("non-image content type should be skipped")
+	}
+	if _, ok := compressImage([]byte("not an image"), "image/png", 300, 70); ok {
+		t.Error("undecodable data should be skipped")
+	}
+}
+
+// withOrientation 在 JPEG 的 SOI 之后插入只含 Orientation 标签的 EXIF 段 (大端 TIFF)
+func withOrientation(jpg []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // 字节序、魔数、IFD0 偏移
+		0, 1, // 1 个条目
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, // Orientation, SHORT, count 1
+		0, 0, 0, 0, // 无下一个 IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	size := len(payload) + 2
+	seg := append([]byte{0xFF, 0xE1, byte(size >> 8), byte(size)}, payload...)
+	return append(append(append([]byte{}, jpg[:2]...), seg...), jpg[2:]...)
+}
+
+func TestCompressImageAppliesOrientation(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 1200; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8(x ^ y), 255})
+		}
+	}
+	// 左上角一块纯红，用于确认旋转方向
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := withOrientation(buf.Bytes(), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", got)
+	}
+	if got := jpegOrientation(buf.Bytes()); got != 1 {
+		t.Errorf("jpegOrientation without EXIF = %d, want 1", got)
+	}
+
+	out, ok := compressImage(data, "image/jpeg", 300, 70)
+	if !ok {
+		t.Fatal("expected compressed output")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 顺时针旋转 90° 后为竖图，原左上角位于右上角
+	if b := img.Bounds(); b.Dx() != 150 || b.Dy() != 300 {
+		t.Fatalf("got %dx%d, want 150x300", b.Dx(), b.Dy())
+	}
+	if r, g, _, _ := img.At(145, 5).RGBA(); r>>8 < 200 || g>>8 > 60 {
+		t.Errorf("top-right pixel is not red: r=%d g=%d", r>>8, g>>8)
+	}
+}
@@ -0,0 +1,77 @@
+package receiver
+
+import (
+	"os"
+	"strings"
+)
+
+// loopHeader 转发邮件时写入的环路标记头
+const loopHeader = "X-Loop"
+
+// loopMarker 本服务写入 X-Loop 的取值 (按主机名区分不同部署)
+var loopMarker = func() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	return "goemail@" + strings.ToLower(host)
+}()
+
+// detectMailLoop 检查邮件的 Received 头是否超过 maxReceived (负数不检查)，超过即视为投递环路。
+// 返回原因，空字符串表示正常
+func detectMailLoop(rawData string, maxReceived int) string {
+	if maxReceived < 0 {
+		return ""
+	}
+	received := 0
+	for _, h := range headerLines(rawData) {
+		if headerName(h) == "received" {
+			received++
+		}
+	}
+	if received > maxReceived {
+		return "too many Received headers"
+	}
+	return ""
+}
+
+// forwardedByUs 检查邮件是否带有本服务写入的 X-Loop 标记 (本服务已转发过一次)
+func forwardedByUs(rawData string) bool {
+	for _, h := range headerLines(rawData) {
+		if headerName(h) == "x-loop" && strings.EqualFold(strings.TrimSpace(h[strings.Index(h, ":")+1:]), loopMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerName 返回头部行的小写头名，不是合法头部行时返回空字符串
+func headerName(line string) string {
+	idx := strings.Index(line, ":")
+	if idx <= 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(line[:idx]))
+}
+
+// headerLines 返回邮件头部的所有头 (已展开折叠行)，同名头分别保留
+func headerLines(rawData string) []string {
+	end := strings.Index(rawData, "\r\n\r\n")
+	if end < 0 {
+		end = strings.Index(rawData, "\n\n")
+	}
+	if end < 0 {
+		end = len(rawData)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(rawData[:end], "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,35 @@
+package receiver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectMailLoop(t *testing.T) {
+	hops := strings.Repeat("Received: from a\r\n\tby b\r\n", 3)
+	if r := detectMailLoop(hops+"Subject: hi\r\n\r\nbody", 3); r != "" {
+		t.Errorf("3 hops within limit, got %q", r)
+	}
+	if r := detectMailLoop(hops+"Received: from c\r\n\r\nReceived: in body", 3); r == "" {
+		t.Error("4 hops over limit not detected")
+	}
+	if r := detectMailLoop(hops+"Received: from c\r\n\r\n", -1); r != "" {
+		t.Errorf("negative limit disables counting, got %q", r)
+	}
+	// X-Loop 标记不再导致丢弃，只阻止再次转发
+	if r := detectMailLoop("X-Loop: "+loopMarker+"\r\n\r\nbody", 50); r != "" {
+		t.Errorf("X-Loop marker should not drop the message, got %q", r)
+	}
+}
+
+func TestForwardedByUs(t *testing.T) {
+	if !forwardedByUs("X-Loop: " + strings.ToUpper(loopMarker) + "\r\nSubject: hi\r\n\r\nbody") {
+		t.Error("own X-Loop marker not honored")
+	}
+	if forwardedByUs("X-Loop: other@example.com\r\n\r\nbody") {
+		t.Error("foreign X-Loop should not block forwarding")
+	}
+	if forwardedByUs("Subject: hi\r\n\r\nX-Loop: " + loopMarker) {
+		t.Error("X-Loop in the body should be ignored")
+	}
+}
@@ -0,0 +1,108 @@
+package receiver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 反向解析 (PTR) 检查结果
+const (
+	ptrPass     = "pass"     // 存在 PTR 且正向解析回同一 IP (FCrDNS)
+	ptrNone     = "none"     // 无 PTR 记录
+	ptrMismatch = "mismatch" // 有 PTR 但正向解析不包含该 IP
+)
+
+// ptrCacheTTL PTR 检查结果的缓存时间
+const ptrCacheTTL = time.Hour
+
+type ptrEntry struct {
+	status  string
+	name    string
+	expires time.Time
+}
+
+var (
+	ptrCacheMu sync.Mutex
+	ptrCache   = map[string]ptrEntry{}
+)
+
+// checkPTR 检查远端 IP 的反向解析及正向确认 (FCrDNS)，返回结果与 PTR 主机名
+// 回环与内网地址不检查 (返回空)；DNS 查询失败 (非 NXDOMAIN) 时不缓存，结果视为 pass 以免误判
+func checkPTR(remoteAddr string) (string, string) {
+	ip := net.ParseIP(hostOnly(remoteAddr))
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+		return "", ""
+	}
+	key := ip.String()
+	now := time.Now()
+
+	ptrCacheMu.Lock()
+	if e, ok := ptrCache[key]; ok && now.Before(e.expires) {
+		ptrCacheMu.Unlock()
+		return e.status, e.name
+	}
+	ptrCacheMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, key)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			return ptrPass, ""
+		}
+	}
+	status, name := fcrdns(ip, names, func(host string) ([]net.IP, error) {
+		return net.DefaultResolver.LookupIP(ctx, "ip", host)
+	})
+
+	ptrCacheMu.Lock()
+	// 简单的容量保护：缓存过大时清理已过期条目
+	if len(ptrCache) > 10000 {
+		for k, e := range ptrCache {
+			if now.After(e.expires) {
+				delete(ptrCache, k)
+			}
+		}
+	}
+	ptrCache[key] = ptrEntry{status: status, name: name, expires: now.Add(ptrCacheTTL)}
+	ptrCacheMu.Unlock()
+	return status, name
+}
+
+// ptrTag 返回 PTR 检查失败时附加到收件箱邮件的标签
+func ptrTag(status string) string {
+	switch status {
+	case ptrNone:
+		return "no-ptr"
+	case ptrMismatch:
+		return "ptr-mismatch"
+	}
+	return ""
+}
+
+// fcrdns 依次正向解析 PTR 主机名 (最多 3 个)，任一解析结果包含原 IP 即为 pass
+func fcrdns(ip net.IP, names []string, resolve func(string) ([]net.IP, error)) (string, string) {
+	if len(names) == 0 {
+		return ptrNone, ""
+	}
+	first := strings.TrimSuffix(names[0], ".")
+	for i, name := range names {
+		if i >= 3 {
+			break
+		}
+		name = strings.TrimSuffix(name, ".")
+		addrs, err := resolve(name)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.Equal(ip) {
+				return ptrPass, name
+			}
+		}
+	}
+	return ptrMismatch, first
+}
@@ -3,8 +3,12 @@ package receiver
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,17 +16,21 @@ import (
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net"
+	"net/mail"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"goemail/internal/config"
 	"goemail/internal/database"
+	"goemail/internal/locale"
 	"goemail/internal/mailer"
+	"goemail/internal/security"
 
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/simplifiedchinese"
@@ -38,6 +46,13 @@ type SMTPSession struct {
 	data       strings.Builder
 	inData     bool
 	tlsEnabled bool
+	tooLarge   bool // DATA 超出大小限制，丢弃剩余内容直到结束符
+	greeted    bool // 已收到 HELO/EHLO
+	ptrStatus  string // 反向解析检查结果 (pass / none / mismatch)，未启用或未检查时为空
+	ptrName    string // PTR 主机名
+
+	authenticated bool   // 已通过 AUTH 认证
+	authUser      string // AUTH 用户名 (仅用于日志)
 }
 
 // RateLimiter IP 速率限制器
@@ -170,7 +185,17 @@ func loadTLSConfig() *tls.Config {
 		keyFile = config.AppConfig.KeyFile
 	}
 
+	// 按 SNI 选择域名证书，未匹配时回退到默认证书
+	cfg := &tls.Config{GetCertificate: getSNICertificate}
+	config.ApplyTLSPolicy(cfg)
+
+	// 没有默认证书时只在证书管理中存在有效证书时启用 STARTTLS，SNI 未匹配的握手使用其中任一证书
 	if certFile == "" || keyFile == "" {
+		if hasManagedCertificates() {
+			log.Println("[Receiver] No default TLS certificate, using per-domain certificates only")
+			cfg.GetCertificate = getManagedCertificate
+			return cfg
+		}
 		log.Println("[Receiver] TLS enabled but no certificate configured")
 		return nil
 	}
@@ -178,13 +203,15 @@ func loadTLSConfig() *tls.Config {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		log.Printf("[Receiver] Failed to load TLS certificate: %v", err)
+		if hasManagedCertificates() {
+			cfg.GetCertificate = getManagedCertificate
+			return cfg
+		}
 		return nil
 	}
 
-	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg
 }
 
 // StartReceiver 启动 SMTP 接收服务
@@ -200,12 +227,19 @@ func StartReceiver() {
 	// 加载黑名单
 	updateBlacklist()
 
+	// 加载垃圾邮件关键词与自动打标签规则
+	ReloadSpamKeywords()
+	ReloadTagRules()
+
 	// 加载 TLS 配置
 	tlsConfig = loadTLSConfig()
 	if tlsConfig != nil {
 		log.Println("[Receiver] STARTTLS enabled")
 	}
 
+	// 加载免认证的可信来源
+	updateTrustedNetworks()
+
 	port := config.AppConfig.ReceiverPort
 	if port == "" {
 		port = "25"
@@ -235,6 +269,26 @@ func StartReceiver() {
 	}()
 }
 
+// errLineTooLong 单行超过长度限制
+var errLineTooLong = errors.New("line too long")
+
+// readLine 读取一行 (含换行符)，超过 maxLen 字节时立即返回 errLineTooLong，避免无限缓冲
+// maxLen <= 0 表示不限制
+func readLine(r *bufio.Reader, maxLen int) (string, error) {
+	var buf []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if maxLen > 0 && len(buf)+len(chunk) > maxLen {
+			return "", errLineTooLong
+		}
+		buf = append(buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(buf), err
+	}
+}
+
 func handleConnection(conn net.Conn) {
 	defer conn.Close()
 
@@ -246,10 +300,16 @@ func handleConnection(conn net.Conn) {
 		conn.Write([]byte("554 Your IP is blocked\r\n"))
 		return
 	}
+	if isAutoBlocked(remoteIP) {
+		log.Printf("[Receiver] Blocked auto-blocked IP: %s", remoteIP)
+		conn.Write([]byte("554 Your IP is temporarily blocked due to abuse\r\n"))
+		return
+	}
 
 	// 检查速率限制
 	if !rateLimiter.Allow(remoteIP) {
 		log.Printf("[Receiver] Rate limit exceeded for IP: %s", remoteIP)
+		recordAbuse(remoteIP, "rate_limit", abuseRateLimited)
 		conn.Write([]byte("421 Too many connections, try again later\r\n"))
 		return
 	}
@@ -261,15 +321,36 @@ func handleConnection(conn net.Conn) {
 		to:       make([]string, 0),
 	}
 
-	// 设置超时
-	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	// 反向解析检查 (FCrDNS)：默认仅作为垃圾邮件信号，配置后拒绝无 PTR 的来源
+	if config.AppConfig.ReceiverPTRCheck {
+		session.ptrStatus, session.ptrName = checkPTR(remoteIP)
+		if session.ptrStatus == ptrNone && config.AppConfig.ReceiverPTRReject {
+			log.Printf("[Receiver] Rejected %s: no reverse DNS", remoteIP)
+			conn.Write([]byte("550 5.7.25 Client host rejected: cannot find your reverse hostname\r\n"))
+			return
+		}
+	}
 
 	// 发送欢迎消息
+	session.conn.SetDeadline(time.Now().Add(session.idleTimeout()))
 	session.send("220 GoEmail SMTP Ready")
 
 	for {
-		line, err := session.reader.ReadString('\n')
+		// 每次读取前按当前阶段刷新超时：命令阶段与 DATA 阶段分别计时，有数据到达即重置
+		session.conn.SetDeadline(time.Now().Add(session.idleTimeout()))
+		line, err := readLine(session.reader, config.AppConfig.ReceiverMaxLineLen)
 		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				log.Printf("[Receiver] Session from %s timed out (in data: %v)", session.remoteIP, session.inData)
+				session.send("421 4.4.2 Timeout exceeded, closing connection")
+				return
+			}
+			if err == errLineTooLong {
+				log.Printf("[Receiver] Line too long from %s, closing session", session.remoteIP)
+				session.send("500 Line too long")
+				recordAbuse(session.remoteIP, "line_too_long", abuseProtocol)
+				return
+			}
 			if err != io.EOF {
 				log.Printf("[Receiver] Read error from %s: %v", session.remoteIP, err)
 			}
@@ -286,21 +367,25 @@ func handleConnection(conn net.Conn) {
 			if line == "." {
 				// 数据结束，处理邮件
 				session.inData = false
-				if err := session.processEmail(); err != nil {
+				if session.tooLarge {
+					session.tooLarge = false
+					session.send("552 Message size exceeds limit")
+				} else if err := session.processEmail(); err != nil {
 					session.send("550 Failed to process email: " + err.Error())
 				} else {
 					session.send("250 OK: Message queued for forwarding")
 				}
 				// 重置会话
-				session.from = ""
-				session.to = make([]string, 0)
-				session.data.Reset()
+				session.resetTransaction()
 			} else {
-				// 检查邮件大小限制
-				maxSize := config.AppConfig.ReceiverMaxMsgSize * 1024
-				if maxSize > 0 && session.data.Len()+len(line) > maxSize {
-					session.inData = false
-					session.send("552 Message size exceeds limit")
+				if session.tooLarge {
+					continue
+				}
+				// 检查邮件大小限制 (按字节精确计算，含 CRLF)
+				maxSize := maxMessageBytes()
+				if maxSize > 0 && int64(session.data.Len())+int64(len(line))+2 > maxSize {
+					log.Printf("[Receiver] Message from %s exceeds size limit (%d bytes)", session.remoteIP, maxSize)
+					session.tooLarge = true
 					session.data.Reset()
 					continue
 				}
@@ -314,35 +399,90 @@ func handleConnection(conn net.Conn) {
 			continue
 		}
 
-		// 解析命令
-		cmd := strings.ToUpper(line)
-		if strings.HasPrefix(cmd, "HELO") || strings.HasPrefix(cmd, "EHLO") {
-			session.handleHelo(line)
-		} else if strings.HasPrefix(cmd, "MAIL FROM:") {
-			session.handleMailFrom(line)
-		} else if strings.HasPrefix(cmd, "RCPT TO:") {
-			session.handleRcptTo(line)
-		} else if cmd == "DATA" {
-			session.handleData()
-		} else if cmd == "STARTTLS" {
-			session.handleStartTLS()
-		} else if cmd == "QUIT" {
-			session.send("221 Bye")
+		if session.handleCommand(line) {
 			return
-		} else if cmd == "RSET" {
-			session.from = ""
-			session.to = make([]string, 0)
-			session.data.Reset()
-			session.send("250 OK")
-		} else if cmd == "NOOP" {
-			session.send("250 OK")
-		} else {
-			session.send("502 Command not implemented")
 		}
 	}
 }
 
+// handleCommand 处理一条 SMTP 命令，返回 true 表示应关闭连接
+// 命令顺序严格遵循 RFC 5321: HELO/EHLO -> MAIL -> RCPT (可多次) -> DATA，乱序命令返回 503
+func (s *SMTPSession) handleCommand(line string) bool {
+	cmd := strings.ToUpper(line)
+	verb := cmd
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		verb = cmd[:i]
+	}
+
+	switch {
+	case verb == "HELO" || verb == "EHLO":
+		s.handleHelo(line)
+	case verb == "QUIT":
+		s.send("221 Bye")
+		return true
+	case verb == "NOOP":
+		s.send("250 OK")
+	case verb == "RSET":
+		s.resetTransaction()
+		s.send("250 OK")
+	case verb == "VRFY" || verb == "EXPN":
+		// 不透露收件人是否存在，防止地址枚举
+		s.send("252 Cannot verify user, but will accept message and attempt delivery")
+	case !s.greeted && (verb == "MAIL" || verb == "RCPT" || verb == "DATA" || verb == "STARTTLS" || verb == "AUTH"):
+		s.send("503 Send HELO/EHLO first")
+	case strings.HasPrefix(cmd, "MAIL FROM:"):
+		if s.from != "" {
+			s.send("503 Sender already specified")
+			return false
+		}
+		s.handleMailFrom(line)
+	case strings.HasPrefix(cmd, "RCPT TO:"):
+		if s.from == "" {
+			s.send("503 Need MAIL command first")
+			return false
+		}
+		s.handleRcptTo(line)
+	case cmd == "DATA":
+		s.handleData()
+	case cmd == "STARTTLS":
+		if s.from != "" {
+			s.send("503 STARTTLS not allowed during a mail transaction")
+			return false
+		}
+		s.handleStartTLS()
+	case verb == "AUTH":
+		s.handleAuth(line)
+	case verb == "MAIL" || verb == "RCPT":
+		s.send("501 Syntax error in parameters")
+	default:
+		s.send("502 Command not implemented")
+		recordAbuse(s.remoteIP, "unknown_command", abuseProtocol)
+	}
+	return false
+}
+
+// resetTransaction 清除当前邮件事务 (保留 HELO 状态)
+func (s *SMTPSession) resetTransaction() {
+	s.from = ""
+	s.to = make([]string, 0)
+	s.data.Reset()
+}
+
+// idleTimeout 返回当前阶段的空闲超时
+func (s *SMTPSession) idleTimeout() time.Duration {
+	seconds := config.AppConfig.ReceiverCommandTimeout
+	if s.inData {
+		seconds = config.AppConfig.ReceiverDataTimeout
+	}
+	if seconds <= 0 {
+		seconds = 300
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func (s *SMTPSession) send(msg string) {
+	// 写超时单独刷新，避免邮件处理耗时后响应写入失败
+	s.conn.SetWriteDeadline(time.Now().Add(s.idleTimeout()))
 	s.conn.Write([]byte(msg + "\r\n"))
 }
 
@@ -353,14 +493,21 @@ func (s *SMTPSession) handleHelo(line string) {
 		return
 	}
 	
+	// HELO/EHLO 隐含 RSET
+	s.resetTransaction()
+	s.greeted = true
+
 	cmd := strings.ToUpper(parts[0])
 	if cmd == "EHLO" {
 		s.send("250-GoEmail")
-		s.send(fmt.Sprintf("250-SIZE %d", config.AppConfig.ReceiverMaxMsgSize*1024))
+		s.send(fmt.Sprintf("250-SIZE %d", maxMessageBytes()))
 		s.send("250-8BITMIME")
 		if tlsConfig != nil && !s.tlsEnabled {
 			s.send("250-STARTTLS")
 		}
+		if s.authAvailable() && !s.authenticated {
+			s.send("250-AUTH PLAIN LOGIN")
+		}
 		s.send("250 OK")
 	} else {
 		s.send("250 GoEmail")
@@ -390,10 +537,11 @@ func (s *SMTPSession) handleStartTLS() {
 	s.reader = bufio.NewReader(tlsConn)
 	s.tlsEnabled = true
 
-	// 重置会话状态
-	s.from = ""
-	s.to = make([]string, 0)
-	s.data.Reset()
+	// 重置会话状态，客户端必须重新 EHLO (RFC 3207)
+	s.resetTransaction()
+	s.greeted = false
+	s.authenticated = false
+	s.authUser = ""
 
 	log.Printf("[Receiver] TLS connection established from %s", s.remoteIP)
 }
@@ -404,12 +552,28 @@ func (s *SMTPSession) handleMailFrom(line string) {
 		s.send("530 Must issue STARTTLS command first")
 		return
 	}
+	// 启用认证要求时，非可信来源必须先 AUTH，拒绝匿名投递
+	if s.authRequired() {
+		s.send("530 5.7.0 Authentication required")
+		return
+	}
 
 	addr := extractEmail(line[10:])
 	if addr == "" {
 		s.send("501 Syntax error in MAIL FROM")
 		return
 	}
+
+	// 处理 SIZE 参数 (RFC 1870)，超过限制时在 DATA 之前直接拒绝
+	size, err := parseSizeParam(line[10:])
+	if err != nil {
+		s.send("501 Syntax error in SIZE parameter")
+		return
+	}
+	if maxSize := maxMessageBytes(); maxSize > 0 && size > maxSize {
+		s.send("552 Message size exceeds fixed maximum message size")
+		return
+	}
 	s.from = addr
 	s.send("250 OK")
 }
@@ -421,15 +585,15 @@ func (s *SMTPSession) handleRcptTo(line string) {
 		return
 	}
 
-	// 检查是否有匹配的转发规则
+	// 检查是否有匹配的转发规则，无匹配时检查域名是否开启 Catch-all
 	rule, domain := findForwardRule(addr)
-	if rule == nil {
+	if rule == nil && (domain == nil || !domain.CatchAll) {
 		s.send("550 Recipient not accepted")
+		recordAbuse(s.remoteIP, "rejected_rcpt", abuseRejectedRcpt)
 		return
 	}
 
 	s.to = append(s.to, addr)
-	_ = domain
 	s.send("250 OK")
 }
 
@@ -452,6 +616,17 @@ func (s *SMTPSession) processEmail() error {
 	// 解析 MIME 邮件
 	parsed := parseMIMEMessage(rawData)
 
+	// 环路检测：Received 头过多时直接丢弃；带本服务 X-Loop 标记的邮件照常入库，只是不再转发，
+	// 避免邮件在转发规则间无限往返
+	if reason := detectMailLoop(rawData, config.AppConfig.ReceiverMaxReceived); reason != "" {
+		log.Printf("[Receiver] Mail loop detected from %s to %v (%s), dropped", s.from, s.to, reason)
+		return nil
+	}
+	looped := forwardedByUs(rawData)
+	if looped {
+		log.Printf("[Receiver] Mail from %s to %v already forwarded by this server (X-Loop), stored without forwarding", s.from, s.to)
+	}
+
 	// 垃圾邮件检测
 	isSpam := false
 	spamReason := ""
@@ -459,16 +634,58 @@ func (s *SMTPSession) processEmail() error {
 		isSpam, spamReason = detectSpam(s.from, parsed.Subject, parsed.Body)
 		if isSpam {
 			log.Printf("[Receiver] Spam detected from %s: %s", s.from, spamReason)
+			recordAbuse(s.remoteIP, "spam", abuseSpam)
 		}
 	}
+
+	// 附件病毒扫描，命中时隔离 (打标签、不保存附件、不转发)
+	quarantined := false
+	if virus, err := scanAttachments(parsed.Attachments); err != nil {
+		quarantined = true
+		log.Printf("[Receiver] Attachment scan failed for mail from %s, quarantined: %v", s.from, err)
+	} else if virus != "" {
+		quarantined = true
+		log.Printf("[Receiver] Virus detected in mail from %s: %s", s.from, virus)
+	}
+
+	var tagList []string
+	if isSpam {
+		tagList = append(tagList, "spam")
+	}
+	if tag := ptrTag(s.ptrStatus); tag != "" {
+		tagList = append(tagList, tag)
+		log.Printf("[Receiver] Mail from %s (%s): reverse DNS %s %s", s.from, s.remoteIP, s.ptrStatus, s.ptrName)
+	}
+	if quarantined {
+		tagList = append(tagList, "quarantine")
+	}
+	for _, tag := range applyTagRules(s.from, parsed.Subject, rawData) {
+		tagList = appendTag(tagList, tag)
+	}
+	tags := ""
+	if len(tagList) > 0 {
+		tagsJSON, _ := json.Marshal(tagList)
+		tags = string(tagsJSON)
+	}
+
+	contactCaptured := false
+	messageHash := computeMessageHash(rawData, parsed)
+	messageID := ""
+	if ids := parseMessageIDs(parsed.MessageID); len(ids) > 0 {
+		messageID = ids[0]
+	}
+	threadSubject, _ := normalizeSubject(parsed.Subject)
+	dedupeWindow := time.Duration(config.AppConfig.ReceiverDedupeWindow) * time.Minute
 	
 	// 对每个收件人进行处理
 	for _, rcpt := range s.to {
-		// 1. 保存到 Inbox (垃圾邮件也保存，但标记 Tags)
-		tags := ""
-		if isSpam {
-			tags = `["spam"]`
+		// 重复投递检测: 窗口期内同一收件人收到相同指纹的邮件则跳过 (不入库、不转发)
+		if dedupeWindow > 0 && isDuplicateMessage(messageHash, rcpt, dedupeWindow) {
+			log.Printf("[Receiver] Duplicate message from %s to %s skipped (hash %s)", s.from, rcpt, messageHash[:12])
+			continue
 		}
+
+		// 1. 保存到 Inbox (垃圾邮件也保存，但标记 Tags)
 		inboxItem := database.Inbox{
 			FromAddr: s.from,
 			ToAddr:   rcpt,
@@ -478,44 +695,90 @@ func (s *SMTPSession) processEmail() error {
 			RemoteIP: s.remoteIP,
 			IsRead:   false,
 			Tags:     tags,
+
+			MessageHash: messageHash,
+
+			MessageID:     messageID,
+			InReplyTo:     parsed.InReplyTo,
+			References:    parsed.References,
+			ThreadID:      resolveThreadID(parsed, rcpt, messageHash),
+			ThreadSubject: threadSubject,
+		}
+		// 启用静态加密时正文与原始数据加密入库
+		if err := sealInboxItem(&inboxItem); err != nil {
+			log.Printf("[Receiver] Failed to encrypt mail from %s to %s: %v", s.from, rcpt, err)
+			return err
 		}
 		database.DB.Create(&inboxItem)
 
+		if quarantined {
+			continue
+		}
+
 		// 保存附件
 		for _, att := range parsed.Attachments {
 			saveInboxAttachment(inboxItem.ID, att)
 		}
 
-		// 2. 查找转发规则并转发
-		rule, _ := findForwardRule(rcpt)
-		if rule == nil || !rule.Enabled {
+		// 2. 查找转发规则并转发 (无规则时使用域名的 Catch-all 默认转发地址)
+		rule, domain := findForwardRule(rcpt)
+
+		// 退信邮箱：交给 DSN 解析器，不收集联系人、不转发
+		if rule != nil && rule.Bounce {
+			handleBounce(inboxItem.ID, rcpt, rawData)
+			continue
+		}
+
+		// 自动收集联系人 (每封邮件只处理一次，垃圾/隔离邮件不收集)
+		if !contactCaptured && !isSpam && domain != nil && domain.AutoCaptureContacts {
+			contactCaptured = true
+			captureContact(s.from, parsed.From)
+		}
+
+		ruleID, forwardTo := forwardTarget(rule, domain)
+		if forwardTo == "" || looped {
 			continue
 		}
 
 		// 创建转发请求
 		forwardReq := mailer.SendRequest{
 			From:    s.from,
-			To:      rule.ForwardTo,
-			Subject: fmt.Sprintf("[转发] %s", parsed.Subject),
+			To:      forwardTo,
+			Subject: locale.T("forward.subject", parsed.Subject),
 			Body:    formatForwardBody(s.from, rcpt, parsed.Body),
+
+			// 转发保留原发件人，其域名不属于本系统，不做发件域名验证
+			AllowUnverifiedDomain: true,
+			ChannelDomainOverride: "forwarded mail keeps the original sender",
+			MaxRetries:            config.AppConfig.ForwardMaxRetries,
+			EnvelopeFrom:          forwardEnvelopeFrom(rule, domain),
+			// 转发是收件人自己的邮件，不计入频率限制
+			BypassRecipientInterval: true,
+
+			Headers: map[string]string{loopHeader: loopMarker},
+		}
+		if replyTo := forwardReplyTo(rule, parsed, s.from, rcpt); replyTo != "" {
+			forwardReq.Headers["Reply-To"] = replyTo
 		}
 
-		_, err := mailer.SendEmailAsync(forwardReq)
+		queueID, err := mailer.SendEmailAsync(forwardReq)
 		
 		logEntry := database.ForwardLog{
-			RuleID:    rule.ID,
+			RuleID:    ruleID,
 			FromAddr:  s.from,
 			ToAddr:    rcpt,
-			ForwardTo: rule.ForwardTo,
+			ForwardTo: forwardTo,
 			Subject:   parsed.Subject,
+			QueueID:   queueID,
 			RemoteIP:  s.remoteIP,
 		}
 
+		// 入队成功只是 pending，最终状态由队列任务完成/失败时回写
 		if err != nil {
 			logEntry.Status = "failed"
 			logEntry.ErrorMsg = err.Error()
 		} else {
-			logEntry.Status = "success"
+			logEntry.Status = "pending"
 		}
 
 		database.DB.Create(&logEntry)
@@ -529,6 +792,12 @@ type ParsedEmail struct {
 	Subject     string
 	Body        string
 	ContentType string
+	MessageID   string
+	InReplyTo   string
+	References  string
+	From        string
+	ReplyTo     string
+	Date        string
 	Attachments []ParsedAttachment
 }
 
@@ -559,6 +828,12 @@ func parseMIMEMessage(rawData string) ParsedEmail {
 	headers := parseHeaders(headerPart)
 	result.Subject = decodeRFC2047(headers["subject"])
 	result.ContentType = headers["content-type"]
+	result.MessageID = strings.TrimSpace(headers["message-id"])
+	result.InReplyTo = strings.TrimSpace(headers["in-reply-to"])
+	result.References = strings.TrimSpace(headers["references"])
+	result.From = strings.TrimSpace(headers["from"])
+	result.ReplyTo = strings.TrimSpace(headers["reply-to"])
+	result.Date = strings.TrimSpace(headers["date"])
 
 	// 解析正文
 	contentType := strings.ToLower(headers["content-type"])
@@ -616,6 +891,50 @@ func parseHeaders(headerPart string) map[string]string {
 	return headers
 }
 
+// HeaderField 原始邮件头中的一个字段 (保持原有顺序，重复字段如 Received 各自保留)
+type HeaderField struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`             // 展开折叠行后的原始值
+	Decoded string `json:"decoded,omitempty"` // RFC 2047 解码后的值 (与原始值相同时省略)
+}
+
+// HeaderBlock 返回原始邮件的头部部分 (首个空行之前)
+func HeaderBlock(raw string) string {
+	if idx := strings.Index(raw, "\r\n\r\n"); idx >= 0 {
+		return raw[:idx]
+	}
+	if idx := strings.Index(raw, "\n\n"); idx >= 0 {
+		return raw[:idx]
+	}
+	return raw
+}
+
+// ParseHeaderList 按原始顺序解析邮件头，保留重复字段
+func ParseHeaderList(raw string) []HeaderField {
+	var fields []HeaderField
+	for _, line := range strings.Split(HeaderBlock(raw), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		fields = append(fields, HeaderField{Name: line[:idx], Value: strings.TrimSpace(line[idx+1:])})
+	}
+	for i := range fields {
+		if decoded := decodeRFC2047(fields[i].Value); decoded != fields[i].Value {
+			fields[i].Decoded = decoded
+		}
+	}
+	return fields
+}
+
 // decodeRFC2047 解码 RFC 2047 编码的头部
 func decodeRFC2047(s string) string {
 	decoder := new(mime.WordDecoder)
@@ -770,6 +1089,149 @@ func decodeCharset(s, charset string) string {
 	}
 }
 
+// charsetReader 供 mime.WordDecoder 使用的字符集转换
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(string(data), charset)), nil
+}
+
+// automatedLocalParts 自动发件地址的本地部分特征，不收集为联系人
+var automatedLocalParts = []string{"noreply", "no-reply", "no_reply", "donotreply", "do-not-reply", "mailer-daemon", "postmaster", "bounce"}
+
+// captureContact 将来信发件人加入收件配置指定的联系人分组
+// 优先使用 From 头中的显示名称与地址，解析失败时使用信封发件人；已是联系人 (任意分组) 的地址跳过
+func captureContact(envelopeFrom, fromHeader string) {
+	groupID := config.AppConfig.ReceiverContactGroupID
+	if groupID == 0 {
+		return
+	}
+
+	email := envelopeFrom
+	name := ""
+	if fromHeader != "" {
+		parser := mail.AddressParser{WordDecoder: &mime.WordDecoder{CharsetReader: charsetReader}}
+		if addr, err := parser.Parse(fromHeader); err == nil {
+			email = addr.Address
+			name = addr.Name
+		}
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || !strings.Contains(email, "@") {
+		return
+	}
+
+	localPart := email[:strings.Index(email, "@")]
+	for _, p := range automatedLocalParts {
+		if strings.Contains(localPart, p) {
+			return
+		}
+	}
+
+	var count int64
+	database.DB.Model(&database.Contact{}).Where("LOWER(email) = ?", email).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	contact := database.Contact{
+		Email:   email,
+		Name:    name,
+		GroupID: groupID,
+		Status:  "active",
+	}
+	if err := database.DB.Create(&contact).Error; err != nil {
+		log.Printf("[Receiver] Failed to capture contact %s: %v", email, err)
+		return
+	}
+	log.Printf("[Receiver] Captured contact %s into group %d", email, groupID)
+}
+
+// computeMessageHash 计算邮件指纹
+// 有 Message-ID 时使用 Message-ID + From + Date，否则使用规范化后的原始内容 (忽略换行差异与中转添加的 Received 头)
+func computeMessageHash(rawData string, parsed ParsedEmail) string {
+	h := sha256.New()
+	if parsed.MessageID != "" {
+		h.Write([]byte(parsed.MessageID + "\n" + parsed.From + "\n" + parsed.Date))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	normalized := strings.ReplaceAll(rawData, "\r\n", "\n")
+	inReceived := false
+	inHeader := true
+	for _, line := range strings.Split(normalized, "\n") {
+		if inHeader {
+			if line == "" {
+				inHeader = false
+			} else if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				if inReceived {
+					continue
+				}
+			} else {
+				inReceived = strings.HasPrefix(strings.ToLower(line), "received:")
+				if inReceived {
+					continue
+				}
+			}
+		}
+		h.Write([]byte(strings.TrimRight(line, " \t")))
+		h.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isDuplicateMessage 检查窗口期内是否已收到相同指纹的邮件
+func isDuplicateMessage(hash, rcpt string, window time.Duration) bool {
+	var count int64
+	database.DB.Model(&database.Inbox{}).
+		Where("message_hash = ? AND to_addr = ? AND created_at > ?", hash, rcpt, time.Now().Add(-window)).
+		Count(&count)
+	return count > 0
+}
+
+// maxConcurrentScans 单封邮件同时进行的附件扫描数 (每个扫描占用一个 clamd 连接)
+const maxConcurrentScans = 4
+
+// scanAttachments 并发扫描所有附件 (最多 maxConcurrentScans 个同时进行)，返回第一个检测到的病毒名
+func scanAttachments(atts []ParsedAttachment) (string, error) {
+	if len(atts) == 0 {
+		return "", nil
+	}
+
+	type scanResult struct {
+		virus string
+		err   error
+	}
+	results := make(chan scanResult, len(atts))
+	slots := make(chan struct{}, maxConcurrentScans)
+	for _, att := range atts {
+		slots <- struct{}{}
+		go func(data []byte) {
+			defer func() { <-slots }()
+			virus, err := security.ScanAttachment(data)
+			results <- scanResult{virus: virus, err: err}
+		}(att.Data)
+	}
+
+	var firstErr error
+	virus := ""
+	for range atts {
+		r := <-results
+		if r.virus != "" && virus == "" {
+			virus = r.virus
+		}
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	if virus != "" {
+		return virus, nil
+	}
+	return "", firstErr
+}
+
 // saveInboxAttachment 保存收件箱附件
 func saveInboxAttachment(inboxID uint, att ParsedAttachment) {
 	if len(att.Data) == 0 {
@@ -788,24 +1250,45 @@ func saveInboxAttachment(inboxID uint, att ParsedAttachment) {
 	newFilename := fmt.Sprintf("%d_%d%s", inboxID, time.Now().UnixNano(), ext)
 	localPath := filepath.Join(saveDir, newFilename)
 
-	if err := os.WriteFile(localPath, att.Data, 0644); err != nil {
-		log.Printf("[Receiver] Failed to save attachment: %v", err)
-		return
-	}
-
-	// 记录到数据库
+	data := att.Data
 	dbFile := database.AttachmentFile{
 		Filename:    att.Filename,
 		FilePath:    localPath,
-		FileSize:    int64(len(att.Data)),
 		ContentType: att.ContentType,
 		Source:      "inbox",
 		RelatedTo:   fmt.Sprintf("inbox:%d", inboxID),
 	}
+
+	// 大图片压缩 (可选保留原图)，仅在压缩后更小时替换
+	cfg := config.AppConfig
+	if cfg.ReceiverImageCompress && len(data) > cfg.ReceiverImageMinSize*1024 {
+		if compressed, ok := compressImage(data, att.ContentType, cfg.ReceiverImageMaxDim, cfg.ReceiverImageQuality); ok {
+			if cfg.ReceiverImageKeepOriginal {
+				origPath := localPath + ".orig"
+				if err := writeInboxFile(origPath, data); err != nil {
+					log.Printf("[Receiver] Failed to save original attachment: %v", err)
+				} else {
+					dbFile.OriginalPath = origPath
+				}
+			}
+			log.Printf("[Receiver] Compressed image attachment %s: %d -> %d bytes", att.Filename, len(data), len(compressed))
+			dbFile.OriginalSize = int64(len(data))
+			data = compressed
+		}
+	}
+
+	if err := writeInboxFile(localPath, data); err != nil {
+		log.Printf("[Receiver] Failed to save attachment: %v", err)
+		return
+	}
+
+	// 记录到数据库
+	dbFile.FileSize = int64(len(data))
 	database.DB.Create(&dbFile)
 }
 
 // findForwardRule 查找匹配的转发规则
+// 域名存在但没有匹配规则时，返回 (nil, domain)，供 Catch-all 判断使用
 func findForwardRule(email string) (*database.ForwardRule, *database.Domain) {
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
@@ -843,34 +1326,98 @@ func findForwardRule(email string) (*database.ForwardRule, *database.Domain) {
 		}
 	}
 
-	return nil, nil
+	return nil, &domain
+}
+
+// forwardTarget 根据匹配结果确定转发目标 (规则优先，其次 Catch-all 默认转发地址)
+func forwardTarget(rule *database.ForwardRule, domain *database.Domain) (uint, string) {
+	if rule != nil && rule.Enabled {
+		return rule.ID, rule.ForwardTo
+	}
+	if rule == nil && domain != nil && domain.CatchAll {
+		return 0, domain.CatchAllForwardTo
+	}
+	return 0, ""
+}
+
+// ForwardMatch 转发规则匹配结果
+type ForwardMatch struct {
+	Email     string                `json:"email"`
+	Domain    string                `json:"domain"`     // 匹配到的域名，为空表示域名未配置
+	Accepted  bool                  `json:"accepted"`   // 接收服务是否接受该收件人 (RCPT TO)
+	Rule      *database.ForwardRule `json:"rule"`       // 匹配到的规则，nil 表示无匹配
+	CatchAll  bool                  `json:"catch_all"`  // 无规则匹配，由 Catch-all 兜底接收
+	ForwardTo string                `json:"forward_to"` // 最终转发目标，为空表示仅存入收件箱
+}
+
+// MatchForwardRule 模拟收件流程，返回指定地址的规则匹配结果 (与实际收件使用相同的匹配顺序)
+func MatchForwardRule(email string) ForwardMatch {
+	email = strings.ToLower(strings.TrimSpace(email))
+	result := ForwardMatch{Email: email}
+
+	rule, domain := findForwardRule(email)
+	if domain != nil {
+		result.Domain = domain.Name
+	}
+	result.Rule = rule
+	result.Accepted = rule != nil || (domain != nil && domain.CatchAll)
+	result.CatchAll = rule == nil && result.Accepted
+	_, result.ForwardTo = forwardTarget(rule, domain)
+	return result
 }
 
 // extractEmail 从 SMTP 命令中提取邮箱地址
 func extractEmail(s string) string {
 	s = strings.TrimSpace(s)
-	if strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
-		s = s[1 : len(s)-1]
-	}
+	// 去掉 ESMTP 参数 (如 SIZE=1024)
 	if idx := strings.Index(s, " "); idx > 0 {
 		s = s[:idx]
 	}
+	if strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
+		s = s[1 : len(s)-1]
+	}
 	if !strings.Contains(s, "@") {
 		return ""
 	}
 	return strings.ToLower(s)
 }
 
+// parseSizeParam 解析 MAIL FROM 中的 SIZE=<n> 参数，未声明时返回 0
+func parseSizeParam(args string) (int64, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return 0, nil
+	}
+	for _, param := range fields[1:] {
+		if len(param) > 5 && strings.EqualFold(param[:5], "SIZE=") {
+			size, err := strconv.ParseInt(param[5:], 10, 64)
+			if err != nil || size < 0 {
+				return 0, fmt.Errorf("invalid SIZE parameter %q", param)
+			}
+			return size, nil
+		}
+	}
+	return 0, nil
+}
+
+// maxMessageBytes 当前生效的最大邮件大小 (字节)，0 表示不限制
+func maxMessageBytes() int64 {
+	if config.AppConfig.ReceiverMaxMsgBytes > 0 {
+		return config.AppConfig.ReceiverMaxMsgBytes
+	}
+	return int64(config.AppConfig.ReceiverMaxMsgSize) * 1024
+}
+
 // formatForwardBody 格式化转发邮件正文
 func formatForwardBody(from, originalTo, body string) string {
 	return fmt.Sprintf(`<div style="background:#f5f5f5; padding:15px; margin-bottom:20px; border-left:4px solid #2563eb; font-size:14px; color:#666;">
-<p><strong>📧 转发邮件</strong></p>
-<p>原始发件人: %s<br>
-原始收件人: %s</p>
+<p><strong>%s</strong></p>
+<p>%s: %s<br>
+%s: %s</p>
 </div>
 <div style="padding:10px 0;">
 %s
-</div>`, from, originalTo, body)
+</div>`, locale.T("forward.banner"), locale.T("forward.original_from"), from, locale.T("forward.original_to"), originalTo, body)
 }
 
 // isValidPort 验证端口号是否为纯数字
@@ -927,64 +1474,9 @@ func ReloadConfig() {
 	rateLimiter = NewRateLimiter(config.AppConfig.ReceiverRateLimit)
 	updateBlacklist()
 	tlsConfig = loadTLSConfig()
+	updateTrustedNetworks()
+	ReloadSpamKeywords()
+	ReloadTagRules()
 	log.Println("[Receiver] Configuration reloaded")
 }
 
-// detectSpam 检测垃圾邮件
-// 返回 (是否垃圾邮件, 原因)
-func detectSpam(from, subject, body string) (bool, string) {
-	// 常见垃圾邮件关键词 (中英文)
-	spamKeywords := []string{
-		// 英文关键词
-		"viagra", "cialis", "lottery", "winner", "congratulations",
-		"nigerian prince", "inheritance", "million dollars",
-		"click here", "act now", "limited time", "free money",
-		"make money fast", "work from home", "earn cash",
-		"no obligation", "risk free", "credit card",
-		"penis enlargement", "weight loss", "diet pills",
-		// 中文关键词
-		"彩票中奖", "恭喜您获得", "免费赠送", "点击领取",
-		"低价出售", "发票代开", "刷单兼职", "网赚项目",
-		"色情", "赌博", "博彩", "六合彩",
-	}
-
-	// 转小写进行匹配
-	lowerSubject := strings.ToLower(subject)
-	lowerBody := strings.ToLower(body)
-	lowerFrom := strings.ToLower(from)
-
-	// 检查关键词
-	for _, keyword := range spamKeywords {
-		if strings.Contains(lowerSubject, keyword) {
-			return true, "subject contains spam keyword: " + keyword
-		}
-		if strings.Contains(lowerBody, keyword) {
-			return true, "body contains spam keyword: " + keyword
-		}
-	}
-
-	// 检查可疑发件人模式
-	suspiciousPatterns := []string{
-		"noreply@", "no-reply@", "donotreply@",
-		"admin@", "support@", "info@",
-	}
-	for _, pattern := range suspiciousPatterns {
-		if strings.HasPrefix(lowerFrom, pattern) {
-			// 这些模式不一定是垃圾邮件，只是可疑，跳过
-			break
-		}
-	}
-
-	// 检查大量链接 (超过 5 个链接视为可疑)
-	linkCount := strings.Count(lowerBody, "http://") + strings.Count(lowerBody, "https://")
-	if linkCount > 10 {
-		return true, fmt.Sprintf("too many links: %d", linkCount)
-	}
-
-	// 检查全大写主题 (营销邮件特征)
-	if len(subject) > 10 && subject == strings.ToUpper(subject) {
-		return true, "subject is all uppercase"
-	}
-
-	return false, ""
-}
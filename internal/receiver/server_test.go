@@ -0,0 +1,478 @@
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+	"goemail/internal/mailer"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReadLine(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("EHLO example.com\r\nQUIT\r\n"))
+	line, err := readLine(r, 1000)
+	if err != nil || line != "EHLO example.com\r\n" {
+		t.Fatalf("readLine() = %q, %v", line, err)
+	}
+	line, err = readLine(r, 1000)
+	if err != nil || line != "QUIT\r\n" {
+		t.Fatalf("readLine() = %q, %v", line, err)
+	}
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	// 远超 bufio 默认缓冲区 (4096) 的单行数据
+	oversized := strings.Repeat("A", 100*1024) + "\r\n"
+	r := bufio.NewReader(strings.NewReader(oversized))
+	if _, err := readLine(r, 65536); err != errLineTooLong {
+		t.Fatalf("readLine() error = %v, want errLineTooLong", err)
+	}
+
+	// 不限制时长行应完整读出
+	r = bufio.NewReader(strings.NewReader(oversized))
+	line, err := readLine(r, 0)
+	if err != nil || len(line) != len(oversized) {
+		t.Fatalf("readLine() len = %d, %v, want %d", len(line), err, len(oversized))
+	}
+}
+
+func TestParseSizeParam(t *testing.T) {
+	tests := []struct {
+		args      string
+		size      int64
+		expectErr bool
+	}{
+		{"<a@example.com>", 0, false},
+		{"<a@example.com> SIZE=1024", 1024, false},
+		{" <a@example.com> BODY=8BITMIME size=20971520", 20971520, false},
+		{"<a@example.com> SIZE=99999999999999", 99999999999999, false},
+		{"<a@example.com> SIZE=abc", 0, true},
+		{"<a@example.com> SIZE=-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		size, err := parseSizeParam(tt.args)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("parseSizeParam(%q) error = %v, expectErr %v", tt.args, err, tt.expectErr)
+		}
+		if size != tt.size {
+			t.Errorf("parseSizeParam(%q) = %d, want %d", tt.args, size, tt.size)
+		}
+	}
+}
+
+func TestExtractEmailWithParams(t *testing.T) {
+	tests := map[string]string{
+		"<User@Example.com>":          "user@example.com",
+		" <a@example.com> SIZE=1024":  "a@example.com",
+		"a@example.com BODY=8BITMIME": "a@example.com",
+		"<not-an-address> SIZE=1024":  "",
+	}
+	for in, want := range tests {
+		if got := extractEmail(in); got != want {
+			t.Errorf("extractEmail(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMaxMessageBytes(t *testing.T) {
+	oldKB, oldBytes := config.AppConfig.ReceiverMaxMsgSize, config.AppConfig.ReceiverMaxMsgBytes
+	defer func() {
+		config.AppConfig.ReceiverMaxMsgSize, config.AppConfig.ReceiverMaxMsgBytes = oldKB, oldBytes
+	}()
+
+	// 未配置字节数时按 KB 换算，结果以 int64 返回 (3GB)
+	config.AppConfig.ReceiverMaxMsgSize, config.AppConfig.ReceiverMaxMsgBytes = 3*1024*1024, 0
+	if got, want := maxMessageBytes(), int64(3)*1024*1024*1024; got != want {
+		t.Errorf("maxMessageBytes() = %d, want %d", got, want)
+	}
+	// receiver_max_msg_bytes 大于 0 时优先于 KB 配置
+	config.AppConfig.ReceiverMaxMsgBytes = 5000
+	if got := maxMessageBytes(); got != 5000 {
+		t.Errorf("maxMessageBytes() = %d, want 5000", got)
+	}
+}
+
+// recordConn 记录写入内容的 net.Conn 桩，用于测试命令状态机
+type recordConn struct {
+	net.Conn
+	out bytes.Buffer
+}
+
+func (c *recordConn) Write(p []byte) (int, error)      { return c.out.Write(p) }
+func (c *recordConn) SetWriteDeadline(time.Time) error { return nil }
+
+// lastReply 返回最后一条响应的状态码
+func (c *recordConn) lastReply() string {
+	lines := strings.Split(strings.TrimRight(c.out.String(), "\r\n"), "\r\n")
+	last := lines[len(lines)-1]
+	if len(last) < 3 {
+		return last
+	}
+	return last[:3]
+}
+
+func TestCommandSequence(t *testing.T) {
+	steps := []struct {
+		line string
+		want string
+		quit bool
+	}{
+		{"MAIL FROM:<a@example.com>", "503", false}, // 未 HELO
+		{"RCPT TO:<b@example.com>", "503", false},
+		{"DATA", "503", false},
+		{"VRFY postmaster", "252", false},
+		{"EXPN staff", "252", false},
+		{"HELO client.example.com", "250", false},
+		{"RCPT TO:<b@example.com>", "503", false}, // 未 MAIL
+		{"DATA", "503", false},
+		{"MAIL FROM:<a@example.com>", "250", false},
+		{"MAIL FROM:<a@example.com>", "503", false}, // 重复 MAIL
+		{"DATA", "503", false},                      // 未 RCPT
+		{"STARTTLS", "503", false},                  // 事务进行中
+		{"RSET", "250", false},
+		{"MAIL FROM:<c@example.com>", "250", false},
+		{"HELO again.example.com", "250", false}, // HELO 隐含 RSET
+		{"DATA", "503", false},
+		{"MAIL", "501", false},
+		{"TURN", "502", false},
+		{"NOOP", "250", false},
+		{"QUIT", "221", true},
+	}
+
+	conn := &recordConn{}
+	s := &SMTPSession{conn: conn, to: make([]string, 0)}
+	for _, step := range steps {
+		quit := s.handleCommand(step.line)
+		if got := conn.lastReply(); got != step.want || quit != step.quit {
+			t.Fatalf("%q: reply %s (quit=%v), want %s (quit=%v)", step.line, got, quit, step.want, step.quit)
+		}
+	}
+}
+
+func TestNormalizeSubject(t *testing.T) {
+	cases := []struct {
+		in        string
+		want      string
+		wantReply bool
+	}{
+		{"Hello World", "hello world", false},
+		{"Re: Hello  World", "hello world", true},
+		{"RE: Fwd: re:Hello World", "hello world", true},
+		{"回复：订单问题", "订单问题", true},
+		{"Re[2]: Status", "status", true},
+		{"Regarding the plan", "regarding the plan", false},
+	}
+	for _, c := range cases {
+		got, reply := normalizeSubject(c.in)
+		if got != c.want || reply != c.wantReply {
+			t.Errorf("normalizeSubject(%q) = %q, %v; want %q, %v", c.in, got, reply, c.want, c.wantReply)
+		}
+	}
+}
+
+func TestParseMessageIDs(t *testing.T) {
+	got := parseMessageIDs("<a@example.com> <b@example.com>\t<c@ex>")
+	if len(got) != 3 || got[0] != "<a@example.com>" || got[2] != "<c@ex>" {
+		t.Fatalf("parseMessageIDs() = %v", got)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	raw := "From: MAILER-DAEMON@mx.example.net\r\n" +
+		"To: bounce+abc123@example.com\r\n" +
+		"Subject: Undelivered Mail Returned to Sender\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=\"XYZ\"\r\n" +
+		"\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Delivery failed.\r\n" +
+		"--XYZ\r\n" +
+		"Content-Type: message/delivery-status\r\n" +
+		"\r\n" +
+		"Reporting-MTA: dns; mx.example.net\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; <User@Example.org>\r\n" +
+		"Action: failed\r\n" +
+		"Status: 5.1.1\r\n" +
+		"Diagnostic-Code: smtp; 550 5.1.1 User unknown\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; later@example.org\r\n" +
+		"Action: delayed\r\n" +
+		"Status: 4.4.1 (timeout)\r\n" +
+		"--XYZ--\r\n"
+
+	reports := parseDSN(raw)
+	if len(reports) != 2 {
+		t.Fatalf("got %d reports, want 2: %+v", len(reports), reports)
+	}
+	if r := reports[0]; r.Recipient != "user@example.org" || r.Status != "5.1.1" || !r.Hard() || r.Diagnostic != "550 5.1.1 User unknown" {
+		t.Errorf("unexpected first report: %+v", r)
+	}
+	if r := reports[1]; r.Action != "delayed" || r.Status != "4.4.1" || r.Hard() {
+		t.Errorf("unexpected second report: %+v", r)
+	}
+
+	if parseDSN("Subject: hi\r\nContent-Type: text/plain\r\n\r\nhello") != nil {
+		t.Error("plain mail should not be parsed as DSN")
+	}
+	if got := verpToken("bounce+abc123@example.com"); got != "abc123" {
+		t.Errorf("verpToken = %q", got)
+	}
+}
+
+func TestParseHeaderList(t *testing.T) {
+	raw := "Received: from a.example.com\r\n\tby mx.example.org; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Received: from b.example.com\r\n" +
+		"Subject: =?UTF-8?B?5rWL6K+V?=\r\n" +
+		"From: a@example.com\r\n" +
+		"\r\n" +
+		"Body: not a header\r\n"
+
+	fields := ParseHeaderList(raw)
+	if len(fields) != 4 {
+		t.Fatalf("got %d fields, want 4: %+v", len(fields), fields)
+	}
+	if fields[0].Name != "Received" || fields[0].Value != "from a.example.com by mx.example.org; Mon, 1 Jan 2024 00:00:00 +0000" {
+		t.Errorf("folded header not unfolded: %+v", fields[0])
+	}
+	if fields[1].Name != "Received" || fields[1].Value != "from b.example.com" {
+		t.Errorf("duplicate header lost: %+v", fields[1])
+	}
+	if fields[2].Decoded != "测试" {
+		t.Errorf("subject not decoded: %+v", fields[2])
+	}
+	if fields[3].Decoded != "" {
+		t.Errorf("plain header should have no decoded value: %+v", fields[3])
+	}
+}
+
+func TestAbuseTracker(t *testing.T) {
+	tr := &abuseTracker{events: make(map[string][]abuseEvent), blocked: make(map[string]BlockedIP)}
+	now := time.Now()
+	window, ttl := 10*time.Minute, time.Hour
+
+	// 窗口外的旧事件不计分
+	tr.record("1.2.3.4", "rcpt", 2, 5, window, ttl, now.Add(-20*time.Minute))
+	if tr.record("1.2.3.4", "rcpt", 2, 5, window, ttl, now) || tr.isBlocked("1.2.3.4", now) {
+		t.Fatal("expired events should not count towards the threshold")
+	}
+	if !tr.record("1.2.3.4", "spam", 3, 5, window, ttl, now.Add(time.Minute)) {
+		t.Fatal("expected block once threshold is reached")
+	}
+	if !tr.isBlocked("1.2.3.4", now.Add(30*time.Minute)) {
+		t.Error("IP should stay blocked within TTL")
+	}
+	if tr.isBlocked("1.2.3.4", now.Add(2*time.Hour)) {
+		t.Error("block should expire after TTL")
+	}
+
+	tr.record("5.6.7.8", "spam", 5, 5, window, ttl, now)
+	if len(tr.list(now)) != 1 || tr.clear("5.6.7.8") != 1 || tr.isBlocked("5.6.7.8", now) {
+		t.Error("manual clear failed")
+	}
+
+	// 不再出现的 IP 在下一个窗口周期被清理
+	tr.record("9.9.9.9", "rcpt", 1, 5, window, ttl, now)
+	tr.record("10.0.0.1", "rcpt", 1, 5, window, ttl, now.Add(window+time.Minute))
+	if _, ok := tr.events["9.9.9.9"]; ok {
+		t.Error("stale IP was not evicted")
+	}
+	if len(tr.events) != 1 {
+		t.Errorf("events tracked for %d IPs, want 1", len(tr.events))
+	}
+}
+
+func TestBuildDSNRoundTrip(t *testing.T) {
+	raw := mailer.BuildDSN(mailer.DSNInfo{
+		ReportingDomain: "example.com",
+		Sender:          "alice@sender.org",
+		Recipient:       "info@example.com",
+		Subject:         "Hello",
+		Diagnostic:      "550 5.1.1 <info@example.com>: Recipient address rejected",
+		Hard:            true,
+	})
+	reports := parseDSN(string(raw))
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	r := reports[0]
+	if r.Recipient != "info@example.com" || r.Status != "5.1.1" || !r.Hard() {
+		t.Errorf("unexpected report: %+v", r)
+	}
+
+	soft := parseDSN(string(mailer.BuildDSN(mailer.DSNInfo{
+		ReportingDomain: "example.com",
+		Sender:          "alice@sender.org",
+		Recipient:       "info@example.com",
+		Diagnostic:      "dial tcp: i/o timeout",
+	})))
+	if len(soft) != 1 || soft[0].Status != "4.4.7" || soft[0].Hard() {
+		t.Errorf("unexpected soft report: %+v", soft)
+	}
+}
+
+func TestMatchSpam(t *testing.T) {
+	rules := []spamRule{
+		{keyword: "lottery", subject: true, body: true},
+		{keyword: "unsubscribe now", subject: false, body: true},
+		{keyword: "发票代开", subject: true, body: false},
+	}
+	tests := []struct {
+		name          string
+		subject, body string
+		want          bool
+	}{
+		{"case-insensitive subject", "You won the LOTTERY", "", true},
+		{"body-only keyword in body", "hello", "Please Unsubscribe Now", true},
+		{"body-only keyword in subject", "unsubscribe now", "", false},
+		{"subject-only keyword in body", "hi", "发票代开", false},
+		{"too many links", "hi", strings.Repeat("https://x ", 4), true},
+		{"all caps subject", "HELLO THERE FRIEND", "", true},
+		{"clean", "Meeting notes", "see you https://example.com", false},
+	}
+	for _, tt := range tests {
+		if got, reason := matchSpam(rules, 3, 10, tt.subject, tt.body); got != tt.want {
+			t.Errorf("%s: got %v (%s), want %v", tt.name, got, reason, tt.want)
+		}
+	}
+	if got, _ := matchSpam(nil, -1, -1, "HELLO THERE FRIEND", strings.Repeat("https://x ", 50)); got {
+		t.Error("negative thresholds should disable link and caps checks")
+	}
+}
+
+func TestFCrDNS(t *testing.T) {
+	ip := net.ParseIP("203.0.113.5")
+	resolve := func(host string) ([]net.IP, error) {
+		switch host {
+		case "mail.example.com":
+			return []net.IP{net.ParseIP("203.0.113.5")}, nil
+		case "other.example.com":
+			return []net.IP{net.ParseIP("198.51.100.1")}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	tests := []struct {
+		names      []string
+		wantStatus string
+		wantName   string
+	}{
+		{nil, ptrNone, ""},
+		{[]string{"mail.example.com."}, ptrPass, "mail.example.com"},
+		{[]string{"other.example.com."}, ptrMismatch, "other.example.com"},
+		{[]string{"missing.example.com.", "mail.example.com."}, ptrPass, "mail.example.com"},
+	}
+	for _, tt := range tests {
+		status, name := fcrdns(ip, tt.names, resolve)
+		if status != tt.wantStatus || name != tt.wantName {
+			t.Errorf("fcrdns(%v) = %s, %s; want %s, %s", tt.names, status, name, tt.wantStatus, tt.wantName)
+		}
+	}
+}
+
+func TestParseTrustedNetworks(t *testing.T) {
+	nets := parseTrustedNetworks("10.0.0.0/8, 192.0.2.7 ,bogus, 2001:db8::1, 300.1.1.1/24")
+	if len(nets) != 3 {
+		t.Fatalf("got %d networks, want 3", len(nets))
+	}
+	contains := func(ip string) bool {
+		for _, n := range nets {
+			if n.Contains(net.ParseIP(ip)) {
+				return true
+			}
+		}
+		return false
+	}
+	for ip, want := range map[string]bool{
+		"10.1.2.3": true, "192.0.2.7": true, "192.0.2.8": false, "2001:db8::1": true, "2001:db8::2": false,
+	} {
+		if contains(ip) != want {
+			t.Errorf("contains(%s) = %v, want %v", ip, !want, want)
+		}
+	}
+}
+
+func TestDecodeAuthPlain(t *testing.T) {
+	resp := base64.StdEncoding.EncodeToString([]byte("\x00user\x00sk_secret"))
+	if u, p, ok := decodeAuthPlain(resp); !ok || u != "user" || p != "sk_secret" {
+		t.Errorf("decodeAuthPlain = %q, %q, %v", u, p, ok)
+	}
+	if _, _, ok := decodeAuthPlain(base64.StdEncoding.EncodeToString([]byte("no-separators"))); ok {
+		t.Error("malformed PLAIN response accepted")
+	}
+	if _, _, ok := decodeAuthPlain("!!!"); ok {
+		t.Error("invalid base64 accepted")
+	}
+}
+
+func TestForwardReplyTo(t *testing.T) {
+	parsed := ParsedEmail{From: `"Alice" <alice@sender.com>`}
+	if got := forwardReplyTo(nil, parsed, "bounce@sender.com", "support@example.com"); got != `"Alice" <alice@sender.com>` {
+		t.Errorf("default reply-to = %q, want original From", got)
+	}
+	parsed.ReplyTo = "team@sender.com"
+	if got := forwardReplyTo(nil, parsed, "bounce@sender.com", "support@example.com"); got != "<team@sender.com>" {
+		t.Errorf("reply-to = %q, want original Reply-To", got)
+	}
+	if got := forwardReplyTo(nil, ParsedEmail{From: "not an address"}, "bounce@sender.com", "support@example.com"); got != "bounce@sender.com" {
+		t.Errorf("reply-to = %q, want envelope sender fallback", got)
+	}
+
+	rule := &database.ForwardRule{ID: 7, ReplyTo: replyToList, RewriteSender: true}
+	if got := forwardReplyTo(rule, parsed, "bounce@sender.com", "support@example.com"); got != "support@example.com" {
+		t.Errorf("list reply-to = %q", got)
+	}
+	rule.ReplyTo = replyToNone
+	if got := forwardReplyTo(rule, parsed, "bounce@sender.com", "support@example.com"); got != "" {
+		t.Errorf("none reply-to = %q", got)
+	}
+	envelope := forwardEnvelopeFrom(rule, &database.Domain{Name: "example.com"})
+	if !strings.HasPrefix(envelope, "bounce+fwd-7.") || !strings.HasSuffix(envelope, "@example.com") {
+		t.Errorf("envelope from = %q", envelope)
+	}
+	if got, ok := verifyVERPToken(verpToken(envelope)); !ok || got != "fwd-7" {
+		t.Errorf("verp token = %q, %v", got, ok)
+	}
+	for _, forged := range []string{"fwd-7", "fwd-8." + verpSignature("fwd-7"), "fwd-7.0000000000000000", ".abc", ""} {
+		if _, ok := verifyVERPToken(forged); ok {
+			t.Errorf("forged verp token %q accepted", forged)
+		}
+	}
+}
+
+func TestCaptureContactSkipsExistingContacts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Contact{}); err != nil {
+		t.Fatal(err)
+	}
+	prev, prevGroup := database.DB, config.AppConfig.ReceiverContactGroupID
+	database.DB = db
+	config.AppConfig.ReceiverContactGroupID = 2
+	defer func() { database.DB, config.AppConfig.ReceiverContactGroupID = prev, prevGroup }()
+
+	db.Create(&database.Contact{Email: "Alice@example.com", GroupID: 1, Status: "active"})
+	captureContact("alice@example.com", "Alice <alice@example.com>")
+	captureContact("bob@example.com", "Bob <bob@example.com>")
+
+	var contacts []database.Contact
+	db.Order("id").Find(&contacts)
+	if len(contacts) != 2 || contacts[1].Email != "bob@example.com" || contacts[1].GroupID != 2 {
+		t.Errorf("contacts = %+v, want only bob captured into group 2", contacts)
+	}
+}
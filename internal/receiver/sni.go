@@ -0,0 +1,149 @@
+package receiver
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"goemail/internal/cert"
+	"goemail/internal/database"
+)
+
+// sniCache 已解析的证书密钥对缓存 (按证书 ID，证书更新后失效)
+var (
+	sniCacheMu sync.Mutex
+	sniCache   = map[uint]sniEntry{}
+)
+
+type sniEntry struct {
+	updatedAt time.Time
+	cert      *tls.Certificate
+}
+
+// hasManagedCertificates 证书管理中是否存在当前有效、可加载的证书
+func hasManagedCertificates() bool {
+	return anyManagedCertificate(time.Now()) != nil
+}
+
+// anyManagedCertificate 返回证书管理中在有效期内、到期时间最晚且可加载的证书，没有时返回 nil
+func anyManagedCertificate(now time.Time) *tls.Certificate {
+	if database.DB == nil {
+		return nil
+	}
+	var certs []database.Certificate
+	database.DB.Where("not_before <= ? AND not_after >= ?", now, now).Order("not_after DESC").Find(&certs)
+	for i := range certs {
+		if kp := loadKeyPair(&certs[i]); kp != nil {
+			return kp
+		}
+	}
+	return nil
+}
+
+// getManagedCertificate 未配置默认证书时使用：SNI 缺失或无匹配时回退到证书管理中任一有效证书，
+// 已宣告 STARTTLS 的会话不会因没有证书而握手失败
+func getManagedCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if kp, _ := getSNICertificate(hello); kp != nil {
+		return kp, nil
+	}
+	if kp := anyManagedCertificate(time.Now()); kp != nil {
+		return kp, nil
+	}
+	return nil, errors.New("no valid TLS certificate available")
+}
+
+// getSNICertificate 按客户端 SNI 主机名选择证书
+// 优先使用域名关联的证书 (Domain.CertificateID)，其次为证书管理中匹配该主机名的证书；均无匹配时返回 nil，回退到默认证书
+func getSNICertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hello.ServerName)), ".")
+	if host == "" || database.DB == nil {
+		return nil, nil
+	}
+	now := time.Now()
+
+	// 1. 域名关联证书：主机名为该域名或其子域名 (如 mx.example.com -> example.com)
+	var domains []database.Domain
+	database.DB.Preload("Certificate").Where("certificate_id IS NOT NULL").Find(&domains)
+	var bound []database.Certificate
+	bestLen := -1
+	for _, d := range domains {
+		name := strings.ToLower(d.Name)
+		if d.Certificate == nil || (host != name && !strings.HasSuffix(host, "."+name)) {
+			continue
+		}
+		// 更具体的域名优先
+		if len(name) > bestLen {
+			bound, bestLen = nil, len(name)
+		}
+		if len(name) == bestLen {
+			bound = append(bound, *d.Certificate)
+		}
+	}
+	if c := bestCertificate(bound, host, now); c != nil {
+		if kp := loadKeyPair(c); kp != nil {
+			return kp, nil
+		}
+	}
+
+	// 2. 证书管理中覆盖该主机名的证书
+	matched, err := cert.NewManager().GetMatchingCertificates(host)
+	if err != nil {
+		return nil, nil
+	}
+	if c := bestCertificate(matched, host, now); c != nil {
+		if kp := loadKeyPair(c); kp != nil {
+			return kp, nil
+		}
+	}
+	return nil, nil
+}
+
+// bestCertificate 从候选证书中选出覆盖 host 且在有效期内、到期时间最晚的证书
+func bestCertificate(certs []database.Certificate, host string, now time.Time) *database.Certificate {
+	var best *database.Certificate
+	for i := range certs {
+		c := &certs[i]
+		if !cert.MatchDomain(strings.Split(c.Domains, ","), host) {
+			continue
+		}
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			continue
+		}
+		if best == nil || c.NotAfter.After(best.NotAfter) {
+			best = c
+		}
+	}
+	return best
+}
+
+// loadKeyPair 加载证书密钥对：优先使用数据库中的 PEM，失败时回退到证书文件
+func loadKeyPair(c *database.Certificate) *tls.Certificate {
+	sniCacheMu.Lock()
+	entry, ok := sniCache[c.ID]
+	sniCacheMu.Unlock()
+	if ok && entry.updatedAt.Equal(c.UpdatedAt) {
+		return entry.cert
+	}
+
+	var kp tls.Certificate
+	var err error
+	keyPEM, decErr := cert.NewManager().GetDecryptedKey(c)
+	if decErr == nil && c.CertPEM != "" {
+		kp, err = tls.X509KeyPair([]byte(c.CertPEM), []byte(keyPEM))
+	}
+	if decErr != nil || c.CertPEM == "" || err != nil {
+		if c.CertPath == "" || c.KeyPath == "" {
+			return nil
+		}
+		if kp, err = tls.LoadX509KeyPair(c.CertPath, c.KeyPath); err != nil {
+			return nil
+		}
+	}
+
+	sniCacheMu.Lock()
+	sniCache[c.ID] = sniEntry{updatedAt: c.UpdatedAt, cert: &kp}
+	sniCacheMu.Unlock()
+	return &kp
+}
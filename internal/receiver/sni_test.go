@@ -0,0 +1,107 @@
+package receiver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"goemail/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBestCertificate(t *testing.T) {
+	now := time.Now()
+	certs := []database.Certificate{
+		{ID: 1, Domains: "mail.example.com", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(24 * time.Hour)},
+		{ID: 2, Domains: "*.example.com", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(48 * time.Hour)},
+		{ID: 3, Domains: "mail.example.com", NotBefore: now.Add(-48 * time.Hour), NotAfter: now.Add(-time.Hour)},
+		{ID: 4, Domains: "other.org", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(72 * time.Hour)},
+	}
+	if c := bestCertificate(certs, "mail.example.com", now); c == nil || c.ID != 2 {
+		t.Errorf("mail.example.com: got %+v, want cert 2", c)
+	}
+	if c := bestCertificate(certs[:1], "mail.example.com", now); c == nil || c.ID != 1 {
+		t.Errorf("single cert: got %+v, want cert 1", c)
+	}
+	if c := bestCertificate(certs[2:3], "mail.example.com", now); c != nil {
+		t.Errorf("expired cert should not be selected, got %d", c.ID)
+	}
+	if c := bestCertificate(certs, "a.b.example.com", now); c != nil {
+		t.Errorf("a.b.example.com: got %d, want none", c.ID)
+	}
+}
+
+// writeTestKeyPair 生成 host 的自签名证书并写入 dir，返回证书与私钥路径
+func writeTestKeyPair(t *testing.T, dir, host string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPath := filepath.Join(dir, host+".crt")
+	keyPath := filepath.Join(dir, host+".key")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestGetManagedCertificateFallback(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立
+	if err := db.AutoMigrate(&database.Certificate{}, &database.Domain{}); err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	defer func() { database.DB = prev }()
+
+	if hasManagedCertificates() {
+		t.Fatal("no certificates yet")
+	}
+	if _, err := getManagedCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error("missing certificate should fail the handshake with an error")
+	}
+
+	now := time.Now()
+	dir := t.TempDir()
+	certPath, keyPath := writeTestKeyPair(t, dir, "mail.example.com", now.Add(24*time.Hour))
+	db.Create(&database.Certificate{Domains: "mail.example.com", CertPath: certPath, KeyPath: keyPath,
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(24 * time.Hour)})
+	if !hasManagedCertificates() {
+		t.Fatal("valid managed certificate not found")
+	}
+
+	// 无 SNI 或 SNI 未匹配时仍返回证书管理中的有效证书
+	for _, name := range []string{"", "unknown.example.org"} {
+		kp, err := getManagedCertificate(&tls.ClientHelloInfo{ServerName: name})
+		if err != nil || kp == nil {
+			t.Errorf("ServerName %q: got %v, %v; want the managed certificate", name, kp, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package receiver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// spamRule 已加载的关键词规则 (关键词已转小写)
+type spamRule struct {
+	keyword string
+	subject bool
+	body    bool
+}
+
+var (
+	spamMu    sync.RWMutex
+	spamRules []spamRule
+)
+
+// ReloadSpamKeywords 从数据库重新加载启用的垃圾邮件关键词
+func ReloadSpamKeywords() {
+	if database.DB == nil {
+		return
+	}
+	var keywords []database.SpamKeyword
+	if err := database.DB.Where("enabled = ?", true).Find(&keywords).Error; err != nil {
+		log.Printf("[Receiver] Failed to load spam keywords: %v", err)
+		return
+	}
+	rules := make([]spamRule, 0, len(keywords))
+	for _, k := range keywords {
+		kw := strings.ToLower(strings.TrimSpace(k.Keyword))
+		if kw == "" {
+			continue
+		}
+		rules = append(rules, spamRule{
+			keyword: kw,
+			subject: k.Target != "body",
+			body:    k.Target != "subject",
+		})
+	}
+
+	spamMu.Lock()
+	spamRules = rules
+	spamMu.Unlock()
+}
+
+// detectSpam 检测垃圾邮件
+// 返回 (是否垃圾邮件, 原因)
+func detectSpam(from, subject, body string) (bool, string) {
+	spamMu.RLock()
+	rules := spamRules
+	spamMu.RUnlock()
+	return matchSpam(rules, config.AppConfig.ReceiverSpamMaxLinks, config.AppConfig.ReceiverSpamCapsMinLen, subject, body)
+}
+
+// matchSpam 按关键词规则、链接数与全大写主题阈值判断是否为垃圾邮件 (阈值为负数时不检查)
+func matchSpam(rules []spamRule, maxLinks, capsMinLen int, subject, body string) (bool, string) {
+	// 转小写进行匹配
+	lowerSubject := strings.ToLower(subject)
+	lowerBody := strings.ToLower(body)
+
+	// 检查关键词
+	for _, r := range rules {
+		if r.subject && strings.Contains(lowerSubject, r.keyword) {
+			return true, "subject contains spam keyword: " + r.keyword
+		}
+		if r.body && strings.Contains(lowerBody, r.keyword) {
+			return true, "body contains spam keyword: " + r.keyword
+		}
+	}
+
+	// 检查大量链接
+	if maxLinks >= 0 {
+		linkCount := strings.Count(lowerBody, "http://") + strings.Count(lowerBody, "https://")
+		if linkCount > maxLinks {
+			return true, fmt.Sprintf("too many links: %d", linkCount)
+		}
+	}
+
+	// 检查全大写主题 (营销邮件特征)
+	if capsMinLen >= 0 && len(subject) > capsMinLen && subject == strings.ToUpper(subject) {
+		return true, "subject is all uppercase"
+	}
+
+	return false, ""
+}
@@ -0,0 +1,152 @@
+package receiver
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"goemail/internal/config"
+	"goemail/internal/database"
+)
+
+// tagRule 已加载的自动打标签规则 (匹配值已转小写)
+type tagRule struct {
+	tag   string
+	field string
+	value string
+}
+
+var (
+	tagMu    sync.RWMutex
+	tagRules []tagRule
+)
+
+// ReloadTagRules 从数据库重新加载启用的自动打标签规则
+func ReloadTagRules() {
+	if database.DB == nil {
+		return
+	}
+	var rows []database.TagRule
+	if err := database.DB.Where("enabled = ?", true).Order("id asc").Find(&rows).Error; err != nil {
+		log.Printf("[Receiver] Failed to load tag rules: %v", err)
+		return
+	}
+	rules := make([]tagRule, 0, len(rows))
+	for _, r := range rows {
+		value := strings.ToLower(strings.TrimSpace(r.Value))
+		if r.Tag == "" || value == "" {
+			continue
+		}
+		rules = append(rules, tagRule{tag: r.Tag, field: r.Field, value: value})
+	}
+
+	tagMu.Lock()
+	tagRules = rules
+	tagMu.Unlock()
+}
+
+// applyTagRules 按已加载的规则为邮件计算标签
+func applyTagRules(from, subject, rawData string) []string {
+	tagMu.RLock()
+	rules := tagRules
+	tagMu.RUnlock()
+	if len(rules) == 0 {
+		return nil
+	}
+	return matchTagRules(rules, from, subject, authResults(rawData, trustedAuthServIDs()))
+}
+
+// matchTagRules 返回命中的标签 (去重，保持规则顺序)
+// sender_domain 匹配发件域名及其子域名，subject 匹配主题关键词，auth 匹配 Authentication-Results 中的结果 (如 spf=fail)
+func matchTagRules(rules []tagRule, from, subject, auth string) []string {
+	domain := ""
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.ToLower(strings.Trim(from[at+1:], "> "))
+	}
+	subject = strings.ToLower(subject)
+
+	var tags []string
+	for _, r := range rules {
+		matched := false
+		switch r.field {
+		case "sender_domain":
+			matched = domain != "" && (domain == r.value || strings.HasSuffix(domain, "."+r.value))
+		case "subject":
+			matched = strings.Contains(subject, r.value)
+		case "auth":
+			matched = authResultMatches(auth, r.value)
+		}
+		if matched {
+			tags = appendTag(tags, r.tag)
+		}
+	}
+	return tags
+}
+
+// authResults 提取 authserv-id 可信的 Authentication-Results 头的内容 (小写，以 ";" 拼接)
+// 认证结果由上游 MTA / 网关写入，本服务不自行校验 SPF/DKIM；发件人可以在邮件中自带伪造的
+// Authentication-Results，因此只采信 authserv-id (头内容的第一项) 属于 trusted 的头 (RFC 8601 §5)
+func authResults(rawData string, trusted []string) string {
+	var parts []string
+	for _, line := range headerLines(rawData) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Authentication-Results") {
+			continue
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		id, _, _ := strings.Cut(value, ";")
+		if fields := strings.Fields(id); len(fields) > 0 && containsFold(trusted, fields[0]) {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// trustedAuthServIDs 返回采信的 authserv-id：receiver_authserv_ids 配置的上游网关主机名，未配置时为本机主机名
+func trustedAuthServIDs() []string {
+	var ids []string
+	for _, id := range strings.Split(config.AppConfig.ReceiverAuthServIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		if host, _ := os.Hostname(); host != "" {
+			ids = append(ids, host)
+		}
+	}
+	return ids
+}
+
+// containsFold 判断 list 中是否有与 s 忽略大小写相等的项
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// authResultMatches 检查认证结果中是否包含指定的 method=result 项 (按词边界匹配，避免 spf=fail 命中 spf=softfail)
+func authResultMatches(auth, want string) bool {
+	for _, field := range strings.FieldsFunc(auth, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t' || r == '(' || r == ')'
+	}) {
+		if field == want {
+			return true
+		}
+	}
+	return false
+}
+
+// appendTag 追加标签，已存在时忽略
+func appendTag(tags []string, tag string) []string {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
@@ -0,0 +1,33 @@
+package receiver
+
+import "testing"
+
+func TestMatchTagRules(t *testing.T) {
+	rules := []tagRule{
+		{tag: "vendor", field: "sender_domain", value: "example.com"},
+		{tag: "invoice", field: "subject", value: "invoice"},
+		{tag: "unauthenticated", field: "auth", value: "spf=fail"},
+		{tag: "vendor", field: "subject", value: "order"},
+	}
+	trusted := []string{"MX.local"}
+	raw := "Authentication-Results: mx.local;\r\n spf=softfail smtp.mailfrom=a@b.com;\r\n dkim=none\r\nSubject: x\r\n\r\nbody"
+	got := matchTagRules(rules, "billing@mail.Example.com", "Your INVOICE and order", authResults(raw, trusted))
+	if len(got) != 2 || got[0] != "vendor" || got[1] != "invoice" {
+		t.Errorf("tags = %v, want [vendor invoice]", got)
+	}
+
+	raw = "Authentication-Results: mx.local; spf=fail (sender not permitted) smtp.mailfrom=a@b.com\r\n\r\n"
+	got = matchTagRules(rules, "a@notexample.com", "hello", authResults(raw, trusted))
+	if len(got) != 1 || got[0] != "unauthenticated" {
+		t.Errorf("tags = %v, want [unauthenticated]", got)
+	}
+
+	// 发件人自带的 (authserv-id 不可信) 认证结果不参与匹配
+	raw = "Authentication-Results: attacker.example; spf=fail\r\nAuthentication-Results: mx.local 1; spf=pass\r\n\r\n"
+	if got := authResults(raw, trusted); got != "mx.local 1; spf=pass" {
+		t.Errorf("authResults = %q, want only the trusted header", got)
+	}
+	if got := matchTagRules(rules, "a@notexample.com", "hello", authResults(raw, trusted)); len(got) != 0 {
+		t.Errorf("tags = %v, want none for a forged header", got)
+	}
+}
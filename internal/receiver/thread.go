@@ -0,0 +1,73 @@
+package receiver
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"goemail/internal/database"
+)
+
+// threadSubjectWindow 按主题归并会话时的回溯时间范围
+const threadSubjectWindow = 30 * 24 * time.Hour
+
+var (
+	messageIDRe     = regexp.MustCompile(`<[^<>\s]+>`)
+	replyPrefixRe   = regexp.MustCompile(`(?i)^\s*(re|fw|fwd|aw|sv|wg|回复|答复|转发)\s*(\[\d+\])?\s*[:：]\s*`)
+	subjectSpacesRe = regexp.MustCompile(`\s+`)
+)
+
+// parseMessageIDs 从 Message-ID / In-Reply-To / References 头中提取所有 <id>
+func parseMessageIDs(header string) []string {
+	return messageIDRe.FindAllString(header, -1)
+}
+
+// normalizeSubject 去除 Re:/Fwd:/回复: 等前缀并统一大小写与空白，返回规范化主题及是否带有回复/转发前缀
+func normalizeSubject(subject string) (string, bool) {
+	hadPrefix := false
+	s := strings.TrimSpace(subject)
+	for {
+		stripped := replyPrefixRe.ReplaceAllString(s, "")
+		if stripped == s {
+			break
+		}
+		hadPrefix = true
+		s = stripped
+	}
+	s = subjectSpacesRe.ReplaceAllString(strings.TrimSpace(s), " ")
+	return strings.ToLower(s), hadPrefix
+}
+
+// resolveThreadID 确定邮件所属会话
+// 1. In-Reply-To / References 命中该收件人已有邮件时沿用其会话
+// 2. 带回复前缀且规范化主题相同的近期邮件归入同一会话
+// 3. 否则以本邮件的 Message-ID (或指纹) 开启新会话
+func resolveThreadID(parsed ParsedEmail, rcpt, messageHash string) string {
+	refs := parseMessageIDs(parsed.References + " " + parsed.InReplyTo)
+	if len(refs) > 0 {
+		var parent database.Inbox
+		if err := database.DB.Where("to_addr = ? AND message_id IN ? AND thread_id <> ''", rcpt, refs).
+			Order("id desc").First(&parent).Error; err == nil {
+			return parent.ThreadID
+		}
+	}
+
+	subject, isReply := normalizeSubject(parsed.Subject)
+	if isReply && subject != "" {
+		var parent database.Inbox
+		if err := database.DB.Where("to_addr = ? AND thread_subject = ? AND thread_id <> '' AND created_at > ?",
+			rcpt, subject, time.Now().Add(-threadSubjectWindow)).
+			Order("id desc").First(&parent).Error; err == nil {
+			return parent.ThreadID
+		}
+	}
+
+	// 回复的邮件链中最早的引用即为会话根
+	if len(refs) > 0 {
+		return refs[0]
+	}
+	if ids := parseMessageIDs(parsed.MessageID); len(ids) > 0 {
+		return ids[0]
+	}
+	return messageHash
+}
@@ -0,0 +1,129 @@
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
+)
+
+// clamdChunkSize INSTREAM 每个数据块的大小
+const clamdChunkSize = 64 * 1024
+
+// ClamAVClient clamd 守护进程客户端 (INSTREAM 协议)
+type ClamAVClient struct {
+	network string // "tcp" 或 "unix"
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVClient 创建 clamd 客户端
+// addr 支持 "tcp://127.0.0.1:3310"、"unix:///var/run/clamav/clamd.ctl"，不带前缀时按 TCP 处理
+func NewClamAVClient(addr string, timeout time.Duration) *ClamAVClient {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		network = "unix"
+		addr = strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		addr = strings.TrimPrefix(addr, "tcp://")
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &ClamAVClient{network: network, address: addr, timeout: timeout}
+}
+
+// Scan 扫描数据流，返回检测到的病毒名称 (空字符串表示未发现威胁)
+func (c *ClamAVClient) Scan(r io.Reader) (string, error) {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return "", fmt.Errorf("connect clamd failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("send INSTREAM failed: %w", err)
+	}
+
+	// 分块发送: 4 字节大端长度 + 数据，以长度 0 结束
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return "", fmt.Errorf("send chunk failed: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return "", fmt.Errorf("send chunk failed: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", fmt.Errorf("send terminator failed: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil && len(reply) == 0 {
+		return "", fmt.Errorf("read clamd reply failed: %w", err)
+	}
+	return parseClamdReply(string(reply))
+}
+
+// parseClamdReply 解析 clamd 响应，如 "stream: OK" 或 "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (string, error) {
+	reply = strings.TrimRight(reply, "\x00\r\n")
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd error: %s", reply)
+	}
+}
+
+// ScanAttachment 按全局配置扫描附件内容
+// 未启用扫描时直接放行；扫描出错时根据 ClamAVFailClosed 决定返回错误 (拒绝) 还是放行
+func ScanAttachment(data []byte) (string, error) {
+	return ScanAttachmentReader(bytes.NewReader(data))
+}
+
+// ScanAttachmentReader 同 ScanAttachment，以流的方式读取内容 (用于已落盘的大附件)
+func ScanAttachmentReader(r io.Reader) (string, error) {
+	config.ConfigMu.RLock()
+	cfg := config.AppConfig
+	config.ConfigMu.RUnlock()
+	if !cfg.ClamAVEnabled || cfg.ClamAVAddress == "" {
+		return "", nil
+	}
+
+	client := NewClamAVClient(cfg.ClamAVAddress, time.Duration(cfg.ClamAVTimeout)*time.Second)
+	virus, err := client.Scan(r)
+	if err != nil {
+		if cfg.ClamAVFailClosed {
+			return "", err
+		}
+		log.Printf("[ClamAV] Scan failed, allowing attachment (fail-open): %v", err)
+		return "", nil
+	}
+	return virus, nil
+}
@@ -0,0 +1,28 @@
+package security
+
+import (
+	"testing"
+)
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		virus     string
+		expectErr bool
+	}{
+		{"stream: OK\x00", "", false},
+		{"stream: Eicar-Signature FOUND\x00", "Eicar-Signature", false},
+		{"stream: OK\n", "", false},
+		{"INSTREAM size limit exceeded. ERROR\x00", "", true},
+	}
+
+	for _, tt := range tests {
+		virus, err := parseClamdReply(tt.reply)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("parseClamdReply(%q) error = %v, expectErr %v", tt.reply, err, tt.expectErr)
+		}
+		if virus != tt.virus {
+			t.Errorf("parseClamdReply(%q) = %q, want %q", tt.reply, virus, tt.virus)
+		}
+	}
+}
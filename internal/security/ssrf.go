@@ -1,8 +1,14 @@
 package security
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/url"
+	"strings"
+	"time"
+
+	"goemail/internal/config"
 )
 
 // IsInternalURL 检查 URL 是否指向内网 (SSRF 防护)
@@ -13,15 +19,75 @@ func IsInternalURL(rawURL string) bool {
 	}
 
 	host := u.Hostname()
+	if IsAllowedInternalHost(host) {
+		return false
+	}
 	ips, err := net.LookupIP(host)
 	if err != nil {
 		return true // DNS 解析失败视为不安全
 	}
 
 	for _, ip := range ips {
-		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		if isInternalIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalIP 判断 IP 是否属于内网/本机地址
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// IsAllowedInternalHost 检查主机是否在 SSRF 白名单中 (配置项 ssrf_allow_hosts，逗号分隔)
+func IsAllowedInternalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range strings.Split(config.AppConfig.SSRFAllowHosts, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && h == host {
 			return true
 		}
 	}
 	return false
 }
+
+// SafeDialContext 用于 http.Transport 的拨号函数
+// 解析域名后校验所有 IP，并直接连接已校验的 IP，防止 DNS 重绑定在检查与连接之间切换到内网地址
+func SafeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if IsAllowedInternalHost(host) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no address for %s", host)
+	}
+	for _, ip := range ips {
+		if isInternalIP(ip.IP) {
+			return nil, fmt.Errorf("access to internal address %s is blocked", ip.IP)
+		}
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
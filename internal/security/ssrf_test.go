@@ -1,7 +1,10 @@
 package security
 
 import (
+	"net"
 	"testing"
+
+	"goemail/internal/config"
 )
 
 func TestIsInternalURL(t *testing.T) {
@@ -27,3 +30,42 @@ func TestIsInternalURL(t *testing.T) {
 		}
 	}
 }
+
+func TestIsInternalIP(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"192.168.0.10", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+
+	for _, tt := range tests {
+		if result := isInternalIP(net.ParseIP(tt.ip)); result != tt.expected {
+			t.Errorf("isInternalIP(%q) = %v, want %v", tt.ip, result, tt.expected)
+		}
+	}
+}
+
+func TestIsAllowedInternalHost(t *testing.T) {
+	old := config.AppConfig.SSRFAllowHosts
+	defer func() { config.AppConfig.SSRFAllowHosts = old }()
+
+	config.AppConfig.SSRFAllowHosts = "files.internal, 10.0.0.5"
+	if !IsAllowedInternalHost("files.internal") || !IsAllowedInternalHost("FILES.INTERNAL.") || !IsAllowedInternalHost("10.0.0.5") {
+		t.Error("expected allowlisted hosts to be allowed")
+	}
+	if IsAllowedInternalHost("other.internal") {
+		t.Error("expected non-allowlisted host to be rejected")
+	}
+	if !IsInternalURL("http://127.0.0.1/x") {
+		t.Error("expected loopback URL to stay blocked")
+	}
+}
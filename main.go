@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"flag"
 	"fmt"
@@ -31,6 +32,7 @@ func main() {
 	// 命令行参数
 	resetPwd := flag.Bool("reset", false, "Reset admin password to 123456")
 	resetTOTP := flag.Bool("reset-totp", false, "Reset admin 2FA (TOTP)")
+	testSend := flag.String("test-send", "", "Send a test email to the given address through the default channel and exit")
 	flag.Parse()
 
 	// 1. 加载配置
@@ -78,8 +80,16 @@ func main() {
 		os.Exit(0)
 	}
 
+	// 处理测试发送指令 (安装或修改配置后验证 SMTP/DKIM，同步发送并输出结果)
+	if *testSend != "" {
+		os.Exit(runTestSend(*testSend))
+	}
+
 	// 启动邮件发送队列 Worker
 	mailer.StartQueueWorker()
+	mailer.StartReputationMonitor()
+	mailer.StartConnectivityProbe()
+	mailer.StartDigestScheduler()
 
 	// 启动 SMTP 接收服务 (邮件转发)
 	receiver.StartReceiver()
@@ -134,7 +144,8 @@ func main() {
 		// 公开接口 (添加速率限制)
 		apiGroup.POST("/login", api.RateLimitMiddleware(api.GetLoginLimiter()), api.LoginHandler)
 		apiGroup.GET("/captcha", api.RateLimitMiddleware(api.GetCaptchaLimiter()), api.CaptchaHandler)
-		apiGroup.GET("/wallpaper", api.WallpaperHandler)
+		apiGroup.GET("/login/precheck", api.RateLimitMiddleware(api.GetCaptchaLimiter()), api.LoginPrecheckHandler)
+		apiGroup.GET("/wallpaper", api.RateLimitMiddleware(api.GetWallpaperLimiter()), api.WallpaperHandler)
 
 		// TOTP 两步验证 (公开接口，用于登录时验证)
 		apiGroup.POST("/totp/verify", api.RateLimitMiddleware(api.GetLoginLimiter()), api.TOTPVerifyHandler)
@@ -146,6 +157,13 @@ func main() {
 		apiGroup.GET("/track/open/:id", api.TrackOpenHandler)
 		apiGroup.GET("/track/click/:id", api.TrackClickHandler)
 		apiGroup.GET("/track/unsubscribe/:id", api.UnsubscribeHandler)
+		apiGroup.GET("/track/preferences/:id", api.PreferencesHandler)
+		apiGroup.POST("/track/preferences/:id", api.UpdatePreferencesHandler)
+		apiGroup.GET("/track/manage/:token", api.ContactPreferencesHandler)
+		apiGroup.POST("/track/manage/:token", api.UpdateContactPreferencesHandler)
+
+		// 附件签名分享链接 (公开，凭签名与有效期访问)
+		apiGroup.GET("/files/shared/:id", api.SharedFileHandler)
 
 		// 需要认证的接口 (支持 JWT 或 API Key)
 		authorized := apiGroup.Group("/")
@@ -153,10 +171,16 @@ func main() {
 		{
 			// 发送接口 (现在受保护)
 			authorized.POST("/send", api.SendHandler)
+			authorized.GET("/queue/:id/stream", api.QueueStreamHandler) // 投递状态与打开/点击事件 (SSE)
 
 			authorized.GET("/stats", api.StatsHandler)
+			authorized.GET("/dashboard", api.DashboardHandler)     // 仪表盘聚合数据
+			authorized.GET("/digest", api.GetDigestHandler)        // 每日摘要预览
+			authorized.POST("/digest/send", api.SendDigestHandler) // 立即发送每日摘要
 			authorized.GET("/logs", api.LogsHandler)
+			authorized.GET("/logs/export.csv", api.ExportLogsHandler)
 			authorized.GET("/logs/:id", api.GetLogDetailHandler)
+			authorized.POST("/logs/:id/resend", api.ResendLogHandler)
 			authorized.POST("/config/dkim", api.GenerateDKIMHandler)
 			authorized.GET("/config", api.GetConfigHandler)
 			authorized.GET("/config/version", api.GetVersionHandler)                  // 新增
@@ -177,9 +201,13 @@ func main() {
 			// 备份管理
 			authorized.GET("/backups", api.ListBackupsHandler)                // 获取备份列表
 			authorized.POST("/backups", api.CreateBackupHandler)              // 创建备份
-			authorized.POST("/backups/:id/restore", api.RestoreBackupHandler) // 恢复备份
+			authorized.POST("/backups/:id/restore", api.RestoreBackupHandler) // 恢复备份 (?scope=full|db|config)
 			authorized.DELETE("/backups/:id", api.DeleteBackupHandler)        // 删除备份
 
+			// 配置迁移 (域名、通道、模板、转发规则、收件与清理设置)
+			authorized.GET("/export/config", api.ExportConfigHandler)  // 导出 JSON 配置包
+			authorized.POST("/import/config", api.ImportConfigHandler) // 导入 (?conflict=skip|overwrite|rename)
+
 			// 两步验证 (TOTP) 管理
 			authorized.GET("/totp/status", api.TOTPStatusHandler)
 			authorized.GET("/totp/setup", api.TOTPSetupHandler)
@@ -198,6 +226,11 @@ func main() {
 			authorized.PUT("/domains/:id", api.UpdateDomainHandler) // 新增 Update
 			authorized.DELETE("/domains/:id", api.DeleteDomainHandler)
 			authorized.POST("/domains/:id/verify", api.VerifyDomainHandler)
+			authorized.GET("/domains/:id/dkim-record", api.GetDomainDKIMRecordHandler)
+			authorized.POST("/domains/:id/bounce-mailbox", api.CreateBounceMailboxHandler)
+			authorized.GET("/domains/:id/reputation", api.GetDomainReputationHandler)
+			authorized.POST("/domains/:id/reputation/resume", api.ResumeDomainReputationHandler) // 解除信誉保护暂停
+			authorized.GET("/bounces", api.ListBouncesHandler)
 			authorized.POST("/domains/:id/bind-cert", api.BindDomainCertHandler) // 绑定证书
 
 			// 模板管理
@@ -205,6 +238,8 @@ func main() {
 			authorized.GET("/templates", api.ListTemplateHandler)
 			authorized.PUT("/templates/:id", api.UpdateTemplateHandler)
 			authorized.DELETE("/templates/:id", api.DeleteTemplateHandler)
+			authorized.POST("/templates/:id/instantiate", api.InstantiateTemplateHandler)
+			authorized.POST("/templates/:id/test", api.TestTemplateHandler)
 
 			// 密钥管理
 			authorized.GET("/keys", api.ListAPIKeysHandler)
@@ -214,18 +249,23 @@ func main() {
 			// 文件管理
 			authorized.GET("/files", api.ListFilesHandler)
 			authorized.GET("/files/:id/download", api.DownloadFileHandler)
+			authorized.POST("/files/:id/share", api.ShareFileHandler)
 			authorized.DELETE("/files/:id", api.DeleteFileHandler)
 			authorized.POST("/files/batch_delete", api.BatchDeleteFilesHandler)
 
 			// 转发规则管理
-			authorized.GET("/forward-rules", api.ListForwardRulesHandler)   // ?domain_id=xxx
-			authorized.POST("/forward-rules", api.CreateForwardRuleHandler) // body: {domain_id, ...}
+			authorized.GET("/forward-rules", api.ListForwardRulesHandler)      // ?domain_id=xxx
+			authorized.POST("/forward-rules", api.CreateForwardRuleHandler)    // body: {domain_id, ...}
+			authorized.POST("/forward-rules/test", api.TestForwardRuleHandler) // body: {email}
 			authorized.PUT("/forward-rules/:id", api.UpdateForwardRuleHandler)
 			authorized.DELETE("/forward-rules/:id", api.DeleteForwardRuleHandler)
 			authorized.POST("/forward-rules/:id/toggle", api.ToggleForwardRuleHandler)
 
 			// 转发日志
-			authorized.GET("/forward-logs", api.ListForwardLogsHandler)
+			authorized.GET("/forward-logs", api.ListForwardLogsHandler) // ?status=pending|success|failed
+			authorized.GET("/forward-logs/export.csv", api.ExportForwardLogsHandler)
+			authorized.GET("/forward-logs/:id", api.GetForwardLogHandler)
+			authorized.POST("/forward-logs/:id/retry", api.RetryForwardLogHandler)
 			authorized.GET("/forward-stats", api.GetForwardStatsHandler)
 
 			// 联系人管理
@@ -238,12 +278,25 @@ func main() {
 			authorized.POST("/contacts", api.CreateContactHandler)
 			authorized.PUT("/contacts/:id", api.UpdateContactHandler)
 			authorized.DELETE("/contacts/:id", api.DeleteContactHandler)
+			authorized.GET("/contacts/:id/activity", api.ContactActivityHandler)
 			authorized.POST("/contacts/import", api.ImportContactsHandler)
 			authorized.GET("/contacts/export", api.ExportContactsHandler)
 			authorized.POST("/contacts/batch_delete", api.BatchDeleteContactsHandler)
 			authorized.GET("/contacts/unsubscribed", api.ListUnsubscribedHandler)
 			authorized.POST("/contacts/:id/resubscribe", api.ResubscribeHandler)
 
+			// 退订主题
+			authorized.GET("/topics", api.ListTopicsHandler)
+			authorized.POST("/topics", api.CreateTopicHandler)
+			authorized.PUT("/topics/:id", api.UpdateTopicHandler)
+			authorized.DELETE("/topics/:id", api.DeleteTopicHandler)
+
+			// 发件人身份
+			authorized.GET("/senders", api.ListSendersHandler)
+			authorized.POST("/senders", api.CreateSenderHandler)
+			authorized.PUT("/senders/:id", api.UpdateSenderHandler)
+			authorized.DELETE("/senders/:id", api.DeleteSenderHandler)
+
 			// 营销活动管理
 			authorized.GET("/campaigns", api.ListCampaignsHandler)
 			authorized.POST("/campaigns", api.CreateCampaignHandler)
@@ -253,13 +306,24 @@ func main() {
 			authorized.POST("/campaigns/:id/pause", api.PauseCampaignHandler)
 			authorized.POST("/campaigns/:id/resume", api.ResumeCampaignHandler)
 			authorized.GET("/campaigns/:id/progress", api.GetCampaignProgressHandler)
+			authorized.GET("/campaigns/:id/recipient/:email/rendered", api.CampaignRecipientRenderedHandler) // 单个收件人实际收到的邮件
 			authorized.POST("/campaigns/:id/test", api.TestCampaignHandler)
+			authorized.GET("/campaigns/:id/preview", api.PreviewCampaignHandler)
+			authorized.GET("/campaigns/:id/audience", api.CampaignAudienceHandler)
 
 			// 收件箱
 			authorized.GET("/inbox", api.ListInboxHandler)
 			authorized.GET("/inbox/stats", api.GetInboxStatsHandler)
+			authorized.GET("/inbox/export", api.ExportInboxHandler) // ?format=csv|json|mbox&q=
+			authorized.GET("/inbox/threads", api.ListInboxThreadsHandler)
+			authorized.GET("/inbox/tags", api.ListInboxTagsHandler)
+			authorized.GET("/inbox/encryption", api.GetInboxEncryptionHandler)
+			authorized.PUT("/inbox/encryption", api.UpdateInboxEncryptionHandler)
+			authorized.POST("/inbox/encryption/rekey", api.RekeyInboxHandler) // 加密历史邮件 / 轮换口令后重新加密
 			authorized.GET("/inbox/:id", api.GetInboxItemHandler)
 			authorized.GET("/inbox/:id/attachments", api.GetInboxAttachmentsHandler)
+			authorized.GET("/inbox/:id/headers", api.GetInboxHeadersHandler)
+			authorized.PUT("/inbox/:id/tags", api.UpdateInboxTagsHandler)
 			authorized.DELETE("/inbox/:id", api.DeleteInboxItemHandler)
 			authorized.POST("/inbox/batch/read", api.BatchMarkReadHandler)
 			authorized.POST("/inbox/batch/delete", api.BatchDeleteHandler)
@@ -267,12 +331,23 @@ func main() {
 			// 收件配置
 			authorized.GET("/receiver/config", api.GetReceiverConfigHandler)
 			authorized.PUT("/receiver/config", api.UpdateReceiverConfigHandler)
+			authorized.GET("/receiver/blocked", api.ListAutoBlockedIPsHandler)
+			authorized.DELETE("/receiver/blocked", api.ClearAutoBlockedIPHandler)
+			authorized.GET("/receiver/spam-keywords", api.ListSpamKeywordsHandler)
+			authorized.POST("/receiver/spam-keywords", api.CreateSpamKeywordHandler)
+			authorized.PUT("/receiver/spam-keywords/:id", api.UpdateSpamKeywordHandler)
+			authorized.DELETE("/receiver/spam-keywords/:id", api.DeleteSpamKeywordHandler)
+			authorized.GET("/receiver/tag-rules", api.ListTagRulesHandler)
+			authorized.POST("/receiver/tag-rules", api.CreateTagRuleHandler)
+			authorized.PUT("/receiver/tag-rules/:id", api.UpdateTagRuleHandler)
+			authorized.DELETE("/receiver/tag-rules/:id", api.DeleteTagRuleHandler)
 
 			// 数据清理
 			authorized.GET("/cleanup/stats", api.GetCleanupStatsHandler)
 			authorized.GET("/cleanup/config", api.GetCleanupConfigHandler)
 			authorized.PUT("/cleanup/config", api.UpdateCleanupConfigHandler)
 			authorized.POST("/cleanup/run", api.RunCleanupHandler)
+			authorized.POST("/cleanup/orphans", api.PurgeOrphansHandler)
 			authorized.GET("/cleanup/status", api.GetCleanupStatusHandler)
 
 			// 证书管理
@@ -346,9 +421,11 @@ func main() {
 
 	// 使用 http.Server 实现优雅关闭
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: r,
+		Addr:      addr,
+		Handler:   r,
+		TLSConfig: &tls.Config{},
 	}
+	config.ApplyTLSPolicy(srv.TLSConfig)
 
 	// 在 goroutine 中启动服务
 	go func() {
@@ -383,3 +460,30 @@ func main() {
 
 	log.Println("Server exited gracefully")
 }
+
+// runTestSend 通过默认通道 (无默认通道时直连) 同步发送一封测试邮件，返回进程退出码
+func runTestSend(to string) int {
+	from := fmt.Sprintf("noreply@%s", config.AppConfig.Domain)
+	route := "direct"
+	var defaultSMTP database.SMTPConfig
+	if err := database.DB.Where("is_default = ?", true).First(&defaultSMTP).Error; err == nil {
+		route = fmt.Sprintf("SMTP channel %q (ID %d), direct as fallback", defaultSMTP.Name, defaultSMTP.ID)
+	}
+	fmt.Printf("Sending test email from %s to %s via %s ...\n", from, to, route)
+
+	start := time.Now()
+	err := mailer.SendEmail(mailer.SendRequest{
+		From:     from,
+		To:       to,
+		Subject:  "GoEmail test message",
+		Body:     fmt.Sprintf("<p>This is a test message sent by <code>goemail -test-send</code> from %s at %s.</p>", config.AppConfig.Domain, start.Format(time.RFC3339)),
+		TextBody: fmt.Sprintf("This is a test message sent by goemail -test-send from %s at %s.", config.AppConfig.Domain, start.Format(time.RFC3339)),
+		SkipBCC:  true,
+	})
+	if err != nil {
+		fmt.Printf("[ERROR] Test email failed after %s: %v\n", time.Since(start).Round(time.Millisecond), err)
+		return 1
+	}
+	fmt.Printf("[SUCCESS] Test email accepted in %s. Check the recipient's headers for SPF/DKIM/DMARC results.\n", time.Since(start).Round(time.Millisecond))
+	return 0
+}